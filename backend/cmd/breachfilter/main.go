@@ -0,0 +1,121 @@
+// Команда breachfilter собирает фильтр Блума утекших паролей для BREACHED_PASSWORDS_FILE.
+//
+//	go run ./cmd/breachfilter -in pwned-passwords-sha1.txt -out breached.bloom -min-count 10
+//
+// Входной файл - строки "SHA1:COUNT" или "SHA1" (формат HIBP), с флагом -plain - пароли
+// в открытом виде по одному на строку. Файл читается дважды: для подсчета и для заполнения
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"jiko-auth/pkg/breach"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	in := flag.String("in", "", "raw list: HIBP \"SHA1:COUNT\" lines or plain passwords with -plain")
+	out := flag.String("out", "breached.bloom", "output filter file")
+	plain := flag.Bool("plain", false, "input contains plain-text passwords, one per line")
+	minCount := flag.Int("min-count", 1, "skip hashes seen fewer times than this (HIBP input only)")
+	fpRate := flag.Float64("fp-rate", 0.001, "target false positive rate")
+	flag.Parse()
+
+	if *in == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Первый проход: число хешей, которые попадут в фильтр
+	var expected uint64
+	if err := scan(*in, *plain, *minCount, func(string) error {
+		expected++
+		return nil
+	}); err != nil {
+		log.Fatal("Failed to read input: ", err)
+	}
+	if expected == 0 {
+		log.Fatal("No hashes matched the threshold")
+	}
+
+	filter, err := breach.NewBloomFilter(expected, *fpRate)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := scan(*in, *plain, *minCount, filter.AddHash); err != nil {
+		log.Fatal("Failed to read input: ", err)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		log.Fatal("Failed to create output: ", err)
+	}
+	writer := bufio.NewWriter(file)
+	if _, err := filter.WriteTo(writer); err != nil {
+		log.Fatal("Failed to write filter: ", err)
+	}
+	if err := writer.Flush(); err != nil {
+		log.Fatal("Failed to write filter: ", err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatal("Failed to write filter: ", err)
+	}
+
+	fmt.Printf("Wrote %s: %d hashes, %d bits, %d hash functions\n", *out, expected, filter.M(), filter.K())
+}
+
+// scan передает в add SHA-1 каждой подходящей строки входного файла
+func scan(path string, plain bool, minCount int, add func(hash string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, 1<<20)
+	lineNumber := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		lineNumber++
+
+		if text := strings.TrimRight(line, "\r\n"); text != "" {
+			hash, ok, parseErr := parseLine(text, plain, minCount)
+			if parseErr != nil {
+				return fmt.Errorf("line %d: %w", lineNumber, parseErr)
+			}
+			if ok {
+				if err := add(hash); err != nil {
+					return fmt.Errorf("line %d: %w", lineNumber, err)
+				}
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func parseLine(text string, plain bool, minCount int) (string, bool, error) {
+	if plain {
+		return breach.HashPassword(text), true, nil
+	}
+
+	hash, countText, found := strings.Cut(strings.TrimSpace(text), ":")
+	if !found {
+		return hash, minCount <= 1, nil
+	}
+	count, err := strconv.Atoi(countText)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid count %q", countText)
+	}
+	return hash, count >= minCount, nil
+}
@@ -7,11 +7,18 @@ import (
 	"jiko-auth/internal/handlers"
 	"jiko-auth/internal/repository"
 	"jiko-auth/internal/routes"
+	"jiko-auth/internal/utils"
 	"jiko-auth/pkg/auth"
+	"jiko-auth/pkg/breach"
 	"jiko-auth/pkg/email"
+	"jiko-auth/pkg/geoip"
 	"jiko-auth/pkg/jwt"
 	"jiko-auth/pkg/oauth2"
+	"jiko-auth/pkg/passwords"
+	"jiko-auth/pkg/risk"
+	"jiko-auth/pkg/saml"
 	"jiko-auth/pkg/services"
+	"jiko-auth/pkg/webauthn"
 	"log"
 	"net/http"
 
@@ -20,6 +27,9 @@ import (
 
 func main() {
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("Invalid configuration:", err)
+	}
 
 	db, err := database.Init(cfg)
 	if err != nil {
@@ -28,36 +38,132 @@ func main() {
 	defer database.Close()
 
 	// Инициализация репозиториев
+	tokenHasher := utils.NewTokenHasher(cfg.TokenHashSecret)
+	passwordHasher, err := utils.NewPasswordHasher(cfg.PasswordHashAlgorithm, utils.Argon2Params{
+		Memory:      cfg.Argon2Memory,
+		Iterations:  cfg.Argon2Iterations,
+		Parallelism: cfg.Argon2Parallelism,
+	}, cfg.BCryptCost)
+	if err != nil {
+		log.Fatal("Failed to initialize password hasher:", err)
+	}
+	breachChecker, err := breach.Open(cfg.BreachedPasswordsFile, cfg.BreachedPasswordsMinCount)
+	if err != nil {
+		log.Fatal("Failed to open breached passwords file:", err)
+	}
+	torExitNodes, err := risk.LoadIPList(cfg.TorExitNodesFile)
+	if err != nil {
+		log.Fatal("Failed to load Tor exit nodes file:", err)
+	}
+	badIPs, err := risk.LoadIPList(cfg.BadIPListFile)
+	if err != nil {
+		log.Fatal("Failed to load bad IP list file:", err)
+	}
 	userRepo := repository.NewUserRepository(db)
-	clientRepo := repository.NewOAuthClientRepository(db)
-	authCodeRepo := repository.NewAuthCodeRepository(db)
-	tokenRepo := repository.NewTokenRepository(db)
+	clientRepo := repository.NewOAuthClientRepository(db, tokenHasher)
+	authCodeRepo := repository.NewAuthCodeRepository(db, tokenHasher)
+	tokenRepo := repository.NewTokenRepository(db, tokenHasher)
 	securityRepo := repository.NewSecurityRepository(db)
+	resourceRepo := repository.NewResourceRepository(db)
+	samlRepo := repository.NewSAMLRepository(db)
+	scimRepo := repository.NewSCIMRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	mfaRepo := repository.NewMFARepository(db, tokenHasher)
+	webauthnRepo := repository.NewWebAuthnRepository(db)
+	passwordlessRepo := repository.NewPasswordlessRepository(db, tokenHasher)
+	settingsRepo := repository.NewSettingsRepository(db)
+	passwordResetRepo := repository.NewPasswordResetRepository(db, tokenHasher)
+	emailChangeRepo := repository.NewEmailChangeRepository(db, tokenHasher)
+	lockoutRepo := repository.NewLockoutRepository(db, tokenHasher)
+	rateLimitRepo := repository.NewRateLimitRepository(db, tokenHasher)
+	passwordHistoryRepo := repository.NewPasswordHistoryRepository(db)
+	deviceRepo := repository.NewDeviceRepository(db)
 
 	// Инициализация сервисов безопасности
 	userAgentParser := services.NewUserAgentParser()
-	geoLocationService := services.NewGeoLocationService("") // Можно добавить API ключ из конфига
+	var geoProviders []geoip.Provider
+	var geoDatabase *geoip.Database
+	if cfg.GeoIPDatabaseFile != "" {
+		geoDatabase, err = geoip.OpenDatabase(cfg.GeoIPDatabaseFile)
+		if err != nil {
+			log.Fatal("Failed to open geolocation database:", err)
+		}
+		geoProviders = append(geoProviders, geoDatabase)
+	}
+	if cfg.GeoIPHTTPFallback {
+		geoProviders = append(geoProviders, geoip.NewHTTPProvider(cfg.GeoIPAPIKey, cfg.GeoIPHTTPTimeout))
+	}
+	geoLocationService := services.NewGeoLocationService(geoip.NewCache(cfg.GeoIPCacheSize, cfg.GeoIPCacheTTL), geoProviders...)
+	if geoDatabase != nil && cfg.GeoIPReloadInterval > 0 {
+		go geoDatabase.Watch(cfg.GeoIPReloadInterval, geoLocationService.Purge)
+	}
 	notificationService := services.NewNotificationService()
+	passwordValidator := passwords.NewValidator(cfg, settingsRepo, passwordHistoryRepo, passwordHasher, breachChecker)
+	riskEngine := risk.NewEngine(securityRepo, torExitNodes, badIPs, risk.Config{
+		SuspiciousThreshold: cfg.RiskSuspiciousThreshold,
+		StepUpThreshold:     cfg.RiskStepUpThreshold,
+	})
 
 	// Инициализация сервисов
-	jwtService := jwt.NewService(cfg.JWTSecret)
-	oauthService := oauth2.NewService(authCodeRepo, tokenRepo, clientRepo, userRepo, jwtService)
+	jwtService := jwt.NewService(cfg.JWTSecret, cfg.AccessTokenExpiry, cfg.RefreshTokenExpiry)
+	oauthService := oauth2.NewService(authCodeRepo, tokenRepo, clientRepo, userRepo, resourceRepo, jwtService, cfg)
 	emailService := email.NewEmailService(cfg)
+	relyingParty := webauthn.NewRelyingParty(cfg.WebAuthnRPID, cfg.WebAuthnRPName, cfg.WebAuthnOrigins)
+	mfaSecrets, err := utils.NewSecretBox(cfg.MFAEncryptionKey)
+	if err != nil {
+		log.Fatal("Failed to initialize MFA secret encryption:", err)
+	}
+	identityProvider, err := saml.NewIdentityProvider(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize SAML identity provider:", err)
+	}
 
 	// Инициализация обработчиков
 	authHandler := auth.NewAuthService(
 		userRepo,
 		cfg,
-		cfg.JWTSecret,
+		jwtService,
 		emailService,
 		securityRepo,
+		sessionRepo,
+		mfaRepo,
+		mfaSecrets,
+		webauthnRepo,
+		relyingParty,
+		passwordlessRepo,
+		settingsRepo,
+		passwordResetRepo,
+		tokenRepo,
+		emailChangeRepo,
+		lockoutRepo,
+		deviceRepo,
+		tokenHasher,
+		passwordHasher,
+		passwordValidator,
+		riskEngine,
 		userAgentParser,
 		geoLocationService,
 		notificationService,
 	)
-	oauthHandler := handlers.NewOAuthHandler(oauthService, clientRepo, userRepo, tokenRepo, jwtService)
+	oauthHandler := handlers.NewOAuthHandler(
+		oauthService,
+		clientRepo,
+		userRepo,
+		tokenRepo,
+		jwtService,
+		securityRepo,
+		notificationService,
+		emailService,
+		cfg,
+	)
 	codesHandler := handlers.NewCodesHandler(clientRepo)
-	adminHandler := handlers.NewAdminHandler(userRepo, clientRepo)
+	adminHandler := handlers.NewAdminHandler(userRepo, clientRepo, tokenRepo, resourceRepo, sessionRepo, mfaRepo, webauthnRepo, lockoutRepo, passwordHasher, passwordValidator)
+	samlHandler := handlers.NewSAMLHandler(identityProvider, samlRepo, userRepo, sessionRepo)
+	scimHandler := handlers.NewSCIMHandler(userRepo, scimRepo, tokenRepo, sessionRepo, passwordHasher, passwordValidator, cfg)
+	sessionHandler := handlers.NewSessionHandler(sessionRepo, userRepo)
+	settingsHandler := handlers.NewSettingsHandler(settingsRepo, passwordValidator, cfg)
+	securityHandler := handlers.NewSecurityHandler(securityRepo)
+	deviceHandler := handlers.NewDeviceHandler(deviceRepo, sessionRepo)
 
 	// Инициализация администратора
 	if err := authHandler.InitializeAdmin(context.Background()); err != nil {
@@ -65,7 +171,7 @@ func main() {
 	}
 
 	// Настройка роутера
-	router := routes.SetupRouter(authHandler, oauthHandler, codesHandler, adminHandler, jwtService, tokenRepo, userRepo)
+	router := routes.SetupRouter(cfg, authHandler, oauthHandler, codesHandler, adminHandler, samlHandler, scimHandler, sessionHandler, settingsHandler, securityHandler, deviceHandler, jwtService, tokenRepo, clientRepo, sessionRepo, userRepo, rateLimitRepo)
 
 	// Запуск сервера
 	server := &http.Server{
@@ -1,8 +1,13 @@
 package config
 
 import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -19,6 +24,10 @@ type Config struct {
 	DBName             string
 	ServerPort         string
 	JWTSecret          string
+	TokenHashSecret    string
+	MFAEncryptionKey   string
+	ClientSecretGrace  time.Duration
+	OAuth21Profile     bool
 	DBMaxOpenConns     int
 	DBMaxIdleConns     int
 	DBMaxIdleTime      time.Duration
@@ -31,14 +40,73 @@ type Config struct {
 	AppUrl             string
 	AccessTokenExpiry  time.Duration
 	RefreshTokenExpiry time.Duration
+	// Сроки жизни OAuth токенов по умолчанию, клиент может переопределить их своей политикой
+	AuthCodeExpiry     time.Duration
+	RefreshMaxLifetime time.Duration
+	IDTokenExpiry      time.Duration
+	IssueRefreshTokens bool
+	// PEM файлы ключа и сертификата для подписи SAML утверждений
+	SAMLKeyFile        string
+	SAMLCertFile       string
+	SCIMTokenExpiry    time.Duration // срок действия токена provisioning клиента SCIM
+	WebAuthnRPID       string        // домен, к которому привязываются ключи WebAuthn
+	WebAuthnRPName     string
+	WebAuthnOrigins    []string // origin фронтенда, с которых разрешены церемонии WebAuthn
+	MagicLinkEnabled   bool
+	MagicLinkTTL       time.Duration // срок действия ссылки и кода входа без пароля
+	MagicLinkPerHour   int           // лимит писем входа на один адрес
+	PasswordResetTTL   time.Duration // срок действия ссылки сброса пароля
 	BCryptCost         int
 	RateLimitPerMinute int
 	MaxLoginAttempts   int           `json:"max_login_attempts"`
 	LockoutDuration    time.Duration `json:"lockout_duration"`
+
+	// Лимиты запросов в минуту по политикам ограничения частоты
+	RateLimits map[string]int
+
+	// Хеширование паролей: argon2id по умолчанию, bcrypt (с BCryptCost) для совместимости
+	PasswordHashAlgorithm string
+	Argon2Memory          uint32 // KiB
+	Argon2Iterations      uint32
+	Argon2Parallelism     uint8
+
+	// Локальная база утекших паролей: фильтр Блума, файл или каталог диапазонов HIBP.
+	// Порог числа вхождений применяется к файлам HIBP, для фильтра он задается при сборке
+	BreachedPasswordsFile     string
+	BreachedPasswordsMinCount int
+
+	// Политика паролей по умолчанию, администратор может изменить ее и задать политики ролей
+	PasswordMinLength   int
+	PasswordMinScore    int // минимальный балл оценки стойкости 0-4
+	PasswordHistorySize int
+	PasswordMaxAgeDays  int
+
+	// Оценка риска входа 0-100: с порога вход отмечается подозрительным, с порога дополнительной
+	// проверки вход подтверждается кодом из письма. 0 отключает порог
+	RiskSuspiciousThreshold int
+	RiskStepUpThreshold     int
+	// Локальные списки адресов и подсетей, по одному на строку
+	TorExitNodesFile string
+	BadIPListFile    string
+
+	// Геолокация: локальная база .mmdb, перечитывается после изменения файла.
+	// Запрос к ipapi.co включается отдельно как запасной вариант
+	GeoIPDatabaseFile   string
+	GeoIPReloadInterval time.Duration
+	GeoIPCacheSize      int
+	GeoIPCacheTTL       time.Duration
+	GeoIPHTTPFallback   bool
+	GeoIPHTTPTimeout    time.Duration
+	GeoIPAPIKey         string
+
+	// Реестр устройств: срок жизни cookie браузера и срок, в течение которого доверенное
+	// устройство входит без второго фактора (0 - второй фактор запрашивается всегда)
+	DeviceCookieTTL time.Duration
+	DeviceTrustTTL  time.Duration
 }
 
 func Load() *Config {
-	return &Config{
+	cfg := &Config{
 		AppEnv:             getEnv("APP_ENV", "development"),
 		AppUrl:             getEnv("APP_URL", "http://localhost:8080"),
 		AppUser:            getEnv("APP_USER", "admin"),
@@ -61,11 +129,111 @@ func Load() *Config {
 		SmtpFromEmail:      getEnv("SMTP_FROM_EMAIL", ""),
 		AccessTokenExpiry:  getEnvAsDuration("ACCESS_TOKEN_EXPIRY", time.Minute*15),
 		RefreshTokenExpiry: getEnvAsDuration("REFRESH_TOKEN_EXPIRY", time.Hour*24*7),
+		AuthCodeExpiry:     getEnvAsDuration("AUTH_CODE_EXPIRY", time.Minute*10),
+		IDTokenExpiry:      getEnvAsDuration("ID_TOKEN_EXPIRY", time.Hour*1),
+		RefreshMaxLifetime: getEnvAsDuration("REFRESH_TOKEN_MAX_LIFETIME", time.Hour*24*30),
+		IssueRefreshTokens: getEnvAsBool("ISSUE_REFRESH_TOKENS", true),
+		SAMLKeyFile:        getEnv("SAML_KEY_FILE", ""),
+		SAMLCertFile:       getEnv("SAML_CERT_FILE", ""),
+		SCIMTokenExpiry:    getEnvAsDuration("SCIM_TOKEN_EXPIRY", time.Hour*24*365),
+		WebAuthnRPID:       getEnv("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnRPName:     getEnv("WEBAUTHN_RP_NAME", "Jiko Auth"),
+		WebAuthnOrigins:    getEnvAsList("WEBAUTHN_ORIGINS", []string{"http://localhost:3000"}),
+		MagicLinkEnabled:   getEnvAsBool("PASSWORDLESS_ENABLED", false),
+		MagicLinkTTL:       getEnvAsDuration("PASSWORDLESS_TTL", time.Minute*15),
+		MagicLinkPerHour:   getEnvAsInt("PASSWORDLESS_PER_HOUR", 5),
+		PasswordResetTTL:   getEnvAsDuration("PASSWORD_RESET_TTL", time.Hour),
 		BCryptCost:         getEnvAsInt("BCRYPT_COST", bcrypt.DefaultCost),
 		RateLimitPerMinute: getEnvAsInt("RATE_LIMIT_PER_MINUTE", 60),
 		MaxLoginAttempts:   getEnvAsInt("MAX_LOGIN_ATTEMPTS", 5),
 		LockoutDuration:    getEnvAsDuration("LOCKOUT_DURATION", time.Minute*15),
+		ClientSecretGrace:  getEnvAsDuration("CLIENT_SECRET_GRACE_PERIOD", time.Hour*24),
+		OAuth21Profile:     getEnvAsBool("OAUTH21_PROFILE", false),
+	}
+
+	// Ключ для хеширования токенов в БД и ключ шифрования секретов MFA. В production они
+	// обязательны (см. Validate), в разработке выводятся из JWT секрета. Смена ключа MFA делает
+	// недействительными все подключенные аутентификаторы
+	cfg.TokenHashSecret = getEnv("TOKEN_HASH_SECRET", cfg.developmentKey("token-hash"))
+	cfg.MFAEncryptionKey = getEnv("MFA_ENCRYPTION_KEY", cfg.developmentKey("mfa-encryption"))
+
+	cfg.PasswordHashAlgorithm = getEnv("PASSWORD_HASH_ALGORITHM", "argon2id")
+	cfg.Argon2Memory = uint32(getEnvAsInt("ARGON2_MEMORY_KIB", 19456))
+	cfg.Argon2Iterations = uint32(getEnvAsInt("ARGON2_ITERATIONS", 2))
+	cfg.Argon2Parallelism = uint8(getEnvAsInt("ARGON2_PARALLELISM", 1))
+
+	cfg.BreachedPasswordsFile = getEnv("BREACHED_PASSWORDS_FILE", "")
+	cfg.BreachedPasswordsMinCount = getEnvAsInt("BREACHED_PASSWORDS_MIN_COUNT", 1)
+
+	cfg.PasswordMinLength = getEnvAsInt("PASSWORD_MIN_LENGTH", 12)
+	cfg.PasswordMinScore = getEnvAsInt("PASSWORD_MIN_SCORE", 3)
+	cfg.PasswordHistorySize = getEnvAsInt("PASSWORD_HISTORY_SIZE", 5)
+	cfg.PasswordMaxAgeDays = getEnvAsInt("PASSWORD_MAX_AGE_DAYS", 0)
+
+	cfg.RiskSuspiciousThreshold = getEnvAsInt("RISK_SUSPICIOUS_THRESHOLD", 50)
+	cfg.RiskStepUpThreshold = getEnvAsInt("RISK_STEP_UP_THRESHOLD", 0)
+	cfg.TorExitNodesFile = getEnv("TOR_EXIT_NODES_FILE", "")
+	cfg.BadIPListFile = getEnv("BAD_IP_LIST_FILE", "")
+
+	cfg.GeoIPDatabaseFile = getEnv("GEOIP_DATABASE_FILE", "")
+	cfg.GeoIPReloadInterval = getEnvAsDuration("GEOIP_RELOAD_INTERVAL", time.Minute)
+	cfg.GeoIPCacheSize = getEnvAsInt("GEOIP_CACHE_SIZE", 10000)
+	cfg.GeoIPCacheTTL = getEnvAsDuration("GEOIP_CACHE_TTL", time.Hour*24)
+	cfg.GeoIPHTTPFallback = getEnvAsBool("GEOIP_HTTP_FALLBACK", false)
+	cfg.GeoIPHTTPTimeout = getEnvAsDuration("GEOIP_HTTP_TIMEOUT", time.Second*2)
+	cfg.GeoIPAPIKey = getEnv("GEOIP_API_KEY", "")
+
+	cfg.DeviceCookieTTL = getEnvAsDuration("DEVICE_COOKIE_TTL", time.Hour*24*365)
+	cfg.DeviceTrustTTL = getEnvAsDuration("DEVICE_TRUST_TTL", time.Hour*24*30)
+
+	// Лимит каждой политики переопределяется переменной RATE_LIMIT_<ПОЛИТИКА>, 0 отключает политику
+	cfg.RateLimits = map[string]int{
+		"login":           getEnvAsInt("RATE_LIMIT_LOGIN", 10),
+		"mfa":             getEnvAsInt("RATE_LIMIT_MFA", 10),
+		"passwordless":    getEnvAsInt("RATE_LIMIT_PASSWORDLESS", 10),
+		"password_reset":  getEnvAsInt("RATE_LIMIT_PASSWORD_RESET", 5),
+		"password_change": getEnvAsInt("RATE_LIMIT_PASSWORD_CHANGE", 5),
+		"email_change":    getEnvAsInt("RATE_LIMIT_EMAIL_CHANGE", 5),
+		"unlock":          getEnvAsInt("RATE_LIMIT_UNLOCK", 5),
+		"register":        getEnvAsInt("RATE_LIMIT_REGISTER", 5),
+		"token":           getEnvAsInt("RATE_LIMIT_TOKEN", cfg.RateLimitPerMinute),
+		"introspect":      getEnvAsInt("RATE_LIMIT_INTROSPECT", cfg.RateLimitPerMinute*5),
+		"refresh":         getEnvAsInt("RATE_LIMIT_REFRESH", cfg.RateLimitPerMinute),
+		"verify_email":    getEnvAsInt("RATE_LIMIT_VERIFY_EMAIL", 10),
+		"admin":           getEnvAsInt("RATE_LIMIT_ADMIN", cfg.RateLimitPerMinute),
+	}
+
+	return cfg
+}
+
+// developmentKey выводит из JWT секрета независимый ключ с меткой label (HKDF-SHA256), чтобы
+// утечка одного ключа не раскрывала остальные. В production ключи не выводятся
+func (c *Config) developmentKey(label string) string {
+	if c.AppEnv == "production" {
+		return ""
+	}
+	key, err := hkdf.Key(sha256.New, []byte(c.JWTSecret), nil, "jiko-auth "+label, 32)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(key)
+}
+
+// Validate проверяет, что в production секреты заданы явно и не совпадают друг с другом
+func (c *Config) Validate() error {
+	if c.AppEnv != "production" {
+		return nil
+	}
+	if c.TokenHashSecret == "" {
+		return errors.New("TOKEN_HASH_SECRET is required in production")
+	}
+	if c.MFAEncryptionKey == "" {
+		return errors.New("MFA_ENCRYPTION_KEY is required in production")
 	}
+	if c.TokenHashSecret == c.JWTSecret || c.MFAEncryptionKey == c.JWTSecret || c.TokenHashSecret == c.MFAEncryptionKey {
+		return errors.New("JWT_SECRET, TOKEN_HASH_SECRET and MFA_ENCRYPTION_KEY must be different")
+	}
+	return nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -88,6 +256,36 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return result
 }
 
+func getEnvAsBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue
+	}
+	return result
+}
+
+// getEnvAsList разбирает список значений через запятую
+func getEnvAsList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	if len(result) == 0 {
+		return defaultValue
+	}
+	return result
+}
+
 func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	value := os.Getenv(key)
 	if value == "" {
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDevelopmentKeys(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	t.Setenv("TOKEN_HASH_SECRET", "")
+	t.Setenv("MFA_ENCRYPTION_KEY", "")
+
+	cfg := Load()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	keys := []string{cfg.JWTSecret, cfg.TokenHashSecret, cfg.MFAEncryptionKey}
+	for i := range keys {
+		for j := i + 1; j < len(keys); j++ {
+			if keys[i] == keys[j] {
+				t.Errorf("keys %d and %d are equal: %q", i, j, keys[i])
+			}
+		}
+	}
+	if len(cfg.TokenHashSecret) != 64 || len(cfg.MFAEncryptionKey) != 64 {
+		t.Errorf("derived keys = %q, %q, want 32 bytes in hex", cfg.TokenHashSecret, cfg.MFAEncryptionKey)
+	}
+
+	// Ключи детерминированы: после перезапуска хеши токенов и секреты MFA остаются читаемыми
+	if again := Load(); again.TokenHashSecret != cfg.TokenHashSecret || again.MFAEncryptionKey != cfg.MFAEncryptionKey {
+		t.Error("derived keys change between loads")
+	}
+
+	t.Setenv("JWT_SECRET", "rotated-secret")
+	if rotated := Load(); rotated.TokenHashSecret == cfg.TokenHashSecret {
+		t.Error("derived key does not depend on JWT_SECRET")
+	}
+}
+
+func TestValidateProduction(t *testing.T) {
+	tests := []struct {
+		name      string
+		tokenHash string
+		mfaKey    string
+		wantError string
+	}{
+		{"explicit keys", "token-hash-secret", "mfa-encryption-key", ""},
+		{"missing token hash secret", "", "mfa-encryption-key", "TOKEN_HASH_SECRET"},
+		{"missing MFA key", "token-hash-secret", "", "MFA_ENCRYPTION_KEY"},
+		{"token hash secret reuses JWT secret", "jwt-secret", "mfa-encryption-key", "must be different"},
+		{"MFA key reuses JWT secret", "token-hash-secret", "jwt-secret", "must be different"},
+		{"same token hash and MFA keys", "shared", "shared", "must be different"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APP_ENV", "production")
+			t.Setenv("JWT_SECRET", "jwt-secret")
+			t.Setenv("TOKEN_HASH_SECRET", tt.tokenHash)
+			t.Setenv("MFA_ENCRYPTION_KEY", tt.mfaKey)
+
+			err := Load().Validate()
+			if tt.wantError == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("Validate error = %v, want %q", err, tt.wantError)
+			}
+		})
+	}
+}
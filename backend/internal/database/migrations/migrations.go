@@ -2,14 +2,18 @@
 package migrations
 
 import (
+	"errors"
 	"fmt"
+	"jiko-auth/internal/config"
 	"jiko-auth/internal/models"
+	"jiko-auth/internal/utils"
 	"log"
+	"time"
 
 	"gorm.io/gorm"
 )
 
-func RunMigrations(db *gorm.DB) error {
+func RunMigrations(db *gorm.DB, cfg *config.Config) error {
 	log.Println("Running database migrations...")
 
 	// Create UUID extension if not exists
@@ -19,11 +23,29 @@ func RunMigrations(db *gorm.DB) error {
 
 	// Автоматическая миграция всех таблиц в правильном порядке
 	tables := []interface{}{
+		&models.SchemaMigration{},
 		&models.User{},
+		&models.Group{},
 		&models.OAuthClient{},
+		&models.ProtectedResource{},
+		&models.SAMLServiceProvider{},
 		&models.AuthorizationCode{},
 		&models.AccessToken{},
 		&models.RefreshToken{},
+		&models.UserDevice{},
+		&models.Session{},
+		&models.TOTPCredential{},
+		&models.MFAChallenge{},
+		&models.RecoveryCode{},
+		&models.PasswordlessLogin{},
+		&models.PasswordResetToken{},
+		&models.EmailChangeRequest{},
+		&models.AccountUnlockToken{},
+		&models.PasswordHistory{},
+		&models.Setting{},
+		&models.RateLimitHit{},
+		&models.WebAuthnCredential{},
+		&models.WebAuthnCeremony{},
 		&models.LoginAttempt{},
 		&models.SecurityNotification{},
 	}
@@ -34,6 +56,96 @@ func RunMigrations(db *gorm.DB) error {
 		}
 	}
 
+	// Одноразовые миграции данных
+	hasher := utils.NewTokenHasher(cfg.TokenHashSecret)
+	dataMigrations := []struct {
+		name string
+		run  func(tx *gorm.DB) error
+	}{
+		{"hash_tokens_at_rest", func(tx *gorm.DB) error { return hashTokensAtRest(tx, hasher) }},
+		{"hash_client_secrets", func(tx *gorm.DB) error { return hashClientSecrets(tx, hasher) }},
+	}
+
+	for _, m := range dataMigrations {
+		if err := runOnce(db, m.name, m.run); err != nil {
+			return fmt.Errorf("failed to run data migration %s: %w", m.name, err)
+		}
+	}
+
 	log.Println("Database migrations completed successfully")
 	return nil
 }
+
+// runOnce выполняет миграцию данных в транзакции, если она еще не была применена
+func runOnce(db *gorm.DB, name string, run func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var applied models.SchemaMigration
+		err := tx.First(&applied, "name = ?", name).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		log.Printf("Applying data migration %s", name)
+		if err := run(tx); err != nil {
+			return err
+		}
+
+		return tx.Create(&models.SchemaMigration{Name: name, AppliedAt: time.Now()}).Error
+	})
+}
+
+// hashTokensAtRest заменяет открытые токены и коды авторизации на их HMAC-хеши
+func hashTokensAtRest(tx *gorm.DB, hasher *utils.TokenHasher) error {
+	var accessTokens []string
+	if err := tx.Model(&models.AccessToken{}).Pluck("token", &accessTokens).Error; err != nil {
+		return err
+	}
+	for _, token := range accessTokens {
+		if err := tx.Exec("UPDATE access_tokens SET token = ?, token_prefix = ? WHERE token = ?",
+			hasher.Hash(token), utils.TokenPrefix(token), token).Error; err != nil {
+			return err
+		}
+	}
+
+	var refreshTokens []models.RefreshToken
+	if err := tx.Find(&refreshTokens).Error; err != nil {
+		return err
+	}
+	for _, rt := range refreshTokens {
+		if err := tx.Exec("UPDATE refresh_tokens SET token = ?, token_prefix = ?, access_token = ? WHERE token = ?",
+			hasher.Hash(rt.Token), utils.TokenPrefix(rt.Token), hasher.Hash(rt.AccessToken), rt.Token).Error; err != nil {
+			return err
+		}
+	}
+
+	var codes []string
+	if err := tx.Model(&models.AuthorizationCode{}).Pluck("code", &codes).Error; err != nil {
+		return err
+	}
+	for _, code := range codes {
+		if err := tx.Exec("UPDATE authorization_codes SET code = ? WHERE code = ?", hasher.Hash(code), code).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hashClientSecrets заменяет открытые секреты OAuth клиентов на их HMAC-хеши
+func hashClientSecrets(tx *gorm.DB, hasher *utils.TokenHasher) error {
+	var clients []models.OAuthClient
+	if err := tx.Find(&clients).Error; err != nil {
+		return err
+	}
+	for _, client := range clients {
+		if err := tx.Model(&models.OAuthClient{}).
+			Where("id = ?", client.ID).
+			Update("secret", hasher.Hash(client.Secret)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
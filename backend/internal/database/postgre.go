@@ -88,7 +88,7 @@ func Init(cfg *config.Config) (*gorm.DB, error) {
 	}
 
 	// Миграции
-	if err := migrations.RunMigrations(DB); err != nil {
+	if err := migrations.RunMigrations(DB, cfg); err != nil {
 		return nil, fmt.Errorf("migrations failed: %w", err)
 	}
 
@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"jiko-auth/internal/models"
 	"jiko-auth/internal/repository"
+	"jiko-auth/internal/utils"
 	"jiko-auth/pkg/logger"
+	"jiko-auth/pkg/oauth2"
+	"jiko-auth/pkg/passwords"
 	"net/http"
 	"strconv"
 	"time"
@@ -12,18 +15,44 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type AdminHandler struct {
-	userRepo   repository.UserRepository
-	clientRepo *repository.OAuthClientRepository
+	userRepo       repository.UserRepository
+	clientRepo     *repository.OAuthClientRepository
+	tokenRepo      *repository.TokenRepository
+	resourceRepo   *repository.ResourceRepository
+	sessionRepo    repository.SessionRepository
+	mfaRepo        repository.MFARepository
+	webauthnRepo   repository.WebAuthnRepository
+	lockoutRepo    repository.LockoutRepository
+	passwordHasher utils.PasswordHasher
+	validator      *passwords.Validator
 }
 
-func NewAdminHandler(userRepo repository.UserRepository, clientRepo *repository.OAuthClientRepository) *AdminHandler {
+func NewAdminHandler(
+	userRepo repository.UserRepository,
+	clientRepo *repository.OAuthClientRepository,
+	tokenRepo *repository.TokenRepository,
+	resourceRepo *repository.ResourceRepository,
+	sessionRepo repository.SessionRepository,
+	mfaRepo repository.MFARepository,
+	webauthnRepo repository.WebAuthnRepository,
+	lockoutRepo repository.LockoutRepository,
+	passwordHasher utils.PasswordHasher,
+	validator *passwords.Validator,
+) *AdminHandler {
 	return &AdminHandler{
-		userRepo:   userRepo,
-		clientRepo: clientRepo,
+		userRepo:       userRepo,
+		clientRepo:     clientRepo,
+		tokenRepo:      tokenRepo,
+		resourceRepo:   resourceRepo,
+		sessionRepo:    sessionRepo,
+		mfaRepo:        mfaRepo,
+		webauthnRepo:   webauthnRepo,
+		lockoutRepo:    lockoutRepo,
+		passwordHasher: passwordHasher,
+		validator:      validator,
 	}
 }
 
@@ -71,11 +100,18 @@ func (h *AdminHandler) GetStats(c *gin.Context) {
 		}
 	}
 
+	totalActiveTokens, err := h.tokenRepo.GetActiveAccessTokenCount(ctx)
+	if err != nil {
+		logger.Error("Failed to count active tokens for stats", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get statistics"})
+		return
+	}
+
 	stats := models.AdminStats{
 		TotalUsers:         totalUsers,
 		TotalVerifiedUsers: totalVerifiedUsers,
 		TotalClients:       totalClients,
-		TotalActiveTokens:  0, // TODO: подсчет активных токенов
+		TotalActiveTokens:  totalActiveTokens,
 		NewUsersToday:      newUsersToday,
 		NewClientsToday:    newClientsToday,
 	}
@@ -118,6 +154,7 @@ func (h *AdminHandler) GetUsers(c *gin.Context) {
 			EmailVerified: user.EmailVerified,
 			Role:          user.Role,
 			LastLogin:     user.LastLogin,
+			LockedUntil:   user.LockedUntil,
 			CreatedAt:     user.CreatedAt,
 			UpdatedAt:     user.UpdatedAt,
 		}
@@ -160,6 +197,7 @@ func (h *AdminHandler) GetUser(c *gin.Context) {
 		EmailVerified: user.EmailVerified,
 		Role:          user.Role,
 		LastLogin:     user.LastLogin,
+		LockedUntil:   user.LockedUntil,
 		CreatedAt:     user.CreatedAt,
 		UpdatedAt:     user.UpdatedAt,
 	}
@@ -177,6 +215,13 @@ func (h *AdminHandler) CreateUser(c *gin.Context) {
 
 	ctx := c.Request.Context()
 
+	// Пароль проверяется по политике роли создаваемого пользователя
+	candidate := &models.User{Username: req.Username, Email: req.Email, Role: req.Role}
+	if err := h.validator.Validate(ctx, req.Password, candidate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Проверяем, не существует ли пользователь с таким email
 	existingUser, err := h.userRepo.GetUserByEmail(ctx, req.Email)
 	if err != nil {
@@ -204,7 +249,7 @@ func (h *AdminHandler) CreateUser(c *gin.Context) {
 	}
 
 	// Хешируем пароль
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := h.passwordHasher.Hash(req.Password)
 	if err != nil {
 		logger.Error("Failed to hash password", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
@@ -212,12 +257,14 @@ func (h *AdminHandler) CreateUser(c *gin.Context) {
 	}
 
 	// Создаем пользователя
+	now := time.Now()
 	user := &models.User{
-		Username:      req.Username,
-		Email:         req.Email,
-		Password:      string(hashedPassword),
-		Role:          req.Role,
-		EmailVerified: true, // Admin создает уже верифицированных пользователей
+		Username:          req.Username,
+		Email:             req.Email,
+		Password:          hashedPassword,
+		Role:              req.Role,
+		EmailVerified:     true, // Admin создает уже верифицированных пользователей
+		PasswordChangedAt: &now,
 	}
 
 	if err := h.userRepo.CreateUser(ctx, user); err != nil {
@@ -234,6 +281,7 @@ func (h *AdminHandler) CreateUser(c *gin.Context) {
 		EmailVerified: user.EmailVerified,
 		Role:          user.Role,
 		LastLogin:     user.LastLogin,
+		LockedUntil:   user.LockedUntil,
 		CreatedAt:     user.CreatedAt,
 		UpdatedAt:     user.UpdatedAt,
 	}
@@ -282,14 +330,25 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 	if req.EmailVerified != nil {
 		user.EmailVerified = *req.EmailVerified
 	}
+	previousHash := ""
 	if req.Password != nil {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+		// Поля запроса уже применены: политика берется по новой роли, имя и email новые
+		if err := h.validator.Validate(ctx, *req.Password, user); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		hashedPassword, err := h.passwordHasher.Hash(*req.Password)
 		if err != nil {
 			logger.Error("Failed to hash password", zap.Error(err))
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 			return
 		}
-		user.Password = string(hashedPassword)
+		previousHash = user.Password
+		now := time.Now()
+		user.Password = hashedPassword
+		user.PasswordChangedAt = &now
+		// Новый пароль от администратора, как и сброс по email, снимает блокировку владельца
+		user.SecurityLockedAt = nil
 	}
 
 	user.UpdatedAt = time.Now()
@@ -299,6 +358,7 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
+	h.validator.Remember(ctx, user, previousHash)
 
 	// Возвращаем обновленного пользователя
 	adminUser := models.AdminUserResponse{
@@ -308,6 +368,7 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 		EmailVerified: user.EmailVerified,
 		Role:          user.Role,
 		LastLogin:     user.LastLogin,
+		LockedUntil:   user.LockedUntil,
 		CreatedAt:     user.CreatedAt,
 		UpdatedAt:     user.UpdatedAt,
 	}
@@ -352,9 +413,184 @@ func (h *AdminHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
+	// Выданные удаленному пользователю JWT перестают действовать вместе с сессиями
+	if _, err := h.sessionRepo.RevokeUserSessions(ctx, userID, uuid.Nil); err != nil {
+		logger.Error("Failed to revoke sessions of deleted user", zap.Error(err), zap.String("user_id", userIDStr))
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
 
+// GetUserMFA возвращает состояние второго фактора пользователя
+func (h *AdminHandler) GetUserMFA(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	credential, err := h.mfaRepo.GetTOTPCredential(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to get TOTP credential", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get MFA status"})
+		return
+	}
+
+	keys, err := h.webauthnRepo.CountUserCredentials(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to count WebAuthn credentials", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get MFA status"})
+		return
+	}
+
+	recoveryCodes, err := h.mfaRepo.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to count recovery codes", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get MFA status"})
+		return
+	}
+
+	status := models.MFAStatusResponse{WebAuthnCredentials: keys, RecoveryCodes: recoveryCodes}
+	if credential != nil && credential.Confirmed {
+		status.TOTPEnabled = true
+		status.ConfirmedAt = credential.ConfirmedAt
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// ResetUserMFA отключает второй фактор пользователя, например при потере телефона или ключа:
+// удаляются аутентификатор, все ключи WebAuthn и коды восстановления. Пользователь сможет
+// войти по паролю и подключить их заново
+func (h *AdminHandler) ResetUserMFA(c *gin.Context) {
+	userIDStr := c.Param("id")
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	deleted, err := h.mfaRepo.DeleteTOTPCredential(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to reset MFA", zap.Error(err), zap.String("user_id", userIDStr))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset MFA"})
+		return
+	}
+
+	keys, err := h.webauthnRepo.DeleteUserCredentials(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to delete WebAuthn credentials", zap.Error(err), zap.String("user_id", userIDStr))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset MFA"})
+		return
+	}
+
+	if _, err := h.mfaRepo.DeleteRecoveryCodes(ctx, userID); err != nil {
+		logger.Error("Failed to delete recovery codes", zap.Error(err), zap.String("user_id", userIDStr))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset MFA"})
+		return
+	}
+
+	if !deleted && keys == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MFA is not enabled for this user"})
+		return
+	}
+
+	logger.Info("MFA reset by admin",
+		zap.String("user_id", userIDStr),
+		zap.String("admin_id", c.GetString("user_id")))
+
+	c.JSON(http.StatusOK, gin.H{"message": "MFA reset successfully"})
+}
+
+// UnlockUser снимает блокировку после неудачных попыток входа и сбрасывает их счетчик
+func (h *AdminHandler) UnlockUser(c *gin.Context) {
+	userIDStr := c.Param("id")
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to get user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := h.lockoutRepo.Reset(ctx, userID); err != nil {
+		logger.Error("Failed to unlock user", zap.Error(err), zap.String("user_id", userIDStr))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+
+	logger.Info("User unlocked by admin",
+		zap.String("user_id", userIDStr),
+		zap.String("admin_id", c.GetString("user_id")))
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
+}
+
+// GetUserWebAuthnCredentials возвращает ключи WebAuthn пользователя
+func (h *AdminHandler) GetUserWebAuthnCredentials(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	credentials, err := h.webauthnRepo.GetUserCredentials(c.Request.Context(), userID)
+	if err != nil {
+		logger.Error("Failed to get WebAuthn credentials", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get credentials"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"credentials": credentials})
+}
+
+// DeleteUserWebAuthnCredential удаляет отдельный ключ пользователя, например утерянный
+func (h *AdminHandler) DeleteUserWebAuthnCredential(c *gin.Context) {
+	userIDStr := c.Param("id")
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	credentialID, err := uuid.Parse(c.Param("credential_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential ID"})
+		return
+	}
+
+	deleted, err := h.webauthnRepo.DeleteCredential(c.Request.Context(), userID, credentialID)
+	if err != nil {
+		logger.Error("Failed to delete WebAuthn credential", zap.Error(err), zap.String("user_id", userIDStr))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete credential"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Credential not found"})
+		return
+	}
+
+	logger.Info("WebAuthn credential deleted by admin",
+		zap.String("user_id", userIDStr),
+		zap.String("credential_id", credentialID.String()),
+		zap.String("admin_id", c.GetString("user_id")))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Credential deleted successfully"})
+}
+
 // GetAllClientsWithUsers возвращает всех клиентов с информацией о пользователях
 func (h *AdminHandler) GetAllClientsWithUsers(c *gin.Context) {
 	clients, err := h.clientRepo.GetAllClients()
@@ -395,18 +631,165 @@ func (h *AdminHandler) GetAllClientsWithUsers(c *gin.Context) {
 		}
 
 		adminClients = append(adminClients, models.AdminClientResponse{
-			ID:           client.ID,
-			UserID:       client.UserID,
-			Username:     user.Username,
-			Email:        user.Email,
-			Name:         client.Name,
-			RedirectURIs: redirectURIs,
-			Grants:       grants,
-			Scope:        client.Scope,
-			CreatedAt:    client.CreatedAt,
-			UpdatedAt:    client.UpdatedAt,
+			ID:             client.ID,
+			UserID:         client.UserID,
+			Username:       user.Username,
+			Email:          user.Email,
+			Name:           client.Name,
+			ClientType:     client.ClientType,
+			OAuth21Profile: client.OAuth21Profile,
+			RedirectURIs:   redirectURIs,
+			WildcardURIs:   client.AllowWildcardRedirects,
+			Provisioning:   client.Provisioning,
+			Grants:         grants,
+			Scope:          client.Scope,
+			CreatedAt:      client.CreatedAt,
+			UpdatedAt:      client.UpdatedAt,
 		})
 	}
 
 	c.JSON(http.StatusOK, adminClients)
 }
+
+// GetActiveTokens возвращает активные access токены, токен идентифицируется только префиксом
+func (h *AdminHandler) GetActiveTokens(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	tokens, err := h.tokenRepo.GetActiveAccessTokens(ctx, limit, offset)
+	if err != nil {
+		logger.Error("Failed to get active tokens", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get tokens"})
+		return
+	}
+
+	adminTokens := make([]models.AdminTokenResponse, len(tokens))
+	for i, token := range tokens {
+		adminTokens[i] = models.AdminTokenResponse{
+			TokenPrefix: token.TokenPrefix,
+			ClientID:    token.ClientID,
+			UserID:      token.UserID,
+			Scope:       token.Scope,
+			Audience:    utils.DecodeStringList(token.Audience),
+			ExpiresAt:   token.ExpiresAt,
+			CreatedAt:   token.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": adminTokens,
+		"limit":  limit,
+		"offset": offset,
+		"count":  len(adminTokens),
+	})
+}
+
+// GetResources возвращает реестр защищаемых ресурсов
+func (h *AdminHandler) GetResources(c *gin.Context) {
+	resources, err := h.resourceRepo.GetAllResources(c.Request.Context())
+	if err != nil {
+		logger.Error("Failed to get resources", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get resources"})
+		return
+	}
+
+	adminResources := make([]models.AdminResourceResponse, len(resources))
+	for i, resource := range resources {
+		adminResources[i] = toAdminResourceResponse(resource)
+	}
+
+	c.JSON(http.StatusOK, adminResources)
+}
+
+// CreateResource регистрирует новый защищаемый ресурс
+func (h *AdminHandler) CreateResource(c *gin.Context) {
+	var req models.AdminResourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := oauth2.ValidateResourceIndicator(req.URI); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Resource URI must be absolute and must not contain a fragment"})
+		return
+	}
+
+	resource := &models.ProtectedResource{
+		URI:    req.URI,
+		Name:   req.Name,
+		Scopes: utils.EncodeStringList(req.Scopes),
+	}
+
+	if err := h.resourceRepo.CreateResource(c.Request.Context(), resource); err != nil {
+		logger.Error("Failed to create resource", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create resource"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toAdminResourceResponse(resource))
+}
+
+// UpdateResource обновляет защищаемый ресурс
+func (h *AdminHandler) UpdateResource(c *gin.Context) {
+	var req models.AdminResourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := oauth2.ValidateResourceIndicator(req.URI); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Resource URI must be absolute and must not contain a fragment"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	resource, err := h.resourceRepo.GetResource(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Resource not found"})
+		return
+	}
+
+	resource.URI = req.URI
+	resource.Name = req.Name
+	resource.Scopes = utils.EncodeStringList(req.Scopes)
+	resource.UpdatedAt = time.Now()
+
+	if err := h.resourceRepo.UpdateResource(ctx, resource); err != nil {
+		logger.Error("Failed to update resource", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update resource"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toAdminResourceResponse(resource))
+}
+
+// DeleteResource удаляет защищаемый ресурс
+func (h *AdminHandler) DeleteResource(c *gin.Context) {
+	if err := h.resourceRepo.DeleteResource(c.Request.Context(), c.Param("id")); err != nil {
+		logger.Error("Failed to delete resource", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete resource"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Resource deleted successfully"})
+}
+
+func toAdminResourceResponse(resource *models.ProtectedResource) models.AdminResourceResponse {
+	return models.AdminResourceResponse{
+		ID:        resource.ID,
+		URI:       resource.URI,
+		Name:      resource.Name,
+		Scopes:    utils.DecodeStringList(resource.Scopes),
+		CreatedAt: resource.CreatedAt,
+		UpdatedAt: resource.UpdatedAt,
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/repository"
+	"jiko-auth/internal/utils"
+	"jiko-auth/pkg/logger"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// DeviceHandler реестр устройств текущего пользователя: название, доверие и удаление устройств
+type DeviceHandler struct {
+	deviceRepo  repository.DeviceRepository
+	sessionRepo repository.SessionRepository
+}
+
+func NewDeviceHandler(deviceRepo repository.DeviceRepository, sessionRepo repository.SessionRepository) *DeviceHandler {
+	return &DeviceHandler{
+		deviceRepo:  deviceRepo,
+		sessionRepo: sessionRepo,
+	}
+}
+
+// UpdateDeviceRequest новое название устройства и/или доверие к нему
+type UpdateDeviceRequest struct {
+	Name    *string `json:"name" binding:"omitempty,max=100"`
+	Trusted *bool   `json:"trusted"`
+}
+
+// ListDevices возвращает устройства, с которых входил текущий пользователь
+func (h *DeviceHandler) ListDevices(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	devices, err := h.deviceRepo.GetUserDevices(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to get devices", zap.Error(err), zap.String("user_id", userID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get devices"})
+		return
+	}
+
+	// Текущее устройство - то, к которому привязана сессия запроса
+	if sessionID, err := uuid.Parse(c.GetString("session_id")); err == nil {
+		session, err := h.sessionRepo.GetSession(ctx, sessionID)
+		if err != nil {
+			logger.Warn("Failed to get current session", zap.Error(err), zap.String("session_id", sessionID.String()))
+		}
+		if session != nil && session.DeviceID != nil {
+			for _, device := range devices {
+				device.Current = device.ID == *session.DeviceID
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": devices})
+}
+
+// UpdateDevice переименовывает устройство текущего пользователя или меняет доверие к нему.
+// Повторное доверие продлевает срок, в течение которого вход не требует второго фактора
+func (h *DeviceHandler) UpdateDevice(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	var req UpdateDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	device := h.findDevice(c, userID)
+	if device == nil {
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Device name is required"})
+			return
+		}
+		device.Name = name
+	}
+	if req.Trusted != nil {
+		if *req.Trusted {
+			session := h.strongSession(c)
+			if session == nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Sign in with an authenticator app or a passkey to trust this device"})
+				return
+			}
+			// Доверять можно только браузеру, из которого выполнен запрос
+			if session.DeviceID == nil || *session.DeviceID != device.ID {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Only the current device can be trusted"})
+				return
+			}
+		}
+		device.TrustedAt = nil
+		if *req.Trusted {
+			now := time.Now()
+			device.TrustedAt = &now
+		}
+	}
+
+	if err := h.deviceRepo.UpdateDevice(c.Request.Context(), device); err != nil {
+		logger.Error("Failed to update device", zap.Error(err), zap.String("device_id", device.ID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device"})
+		return
+	}
+
+	logger.Info("Device updated",
+		zap.String("user_id", userID.String()),
+		zap.String("device_id", device.ID.String()),
+		zap.Bool("trusted", device.TrustedAt != nil))
+	c.JSON(http.StatusOK, device)
+}
+
+// trustFactors методы входа (RFC 8176), после которых можно доверять устройству: код
+// аутентификатора и ключи WebAuthn. Коды из письма и коды восстановления не подходят
+var trustFactors = []string{"otp", "hwk", "swk"}
+
+// strongSession возвращает текущую сессию, если она начата с аутентификатором или ключом WebAuthn,
+// иначе nil. Украденный пароль вместе с доступом к почте не должен отключать второй фактор для чужого браузера
+func (h *DeviceHandler) strongSession(c *gin.Context) *models.Session {
+	sessionID, err := uuid.Parse(c.GetString("session_id"))
+	if err != nil {
+		return nil
+	}
+	session, err := h.sessionRepo.GetSession(c.Request.Context(), sessionID)
+	if err != nil {
+		logger.Error("Failed to get session", zap.Error(err), zap.String("session_id", sessionID.String()))
+		return nil
+	}
+	if session == nil {
+		return nil
+	}
+
+	for _, method := range utils.DecodeStringList(session.AMR) {
+		if slices.Contains(trustFactors, method) {
+			return session
+		}
+	}
+	return nil
+}
+
+// DeleteDevice удаляет устройство из реестра и завершает его сессии
+func (h *DeviceHandler) DeleteDevice(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	deviceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+
+	deleted, err := h.deviceRepo.DeleteDevice(c.Request.Context(), userID, deviceID)
+	if err != nil {
+		logger.Error("Failed to delete device", zap.Error(err), zap.String("device_id", deviceID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete device"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+
+	logger.Info("Device removed", zap.String("user_id", userID.String()), zap.String("device_id", deviceID.String()))
+	c.JSON(http.StatusOK, gin.H{"message": "Device removed"})
+}
+
+func (h *DeviceHandler) findDevice(c *gin.Context, userID uuid.UUID) *models.UserDevice {
+	deviceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return nil
+	}
+
+	device, err := h.deviceRepo.GetDevice(c.Request.Context(), userID, deviceID)
+	if err != nil {
+		logger.Error("Failed to get device", zap.Error(err), zap.String("device_id", deviceID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get device"})
+		return nil
+	}
+	if device == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return nil
+	}
+	return device
+}
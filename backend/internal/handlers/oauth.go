@@ -3,34 +3,59 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"jiko-auth/internal/config"
 	"jiko-auth/internal/models"
 	"jiko-auth/internal/repository"
 	"jiko-auth/internal/utils"
+	"jiko-auth/pkg/email"
 	"jiko-auth/pkg/jwt"
+	"jiko-auth/pkg/logger"
 	"jiko-auth/pkg/oauth2"
+	"jiko-auth/pkg/scim"
+	"jiko-auth/pkg/services"
 	"net/http"
 	"net/url"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 )
 
 type OAuthHandler struct {
-	oauthService *oauth2.Service
-	clientRepo   *repository.OAuthClientRepository
-	userRepo     repository.UserRepository
-	tokenRepo    *repository.TokenRepository
-	jwtService   *jwt.Service
+	oauthService        *oauth2.Service
+	clientRepo          *repository.OAuthClientRepository
+	userRepo            repository.UserRepository
+	tokenRepo           *repository.TokenRepository
+	jwtService          *jwt.Service
+	securityRepo        repository.SecurityRepository
+	notificationService *services.NotificationService
+	emailService        *email.EmailService
+	cfg                 *config.Config
 }
 
-func NewOAuthHandler(oauthService *oauth2.Service, clientRepo *repository.OAuthClientRepository, userRepo repository.UserRepository, tokenRepo *repository.TokenRepository, jwtService *jwt.Service) *OAuthHandler {
+func NewOAuthHandler(
+	oauthService *oauth2.Service,
+	clientRepo *repository.OAuthClientRepository,
+	userRepo repository.UserRepository,
+	tokenRepo *repository.TokenRepository,
+	jwtService *jwt.Service,
+	securityRepo repository.SecurityRepository,
+	notificationService *services.NotificationService,
+	emailService *email.EmailService,
+	cfg *config.Config,
+) *OAuthHandler {
 	return &OAuthHandler{
-		oauthService: oauthService,
-		clientRepo:   clientRepo,
-		userRepo:     userRepo,
-		tokenRepo:    tokenRepo,
-		jwtService:   jwtService,
+		oauthService:        oauthService,
+		clientRepo:          clientRepo,
+		userRepo:            userRepo,
+		tokenRepo:           tokenRepo,
+		jwtService:          jwtService,
+		securityRepo:        securityRepo,
+		notificationService: notificationService,
+		emailService:        emailService,
+		cfg:                 cfg,
 	}
 }
 
@@ -43,6 +68,7 @@ func (h *OAuthHandler) Authorize(c *gin.Context) {
 	codeChallenge := c.Query("code_challenge")
 	codeChallengeMethod := c.Query("code_challenge_method")
 	nonce := c.Query("nonce")
+	resources := c.QueryArray("resource")
 
 	// Валидируем client_id
 	client, err := h.clientRepo.GetClient(clientID)
@@ -51,29 +77,20 @@ func (h *OAuthHandler) Authorize(c *gin.Context) {
 		return
 	}
 
-	// Валидируем redirect_uri
-	var redirectURIs []string
-	if err := json.Unmarshal([]byte(client.RedirectURIs), &redirectURIs); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid client configuration"})
+	// Валидируем redirect_uri, response_type и PKCE
+	if err := h.oauthService.ValidateAuthorizationRequest(client, redirectURI, responseType, codeChallenge, codeChallengeMethod); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	isValidRedirect := false
-	for _, uri := range redirectURIs {
-		if uri == redirectURI {
-			isValidRedirect = true
-			break
-		}
-	}
-
-	if !isValidRedirect {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid redirect_uri"})
+	// Валидируем resource indicators (RFC 8707)
+	if _, err := h.oauthService.ResolveResources(resources, scope); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": oauthErrorCode(err)})
 		return
 	}
 
 	// Проверяем, авторизован ли пользователь (используем FlexibleAuthMiddleware)
-	authenticated, exists := c.Get("authenticated")
-	if !exists || !authenticated.(bool) {
+	if !h.isAuthenticated(c, client) {
 		// Если пользователь не авторизован, перенаправляем на фронтенд страницу авторизации
 		frontendURL := "/oauth/authorize"
 		queryParams := "?client_id=" + clientID +
@@ -84,6 +101,9 @@ func (h *OAuthHandler) Authorize(c *gin.Context) {
 			"&code_challenge=" + url.QueryEscape(codeChallenge) +
 			"&code_challenge_method=" + url.QueryEscape(codeChallengeMethod) +
 			"&nonce=" + url.QueryEscape(nonce)
+		for _, resource := range resources {
+			queryParams += "&resource=" + url.QueryEscape(resource)
+		}
 		c.Redirect(http.StatusFound, frontendURL+queryParams)
 		return
 	}
@@ -95,35 +115,43 @@ func (h *OAuthHandler) Authorize(c *gin.Context) {
 		return
 	}
 
-	// Если response_type=code, генерируем authorization code
-	if responseType == "code" {
-		code, err := h.oauthService.GenerateAuthorizationCode(clientID, userID.(string), redirectURI, scope, codeChallenge, codeChallengeMethod, nonce)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate authorization code"})
-			return
-		}
-
-		// Перенаправляем с кодом
-		redirectURL := redirectURI + "?code=" + code + "&state=" + state
-		c.Redirect(http.StatusFound, redirectURL)
+	// response_type=code уже проверен, генерируем authorization code
+	code, err := h.oauthService.GenerateAuthorizationCode(clientID, userID.(string), redirectURI, scope, codeChallenge, codeChallengeMethod, nonce, resources)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate authorization code"})
 		return
 	}
 
-	c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported response_type"})
+	// Перенаправляем с кодом
+	redirectURL := redirectURI + "?code=" + code + "&state=" + state
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// isAuthenticated проверяет результат FlexibleAuthMiddleware. Для клиентов в профиле
+// OAuth 2.1 токен, переданный в query string, не считается аутентификацией
+func (h *OAuthHandler) isAuthenticated(c *gin.Context, client *models.OAuthClient) bool {
+	if !c.GetBool("authenticated") {
+		return false
+	}
+	if c.GetBool("token_from_query") && h.oauthService.ProfileEnabled(client) {
+		return false
+	}
+	return true
 }
 
 // AuthorizeApproval обрабатывает подтверждение авторизации от пользователя
 func (h *OAuthHandler) AuthorizeApproval(c *gin.Context) {
 	var req struct {
-		ClientID            string `json:"client_id" binding:"required"`
-		RedirectURI         string `json:"redirect_uri" binding:"required"`
-		ResponseType        string `json:"response_type" binding:"required"`
-		Scope               string `json:"scope"`
-		State               string `json:"state"`
-		CodeChallenge       string `json:"code_challenge"`
-		CodeChallengeMethod string `json:"code_challenge_method"`
-		Nonce               string `json:"nonce"`
-		Action              string `json:"action" binding:"required"` // "approve" или "deny"
+		ClientID            string   `json:"client_id" binding:"required"`
+		RedirectURI         string   `json:"redirect_uri" binding:"required"`
+		ResponseType        string   `json:"response_type" binding:"required"`
+		Scope               string   `json:"scope"`
+		State               string   `json:"state"`
+		CodeChallenge       string   `json:"code_challenge"`
+		CodeChallengeMethod string   `json:"code_challenge_method"`
+		Nonce               string   `json:"nonce"`
+		Resource            []string `json:"resource"`
+		Action              string   `json:"action" binding:"required"` // "approve" или "deny"
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -131,9 +159,20 @@ func (h *OAuthHandler) AuthorizeApproval(c *gin.Context) {
 		return
 	}
 
+	client, err := h.clientRepo.GetClient(req.ClientID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client_id"})
+		return
+	}
+
+	// Проверяем redirect_uri до любого перенаправления, в том числе при отказе
+	if err := h.oauthService.ValidateAuthorizationRequest(client, req.RedirectURI, req.ResponseType, req.CodeChallenge, req.CodeChallengeMethod); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Проверяем авторизацию
-	authenticated, exists := c.Get("authenticated")
-	if !exists || !authenticated.(bool) {
+	if !h.isAuthenticated(c, client) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
 		return
 	}
@@ -152,9 +191,13 @@ func (h *OAuthHandler) AuthorizeApproval(c *gin.Context) {
 		return
 	}
 
-	if req.Action == "approve" && req.ResponseType == "code" {
+	if req.Action == "approve" {
 		// Пользователь разрешил доступ, генерируем код
-		code, err := h.oauthService.GenerateAuthorizationCode(req.ClientID, userID.(string), req.RedirectURI, req.Scope, req.CodeChallenge, req.CodeChallengeMethod, req.Nonce)
+		code, err := h.oauthService.GenerateAuthorizationCode(req.ClientID, userID.(string), req.RedirectURI, req.Scope, req.CodeChallenge, req.CodeChallengeMethod, req.Nonce, req.Resource)
+		if errors.Is(err, oauth2.ErrInvalidTarget) || errors.Is(err, oauth2.ErrInvalidScope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate authorization code"})
 			return
@@ -197,6 +240,7 @@ func (h *OAuthHandler) Token(c *gin.Context) {
 
 	clientID := c.PostForm("client_id")
 	clientSecret := c.PostForm("client_secret")
+	resources := c.PostFormArray("resource")
 
 	switch grantType {
 	case "authorization_code":
@@ -207,7 +251,7 @@ func (h *OAuthHandler) Token(c *gin.Context) {
 		var tokens map[string]interface{}
 		var err error
 
-		tokens, err = h.oauthService.ExchangeCodeForToken(code, redirectURI, clientID, clientSecret, codeVerifier)
+		tokens, err = h.oauthService.ExchangeCodeForToken(code, redirectURI, clientID, clientSecret, codeVerifier, resources)
 
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -219,7 +263,7 @@ func (h *OAuthHandler) Token(c *gin.Context) {
 	case "refresh_token":
 		refreshToken := c.PostForm("refresh_token")
 
-		tokens, err := h.oauthService.RefreshToken(refreshToken, clientID, clientSecret)
+		tokens, err := h.oauthService.RefreshToken(refreshToken, clientID, clientSecret, resources)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -262,8 +306,10 @@ func (h *OAuthHandler) CreateClient(c *gin.Context) {
 	}
 
 	var req struct {
-		Name         string   `json:"name" binding:"required"`
-		RedirectURIs []string `json:"redirect_uris" binding:"required"`
+		Name           string   `json:"name" binding:"required"`
+		RedirectURIs   []string `json:"redirect_uris" binding:"required"`
+		ClientType     string   `json:"client_type" binding:"omitempty,oneof=public confidential"`
+		OAuth21Profile bool     `json:"oauth21_profile"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -277,13 +323,26 @@ func (h *OAuthHandler) CreateClient(c *gin.Context) {
 		return
 	}
 
-	// Генерируем client secret
-	secret, err := utils.GenerateRandomString(32)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate client secret"})
+	if req.ClientType == "" {
+		req.ClientType = models.ClientTypeConfidential
+	}
+
+	// Шаблоны redirect_uri с подстановкой может включить только администратор
+	if err := oauth2.ValidateRedirectURIs(req.RedirectURIs, req.ClientType, false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Генерируем client secret, публичным клиентам секрет не выдается
+	var secret string
+	if req.ClientType == models.ClientTypeConfidential {
+		secret, err = utils.GenerateRandomString(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate client secret"})
+			return
+		}
+	}
+
 	// Сериализуем RedirectURIs в JSON
 	redirectURIsJSON, err := json.Marshal(req.RedirectURIs)
 	if err != nil {
@@ -300,23 +359,29 @@ func (h *OAuthHandler) CreateClient(c *gin.Context) {
 	}
 
 	client := &models.OAuthClient{
-		UserID:       uid,
-		Name:         req.Name,
-		Secret:       secret,
-		RedirectURIs: string(redirectURIsJSON),
-		Grants:       string(grantsJSON),
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+		UserID:         uid,
+		Name:           req.Name,
+		ClientType:     req.ClientType,
+		OAuth21Profile: req.OAuth21Profile,
+		RedirectURIs:   string(redirectURIsJSON),
+		Grants:         string(grantsJSON),
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
 	}
 
-	err = h.clientRepo.CreateClient(client)
+	err = h.clientRepo.CreateClient(client, secret)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create client"})
 		return
 	}
 
+	if client.IsPublic() {
+		c.JSON(http.StatusCreated, client)
+		return
+	}
+
 	// Возвращаем клиента с секретом (только один раз!)
-	c.JSON(http.StatusCreated, client)
+	c.JSON(http.StatusCreated, models.OAuthClientWithSecret{OAuthClient: client, Secret: secret})
 }
 
 func (h *OAuthHandler) CreateToken(c *gin.Context) {
@@ -363,9 +428,14 @@ func (h *OAuthHandler) GetAllClients(c *gin.Context) {
 
 func (h *OAuthHandler) AdminCreateClient(c *gin.Context) {
 	var req struct {
-		UserID       string   `json:"user_id" binding:"required"`
-		Name         string   `json:"name" binding:"required"`
-		RedirectURIs []string `json:"redirect_uris" binding:"required"`
+		UserID         string   `json:"user_id" binding:"required"`
+		Name           string   `json:"name" binding:"required"`
+		RedirectURIs   []string `json:"redirect_uris" binding:"required"`
+		ClientType     string   `json:"client_type" binding:"omitempty,oneof=public confidential"`
+		OAuth21Profile bool     `json:"oauth21_profile"`
+		Provisioning   bool     `json:"provisioning"`
+
+		AllowWildcardRedirects bool `json:"allow_wildcard_redirects"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -379,13 +449,25 @@ func (h *OAuthHandler) AdminCreateClient(c *gin.Context) {
 		return
 	}
 
-	// Генерируем client secret
-	secret, err := utils.GenerateRandomString(32)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate client secret"})
+	if req.ClientType == "" {
+		req.ClientType = models.ClientTypeConfidential
+	}
+
+	if err := oauth2.ValidateRedirectURIs(req.RedirectURIs, req.ClientType, req.AllowWildcardRedirects); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Генерируем client secret, публичным клиентам секрет не выдается
+	var secret string
+	if req.ClientType == models.ClientTypeConfidential {
+		secret, err = utils.GenerateRandomString(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate client secret"})
+			return
+		}
+	}
+
 	// Сериализуем RedirectURIs в JSON
 	redirectURIsJSON, err := json.Marshal(req.RedirectURIs)
 	if err != nil {
@@ -402,30 +484,107 @@ func (h *OAuthHandler) AdminCreateClient(c *gin.Context) {
 	}
 
 	client := &models.OAuthClient{
-		UserID:       userUUID,
-		Name:         req.Name,
-		Secret:       secret,
-		RedirectURIs: string(redirectURIsJSON),
-		Grants:       string(grantsJSON),
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+		UserID:         userUUID,
+		Name:           req.Name,
+		ClientType:     req.ClientType,
+		OAuth21Profile: req.OAuth21Profile,
+		Provisioning:   req.Provisioning,
+		RedirectURIs:   string(redirectURIsJSON),
+
+		AllowWildcardRedirects: req.AllowWildcardRedirects,
+		Grants:                 string(grantsJSON),
+		CreatedAt:              time.Now(),
+		UpdatedAt:              time.Now(),
 	}
 
-	err = h.clientRepo.CreateClient(client)
+	err = h.clientRepo.CreateClient(client, secret)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create client"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, client)
+	if client.IsPublic() {
+		c.JSON(http.StatusCreated, client)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.OAuthClientWithSecret{OAuthClient: client, Secret: secret})
+}
+
+// RotateClientSecret выпускает новый секрет клиента. Доступно администратору и владельцу клиента,
+// предыдущий секрет действует еще cfg.ClientSecretGrace
+func (h *OAuthHandler) RotateClientSecret(c *gin.Context) {
+	clientID := c.Param("id")
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	client, err := h.clientRepo.GetClient(clientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+		return
+	}
+
+	if c.GetString("user_role") != "admin" && client.UserID.String() != userID.(string) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	if client.IsPublic() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Public clients have no secret"})
+		return
+	}
+
+	secret, err := utils.GenerateRandomString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate client secret"})
+		return
+	}
+
+	if err := h.clientRepo.RotateClientSecret(client, secret, h.cfg.ClientSecretGrace); err != nil {
+		logger.Error("Failed to rotate client secret", zap.Error(err), zap.String("client_id", clientID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate client secret"})
+		return
+	}
+
+	h.notifyClientOwner(c, client)
+
+	c.JSON(http.StatusOK, models.OAuthClientWithSecret{OAuthClient: client, Secret: secret})
+}
+
+// notifyClientOwner уведомляет владельца клиента о ротации секрета
+func (h *OAuthHandler) notifyClientOwner(c *gin.Context, client *models.OAuthClient) {
+	ctx := c.Request.Context()
+
+	owner, err := h.userRepo.GetUserByID(ctx, client.UserID)
+	if err != nil || owner == nil {
+		logger.Warn("Client owner not found for secret rotation notification", zap.String("client_id", client.ID.String()))
+		return
+	}
+
+	notification := h.notificationService.CreateClientSecretRotatedNotification(client, owner)
+	if err := h.securityRepo.CreateNotification(ctx, notification); err != nil {
+		logger.Error("Failed to save notification", zap.Error(err))
+	}
+
+	if err := h.emailService.SendSecurityNotification(owner.Email, notification); err != nil {
+		logger.Warn("Failed to send client secret rotation email", zap.Error(err), zap.String("email", owner.Email))
+	}
 }
 
 func (h *OAuthHandler) AdminUpdateClient(c *gin.Context) {
 	clientID := c.Param("id")
 
 	var req struct {
-		Name         *string  `json:"name"`
-		RedirectURIs []string `json:"redirect_uris"`
+		Name           *string  `json:"name"`
+		RedirectURIs   []string `json:"redirect_uris"`
+		OAuth21Profile *bool    `json:"oauth21_profile"`
+		Provisioning   *bool    `json:"provisioning"`
+
+		AllowWildcardRedirects *bool `json:"allow_wildcard_redirects"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -443,6 +602,28 @@ func (h *OAuthHandler) AdminUpdateClient(c *gin.Context) {
 		client.Name = *req.Name
 	}
 
+	if req.OAuth21Profile != nil {
+		client.OAuth21Profile = *req.OAuth21Profile
+	}
+
+	if req.Provisioning != nil {
+		client.Provisioning = *req.Provisioning
+	}
+
+	if req.AllowWildcardRedirects != nil {
+		client.AllowWildcardRedirects = *req.AllowWildcardRedirects
+	}
+
+	// Проверяем итоговый список: отключение шаблонов делает недействительными уже сохраненные
+	redirectURIs := utils.DecodeStringList(client.RedirectURIs)
+	if req.RedirectURIs != nil {
+		redirectURIs = req.RedirectURIs
+	}
+	if err := oauth2.ValidateRedirectURIs(redirectURIs, client.ClientType, client.AllowWildcardRedirects); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	if req.RedirectURIs != nil {
 		redirectURIsJSON, err := json.Marshal(req.RedirectURIs)
 		if err != nil {
@@ -475,6 +656,96 @@ func (h *OAuthHandler) AdminDeleteClient(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Client deleted successfully"})
 }
 
+// AdminIssueProvisioningToken выпускает bearer токен со scope scim для клиента provisioning.
+// Токен показывается один раз, в БД хранится только его хеш
+func (h *OAuthHandler) AdminIssueProvisioningToken(c *gin.Context) {
+	client, err := h.clientRepo.GetClient(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+		return
+	}
+
+	if !client.Provisioning {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Client is not a provisioning client"})
+		return
+	}
+
+	token, err := utils.GenerateRandomString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	expiresAt := time.Now().Add(h.cfg.SCIMTokenExpiry)
+	if err := h.tokenRepo.SaveAccessToken(token, client.ID.String(), client.UserID.String(), scim.Scope, nil, expiresAt); err != nil {
+		logger.Error("Failed to save provisioning token", zap.Error(err), zap.String("client_id", client.ID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":      token,
+		"token_type": "Bearer",
+		"scope":      scim.Scope,
+		"expires_at": expiresAt,
+	})
+}
+
+// AdminGetDefaultTokenPolicy возвращает сроки жизни токенов по умолчанию из конфигурации
+func (h *OAuthHandler) AdminGetDefaultTokenPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, oauth2.DefaultTokenPolicy(h.cfg).Model())
+}
+
+// AdminGetClientTokenPolicy возвращает переопределения клиента и итоговую политику
+func (h *OAuthHandler) AdminGetClientTokenPolicy(c *gin.Context) {
+	client, err := h.clientRepo.GetClient(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.tokenPolicyResponse(client))
+}
+
+// AdminUpdateClientTokenPolicy заменяет переопределения политики токенов клиента.
+// Поле со значением null возвращает значение по умолчанию
+func (h *OAuthHandler) AdminUpdateClientTokenPolicy(c *gin.Context) {
+	var req models.TokenPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client, err := h.clientRepo.GetClient(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+		return
+	}
+
+	if err := h.oauthService.ValidateTokenPolicy(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "TTL values must be positive and refresh_absolute_ttl must not be less than refresh_idle_ttl"})
+		return
+	}
+
+	client.TokenPolicy = req
+	client.UpdatedAt = time.Now()
+
+	if err := h.clientRepo.UpdateClient(client); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update token policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.tokenPolicyResponse(client))
+}
+
+func (h *OAuthHandler) tokenPolicyResponse(client *models.OAuthClient) models.AdminTokenPolicyResponse {
+	return models.AdminTokenPolicyResponse{
+		ClientID:  client.ID,
+		Overrides: client.TokenPolicy,
+		Effective: h.oauthService.TokenPolicyFor(client).Model(),
+	}
+}
+
 func (h *OAuthHandler) UserInfo(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
@@ -562,6 +833,11 @@ func (h *OAuthHandler) OpenIDConfiguration(c *gin.Context) {
 	}
 	baseURL := scheme + "://" + c.Request.Host + "/api/v1"
 
+	codeChallengeMethods := []string{"S256", "plain"}
+	if h.cfg.OAuth21Profile {
+		codeChallengeMethods = []string{"S256"}
+	}
+
 	config := map[string]interface{}{
 		"issuer":                                baseURL,
 		"authorization_endpoint":                baseURL + "/oauth/authorize",
@@ -573,9 +849,22 @@ func (h *OAuthHandler) OpenIDConfiguration(c *gin.Context) {
 		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
 		"subject_types_supported":               []string{"public"},
 		"id_token_signing_alg_values_supported": []string{"HS256"},
-		"token_endpoint_auth_methods_supported": []string{"client_secret_post"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_post", "none"},
+		"code_challenge_methods_supported":      codeChallengeMethods,
 		"claims_supported":                      []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "email", "email_verified"},
 	}
 
 	c.JSON(http.StatusOK, config)
 }
+
+// oauthErrorCode возвращает код ошибки OAuth для известных ошибок сервиса
+func oauthErrorCode(err error) string {
+	switch {
+	case errors.Is(err, oauth2.ErrInvalidTarget):
+		return oauth2.ErrInvalidTarget.Error()
+	case errors.Is(err, oauth2.ErrInvalidScope):
+		return oauth2.ErrInvalidScope.Error()
+	default:
+		return "invalid_request"
+	}
+}
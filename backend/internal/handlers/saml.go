@@ -0,0 +1,379 @@
+package handlers
+
+import (
+	"errors"
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/repository"
+	"jiko-auth/internal/utils"
+	"jiko-auth/pkg/logger"
+	"jiko-auth/pkg/saml"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// SAMLHandler SAML 2.0 Identity Provider. Пользователь аутентифицируется той же сессией,
+// что и в OAuth authorize (FlexibleAuthMiddleware), неаутентифицированный пользователь
+// перенаправляется на страницу входа фронтенда
+type SAMLHandler struct {
+	idp         *saml.IdentityProvider
+	samlRepo    *repository.SAMLRepository
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+}
+
+// forceAuthnMaxAge возраст сессии, при котором вход еще считается выполненным для запроса
+// с ForceAuthn="true". Более старая сессия требует повторного входа
+const forceAuthnMaxAge = 5 * time.Minute
+
+func NewSAMLHandler(idp *saml.IdentityProvider, samlRepo *repository.SAMLRepository, userRepo repository.UserRepository, sessionRepo repository.SessionRepository) *SAMLHandler {
+	return &SAMLHandler{
+		idp:         idp,
+		samlRepo:    samlRepo,
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+	}
+}
+
+// Metadata отдает метаданные IdP
+func (h *SAMLHandler) Metadata(c *gin.Context) {
+	c.Data(http.StatusOK, "application/samlmetadata+xml", []byte(h.idp.Metadata()))
+}
+
+// SSO обрабатывает SP-initiated вход через HTTP-Redirect (GET) и HTTP-POST (POST) binding
+func (h *SAMLHandler) SSO(c *gin.Context) {
+	var (
+		samlRequest string
+		relayState  string
+		binding     string
+		authnReq    *saml.AuthnRequest
+		err         error
+	)
+
+	if c.Request.Method == http.MethodPost {
+		samlRequest = c.PostForm("SAMLRequest")
+		relayState = c.PostForm("RelayState")
+		binding = "post"
+		authnReq, err = saml.DecodePostRequest(samlRequest)
+	} else {
+		samlRequest = c.Query("SAMLRequest")
+		relayState = c.Query("RelayState")
+		binding = "redirect"
+		authnReq, err = saml.DecodeRedirectRequest(samlRequest)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sp, err := h.validateRequest(c, authnReq)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// При ForceAuthn свежесть входа проверяет CompleteSSO, а фронтенд при необходимости
+	// запрашивает вход заново
+	if !c.GetBool("authenticated") || authnReq.ForceAuthn {
+		// Фронтенд после входа вызывает CompleteSSO с теми же параметрами
+		c.Redirect(http.StatusFound, "/saml/sso?SAMLRequest="+url.QueryEscape(samlRequest)+
+			"&binding="+binding+
+			"&RelayState="+url.QueryEscape(relayState))
+		return
+	}
+
+	h.postResponse(c, sp, authnReq.ID, relayState)
+}
+
+// IdPInitiated выполняет вход в SP без AuthnRequest (IdP-initiated SSO)
+func (h *SAMLHandler) IdPInitiated(c *gin.Context) {
+	spID := c.Param("id")
+	relayState := c.Query("RelayState")
+
+	sp, err := h.samlRepo.GetServiceProvider(c.Request.Context(), spID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service provider not found"})
+		return
+	}
+
+	if !c.GetBool("authenticated") {
+		c.Redirect(http.StatusFound, "/saml/sso?sp="+url.QueryEscape(spID)+"&RelayState="+url.QueryEscape(relayState))
+		return
+	}
+
+	h.postResponse(c, sp, "", relayState)
+}
+
+// CompleteSSO вызывается фронтендом после входа пользователя и возвращает данные
+// для отправки ответа на ACS
+func (h *SAMLHandler) CompleteSSO(c *gin.Context) {
+	var req struct {
+		SAMLRequest       string `json:"saml_request"`
+		Binding           string `json:"binding" binding:"omitempty,oneof=redirect post"`
+		ServiceProviderID string `json:"sp"`
+		RelayState        string `json:"relay_state"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !c.GetBool("authenticated") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		return
+	}
+
+	var (
+		sp           *models.SAMLServiceProvider
+		inResponseTo string
+		forceAuthn   bool
+		err          error
+	)
+
+	if req.SAMLRequest != "" {
+		var authnReq *saml.AuthnRequest
+		if req.Binding == "post" {
+			authnReq, err = saml.DecodePostRequest(req.SAMLRequest)
+		} else {
+			authnReq, err = saml.DecodeRedirectRequest(req.SAMLRequest)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sp, err = h.validateRequest(c, authnReq)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		inResponseTo = authnReq.ID
+		forceAuthn = authnReq.ForceAuthn
+	} else {
+		sp, err = h.samlRepo.GetServiceProvider(c.Request.Context(), req.ServiceProviderID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Service provider not found"})
+			return
+		}
+	}
+
+	session, err := h.currentSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		return
+	}
+	if forceAuthn && time.Since(session.CreatedAt) > forceAuthnMaxAge {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "reauthentication required", "reauthenticate": true})
+		return
+	}
+
+	samlResponse, err := h.buildResponse(c, sp, session, inResponseTo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build SAML response"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"acs_url":       sp.ACSURL,
+		"saml_response": samlResponse,
+		"relay_state":   req.RelayState,
+	})
+}
+
+func (h *SAMLHandler) validateRequest(c *gin.Context, authnReq *saml.AuthnRequest) (*models.SAMLServiceProvider, error) {
+	sp, err := h.samlRepo.GetServiceProviderByEntityID(c.Request.Context(), authnReq.Issuer)
+	if err != nil {
+		return nil, errors.New("unknown service provider")
+	}
+	if err := h.idp.ValidateRequest(authnReq, sp); err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+// postResponse отправляет подписанный ответ на ACS через HTTP-POST binding
+func (h *SAMLHandler) postResponse(c *gin.Context, sp *models.SAMLServiceProvider, inResponseTo, relayState string) {
+	session, err := h.currentSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		return
+	}
+
+	samlResponse, err := h.buildResponse(c, sp, session, inResponseTo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build SAML response"})
+		return
+	}
+
+	page, err := saml.PostForm(sp.ACSURL, samlResponse, relayState)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render SAML response"})
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+}
+
+// currentSession возвращает сессию, которой аутентифицирован запрос
+func (h *SAMLHandler) currentSession(c *gin.Context) (*models.Session, error) {
+	sessionID, err := uuid.Parse(c.GetString("session_id"))
+	if err != nil {
+		return nil, err
+	}
+	session, err := h.sessionRepo.GetSession(c.Request.Context(), sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, errors.New("session not found")
+	}
+	return session, nil
+}
+
+// buildResponse выпускает утверждение о владельце сессии. AuthnInstant - время входа,
+// с которого началась сессия, контекст аутентификации определяется ее методами входа
+func (h *SAMLHandler) buildResponse(c *gin.Context, sp *models.SAMLServiceProvider, session *models.Session, inResponseTo string) (string, error) {
+	user, err := h.userRepo.GetUserByID(c.Request.Context(), session.UserID)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", errors.New("user not found")
+	}
+
+	amr := utils.DecodeStringList(session.AMR)
+	samlResponse, err := h.idp.BuildResponse(sp, user, inResponseTo, session.CreatedAt, amr)
+	if err != nil {
+		logger.Error("Failed to build SAML response", zap.Error(err), zap.String("sp", sp.EntityID))
+		return "", err
+	}
+	return samlResponse, nil
+}
+
+func (h *SAMLHandler) GetServiceProviders(c *gin.Context) {
+	providers, err := h.samlRepo.GetAllServiceProviders(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get service providers"})
+		return
+	}
+
+	response := make([]models.AdminSAMLServiceProviderResponse, 0, len(providers))
+	for _, sp := range providers {
+		response = append(response, toAdminSAMLServiceProviderResponse(sp))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *SAMLHandler) CreateServiceProvider(c *gin.Context) {
+	var req models.AdminSAMLServiceProviderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.NameIDFormat == "" {
+		req.NameIDFormat = models.NameIDFormatEmail
+	}
+	if err := validateServiceProviderRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sp := &models.SAMLServiceProvider{
+		EntityID:         req.EntityID,
+		Name:             req.Name,
+		ACSURL:           req.ACSURL,
+		NameIDFormat:     req.NameIDFormat,
+		AttributeMapping: saml.EncodeAttributeMapping(req.AttributeMapping),
+	}
+
+	if err := h.samlRepo.CreateServiceProvider(c.Request.Context(), sp); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Service provider already exists"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toAdminSAMLServiceProviderResponse(sp))
+}
+
+func (h *SAMLHandler) UpdateServiceProvider(c *gin.Context) {
+	var req models.AdminSAMLServiceProviderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sp, err := h.samlRepo.GetServiceProvider(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service provider not found"})
+		return
+	}
+
+	if req.NameIDFormat == "" {
+		req.NameIDFormat = sp.NameIDFormat
+	}
+	if err := validateServiceProviderRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sp.EntityID = req.EntityID
+	sp.Name = req.Name
+	sp.ACSURL = req.ACSURL
+	sp.NameIDFormat = req.NameIDFormat
+	sp.AttributeMapping = saml.EncodeAttributeMapping(req.AttributeMapping)
+
+	if err := h.samlRepo.UpdateServiceProvider(c.Request.Context(), sp); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update service provider"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toAdminSAMLServiceProviderResponse(sp))
+}
+
+func (h *SAMLHandler) DeleteServiceProvider(c *gin.Context) {
+	if err := h.samlRepo.DeleteServiceProvider(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete service provider"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Service provider deleted successfully"})
+}
+
+func validateServiceProviderRequest(req *models.AdminSAMLServiceProviderRequest) error {
+	if err := saml.ValidateNameIDFormat(req.NameIDFormat); err != nil {
+		return err
+	}
+	if err := saml.ValidateAttributeMapping(req.AttributeMapping); err != nil {
+		return err
+	}
+
+	acsURL, err := url.Parse(req.ACSURL)
+	if err != nil || acsURL.Scheme != "https" && !isLoopbackURL(acsURL) {
+		return errors.New("acs_url must use https")
+	}
+	return nil
+}
+
+// isLoopbackURL разрешает http ACS только для локальной разработки
+func isLoopbackURL(u *url.URL) bool {
+	return u.Scheme == "http" && (u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1" || u.Hostname() == "::1")
+}
+
+func toAdminSAMLServiceProviderResponse(sp *models.SAMLServiceProvider) models.AdminSAMLServiceProviderResponse {
+	return models.AdminSAMLServiceProviderResponse{
+		ID:               sp.ID,
+		EntityID:         sp.EntityID,
+		Name:             sp.Name,
+		ACSURL:           sp.ACSURL,
+		NameIDFormat:     sp.NameIDFormat,
+		AttributeMapping: saml.DecodeAttributeMapping(sp.AttributeMapping),
+		CreatedAt:        sp.CreatedAt,
+		UpdatedAt:        sp.UpdatedAt,
+	}
+}
@@ -0,0 +1,1221 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"jiko-auth/internal/config"
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/repository"
+	"jiko-auth/internal/utils"
+	"jiko-auth/pkg/logger"
+	"jiko-auth/pkg/passwords"
+	"jiko-auth/pkg/scim"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const scimContentType = "application/scim+json"
+
+var userColumns = scim.ColumnMap{
+	"id":                {Expr: "id::text", CaseExact: true},
+	"username":          {Expr: "username"},
+	"externalid":        {Expr: "external_id", CaseExact: true},
+	"displayname":       {Expr: "display_name"},
+	"name.givenname":    {Expr: "given_name"},
+	"name.familyname":   {Expr: "family_name"},
+	"emails":            {Expr: "email"},
+	"emails.value":      {Expr: "email"},
+	"active":            {Expr: "disabled", Type: scim.AttrBool, Negate: true},
+	"meta.created":      {Expr: "created_at", Type: scim.AttrDateTime},
+	"meta.lastmodified": {Expr: "updated_at", Type: scim.AttrDateTime},
+}
+
+var groupColumns = scim.ColumnMap{
+	"id":                {Expr: "id::text", CaseExact: true},
+	"displayname":       {Expr: "display_name"},
+	"externalid":        {Expr: "external_id", CaseExact: true},
+	"members":           {Expr: "user_id::text", CaseExact: true, Wrap: "id IN (SELECT group_id FROM group_members WHERE %s)"},
+	"members.value":     {Expr: "user_id::text", CaseExact: true, Wrap: "id IN (SELECT group_id FROM group_members WHERE %s)"},
+	"meta.created":      {Expr: "created_at", Type: scim.AttrDateTime},
+	"meta.lastmodified": {Expr: "updated_at", Type: scim.AttrDateTime},
+}
+
+// SCIMHandler SCIM 2.0 provisioning API (RFC 7643, RFC 7644) для пользователей и групп
+type SCIMHandler struct {
+	userRepo          repository.UserRepository
+	scimRepo          *repository.SCIMRepository
+	tokenRepo         *repository.TokenRepository
+	sessionRepo       repository.SessionRepository
+	passwordHasher    utils.PasswordHasher
+	passwordValidator *passwords.Validator
+	renderer          *scim.Renderer
+}
+
+func NewSCIMHandler(
+	userRepo repository.UserRepository,
+	scimRepo *repository.SCIMRepository,
+	tokenRepo *repository.TokenRepository,
+	sessionRepo repository.SessionRepository,
+	passwordHasher utils.PasswordHasher,
+	passwordValidator *passwords.Validator,
+	cfg *config.Config,
+) *SCIMHandler {
+	return &SCIMHandler{
+		userRepo:          userRepo,
+		scimRepo:          scimRepo,
+		tokenRepo:         tokenRepo,
+		sessionRepo:       sessionRepo,
+		passwordHasher:    passwordHasher,
+		passwordValidator: passwordValidator,
+		renderer:          scim.NewRenderer(strings.TrimRight(cfg.AppUrl, "/") + "/scim/v2"),
+	}
+}
+
+// Discovery
+
+func (h *SCIMHandler) ServiceProviderConfig(c *gin.Context) {
+	h.write(c, http.StatusOK, h.renderer.ServiceProviderConfig())
+}
+
+func (h *SCIMHandler) ResourceTypes(c *gin.Context) {
+	types := h.renderer.ResourceTypes()
+	h.write(c, http.StatusOK, scim.NewListResponse(types, int64(len(types)), 1, len(types)))
+}
+
+func (h *SCIMHandler) Schemas(c *gin.Context) {
+	schemas := h.renderer.Schemas()
+	h.write(c, http.StatusOK, scim.NewListResponse(schemas, int64(len(schemas)), 1, len(schemas)))
+}
+
+func (h *SCIMHandler) Schema(c *gin.Context) {
+	for _, schema := range h.renderer.Schemas() {
+		if schema.ID == c.Param("id") {
+			h.write(c, http.StatusOK, schema)
+			return
+		}
+	}
+	h.writeError(c, scim.NotFound("Schema", c.Param("id")))
+}
+
+// Users
+
+func (h *SCIMHandler) ListUsers(c *gin.Context) {
+	query, startIndex, err := listQuery(c, userColumns, scim.SchemaUser)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	users, total, err := h.scimRepo.FindUsers(c.Request.Context(), query)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	resources := make([]*scim.User, 0, len(users))
+	for _, user := range users {
+		resource, err := h.renderUser(c.Request.Context(), user)
+		if err != nil {
+			h.writeError(c, err)
+			return
+		}
+		resources = append(resources, resource)
+	}
+
+	h.write(c, http.StatusOK, scim.NewListResponse(resources, total, startIndex, len(resources)))
+}
+
+func (h *SCIMHandler) GetUser(c *gin.Context) {
+	user, err := h.findUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	if c.GetHeader("If-None-Match") == scim.ETag(user.UpdatedAt) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	h.writeUser(c, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) CreateUser(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		h.writeError(c, scim.BadRequest(scim.ScimTypeInvalidSyntax, "failed to read request body"))
+		return
+	}
+
+	user, err := h.createUser(c.Request.Context(), body)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.writeUser(c, http.StatusCreated, user)
+}
+
+func (h *SCIMHandler) ReplaceUser(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		h.writeError(c, scim.BadRequest(scim.ScimTypeInvalidSyntax, "failed to read request body"))
+		return
+	}
+
+	user, err := h.replaceUser(c.Request.Context(), c.Param("id"), body, c.GetHeader("If-Match"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.writeUser(c, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) PatchUser(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		h.writeError(c, scim.BadRequest(scim.ScimTypeInvalidSyntax, "failed to read request body"))
+		return
+	}
+
+	user, err := h.patchUser(c.Request.Context(), c.Param("id"), body, c.GetHeader("If-Match"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.writeUser(c, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) DeleteUser(c *gin.Context) {
+	if err := h.deleteUser(c.Request.Context(), c.Param("id"), c.GetHeader("If-Match")); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Groups
+
+func (h *SCIMHandler) ListGroups(c *gin.Context) {
+	query, startIndex, err := listQuery(c, groupColumns, scim.SchemaGroup)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	groups, total, err := h.scimRepo.FindGroups(c.Request.Context(), query)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	resources := make([]*scim.Group, 0, len(groups))
+	for _, group := range groups {
+		resources = append(resources, h.renderer.Group(group))
+	}
+
+	h.write(c, http.StatusOK, scim.NewListResponse(resources, total, startIndex, len(resources)))
+}
+
+func (h *SCIMHandler) GetGroup(c *gin.Context) {
+	group, err := h.findGroup(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	if c.GetHeader("If-None-Match") == scim.ETag(group.UpdatedAt) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	h.writeGroup(c, http.StatusOK, group)
+}
+
+func (h *SCIMHandler) CreateGroup(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		h.writeError(c, scim.BadRequest(scim.ScimTypeInvalidSyntax, "failed to read request body"))
+		return
+	}
+
+	group, err := h.createGroup(c.Request.Context(), body)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.writeGroup(c, http.StatusCreated, group)
+}
+
+func (h *SCIMHandler) ReplaceGroup(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		h.writeError(c, scim.BadRequest(scim.ScimTypeInvalidSyntax, "failed to read request body"))
+		return
+	}
+
+	group, err := h.replaceGroup(c.Request.Context(), c.Param("id"), body, c.GetHeader("If-Match"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.writeGroup(c, http.StatusOK, group)
+}
+
+func (h *SCIMHandler) PatchGroup(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		h.writeError(c, scim.BadRequest(scim.ScimTypeInvalidSyntax, "failed to read request body"))
+		return
+	}
+
+	group, err := h.patchGroup(c.Request.Context(), c.Param("id"), body, c.GetHeader("If-Match"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.writeGroup(c, http.StatusOK, group)
+}
+
+func (h *SCIMHandler) DeleteGroup(c *gin.Context) {
+	if err := h.deleteGroup(c.Request.Context(), c.Param("id"), c.GetHeader("If-Match")); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Bulk выполняет операции последовательно. Ссылки bulkId:<id> разрешаются
+// в идентификаторы ресурсов, созданных предыдущими операциями запроса
+func (h *SCIMHandler) Bulk(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		h.writeError(c, scim.BadRequest(scim.ScimTypeInvalidSyntax, "failed to read request body"))
+		return
+	}
+
+	req, err := scim.ParseBulkRequest(body)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	created := make(map[string]string)
+	results := make([]scim.BulkOperationResult, 0, len(req.Operations))
+	failures := 0
+
+	for _, op := range req.Operations {
+		result := scim.BulkOperationResult{Method: op.Method, BulkID: op.BulkID}
+
+		location, version, status, err := h.bulkOperation(ctx, &op, created)
+		if err != nil {
+			scimErr := h.toSCIMError(err)
+			response := scimErr.Response()
+			result.Status = strconv.Itoa(scimErr.Status)
+			result.Response = &response
+			failures++
+		} else {
+			result.Status = strconv.Itoa(status)
+			result.Location = location
+			result.Version = version
+		}
+		results = append(results, result)
+
+		if req.FailOnErrors > 0 && failures >= req.FailOnErrors {
+			break
+		}
+	}
+
+	h.write(c, http.StatusOK, scim.BulkResponse{
+		Schemas:    []string{scim.SchemaBulkResponse},
+		Operations: results,
+	})
+}
+
+func (h *SCIMHandler) bulkOperation(ctx context.Context, op *scim.BulkOperation, created map[string]string) (string, string, int, error) {
+	if err := scim.ResolveBulkIDs(op, created); err != nil {
+		return "", "", 0, err
+	}
+
+	parts := strings.Split(strings.Trim(op.Path, "/"), "/")
+	resourceType := parts[0]
+	var id string
+	if len(parts) == 2 {
+		id = parts[1]
+	}
+	if len(parts) > 2 || (resourceType != "Users" && resourceType != "Groups") {
+		return "", "", 0, scim.BadRequest(scim.ScimTypeInvalidPath, "invalid bulk path %q", op.Path)
+	}
+	if (op.Method == http.MethodPost) != (id == "") {
+		return "", "", 0, scim.BadRequest(scim.ScimTypeInvalidPath, "invalid bulk path %q for %s", op.Path, op.Method)
+	}
+
+	if resourceType == "Users" {
+		var (
+			user *models.User
+			err  error
+		)
+		switch op.Method {
+		case http.MethodPost:
+			user, err = h.createUser(ctx, op.Data)
+		case http.MethodPut:
+			user, err = h.replaceUser(ctx, id, op.Data, op.Version)
+		case http.MethodPatch:
+			user, err = h.patchUser(ctx, id, op.Data, op.Version)
+		case http.MethodDelete:
+			return "", "", http.StatusNoContent, h.deleteUser(ctx, id, op.Version)
+		default:
+			return "", "", 0, scim.BadRequest(scim.ScimTypeInvalidSyntax, "unsupported bulk method %q", op.Method)
+		}
+		if err != nil {
+			return "", "", 0, err
+		}
+		if op.Method == http.MethodPost {
+			created[op.BulkID] = user.ID.String()
+			return h.renderer.UserLocation(user.ID.String()), scim.ETag(user.UpdatedAt), http.StatusCreated, nil
+		}
+		return h.renderer.UserLocation(user.ID.String()), scim.ETag(user.UpdatedAt), http.StatusOK, nil
+	}
+
+	var (
+		group *models.Group
+		err   error
+	)
+	switch op.Method {
+	case http.MethodPost:
+		group, err = h.createGroup(ctx, op.Data)
+	case http.MethodPut:
+		group, err = h.replaceGroup(ctx, id, op.Data, op.Version)
+	case http.MethodPatch:
+		group, err = h.patchGroup(ctx, id, op.Data, op.Version)
+	case http.MethodDelete:
+		return "", "", http.StatusNoContent, h.deleteGroup(ctx, id, op.Version)
+	default:
+		return "", "", 0, scim.BadRequest(scim.ScimTypeInvalidSyntax, "unsupported bulk method %q", op.Method)
+	}
+	if err != nil {
+		return "", "", 0, err
+	}
+	if op.Method == http.MethodPost {
+		created[op.BulkID] = group.ID.String()
+		return h.renderer.GroupLocation(group.ID.String()), scim.ETag(group.UpdatedAt), http.StatusCreated, nil
+	}
+	return h.renderer.GroupLocation(group.ID.String()), scim.ETag(group.UpdatedAt), http.StatusOK, nil
+}
+
+// Операции над пользователями
+
+func (h *SCIMHandler) createUser(ctx context.Context, body []byte) (*models.User, error) {
+	payload, err := parseUserPayload(body)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		Role:          repository.SCIMUserRole,
+		EmailVerified: true, // адрес подтвержден системой-источником
+	}
+	if err := applyUserPayload(user, payload); err != nil {
+		return nil, err
+	}
+	if err := h.setUserPassword(ctx, user, payload.Password); err != nil {
+		return nil, err
+	}
+	if err := h.checkUserUniqueness(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if err := h.userRepo.CreateUser(ctx, user); err != nil {
+		return nil, conflictOrError(err, "user")
+	}
+
+	logger.Info("User provisioned via SCIM", zap.String("user_id", user.ID.String()))
+	return h.reloadUser(ctx, user.ID)
+}
+
+func (h *SCIMHandler) replaceUser(ctx context.Context, id string, body []byte, ifMatch string) (*models.User, error) {
+	user, err := h.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !scim.MatchesETag(ifMatch, user.UpdatedAt) {
+		return nil, scim.PreconditionFailed()
+	}
+
+	payload, err := parseUserPayload(body)
+	if err != nil {
+		return nil, err
+	}
+
+	wasDisabled, previousHash := user.Disabled, user.Password
+	if err := applyUserPayload(user, payload); err != nil {
+		return nil, err
+	}
+	if payload.Password != "" {
+		if err := h.setUserPassword(ctx, user, payload.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	return h.saveUser(ctx, user, wasDisabled, previousHash)
+}
+
+func (h *SCIMHandler) patchUser(ctx context.Context, id string, body []byte, ifMatch string) (*models.User, error) {
+	user, err := h.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !scim.MatchesETag(ifMatch, user.UpdatedAt) {
+		return nil, scim.PreconditionFailed()
+	}
+
+	req, err := scim.ParsePatchRequest(body)
+	if err != nil {
+		return nil, err
+	}
+
+	wasDisabled, previousHash := user.Disabled, user.Password
+	for _, op := range req.Operations {
+		if err := h.patchUserAttribute(ctx, user, op.Op, op.Path, op.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	return h.saveUser(ctx, user, wasDisabled, previousHash)
+}
+
+func (h *SCIMHandler) deleteUser(ctx context.Context, id string, ifMatch string) error {
+	user, err := h.findUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !scim.MatchesETag(ifMatch, user.UpdatedAt) {
+		return scim.PreconditionFailed()
+	}
+
+	if err := h.userRepo.DeleteUser(ctx, user.ID); err != nil {
+		return err
+	}
+	h.revokeAccess(ctx, user.ID)
+
+	logger.Info("User deprovisioned via SCIM", zap.String("user_id", user.ID.String()))
+	return nil
+}
+
+// saveUser сохраняет изменения; при деактивации отзываются токены и сессии пользователя
+func (h *SCIMHandler) saveUser(ctx context.Context, user *models.User, wasDisabled bool, previousHash string) (*models.User, error) {
+	if err := h.checkUserUniqueness(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if err := h.userRepo.UpdateUser(ctx, user); err != nil {
+		return nil, conflictOrError(err, "user")
+	}
+	if user.Password != previousHash {
+		h.passwordValidator.Remember(ctx, user, previousHash)
+	}
+
+	if user.Disabled && !wasDisabled {
+		h.revokeAccess(ctx, user.ID)
+		logger.Info("User deactivated via SCIM", zap.String("user_id", user.ID.String()))
+	}
+
+	return h.reloadUser(ctx, user.ID)
+}
+
+// revokeAccess отзывает OAuth токены и сессии входа деактивированного или удаленного пользователя
+func (h *SCIMHandler) revokeAccess(ctx context.Context, userID uuid.UUID) {
+	if err := h.tokenRepo.RevokeTokensForUser(userID.String()); err != nil {
+		logger.Error("Failed to revoke tokens of deprovisioned user", zap.Error(err), zap.String("user_id", userID.String()))
+	}
+	if _, err := h.sessionRepo.RevokeUserSessions(ctx, userID, uuid.Nil); err != nil {
+		logger.Error("Failed to revoke sessions of deprovisioned user", zap.Error(err), zap.String("user_id", userID.String()))
+	}
+}
+
+func (h *SCIMHandler) checkUserUniqueness(ctx context.Context, user *models.User) error {
+	if existing, err := h.userRepo.GetUserByUsername(ctx, user.Username); err != nil {
+		return err
+	} else if existing != nil && existing.ID != user.ID {
+		return scim.Conflict("userName %q is already taken", user.Username)
+	}
+
+	if existing, err := h.userRepo.GetUserByEmail(ctx, user.Email); err != nil {
+		return err
+	} else if existing != nil && existing.ID != user.ID {
+		return scim.Conflict("email %q is already taken", user.Email)
+	}
+
+	if user.ExternalID != nil {
+		exists, err := h.scimRepo.UserExternalIDExists(ctx, *user.ExternalID, user.ID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return scim.Conflict("externalId %q is already taken", *user.ExternalID)
+		}
+	}
+	return nil
+}
+
+// findUser возвращает пользователя, которым управляет SCIM. Для администраторов ответ тот же,
+// что для несуществующего пользователя
+func (h *SCIMHandler) findUser(ctx context.Context, id string) (*models.User, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, scim.NotFound(scim.ResourceTypeUser, id)
+	}
+	user, err := h.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Role != repository.SCIMUserRole {
+		return nil, scim.NotFound(scim.ResourceTypeUser, id)
+	}
+	return user, nil
+}
+
+// reloadUser перечитывает пользователя, чтобы версия (ETag) совпадала с сохраненной в БД
+func (h *SCIMHandler) reloadUser(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	return h.findUser(ctx, id.String())
+}
+
+func (h *SCIMHandler) renderUser(ctx context.Context, user *models.User) (*scim.User, error) {
+	groups, err := h.scimRepo.GetGroupsForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return h.renderer.User(user, groups), nil
+}
+
+func parseUserPayload(body []byte) (*scim.User, error) {
+	var payload scim.User
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, scim.BadRequest(scim.ScimTypeInvalidSyntax, "invalid User resource")
+	}
+	if !scim.HasSchema(payload.Schemas, scim.SchemaUser) {
+		return nil, scim.BadRequest(scim.ScimTypeInvalidSyntax, "resource must use the %s schema", scim.SchemaUser)
+	}
+	return &payload, nil
+}
+
+// applyUserPayload заменяет атрибуты пользователя значениями ресурса (PUT и POST)
+func applyUserPayload(user *models.User, payload *scim.User) error {
+	if payload.UserName == "" {
+		return scim.BadRequest(scim.ScimTypeInvalidValue, "userName is required")
+	}
+	user.Username = payload.UserName
+
+	email := primaryEmail(payload.Emails)
+	if email == "" && strings.Contains(payload.UserName, "@") {
+		email = payload.UserName
+	}
+	if email == "" {
+		return scim.BadRequest(scim.ScimTypeInvalidValue, "emails is required")
+	}
+	user.Email = email
+
+	user.ExternalID = nil
+	if payload.ExternalID != "" {
+		user.ExternalID = &payload.ExternalID
+	}
+
+	user.GivenName, user.FamilyName = "", ""
+	if payload.Name != nil {
+		user.GivenName = payload.Name.GivenName
+		user.FamilyName = payload.Name.FamilyName
+	}
+	user.DisplayName = payload.DisplayName
+
+	user.Disabled = payload.Active != nil && !*payload.Active
+	return nil
+}
+
+// patchUserAttribute применяет одну операцию PATCH к пользователю. Операция без пути
+// содержит объект, каждое поле которого обрабатывается как отдельный путь
+func (h *SCIMHandler) patchUserAttribute(ctx context.Context, user *models.User, op, path string, value json.RawMessage) error {
+	if path == "" {
+		if op == "remove" {
+			return scim.BadRequest(scim.ScimTypeNoTarget, "remove requires a path")
+		}
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(value, &attrs); err != nil {
+			return scim.BadRequest(scim.ScimTypeInvalidValue, "value must be an object when path is omitted")
+		}
+		for attr, attrValue := range attrs {
+			if err := h.patchUserAttribute(ctx, user, op, attr, attrValue); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Атрибуты расширений схемы не хранятся и пропускаются
+	if isExtensionPath(path, scim.SchemaUser) {
+		return nil
+	}
+
+	p, err := scim.ParsePath(path, scim.SchemaUser)
+	if err != nil {
+		return err
+	}
+	remove := op == "remove"
+
+	switch p.Attr {
+	case "username":
+		if remove {
+			return scim.BadRequest(scim.ScimTypeMutability, "userName is required")
+		}
+		userName, err := scim.StringValue(value)
+		if err != nil || userName == "" {
+			return scim.BadRequest(scim.ScimTypeInvalidValue, "userName must be a non-empty string")
+		}
+		user.Username = userName
+
+	case "externalid":
+		user.ExternalID = nil
+		if !remove {
+			externalID, err := scim.StringValue(value)
+			if err != nil {
+				return err
+			}
+			if externalID != "" {
+				user.ExternalID = &externalID
+			}
+		}
+
+	case "displayname":
+		user.DisplayName = ""
+		if !remove {
+			if user.DisplayName, err = scim.StringValue(value); err != nil {
+				return err
+			}
+		}
+
+	case "active":
+		if remove {
+			return scim.BadRequest(scim.ScimTypeMutability, "active cannot be removed")
+		}
+		active, err := scim.BoolValue(value)
+		if err != nil {
+			return err
+		}
+		user.Disabled = !active
+
+	case "name":
+		return patchUserName(user, p.SubAttr, remove, value)
+
+	case "emails":
+		if remove {
+			return scim.BadRequest(scim.ScimTypeMutability, "emails is required")
+		}
+		// Хранится единственный адрес, фильтр по значению (emails[type eq "work"]) не сужает выбор
+		var email string
+		if p.SubAttr == "value" {
+			email, err = scim.StringValue(value)
+		} else {
+			var emails []scim.Email
+			if err = json.Unmarshal(value, &emails); err != nil {
+				err = scim.BadRequest(scim.ScimTypeInvalidValue, "emails must be a list")
+			}
+			email = primaryEmail(emails)
+		}
+		if err != nil {
+			return err
+		}
+		if email == "" {
+			return scim.BadRequest(scim.ScimTypeInvalidValue, "email value is required")
+		}
+		user.Email = email
+
+	case "password":
+		if remove {
+			return scim.BadRequest(scim.ScimTypeMutability, "password cannot be removed")
+		}
+		password, err := scim.StringValue(value)
+		if err != nil {
+			return err
+		}
+		return h.setUserPassword(ctx, user, password)
+
+	case "groups":
+		return scim.BadRequest(scim.ScimTypeMutability, "groups is read-only, update group membership instead")
+
+	default:
+		return scim.BadRequest(scim.ScimTypeInvalidPath, "unsupported attribute %q", path)
+	}
+	return nil
+}
+
+func patchUserName(user *models.User, subAttr string, remove bool, value json.RawMessage) error {
+	switch subAttr {
+	case "":
+		user.GivenName, user.FamilyName = "", ""
+		if remove {
+			return nil
+		}
+		var name scim.Name
+		if err := json.Unmarshal(value, &name); err != nil {
+			return scim.BadRequest(scim.ScimTypeInvalidValue, "name must be an object")
+		}
+		user.GivenName, user.FamilyName = name.GivenName, name.FamilyName
+	case "givenname", "familyname":
+		var v string
+		if !remove {
+			var err error
+			if v, err = scim.StringValue(value); err != nil {
+				return err
+			}
+		}
+		if subAttr == "givenname" {
+			user.GivenName = v
+		} else {
+			user.FamilyName = v
+		}
+	case "formatted":
+		return scim.BadRequest(scim.ScimTypeMutability, "name.formatted is read-only")
+	default:
+		return scim.BadRequest(scim.ScimTypeInvalidPath, "unsupported attribute name.%s", subAttr)
+	}
+	return nil
+}
+
+// setUserPassword проверяет пароль из SCIM той же политикой, что и смена пароля пользователем
+// (база утечек, требования роли, история), и хеширует его. Без пароля устанавливается
+// случайный, пользователь входит через SSO или восстановление пароля
+func (h *SCIMHandler) setUserPassword(ctx context.Context, user *models.User, password string) error {
+	if password != "" {
+		if err := h.passwordValidator.Validate(ctx, password, user); err != nil {
+			return scim.BadRequest(scim.ScimTypeInvalidValue, "%s", err.Error())
+		}
+	}
+	if password == "" {
+		random, err := utils.GenerateRandomString(32)
+		if err != nil {
+			return err
+		}
+		password = random
+	}
+
+	hashed, err := h.passwordHasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	user.Password = hashed
+	user.PasswordChangedAt = &now
+	return nil
+}
+
+func primaryEmail(emails []scim.Email) string {
+	for _, email := range emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
+
+// Операции над группами
+
+func (h *SCIMHandler) createGroup(ctx context.Context, body []byte) (*models.Group, error) {
+	payload, err := parseGroupPayload(body)
+	if err != nil {
+		return nil, err
+	}
+
+	group := &models.Group{}
+	if err := h.applyGroupPayload(ctx, group, payload); err != nil {
+		return nil, err
+	}
+
+	return h.saveGroup(ctx, group)
+}
+
+func (h *SCIMHandler) replaceGroup(ctx context.Context, id string, body []byte, ifMatch string) (*models.Group, error) {
+	group, err := h.findGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !scim.MatchesETag(ifMatch, group.UpdatedAt) {
+		return nil, scim.PreconditionFailed()
+	}
+
+	payload, err := parseGroupPayload(body)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.applyGroupPayload(ctx, group, payload); err != nil {
+		return nil, err
+	}
+
+	return h.saveGroup(ctx, group)
+}
+
+func (h *SCIMHandler) patchGroup(ctx context.Context, id string, body []byte, ifMatch string) (*models.Group, error) {
+	group, err := h.findGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !scim.MatchesETag(ifMatch, group.UpdatedAt) {
+		return nil, scim.PreconditionFailed()
+	}
+
+	req, err := scim.ParsePatchRequest(body)
+	if err != nil {
+		return nil, err
+	}
+
+	members := memberIDs(group.Members)
+	for _, op := range req.Operations {
+		if members, err = patchGroupAttribute(group, members, op.Op, op.Path, op.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	if group.Members, err = h.resolveMembers(ctx, members); err != nil {
+		return nil, err
+	}
+	return h.saveGroup(ctx, group)
+}
+
+func (h *SCIMHandler) deleteGroup(ctx context.Context, id string, ifMatch string) error {
+	group, err := h.findGroup(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !scim.MatchesETag(ifMatch, group.UpdatedAt) {
+		return scim.PreconditionFailed()
+	}
+	return h.scimRepo.DeleteGroup(ctx, group)
+}
+
+func (h *SCIMHandler) saveGroup(ctx context.Context, group *models.Group) (*models.Group, error) {
+	exists, err := h.scimRepo.GroupDisplayNameExists(ctx, group.DisplayName, group.ID)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, scim.Conflict("displayName %q is already taken", group.DisplayName)
+	}
+
+	if err := h.scimRepo.SaveGroup(ctx, group); err != nil {
+		return nil, conflictOrError(err, "group")
+	}
+	return h.findGroup(ctx, group.ID.String())
+}
+
+func (h *SCIMHandler) findGroup(ctx context.Context, id string) (*models.Group, error) {
+	groupID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, scim.NotFound(scim.ResourceTypeGroup, id)
+	}
+	group, err := h.scimRepo.GetGroup(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, scim.NotFound(scim.ResourceTypeGroup, id)
+	}
+	return group, nil
+}
+
+func parseGroupPayload(body []byte) (*scim.Group, error) {
+	var payload scim.Group
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, scim.BadRequest(scim.ScimTypeInvalidSyntax, "invalid Group resource")
+	}
+	if !scim.HasSchema(payload.Schemas, scim.SchemaGroup) {
+		return nil, scim.BadRequest(scim.ScimTypeInvalidSyntax, "resource must use the %s schema", scim.SchemaGroup)
+	}
+	if payload.DisplayName == "" {
+		return nil, scim.BadRequest(scim.ScimTypeInvalidValue, "displayName is required")
+	}
+	return &payload, nil
+}
+
+func (h *SCIMHandler) applyGroupPayload(ctx context.Context, group *models.Group, payload *scim.Group) error {
+	group.DisplayName = payload.DisplayName
+	group.ExternalID = nil
+	if payload.ExternalID != "" {
+		group.ExternalID = &payload.ExternalID
+	}
+
+	members := make([]string, 0, len(payload.Members))
+	for _, member := range payload.Members {
+		members = append(members, member.Value)
+	}
+
+	var err error
+	group.Members, err = h.resolveMembers(ctx, members)
+	return err
+}
+
+// patchGroupAttribute применяет операцию PATCH к группе, изменяя список идентификаторов участников
+func patchGroupAttribute(group *models.Group, members []string, op, path string, value json.RawMessage) ([]string, error) {
+	if path == "" {
+		if op == "remove" {
+			return nil, scim.BadRequest(scim.ScimTypeNoTarget, "remove requires a path")
+		}
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(value, &attrs); err != nil {
+			return nil, scim.BadRequest(scim.ScimTypeInvalidValue, "value must be an object when path is omitted")
+		}
+		for attr, attrValue := range attrs {
+			var err error
+			if members, err = patchGroupAttribute(group, members, op, attr, attrValue); err != nil {
+				return nil, err
+			}
+		}
+		return members, nil
+	}
+
+	p, err := scim.ParsePath(path, scim.SchemaGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.Attr {
+	case "displayname":
+		if op == "remove" {
+			return nil, scim.BadRequest(scim.ScimTypeMutability, "displayName is required")
+		}
+		displayName, err := scim.StringValue(value)
+		if err != nil || displayName == "" {
+			return nil, scim.BadRequest(scim.ScimTypeInvalidValue, "displayName must be a non-empty string")
+		}
+		group.DisplayName = displayName
+
+	case "externalid":
+		group.ExternalID = nil
+		if op != "remove" {
+			externalID, err := scim.StringValue(value)
+			if err != nil {
+				return nil, err
+			}
+			if externalID != "" {
+				group.ExternalID = &externalID
+			}
+		}
+
+	case "members":
+		return patchMembers(members, op, p, value)
+
+	default:
+		return nil, scim.BadRequest(scim.ScimTypeInvalidPath, "unsupported attribute %q", path)
+	}
+	return members, nil
+}
+
+func patchMembers(members []string, op string, p *scim.Path, value json.RawMessage) ([]string, error) {
+	switch op {
+	case "add":
+		values, err := scim.MemberValues(value)
+		if err != nil {
+			return nil, err
+		}
+		return appendUnique(members, values...), nil
+
+	case "replace":
+		values, err := scim.MemberValues(value)
+		if err != nil {
+			return nil, err
+		}
+		return appendUnique(nil, values...), nil
+	}
+
+	// remove: members[value eq "id"], список в value или все участники
+	var values []string
+	switch {
+	case p.Filter != nil:
+		var ok bool
+		if values, ok = scim.EqualValues(p.Filter, "members.value"); !ok {
+			return nil, scim.BadRequest(scim.ScimTypeInvalidPath, `only members[value eq "..."] filters are supported`)
+		}
+	case len(value) > 0 && string(value) != "null":
+		var err error
+		if values, err = scim.MemberValues(value); err != nil {
+			return nil, err
+		}
+	default:
+		return []string{}, nil
+	}
+
+	removed := make(map[string]bool, len(values))
+	for _, v := range values {
+		removed[strings.ToLower(v)] = true
+	}
+	result := make([]string, 0, len(members))
+	for _, m := range members {
+		if !removed[strings.ToLower(m)] {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+// resolveMembers загружает пользователей по идентификаторам участников
+func (h *SCIMHandler) resolveMembers(ctx context.Context, values []string) ([]models.User, error) {
+	ids := make([]uuid.UUID, 0, len(values))
+	for _, v := range appendUnique(nil, values...) {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return nil, scim.BadRequest(scim.ScimTypeInvalidValue, "member %q is not a known user", v)
+		}
+		ids = append(ids, id)
+	}
+
+	users, err := h.scimRepo.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) != len(ids) {
+		return nil, scim.BadRequest(scim.ScimTypeInvalidValue, "group members must reference existing users")
+	}
+	return users, nil
+}
+
+func memberIDs(users []models.User) []string {
+	ids := make([]string, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.ID.String())
+	}
+	return ids
+}
+
+func appendUnique(list []string, values ...string) []string {
+	seen := make(map[string]bool, len(list))
+	for _, v := range list {
+		seen[strings.ToLower(v)] = true
+	}
+	for _, v := range values {
+		if !seen[strings.ToLower(v)] {
+			seen[strings.ToLower(v)] = true
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// Вспомогательные функции
+
+// listQuery строит выборку по параметрам filter, startIndex, count, sortBy и sortOrder
+func listQuery(c *gin.Context, columns scim.ColumnMap, schema string) (repository.SCIMQuery, int, error) {
+	query := repository.SCIMQuery{Order: "created_at, id", Limit: scim.DefaultCount}
+
+	startIndex, err := strconv.Atoi(c.DefaultQuery("startIndex", "1"))
+	if err != nil {
+		return query, 0, scim.BadRequest(scim.ScimTypeInvalidValue, "startIndex must be an integer")
+	}
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	query.Offset = startIndex - 1
+
+	if raw := c.Query("count"); raw != "" {
+		count, err := strconv.Atoi(raw)
+		if err != nil {
+			return query, 0, scim.BadRequest(scim.ScimTypeInvalidValue, "count must be an integer")
+		}
+		query.Limit = min(max(count, 0), scim.MaxResults)
+	}
+
+	if raw := c.Query("filter"); raw != "" {
+		filter, err := scim.ParseFilter(raw)
+		if err != nil {
+			return query, 0, err
+		}
+		if query.Where, query.Args, err = scim.ToSQL(filter, columns, schema); err != nil {
+			return query, 0, err
+		}
+	}
+
+	if sortBy := c.Query("sortBy"); sortBy != "" {
+		col, ok := columns.Lookup(sortBy, schema)
+		if !ok || col.Wrap != "" {
+			return query, 0, scim.BadRequest(scim.ScimTypeInvalidValue, "sorting by %q is not supported", sortBy)
+		}
+		direction := "ASC"
+		if strings.EqualFold(c.Query("sortOrder"), "descending") {
+			direction = "DESC"
+		}
+		query.Order = col.Expr + " " + direction + ", id"
+	}
+
+	return query, startIndex, nil
+}
+
+func isExtensionPath(path, schema string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasPrefix(lower, "urn:") && !strings.HasPrefix(lower, strings.ToLower(schema)+":")
+}
+
+// conflictOrError превращает нарушение уникального индекса в ошибку uniqueness
+func conflictOrError(err error, resource string) error {
+	if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "23505") {
+		return scim.Conflict("%s already exists", resource)
+	}
+	return err
+}
+
+func (h *SCIMHandler) writeUser(c *gin.Context, status int, user *models.User) {
+	resource, err := h.renderUser(c.Request.Context(), user)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.Header("ETag", resource.Meta.Version)
+	if status == http.StatusCreated {
+		c.Header("Location", resource.Meta.Location)
+	}
+	h.write(c, status, resource)
+}
+
+func (h *SCIMHandler) writeGroup(c *gin.Context, status int, group *models.Group) {
+	resource := h.renderer.Group(group)
+	c.Header("ETag", resource.Meta.Version)
+	if status == http.StatusCreated {
+		c.Header("Location", resource.Meta.Location)
+	}
+	h.write(c, status, resource)
+}
+
+func (h *SCIMHandler) write(c *gin.Context, status int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.Data(status, scimContentType, data)
+}
+
+func (h *SCIMHandler) writeError(c *gin.Context, err error) {
+	scimErr := h.toSCIMError(err)
+	data, _ := json.Marshal(scimErr.Response())
+	c.Data(scimErr.Status, scimContentType, data)
+}
+
+func (h *SCIMHandler) toSCIMError(err error) *scim.Error {
+	var scimErr *scim.Error
+	if errors.As(err, &scimErr) {
+		return scimErr
+	}
+	logger.Error("SCIM request failed", zap.Error(err))
+	return scim.NewError(http.StatusInternalServerError, "", "internal server error")
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"jiko-auth/internal/repository"
+	"jiko-auth/pkg/logger"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+// SecurityHandler история входов и уведомления безопасности текущего пользователя
+type SecurityHandler struct {
+	securityRepo repository.SecurityRepository
+}
+
+func NewSecurityHandler(securityRepo repository.SecurityRepository) *SecurityHandler {
+	return &SecurityHandler{securityRepo: securityRepo}
+}
+
+// GetLoginHistory возвращает последние попытки входа текущего пользователя, ?limit= до 200
+func (h *SecurityHandler) GetLoginHistory(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	attempts, err := h.securityRepo.GetUserLoginHistory(c.Request.Context(), userID, queryLimit(c))
+	if err != nil {
+		logger.Error("Failed to get login history", zap.Error(err), zap.String("user_id", userID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get login history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attempts": attempts})
+}
+
+// GetNotifications возвращает уведомления безопасности текущего пользователя,
+// ?unread=true оставляет только непрочитанные
+func (h *SecurityHandler) GetNotifications(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	unreadOnly := c.Query("unread") == "true"
+
+	notifications, err := h.securityRepo.GetUserNotifications(ctx, userID, unreadOnly, queryLimit(c))
+	if err != nil {
+		logger.Error("Failed to get notifications", zap.Error(err), zap.String("user_id", userID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+
+	unread, err := h.securityRepo.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to count unread notifications", zap.Error(err), zap.String("user_id", userID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notifications": notifications, "unread": unread})
+}
+
+// MarkNotificationRead отмечает уведомление текущего пользователя прочитанным
+func (h *SecurityHandler) MarkNotificationRead(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	notificationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	marked, err := h.securityRepo.MarkNotificationAsRead(c.Request.Context(), userID, notificationID)
+	if err != nil {
+		logger.Error("Failed to mark notification as read", zap.Error(err), zap.String("notification_id", notificationID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+		return
+	}
+	if !marked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+// MarkAllNotificationsRead отмечает прочитанными все уведомления текущего пользователя
+func (h *SecurityHandler) MarkAllNotificationsRead(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	marked, err := h.securityRepo.MarkAllNotificationsAsRead(c.Request.Context(), userID)
+	if err != nil {
+		logger.Error("Failed to mark notifications as read", zap.Error(err), zap.String("user_id", userID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"marked": marked})
+}
+
+func queryLimit(c *gin.Context) int {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		return defaultHistoryLimit
+	}
+	return min(limit, maxHistoryLimit)
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/repository"
+	"jiko-auth/pkg/logger"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// SessionHandler просмотр и отзыв серверных сессий входа
+type SessionHandler struct {
+	sessionRepo repository.SessionRepository
+	userRepo    repository.UserRepository
+}
+
+func NewSessionHandler(sessionRepo repository.SessionRepository, userRepo repository.UserRepository) *SessionHandler {
+	return &SessionHandler{
+		sessionRepo: sessionRepo,
+		userRepo:    userRepo,
+	}
+}
+
+// ListSessions возвращает активные сессии текущего пользователя
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	h.listSessions(c, userID)
+}
+
+// RevokeSession отзывает одну из сессий текущего пользователя
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	h.revokeSession(c, userID, c.Param("id"))
+}
+
+// RevokeOtherSessions отзывает все сессии текущего пользователя, кроме той, которой выполнен запрос
+func (h *SessionHandler) RevokeOtherSessions(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	currentID, _ := uuid.Parse(c.GetString("session_id"))
+	h.revokeUserSessions(c, userID, currentID)
+}
+
+func (h *SessionHandler) AdminListUserSessions(c *gin.Context) {
+	user := h.findUser(c)
+	if user == nil {
+		return
+	}
+
+	h.listSessions(c, user.ID)
+}
+
+func (h *SessionHandler) AdminRevokeUserSession(c *gin.Context) {
+	user := h.findUser(c)
+	if user == nil {
+		return
+	}
+
+	h.revokeSession(c, user.ID, c.Param("session_id"))
+}
+
+func (h *SessionHandler) AdminRevokeUserSessions(c *gin.Context) {
+	user := h.findUser(c)
+	if user == nil {
+		return
+	}
+
+	h.revokeUserSessions(c, user.ID, uuid.Nil)
+}
+
+func (h *SessionHandler) listSessions(c *gin.Context, userID uuid.UUID) {
+	sessions, err := h.sessionRepo.GetUserSessions(c.Request.Context(), userID)
+	if err != nil {
+		logger.Error("Failed to get sessions", zap.Error(err), zap.String("user_id", userID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sessions"})
+		return
+	}
+
+	currentID := c.GetString("session_id")
+	for _, session := range sessions {
+		session.Current = session.ID.String() == currentID
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (h *SessionHandler) revokeSession(c *gin.Context, userID uuid.UUID, sessionIDStr string) {
+	sessionID, err := uuid.Parse(sessionIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	revoked, err := h.sessionRepo.RevokeSession(c.Request.Context(), userID, sessionID)
+	if err != nil {
+		logger.Error("Failed to revoke session", zap.Error(err), zap.String("session_id", sessionIDStr))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	logger.Info("Session revoked",
+		zap.String("session_id", sessionIDStr),
+		zap.String("user_id", userID.String()),
+		zap.String("revoked_by", c.GetString("user_id")))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+func (h *SessionHandler) revokeUserSessions(c *gin.Context, userID, exceptID uuid.UUID) {
+	count, err := h.sessionRepo.RevokeUserSessions(c.Request.Context(), userID, exceptID)
+	if err != nil {
+		logger.Error("Failed to revoke sessions", zap.Error(err), zap.String("user_id", userID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	logger.Info("Sessions revoked",
+		zap.String("user_id", userID.String()),
+		zap.Int64("count", count),
+		zap.String("revoked_by", c.GetString("user_id")))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "revoked": count})
+}
+
+// findUser находит пользователя из параметра :id и сам отвечает клиенту, если его нет
+func (h *SessionHandler) findUser(c *gin.Context) *models.User {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil
+	}
+
+	user, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		logger.Error("Failed to get user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return nil
+	}
+
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil
+	}
+
+	return user
+}
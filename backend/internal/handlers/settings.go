@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"jiko-auth/internal/config"
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/repository"
+	"jiko-auth/pkg/logger"
+	"jiko-auth/pkg/passwords"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// SettingsHandler настройки аутентификации, изменяемые администратором без перезапуска
+type SettingsHandler struct {
+	settingsRepo      repository.SettingsRepository
+	passwordValidator *passwords.Validator
+	cfg               *config.Config
+}
+
+func NewSettingsHandler(settingsRepo repository.SettingsRepository, passwordValidator *passwords.Validator, cfg *config.Config) *SettingsHandler {
+	return &SettingsHandler{
+		settingsRepo:      settingsRepo,
+		passwordValidator: passwordValidator,
+		cfg:               cfg,
+	}
+}
+
+// UpdateSettingsRequest не переданные поля остаются без изменений
+type UpdateSettingsRequest struct {
+	PasswordlessEnabled *bool `json:"passwordless_enabled"`
+}
+
+// GetSettings возвращает текущие настройки аутентификации
+func (h *SettingsHandler) GetSettings(c *gin.Context) {
+	h.respondSettings(c)
+}
+
+// UpdateSettings изменяет настройки аутентификации
+func (h *SettingsHandler) UpdateSettings(c *gin.Context) {
+	var req UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.PasswordlessEnabled != nil {
+		if err := h.settingsRepo.SetBool(c.Request.Context(), repository.SettingPasswordlessEnabled, *req.PasswordlessEnabled); err != nil {
+			logger.Error("Failed to update passwordless setting", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+			return
+		}
+		logger.Info("Passwordless login setting changed",
+			zap.Bool("enabled", *req.PasswordlessEnabled),
+			zap.String("admin_id", c.GetString("user_id")))
+	}
+
+	h.respondSettings(c)
+}
+
+func (h *SettingsHandler) respondSettings(c *gin.Context) {
+	passwordless, err := h.settingsRepo.GetBool(c.Request.Context(), repository.SettingPasswordlessEnabled, h.cfg.MagicLinkEnabled)
+	if err != nil {
+		logger.Error("Failed to get settings", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.AuthSettings{PasswordlessEnabled: passwordless})
+}
+
+// GetPasswordPolicy возвращает политику паролей по умолчанию и политики ролей
+func (h *SettingsHandler) GetPasswordPolicy(c *gin.Context) {
+	settings, err := h.passwordValidator.Settings(c.Request.Context())
+	if err != nil {
+		logger.Error("Failed to get password policy", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get password policy"})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdatePasswordPolicy заменяет политики паролей. Новые требования применяются при следующей
+// смене пароля, срок действия - при следующем входе
+func (h *SettingsHandler) UpdatePasswordPolicy(c *gin.Context) {
+	var req models.PasswordPolicySettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := passwords.CheckSettings(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.passwordValidator.UpdateSettings(c.Request.Context(), req); err != nil {
+		logger.Error("Failed to update password policy", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password policy"})
+		return
+	}
+	logger.Info("Password policy changed", zap.String("admin_id", c.GetString("user_id")))
+
+	c.JSON(http.StatusOK, req)
+}
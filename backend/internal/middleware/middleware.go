@@ -3,9 +3,9 @@ package middleware
 
 import (
 	"jiko-auth/pkg/jwt"
+	"jiko-auth/pkg/scim"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 
 	"jiko-auth/internal/repository"
@@ -39,7 +39,7 @@ func CORSMiddleware() gin.HandlerFunc {
 
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -50,7 +50,7 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
-func AuthMiddleware(jwtService *jwt.Service) gin.HandlerFunc {
+func AuthMiddleware(jwtService *jwt.Service, sessionRepo repository.SessionRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := extractTokenFromHeader(c)
 		if tokenString == "" {
@@ -66,8 +66,15 @@ func AuthMiddleware(jwtService *jwt.Service) gin.HandlerFunc {
 			return
 		}
 
+		if _, err := ValidateSession(c.Request.Context(), sessionRepo, claims.SessionID, claims.UserID); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session revoked or expired"})
+			c.Abort()
+			return
+		}
+
 		// Теперь правильно работаем со структурой Claims
 		c.Set("user_id", claims.UserID) // Используем поле структуры, а не map
+		c.Set("session_id", claims.SessionID)
 		if claims.Role != "" {
 			c.Set("user_role", claims.Role)
 		}
@@ -75,7 +82,7 @@ func AuthMiddleware(jwtService *jwt.Service) gin.HandlerFunc {
 	}
 }
 
-func AdminMiddleware(jwtService *jwt.Service) gin.HandlerFunc {
+func AdminMiddleware(jwtService *jwt.Service, sessionRepo repository.SessionRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := extractTokenFromHeader(c)
 		if tokenString == "" {
@@ -98,9 +105,16 @@ func AdminMiddleware(jwtService *jwt.Service) gin.HandlerFunc {
 			return
 		}
 
+		if _, err := ValidateSession(c.Request.Context(), sessionRepo, claims.SessionID, claims.UserID); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session revoked or expired"})
+			c.Abort()
+			return
+		}
+
 		// Сохраняем информацию о пользователе в контексте
 		c.Set("user_id", claims.UserID)
 		c.Set("user_role", claims.Role)
+		c.Set("session_id", claims.SessionID)
 		c.Next()
 	}
 }
@@ -145,7 +159,7 @@ func OAuthMiddleware(tokenRepo *repository.TokenRepository, userRepo repository.
 
 		// Получаем пользователя
 		user, err := userRepo.GetUserByID(c.Request.Context(), accessToken.UserID)
-		if err != nil || user == nil {
+		if err != nil || user == nil || user.Disabled {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			c.Abort()
 			return
@@ -158,15 +172,54 @@ func OAuthMiddleware(tokenRepo *repository.TokenRepository, userRepo repository.
 	}
 }
 
+// SCIMAuthMiddleware пропускает только bearer токены со scope scim, выпущенные
+// клиенту с флагом provisioning. Ошибки возвращаются в формате SCIM
+func SCIMAuthMiddleware(tokenRepo *repository.TokenRepository, clientRepo *repository.OAuthClientRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		abort := func(status int, detail string) {
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			c.AbortWithStatusJSON(status, scim.NewError(status, "", "%s", detail).Response())
+		}
+
+		tokenString := extractTokenFromHeader(c)
+		if tokenString == "" {
+			abort(http.StatusUnauthorized, "Authorization token required")
+			return
+		}
+
+		accessToken, err := tokenRepo.GetAccessToken(tokenString)
+		if err != nil || time.Now().After(accessToken.ExpiresAt) {
+			abort(http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+
+		if !strings.Contains(" "+accessToken.Scope+" ", " "+scim.Scope+" ") {
+			abort(http.StatusForbidden, "Token is not authorized for provisioning")
+			return
+		}
+
+		client, err := clientRepo.GetClient(accessToken.ClientID.String())
+		if err != nil || !client.Provisioning {
+			abort(http.StatusForbidden, "Client is not a provisioning client")
+			return
+		}
+
+		c.Set("client_id", client.ID.String())
+		c.Next()
+	}
+}
+
 // FlexibleAuthMiddleware проверяет авторизацию по JWT токену из заголовка или параметров
-// Подходит для OAuth flow где фронтенд передает токен через query params или Authorization header
-func FlexibleAuthMiddleware(jwtService *jwt.Service) gin.HandlerFunc {
+// Подходит для OAuth flow где фронтенд передает токен через query params или Authorization header.
+// При allowQueryToken=false (профиль OAuth 2.1) параметр access_token игнорируется
+func FlexibleAuthMiddleware(jwtService *jwt.Service, sessionRepo repository.SessionRepository, allowQueryToken bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var tokenString string
 
 		tokenString = extractTokenFromHeader(c)
-		if tokenString == "" {
+		if tokenString == "" && allowQueryToken {
 			tokenString = c.Query("access_token")
+			c.Set("token_from_query", tokenString != "")
 		}
 
 		if tokenString == "" {
@@ -182,79 +235,20 @@ func FlexibleAuthMiddleware(jwtService *jwt.Service) gin.HandlerFunc {
 			return
 		}
 
+		// Токен отозванной сессии равносилен отсутствию авторизации
+		if _, err := ValidateSession(c.Request.Context(), sessionRepo, claims.SessionID, claims.UserID); err != nil {
+			c.Set("authenticated", false)
+			c.Next()
+			return
+		}
+
 		// Работаем со структурой Claims
 		c.Set("user_id", claims.UserID)
 		if claims.Role != "" {
 			c.Set("user_role", claims.Role)
 		}
+		c.Set("session_id", claims.SessionID)
 		c.Set("authenticated", true)
 		c.Next()
 	}
 }
-
-type visitor struct {
-	lastSeen time.Time
-	count    int
-}
-
-type RateLimiter struct {
-	visitors map[string]*visitor
-	mu       sync.RWMutex
-	rate     time.Duration
-	limit    int
-}
-
-func NewRateLimiter(rate time.Duration, limit int) *RateLimiter {
-	rl := &RateLimiter{
-		visitors: make(map[string]*visitor),
-		rate:     rate,
-		limit:    limit,
-	}
-
-	go rl.cleanup()
-	return rl
-}
-
-func (rl *RateLimiter) cleanup() {
-	ticker := time.NewTicker(time.Minute)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		rl.mu.Lock()
-		for ip, v := range rl.visitors {
-			if time.Since(v.lastSeen) > rl.rate {
-				delete(rl.visitors, ip)
-			}
-		}
-		rl.mu.Unlock()
-	}
-}
-
-func (rl *RateLimiter) Allow(ip string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	now := time.Now()
-	v, exists := rl.visitors[ip]
-
-	if !exists {
-		rl.visitors[ip] = &visitor{
-			lastSeen: now,
-			count:    1,
-		}
-		return true
-	}
-
-	if now.Sub(v.lastSeen) > rl.rate {
-		v.lastSeen = now
-		v.count = 1
-		return true
-	}
-
-	if v.count >= rl.limit {
-		return false
-	}
-
-	v.count++
-	return true
-}
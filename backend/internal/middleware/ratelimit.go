@@ -0,0 +1,258 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"jiko-auth/internal/repository"
+	"jiko-auth/pkg/logger"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RateLimitStore хранилище скользящих окон. Для нескольких реплик используется
+// repository.RateLimitRepository, MemoryRateLimitStore подходит только для одного процесса
+type RateLimitStore interface {
+	Hit(ctx context.Context, key string, limit int, window time.Duration) (*repository.RateLimitResult, error)
+	Cleanup(ctx context.Context, before time.Time) error
+}
+
+// RateLimitKey извлекает из запроса ключ учета; пустая строка означает, что ключ неприменим
+type RateLimitKey func(c *gin.Context) string
+
+// RateLimitPolicy именованная политика: не более Limit запросов за Window по каждому из ключей.
+// Политика с Limit <= 0 отключена
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	Keys   []RateLimitKey
+}
+
+type RateLimiter struct {
+	store    RateLimitStore
+	policies map[string]RateLimitPolicy
+}
+
+func NewRateLimiter(store RateLimitStore, policies ...RateLimitPolicy) *RateLimiter {
+	rl := &RateLimiter{
+		store:    store,
+		policies: make(map[string]RateLimitPolicy, len(policies)),
+	}
+
+	var maxWindow time.Duration
+	for _, policy := range policies {
+		rl.policies[policy.Name] = policy
+		if policy.Window > maxWindow {
+			maxWindow = policy.Window
+		}
+	}
+
+	go rl.cleanup(maxWindow)
+	return rl
+}
+
+func (rl *RateLimiter) cleanup(maxWindow time.Duration) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := rl.store.Cleanup(context.Background(), time.Now().Add(-maxWindow)); err != nil {
+			logger.Warn("Failed to clean up rate limit windows", zap.Error(err))
+		}
+	}
+}
+
+// Limit возвращает middleware политики name. Ответ содержит заголовки RateLimit-*,
+// при превышении лимита - 429 и Retry-After
+func (rl *RateLimiter) Limit(name string) gin.HandlerFunc {
+	policy, ok := rl.policies[name]
+	if !ok {
+		panic("unknown rate limit policy: " + name)
+	}
+	if policy.Limit <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		var tightest *repository.RateLimitResult
+		for _, keyFunc := range policy.Keys {
+			key := keyFunc(c)
+			if key == "" {
+				continue
+			}
+
+			result, err := rl.store.Hit(c.Request.Context(), policy.Name+":"+key, policy.Limit, policy.Window)
+			if err != nil {
+				// Недоступность хранилища не должна останавливать вход
+				logger.Warn("Rate limit check failed", zap.Error(err), zap.String("policy", policy.Name))
+				continue
+			}
+
+			if !result.Allowed {
+				retryAfter := setRateLimitHeaders(c, policy, result)
+				c.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+				logger.Warn("Rate limit exceeded",
+					zap.String("policy", policy.Name),
+					zap.String("ip", c.ClientIP()),
+					zap.String("path", c.FullPath()))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many requests, please try again later"})
+				return
+			}
+
+			if tightest == nil || result.Remaining < tightest.Remaining {
+				tightest = result
+			}
+		}
+
+		if tightest != nil {
+			setRateLimitHeaders(c, policy, tightest)
+		}
+		c.Next()
+	}
+}
+
+// setRateLimitHeaders выставляет заголовки RateLimit-* и возвращает секунды до освобождения места
+func setRateLimitHeaders(c *gin.Context, policy RateLimitPolicy, result *repository.RateLimitResult) int {
+	reset := int(math.Ceil(time.Until(result.ResetAt).Seconds()))
+	if reset < 0 {
+		reset = 0
+	}
+
+	c.Header("RateLimit-Limit", strconv.Itoa(policy.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(reset))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Window.Seconds())))
+	return reset
+}
+
+// KeyByIP учитывает запросы по IP адресу клиента
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByUser учитывает запросы по аутентифицированному пользователю
+func KeyByUser(c *gin.Context) string {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		return ""
+	}
+	return "user:" + userID
+}
+
+// ClientSecretValidator проверяет секрет OAuth клиента
+type ClientSecretValidator func(clientID, clientSecret string) (bool, error)
+
+// KeyByAuthenticatedClient учитывает запросы по client_id из формы или Basic авторизации,
+// но только если секрет клиента верен. Иначе чужой client_id позволял бы исчерпать лимит
+// настоящего клиента, а смена client_id - обходить лимит, поэтому такие политики всегда
+// сочетаются с KeyByIP
+func KeyByAuthenticatedClient(validate ClientSecretValidator) RateLimitKey {
+	return func(c *gin.Context) string {
+		clientID, clientSecret, ok := c.Request.BasicAuth()
+		if !ok {
+			clientID, clientSecret = c.PostForm("client_id"), c.PostForm("client_secret")
+		}
+		if clientID == "" || clientSecret == "" {
+			return ""
+		}
+		if valid, err := validate(clientID, clientSecret); err != nil || !valid {
+			return ""
+		}
+		return "client:" + clientID
+	}
+}
+
+// KeyByAccount учитывает запросы по идентификатору учетной записи из первого
+// заполненного поля JSON тела. Тело восстанавливается для обработчика
+func KeyByAccount(fields ...string) RateLimitKey {
+	return func(c *gin.Context) string {
+		body, err := c.GetRawData()
+		if err != nil {
+			return ""
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return ""
+		}
+
+		for _, field := range fields {
+			if value, ok := payload[field].(string); ok && strings.TrimSpace(value) != "" {
+				return "account:" + strings.ToLower(strings.TrimSpace(value))
+			}
+		}
+		return ""
+	}
+}
+
+// KeyByIPAndAccount учитывает запросы по паре IP адреса и учетной записи из полей JSON тела.
+// Подходит для восстановления доступа: лимит по одной учетной записи позволял бы любому
+// исчерпать его и не дать владельцу восстановить доступ
+func KeyByIPAndAccount(fields ...string) RateLimitKey {
+	byAccount := KeyByAccount(fields...)
+	return func(c *gin.Context) string {
+		account := byAccount(c)
+		if account == "" {
+			return ""
+		}
+		return KeyByIP(c) + ":" + account
+	}
+}
+
+// MemoryRateLimitStore скользящие окна в памяти процесса
+type MemoryRateLimitStore struct {
+	mu   sync.Mutex
+	hits map[string][]time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{hits: make(map[string][]time.Time)}
+}
+
+func (s *MemoryRateLimitStore) Hit(_ context.Context, key string, limit int, window time.Duration) (*repository.RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	windowStart := now.Add(-window)
+	hits := s.hits[key]
+	for len(hits) > 0 && !hits[0].After(windowStart) {
+		hits = hits[1:]
+	}
+
+	if len(hits) >= limit {
+		s.hits[key] = hits
+		return &repository.RateLimitResult{ResetAt: hits[0].Add(window)}, nil
+	}
+
+	hits = append(hits, now)
+	s.hits[key] = hits
+	return &repository.RateLimitResult{
+		Allowed:   true,
+		Remaining: limit - len(hits),
+		ResetAt:   hits[0].Add(window),
+	}, nil
+}
+
+func (s *MemoryRateLimitStore) Cleanup(_ context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, hits := range s.hits {
+		if len(hits) == 0 || hits[len(hits)-1].Before(before) {
+			delete(s.hits, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/repository"
+	"jiko-auth/pkg/logger"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var ErrSessionInactive = errors.New("session revoked or expired")
+
+// ValidateSession проверяет, что сессия из claim sid активна и принадлежит владельцу токена.
+// Токены без sid и ошибки БД считаются недействительными
+func ValidateSession(ctx context.Context, sessionRepo repository.SessionRepository, sessionID, userID string) (*models.Session, error) {
+	id, err := uuid.Parse(sessionID)
+	if err != nil {
+		return nil, ErrSessionInactive
+	}
+
+	session, err := sessionRepo.GetSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if session == nil || session.UserID.String() != userID || !session.IsActive(now) {
+		return nil, ErrSessionInactive
+	}
+
+	if err := sessionRepo.TouchSession(ctx, session.ID, now); err != nil {
+		logger.Warn("Failed to update session activity", zap.Error(err), zap.String("session_id", sessionID))
+	}
+
+	return session, nil
+}
@@ -17,27 +17,73 @@ type User struct {
 	EmailVerificationToken  *string        `gorm:"type:varchar(255)" json:"-"`
 	EmailVerificationSentAt time.Time      `json:"-"`
 	Role                    string         `gorm:"type:varchar(50);default:'user'" json:"role"`
+	ExternalID              *string        `gorm:"type:varchar(255);uniqueIndex" json:"external_id,omitempty"` // идентификатор во внешней системе (SCIM)
+	GivenName               string         `gorm:"type:varchar(255)" json:"given_name,omitempty"`
+	FamilyName              string         `gorm:"type:varchar(255)" json:"family_name,omitempty"`
+	DisplayName             string         `gorm:"type:varchar(255)" json:"display_name,omitempty"`
+	Disabled                bool           `gorm:"default:false" json:"disabled"` // деактивирован через SCIM, вход запрещен
 	LastLogin               *time.Time     `json:"last_login,omitempty"`
 	LoginAttempts           int            `gorm:"default:0" json:"-"`
 	LockedUntil             *time.Time     `json:"-"`
+	SecurityLockedAt        *time.Time     `json:"security_locked_at,omitempty"` // заблокирован владельцем по ссылке отмены смены email, снимается сбросом пароля
+	PasswordChangedAt       *time.Time     `json:"password_changed_at,omitempty"`
 	CreatedAt               time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt               time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 	DeletedAt               gorm.DeletedAt `gorm:"index" json:"-"`
 }
+
+const (
+	ClientTypeConfidential = "confidential"
+	ClientTypePublic       = "public"
+)
+
+// OAuthClient хранит только HMAC-хеш секрета. После ротации предыдущий
+// секрет остается действительным до PreviousSecretExpiresAt.
+// У публичных клиентов (SPA, нативные приложения) секрета нет
 type OAuthClient struct {
-	ID           uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
-	UserID       uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
-	Name         string    `gorm:"type:varchar(255);not null" json:"name"`
-	Secret       string    `gorm:"type:varchar(255);not null" json:"secret"`
-	RedirectURIs string    `gorm:"type:text" json:"redirect_uris"`
-	Grants       string    `gorm:"type:text" json:"grants"`
-	Scope        string    `gorm:"type:varchar(500)" json:"scope"`
-	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID                      uuid.UUID   `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	UserID                  uuid.UUID   `gorm:"type:uuid;not null" json:"user_id"`
+	Name                    string      `gorm:"type:varchar(255);not null" json:"name"`
+	ClientType              string      `gorm:"type:varchar(20);default:'confidential'" json:"client_type"`
+	OAuth21Profile          bool        `gorm:"default:false" json:"oauth21_profile"` // строгий профиль OAuth 2.1 для клиента
+	Secret                  string      `gorm:"type:varchar(255);not null" json:"-"`
+	PreviousSecret          string      `gorm:"type:varchar(255)" json:"-"`
+	PreviousSecretExpiresAt *time.Time  `json:"previous_secret_expires_at,omitempty"`
+	SecretRotatedAt         *time.Time  `json:"secret_rotated_at,omitempty"`
+	RedirectURIs            string      `gorm:"type:text" json:"redirect_uris"`
+	AllowWildcardRedirects  bool        `gorm:"default:false" json:"allow_wildcard_redirects"` // включается только администратором
+	Provisioning            bool        `gorm:"default:false" json:"provisioning"`             // клиент для SCIM provisioning
+	Grants                  string      `gorm:"type:text" json:"grants"`
+	Scope                   string      `gorm:"type:varchar(500)" json:"scope"`
+	TokenPolicy             TokenPolicy `gorm:"embedded;embeddedPrefix:policy_" json:"token_policy"`
+	CreatedAt               time.Time   `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt               time.Time   `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TokenPolicy задает сроки жизни токенов клиента в секундах.
+// Незаданное (nil) поле означает значение по умолчанию из конфигурации
+type TokenPolicy struct {
+	CodeTTL            *int  `json:"code_ttl"`
+	AccessTokenTTL     *int  `json:"access_token_ttl"`
+	RefreshIdleTTL     *int  `json:"refresh_idle_ttl"`
+	RefreshAbsoluteTTL *int  `json:"refresh_absolute_ttl"`
+	IDTokenTTL         *int  `json:"id_token_ttl"`
+	IssueRefreshTokens *bool `json:"issue_refresh_tokens"`
+}
+
+func (c *OAuthClient) IsPublic() bool {
+	return c.ClientType == ClientTypePublic
+}
+
+// OAuthClientWithSecret возвращается один раз при создании клиента или ротации секрета
+type OAuthClientWithSecret struct {
+	*OAuthClient
+	Secret string `json:"secret"`
 }
 
+// AuthorizationCode хранит HMAC-хеш кода, сам код в БД не сохраняется
 type AuthorizationCode struct {
-	Code                string    `gorm:"type:varchar(255);primaryKey" json:"code"`
+	Code                string    `gorm:"type:varchar(255);primaryKey" json:"-"`
 	ClientID            uuid.UUID `gorm:"type:uuid;not null" json:"client_id"`
 	UserID              uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
 	RedirectURI         string    `gorm:"type:text" json:"redirect_uri"`
@@ -48,25 +94,238 @@ type AuthorizationCode struct {
 	CodeChallenge       string    `gorm:"type:text" json:"codeChallenge"`
 	CodeChallengeMethod string    `gorm:"type:text" json:"codeChallengeMethod"`
 	Nonce               string    `gorm:"type:varchar(255)" json:"nonce"`
+	Resources           string    `gorm:"type:text" json:"resources"` // JSON список resource indicators (RFC 8707)
 }
 
+// AccessToken хранит HMAC-хеш токена и короткий префикс для идентификации
 type AccessToken struct {
-	Token     string    `gorm:"type:varchar(255);primaryKey" json:"token"`
-	ClientID  uuid.UUID `gorm:"type:uuid;not null" json:"client_id"`
-	UserID    uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
-	Scope     string    `gorm:"type:varchar(500)" json:"scope"`
-	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	Token       string    `gorm:"type:varchar(255);primaryKey" json:"-"`
+	TokenPrefix string    `gorm:"type:varchar(16)" json:"token_prefix"`
+	ClientID    uuid.UUID `gorm:"type:uuid;not null" json:"client_id"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
+	Scope       string    `gorm:"type:varchar(500)" json:"scope"`
+	Audience    string    `gorm:"type:text" json:"audience"` // JSON список ресурсов, для которых выпущен токен
+	ExpiresAt   time.Time `gorm:"not null" json:"expires_at"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
 
+// RefreshToken хранит HMAC-хеши refresh токена и связанного access токена
 type RefreshToken struct {
-	Token       string    `gorm:"type:varchar(255);primaryKey" json:"token"`
-	AccessToken string    `gorm:"type:varchar(255)" json:"access_token"`
+	Token       string    `gorm:"type:varchar(255);primaryKey" json:"-"`
+	TokenPrefix string    `gorm:"type:varchar(16)" json:"token_prefix"`
+	AccessToken string    `gorm:"type:varchar(255)" json:"-"`
 	ClientID    uuid.UUID `gorm:"type:uuid;not null" json:"client_id"`
 	UserID      uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
 	Scope       string    `gorm:"type:varchar(500)" json:"scope"`
-	ExpiresAt   time.Time `gorm:"not null" json:"expires_at"`
-	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	Resources   string    `gorm:"type:text" json:"resources"` // JSON список ресурсов, на которые выдано согласие
+	Revoked     bool      `gorm:"default:false" json:"revoked"`
+	ExpiresAt   time.Time `gorm:"not null" json:"expires_at"` // истечение по неактивности, продлевается при использовании
+	// AbsoluteExpiresAt предельный срок жизни цепочки refresh токенов
+	AbsoluteExpiresAt *time.Time `json:"absolute_expires_at,omitempty"`
+	CreatedAt         time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Session серверная сессия входа в приложение. Идентификатор передается в claim sid JWT,
+// отозванная или истекшая сессия делает недействительными все выданные для нее токены
+type Session struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Device     string     `gorm:"type:varchar(255)" json:"device"` // например "Chrome on Windows"
+	UserAgent  string     `gorm:"type:text" json:"user_agent"`
+	IPAddress  string     `gorm:"type:varchar(45)" json:"ip_address"`
+	DeviceID   *uuid.UUID `gorm:"type:uuid;index" json:"device_id,omitempty"`
+	RefreshJTI string     `gorm:"type:varchar(36)" json:"-"`  // jti последнего выданного refresh токена
+	AMR        string     `gorm:"type:varchar(100)" json:"-"` // JSON список методов входа (RFC 8176), переносится в токены
+	LastSeenAt time.Time  `gorm:"not null" json:"last_seen_at"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"` // продлевается при ротации refresh токена
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	Current    bool       `gorm:"-" json:"current"` // сессия, которой выполнен запрос
+}
+
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// TOTPCredential секрет приложения-аутентификатора (RFC 6238). Секрет хранится зашифрованным,
+// до подтверждения кодом MFA не действует
+type TOTPCredential struct {
+	UserID       uuid.UUID  `gorm:"type:uuid;primaryKey" json:"user_id"`
+	Secret       string     `gorm:"type:text;not null" json:"-"`
+	Confirmed    bool       `gorm:"default:false" json:"confirmed"`
+	LastUsedStep int64      `gorm:"default:0" json:"-"` // интервал последнего принятого кода, защита от повтора
+	ConfirmedAt  *time.Time `json:"confirmed_at,omitempty"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// MFAChallenge второй шаг входа: выдается после проверки пароля и гасится после
+// проверки второго фактора. Число попыток ограничено
+type MFAChallenge struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Attempts    int        `gorm:"default:0" json:"attempts"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Challenge   string     `gorm:"type:varchar(64)" json:"-"` // challenge WebAuthn, если второй фактор - ключ
+	AMR         string     `gorm:"type:varchar(20)" json:"-"` // первый фактор входа: pwd или email
+	CodeHash    string     `gorm:"type:varchar(64)" json:"-"` // код из письма, если вход подтверждается по почте
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type MFAStatusResponse struct {
+	TOTPEnabled         bool       `json:"totp_enabled"`
+	ConfirmedAt         *time.Time `json:"totp_confirmed_at,omitempty"`
+	WebAuthnCredentials int64      `json:"webauthn_credentials"`
+	RecoveryCodes       int64      `json:"recovery_codes_remaining"` // неиспользованные коды восстановления
+}
+
+// RecoveryCode одноразовый код для входа при потере второго фактора. Хранится только хеш кода
+type RecoveryCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"type:varchar(64);not null;index" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// WebAuthnCredential ключ WebAuthn пользователя: passkey для входа без пароля или второй фактор.
+// ID ключа и открытый ключ COSE получены при регистрации
+type WebAuthnCredential struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID         uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	CredentialID   string     `gorm:"type:varchar(1400);uniqueIndex;not null" json:"credential_id"` // base64url
+	PublicKey      []byte     `gorm:"type:bytea;not null" json:"-"`
+	Algorithm      int64      `gorm:"not null" json:"algorithm"`
+	SignCount      int64      `gorm:"default:0" json:"sign_count"`
+	Name           string     `gorm:"type:varchar(100);not null" json:"name"`
+	AAGUID         string     `gorm:"type:varchar(36)" json:"aaguid"`
+	Transports     string     `gorm:"type:varchar(255)" json:"-"`           // JSON список транспортов для allowCredentials
+	BackupEligible bool       `gorm:"default:false" json:"backup_eligible"` // синхронизируемый passkey, а не аппаратный ключ
+	BackupState    bool       `gorm:"default:false" json:"backup_state"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// WebAuthnCeremony challenge регистрации ключа или входа по ключу, гасится при завершении церемонии
+type WebAuthnCeremony struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID    *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"` // пусто при входе по passkey
+	Purpose   string     `gorm:"type:varchar(20);not null" json:"purpose"`
+	Challenge string     `gorm:"type:varchar(64);not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// PasswordlessLogin запрос входа без пароля: ссылка и 6-значный код из письма. Хранятся только
+// хеши; BrowserHash привязывает запрос к браузеру, из которого он отправлен
+type PasswordlessLogin struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID      *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"` // пусто для неизвестного адреса
+	Email       string     `gorm:"type:varchar(255);not null;index" json:"email"`
+	TokenHash   string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	CodeHash    string     `gorm:"type:varchar(64);not null" json:"-"`
+	BrowserHash string     `gorm:"type:varchar(64);not null" json:"-"`
+	Attempts    int        `gorm:"default:0" json:"attempts"`
+	IPAddress   string     `gorm:"type:varchar(45)" json:"ip_address"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	ConsumedAt  *time.Time `json:"consumed_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// PasswordResetToken одноразовый токен сброса пароля из письма, хранится только хеш
+type PasswordResetToken struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	TokenHash string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	IPAddress string     `gorm:"type:varchar(45)" json:"ip_address"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// AccountUnlockToken одноразовая ссылка из письма о блокировке после неудачных попыток входа
+type AccountUnlockToken struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	TokenHash string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// RateLimitHit запрос, учтенный ограничителем частоты. Ключ хранится в виде хеша,
+// чтобы в таблице не оседали адреса и идентификаторы учетных записей
+type RateLimitHit struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement"`
+	KeyHash   string    `gorm:"type:varchar(64);not null;index:idx_rate_limit_hits_key_created,priority:1"`
+	CreatedAt time.Time `gorm:"not null;index:idx_rate_limit_hits_key_created,priority:2;index"`
+}
+
+// EmailChangeRequest смена email пользователем. Новый адрес подтверждается ссылкой из письма,
+// на старый приходит ссылка отмены, которая возвращает адрес и блокирует учетную запись
+type EmailChangeRequest struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID          uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	OldEmail        string     `gorm:"type:varchar(255);not null" json:"old_email"`
+	NewEmail        string     `gorm:"type:varchar(255);not null" json:"new_email"`
+	TokenHash       string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	CancelTokenHash string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	ExpiresAt       time.Time  `gorm:"not null" json:"expires_at"`
+	CancelExpiresAt time.Time  `gorm:"not null" json:"cancel_expires_at"`
+	ConfirmedAt     *time.Time `json:"confirmed_at,omitempty"`
+	CancelledAt     *time.Time `json:"cancelled_at,omitempty"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Setting параметр, который администратор меняет без перезапуска сервиса
+type Setting struct {
+	Key       string    `gorm:"type:varchar(100);primaryKey" json:"key"`
+	Value     string    `gorm:"type:text;not null" json:"value"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// AuthSettings настройки методов входа в админ API
+type AuthSettings struct {
+	PasswordlessEnabled bool `json:"passwordless_enabled"`
+}
+
+// PasswordPolicy требования к новым паролям
+type PasswordPolicy struct {
+	MinLength        int  `json:"min_length"`
+	RequireUpper     bool `json:"require_upper"`
+	RequireLower     bool `json:"require_lower"`
+	RequireNumber    bool `json:"require_number"`
+	RequireSpecial   bool `json:"require_special"`
+	MinScore         int  `json:"min_score"`         // минимальный балл оценки стойкости 0-4, 0 - без проверки
+	DisallowIdentity bool `json:"disallow_identity"` // пароль не может содержать имя пользователя или email
+	HistorySize      int  `json:"history_size"`      // сколько последних паролей нельзя использовать повторно
+	MaxAgeDays       int  `json:"max_age_days"`      // срок действия пароля, 0 - бессрочно
+}
+
+// PasswordPolicySettings политика по умолчанию и политики отдельных ролей
+type PasswordPolicySettings struct {
+	Default PasswordPolicy            `json:"default"`
+	Roles   map[string]PasswordPolicy `json:"roles,omitempty"`
+}
+
+// PasswordHistory прежние хеши паролей пользователя для запрета повторного использования
+type PasswordHistory struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	UserID       uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	PasswordHash string    `gorm:"type:varchar(255);not null" json:"-"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// ProtectedResource описывает защищаемый API (resource server) и разрешенные для него scope
+type ProtectedResource struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	URI       string    `gorm:"type:varchar(500);uniqueIndex;not null" json:"uri"`
+	Name      string    `gorm:"type:varchar(255);not null" json:"name"`
+	Scopes    string    `gorm:"type:text" json:"scopes"` // JSON список разрешенных scope
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 // Admin DTOs for API responses
@@ -77,35 +336,119 @@ type AdminUserResponse struct {
 	EmailVerified bool       `json:"email_verified"`
 	Role          string     `json:"role"`
 	LastLogin     *time.Time `json:"last_login"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
 	CreatedAt     time.Time  `json:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at"`
 }
 
+// Group группа пользователей, управляемая через SCIM
+type Group struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	DisplayName string    `gorm:"type:varchar(255);uniqueIndex;not null" json:"display_name"`
+	ExternalID  *string   `gorm:"type:varchar(255);uniqueIndex" json:"external_id,omitempty"`
+	Members     []User    `gorm:"many2many:group_members" json:"members,omitempty"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+const (
+	NameIDFormatEmail       = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormatPersistent  = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	NameIDFormatUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+)
+
+// SAMLServiceProvider зарегистрированный SAML Service Provider. AttributeMapping хранит
+// JSON объект "имя SAML атрибута" -> "поле пользователя" (id, username, email, email_verified, role)
+type SAMLServiceProvider struct {
+	ID               uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	EntityID         string    `gorm:"type:varchar(500);uniqueIndex;not null" json:"entity_id"`
+	Name             string    `gorm:"type:varchar(255);not null" json:"name"`
+	ACSURL           string    `gorm:"type:varchar(500);not null" json:"acs_url"`
+	NameIDFormat     string    `gorm:"type:varchar(255);not null" json:"name_id_format"`
+	AttributeMapping string    `gorm:"type:text" json:"attribute_mapping"`
+	CreatedAt        time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt        time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type AdminSAMLServiceProviderRequest struct {
+	EntityID         string            `json:"entity_id" binding:"required"`
+	Name             string            `json:"name" binding:"required"`
+	ACSURL           string            `json:"acs_url" binding:"required,url"`
+	NameIDFormat     string            `json:"name_id_format"`
+	AttributeMapping map[string]string `json:"attribute_mapping"`
+}
+
+type AdminSAMLServiceProviderResponse struct {
+	ID               uuid.UUID         `json:"id"`
+	EntityID         string            `json:"entity_id"`
+	Name             string            `json:"name"`
+	ACSURL           string            `json:"acs_url"`
+	NameIDFormat     string            `json:"name_id_format"`
+	AttributeMapping map[string]string `json:"attribute_mapping"`
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+}
+
 type AdminClientResponse struct {
-	ID           uuid.UUID `json:"id"`
-	UserID       uuid.UUID `json:"user_id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	Name         string    `json:"name"`
-	RedirectURIs []string  `json:"redirect_uris"`
-	Grants       []string  `json:"grants"`
-	Scope        string    `json:"scope"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID             uuid.UUID `json:"id"`
+	UserID         uuid.UUID `json:"user_id"`
+	Username       string    `json:"username"`
+	Email          string    `json:"email"`
+	Name           string    `json:"name"`
+	ClientType     string    `json:"client_type"`
+	OAuth21Profile bool      `json:"oauth21_profile"`
+	RedirectURIs   []string  `json:"redirect_uris"`
+	WildcardURIs   bool      `json:"allow_wildcard_redirects"`
+	Provisioning   bool      `json:"provisioning"`
+	Grants         []string  `json:"grants"`
+	Scope          string    `json:"scope"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type AdminTokenResponse struct {
+	TokenPrefix string    `json:"token_prefix"`
+	ClientID    uuid.UUID `json:"client_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	Scope       string    `json:"scope"`
+	Audience    []string  `json:"audience"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 // Admin request structures
 type AdminCreateUserRequest struct {
 	Username string `json:"username" binding:"required,min=3"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Password string `json:"password" binding:"required"`
 	Role     string `json:"role" binding:"required,oneof=user admin"`
 }
 
+type AdminTokenPolicyResponse struct {
+	ClientID  uuid.UUID   `json:"client_id"`
+	Overrides TokenPolicy `json:"overrides"`
+	Effective TokenPolicy `json:"effective"`
+}
+
+type AdminResourceRequest struct {
+	URI    string   `json:"uri" binding:"required,url"`
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes"`
+}
+
+type AdminResourceResponse struct {
+	ID        uuid.UUID `json:"id"`
+	URI       string    `json:"uri"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 type AdminUpdateUserRequest struct {
 	Username      *string `json:"username,omitempty" binding:"omitempty,min=3"`
 	Email         *string `json:"email,omitempty" binding:"omitempty,email"`
-	Password      *string `json:"password,omitempty" binding:"omitempty,min=8"`
+	Password      *string `json:"password,omitempty"`
 	Role          *string `json:"role,omitempty" binding:"omitempty,oneof=user admin"`
 	EmailVerified *bool   `json:"email_verified,omitempty"`
 }
@@ -120,18 +463,42 @@ type AdminStats struct {
 	NewClientsToday    int64 `json:"new_clients_today"`
 }
 
+// SchemaMigration фиксирует одноразовые миграции данных, которые уже были применены
+type SchemaMigration struct {
+	Name      string    `gorm:"type:varchar(255);primaryKey"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// UserDevice устройство из реестра устройств пользователя. Браузер узнается по долгоживущей
+// подписанной cookie вместе с браузером и ОС из User-Agent. Доверенным устройство делает пользователь,
+// вход с доверенного устройства не требует второго фактора
+type UserDevice struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_user_devices_user_key" json:"user_id"`
+	DeviceKey  string     `gorm:"type:varchar(36);not null;uniqueIndex:idx_user_devices_user_key" json:"-"` // идентификатор браузера из cookie
+	Name       string     `gorm:"type:varchar(100)" json:"name"`
+	Browser    string     `gorm:"type:varchar(100)" json:"browser"`
+	OS         string     `gorm:"type:varchar(100)" json:"os"`
+	DeviceType string     `gorm:"type:varchar(50)" json:"device_type"`
+	IPAddress  string     `gorm:"type:varchar(45)" json:"ip_address"` // адрес последнего входа
+	TrustedAt  *time.Time `json:"trusted_at,omitempty"`
+	LastSeenAt time.Time  `gorm:"not null" json:"last_seen_at"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	Current    bool       `gorm:"-" json:"current"` // устройство, с которого выполнен запрос
+}
+
 // LoginAttempt представляет попытку входа пользователя
 type LoginAttempt struct {
 	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
-	UserID      uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;index:idx_login_attempts_user_timestamp" json:"user_id"`
 	Email       string    `gorm:"not null" json:"email"`
-	Timestamp   time.Time `gorm:"not null" json:"timestamp"`
-	IPAddress   string    `gorm:"not null" json:"ip_address"`
+	Timestamp   time.Time `gorm:"not null;index:idx_login_attempts_user_timestamp" json:"timestamp"`
+	IPAddress   string    `gorm:"not null;index" json:"ip_address"`
 	UserAgent   string    `gorm:"type:text" json:"user_agent"`
 	DeviceInfo  Device    `gorm:"embedded;embeddedPrefix:device_" json:"device_info"`
 	GeoLocation Location  `gorm:"embedded;embeddedPrefix:geo_" json:"geo_location"`
 	SessionID   string    `gorm:"type:varchar(255)" json:"session_id"`
-	Status      string    `gorm:"type:varchar(20);not null" json:"status"` // "success", "failed", "suspicious"
+	Status      string    `gorm:"type:varchar(20);not null" json:"status"` // "success", "failed", "locked", "denied", "mfa_required", "password_expired", "suspicious"
 
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
@@ -168,7 +535,7 @@ type Location struct {
 // SecurityNotification представляет уведомление о безопасности
 type SecurityNotification struct {
 	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
-	UserID         uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
+	UserID         uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
 	LoginAttemptID uuid.UUID `gorm:"type:uuid;not null" json:"login_attempt_id"`
 	Title          string    `gorm:"type:varchar(255);not null" json:"title"`
 	Message        string    `gorm:"type:text;not null" json:"message"`
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"jiko-auth/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type DeviceRepository interface {
+	FindDevice(ctx context.Context, userID uuid.UUID, deviceKey string) (*models.UserDevice, error)
+	GetDevice(ctx context.Context, userID, id uuid.UUID) (*models.UserDevice, error)
+	GetUserDevices(ctx context.Context, userID uuid.UUID) ([]*models.UserDevice, error)
+	CreateDevice(ctx context.Context, device *models.UserDevice) error
+	UpdateDevice(ctx context.Context, device *models.UserDevice) error
+	TouchDevice(ctx context.Context, id uuid.UUID, ipAddress string, seenAt time.Time) error
+	DeleteDevice(ctx context.Context, userID, id uuid.UUID) (bool, error)
+}
+
+type deviceRepository struct {
+	db *gorm.DB
+}
+
+func NewDeviceRepository(db *gorm.DB) DeviceRepository {
+	return &deviceRepository{db: db}
+}
+
+// FindDevice возвращает устройство пользователя по ключу браузера или nil, если оно не найдено
+func (r *deviceRepository) FindDevice(ctx context.Context, userID uuid.UUID, deviceKey string) (*models.UserDevice, error) {
+	return r.first(ctx, "user_id = ? AND device_key = ?", userID, deviceKey)
+}
+
+// GetDevice возвращает устройство пользователя или nil, если оно не найдено
+func (r *deviceRepository) GetDevice(ctx context.Context, userID, id uuid.UUID) (*models.UserDevice, error) {
+	return r.first(ctx, "id = ? AND user_id = ?", id, userID)
+}
+
+func (r *deviceRepository) first(ctx context.Context, query string, args ...interface{}) (*models.UserDevice, error) {
+	var device models.UserDevice
+	err := r.db.WithContext(ctx).Where(query, args...).First(&device).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// GetUserDevices возвращает устройства пользователя, последние использованные первыми
+func (r *deviceRepository) GetUserDevices(ctx context.Context, userID uuid.UUID) ([]*models.UserDevice, error) {
+	var devices []*models.UserDevice
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("last_seen_at DESC").
+		Find(&devices).Error
+	return devices, err
+}
+
+func (r *deviceRepository) CreateDevice(ctx context.Context, device *models.UserDevice) error {
+	return r.db.WithContext(ctx).Create(device).Error
+}
+
+// UpdateDevice сохраняет название и доверие устройства
+func (r *deviceRepository) UpdateDevice(ctx context.Context, device *models.UserDevice) error {
+	return r.db.WithContext(ctx).
+		Model(&models.UserDevice{}).
+		Where("id = ? AND user_id = ?", device.ID, device.UserID).
+		Updates(map[string]interface{}{
+			"name":       device.Name,
+			"trusted_at": device.TrustedAt,
+		}).Error
+}
+
+// TouchDevice отмечает новый вход с устройства
+func (r *deviceRepository) TouchDevice(ctx context.Context, id uuid.UUID, ipAddress string, seenAt time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&models.UserDevice{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"ip_address":   ipAddress,
+			"last_seen_at": seenAt,
+		}).Error
+}
+
+// DeleteDevice удаляет устройство из реестра и отзывает его сессии. Следующий вход
+// с этого браузера снова будет входом с нового устройства
+func (r *deviceRepository) DeleteDevice(ctx context.Context, userID, id uuid.UUID) (bool, error) {
+	deleted := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&models.UserDevice{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = true
+
+		return tx.Model(&models.Session{}).
+			Where("user_id = ? AND device_id = ? AND revoked_at IS NULL", userID, id).
+			Update("revoked_at", time.Now()).Error
+	})
+	return deleted, err
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type EmailChangeRepository interface {
+	CreateRequest(ctx context.Context, request *models.EmailChangeRequest, token, cancelToken string) error
+	ConfirmRequest(ctx context.Context, token string) (*models.EmailChangeRequest, error)
+	CancelRequest(ctx context.Context, cancelToken string) (*models.EmailChangeRequest, error)
+	ExpireUserRequests(ctx context.Context, userID uuid.UUID) error
+}
+
+type emailChangeRepository struct {
+	db     *gorm.DB
+	hasher *utils.TokenHasher
+}
+
+func NewEmailChangeRepository(db *gorm.DB, hasher *utils.TokenHasher) EmailChangeRepository {
+	return &emailChangeRepository{db: db, hasher: hasher}
+}
+
+// CreateRequest сохраняет запрос смены email. Неподтвержденные запросы пользователя истекают,
+// подтвердить можно только последний; ссылки отмены из прежних писем продолжают действовать
+func (r *emailChangeRepository) CreateRequest(ctx context.Context, request *models.EmailChangeRequest, token, cancelToken string) error {
+	request.TokenHash = r.hasher.Hash(token)
+	request.CancelTokenHash = r.hasher.Hash(cancelToken)
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := expireEmailChangeRequests(tx, request.UserID); err != nil {
+			return err
+		}
+		return tx.Create(request).Error
+	})
+}
+
+// ConfirmRequest отмечает запрос подтвержденным и возвращает его; nil, если токен не найден,
+// истек, запрос уже подтвержден или отменен
+func (r *emailChangeRepository) ConfirmRequest(ctx context.Context, token string) (*models.EmailChangeRequest, error) {
+	var request models.EmailChangeRequest
+	result := r.db.WithContext(ctx).
+		Model(&request).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND confirmed_at IS NULL AND cancelled_at IS NULL AND expires_at > ?", r.hasher.Hash(token), time.Now()).
+		Update("confirmed_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &request, nil
+}
+
+// CancelRequest отмечает запрос отмененным по ссылке со старого адреса. Отменить можно и уже
+// подтвержденную смену, пока не истек срок ссылки отмены
+func (r *emailChangeRepository) CancelRequest(ctx context.Context, cancelToken string) (*models.EmailChangeRequest, error) {
+	var request models.EmailChangeRequest
+	result := r.db.WithContext(ctx).
+		Model(&request).
+		Clauses(clause.Returning{}).
+		Where("cancel_token_hash = ? AND cancelled_at IS NULL AND cancel_expires_at > ?", r.hasher.Hash(cancelToken), time.Now()).
+		Update("cancelled_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &request, nil
+}
+
+// ExpireUserRequests делает недействительными неподтвержденные запросы пользователя
+func (r *emailChangeRepository) ExpireUserRequests(ctx context.Context, userID uuid.UUID) error {
+	return expireEmailChangeRequests(r.db.WithContext(ctx), userID)
+}
+
+func expireEmailChangeRequests(db *gorm.DB, userID uuid.UUID) error {
+	return db.Model(&models.EmailChangeRequest{}).
+		Where("user_id = ? AND confirmed_at IS NULL AND cancelled_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Update("expires_at", time.Now()).Error
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LockoutPolicy параметры блокировки после неудачных попыток входа: после MaxAttempts
+// неудач подряд вход блокируется на BaseDuration, каждая следующая неудача удваивает срок
+type LockoutPolicy struct {
+	MaxAttempts  int
+	BaseDuration time.Duration
+	MaxDuration  time.Duration
+}
+
+// Duration срок блокировки после failures неудачных попыток подряд; 0 - без блокировки
+func (p LockoutPolicy) Duration(failures int) time.Duration {
+	if p.MaxAttempts <= 0 || failures < p.MaxAttempts {
+		return 0
+	}
+	duration := p.BaseDuration
+	for i := p.MaxAttempts; i < failures && duration < p.MaxDuration; i++ {
+		duration *= 2
+	}
+	if duration > p.MaxDuration {
+		duration = p.MaxDuration
+	}
+	return duration
+}
+
+type LockoutRepository interface {
+	RecordFailure(ctx context.Context, userID uuid.UUID, policy LockoutPolicy) (*time.Time, error)
+	Reset(ctx context.Context, userID uuid.UUID) error
+	CreateUnlockToken(ctx context.Context, unlock *models.AccountUnlockToken, token string) error
+	ConsumeUnlockToken(ctx context.Context, token string) (*models.AccountUnlockToken, error)
+}
+
+type lockoutRepository struct {
+	db     *gorm.DB
+	hasher *utils.TokenHasher
+}
+
+func NewLockoutRepository(db *gorm.DB, hasher *utils.TokenHasher) LockoutRepository {
+	return &lockoutRepository{db: db, hasher: hasher}
+}
+
+// RecordFailure учитывает неудачную попытку входа. Возвращает срок блокировки, если эта
+// попытка заблокировала учетную запись, иначе nil. Неудачи во время блокировки не учитываются
+func (r *lockoutRepository) RecordFailure(ctx context.Context, userID uuid.UUID, policy LockoutPolicy) (*time.Time, error) {
+	var lockedUntil *time.Time
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "login_attempts", "locked_until").
+			First(&user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if user.LockedUntil != nil && user.LockedUntil.After(now) {
+			return nil
+		}
+
+		updates := map[string]interface{}{"login_attempts": user.LoginAttempts + 1}
+		if duration := policy.Duration(user.LoginAttempts + 1); duration > 0 {
+			until := now.Add(duration)
+			updates["locked_until"] = until
+			lockedUntil = &until
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error
+	})
+	return lockedUntil, err
+}
+
+// Reset сбрасывает счетчик неудачных попыток и снимает блокировку
+func (r *lockoutRepository) Reset(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ? AND (login_attempts <> 0 OR locked_until IS NOT NULL)", userID).
+		Updates(map[string]interface{}{"login_attempts": 0, "locked_until": nil}).Error
+}
+
+// CreateUnlockToken сохраняет хеш ссылки разблокировки
+func (r *lockoutRepository) CreateUnlockToken(ctx context.Context, unlock *models.AccountUnlockToken, token string) error {
+	unlock.TokenHash = r.hasher.Hash(token)
+	return r.db.WithContext(ctx).Create(unlock).Error
+}
+
+// ConsumeUnlockToken гасит ссылку разблокировки; nil, если она не найдена, истекла или использована
+func (r *lockoutRepository) ConsumeUnlockToken(ctx context.Context, token string) (*models.AccountUnlockToken, error) {
+	var unlock models.AccountUnlockToken
+	result := r.db.WithContext(ctx).
+		Model(&unlock).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", r.hasher.Hash(token), time.Now()).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &unlock, nil
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MFARepository interface {
+	GetTOTPCredential(ctx context.Context, userID uuid.UUID) (*models.TOTPCredential, error)
+	SaveTOTPCredential(ctx context.Context, credential *models.TOTPCredential) error
+	UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error)
+	DeleteTOTPCredential(ctx context.Context, userID uuid.UUID) (bool, error)
+
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codes []string) error
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, code string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error)
+	DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error)
+
+	CreateChallenge(ctx context.Context, challenge *models.MFAChallenge) error
+	CreateEmailChallenge(ctx context.Context, challenge *models.MFAChallenge, code string) error
+	MatchesEmailCode(challenge *models.MFAChallenge, code string) bool
+	GetChallenge(ctx context.Context, id uuid.UUID) (*models.MFAChallenge, error)
+	SetChallengeNonce(ctx context.Context, id uuid.UUID, challenge string) (bool, error)
+	RecordChallengeAttempt(ctx context.Context, id uuid.UUID, maxAttempts int) (bool, error)
+	CompleteChallenge(ctx context.Context, id uuid.UUID) (bool, error)
+}
+
+type mfaRepository struct {
+	db     *gorm.DB
+	hasher *utils.TokenHasher
+}
+
+func NewMFARepository(db *gorm.DB, hasher *utils.TokenHasher) MFARepository {
+	return &mfaRepository{db: db, hasher: hasher}
+}
+
+// GetTOTPCredential возвращает секрет пользователя или nil, если аутентификатор не подключен
+func (r *mfaRepository) GetTOTPCredential(ctx context.Context, userID uuid.UUID) (*models.TOTPCredential, error) {
+	var credential models.TOTPCredential
+	err := r.db.WithContext(ctx).First(&credential, "user_id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &credential, err
+}
+
+func (r *mfaRepository) SaveTOTPCredential(ctx context.Context, credential *models.TOTPCredential) error {
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(credential).Error
+}
+
+// UseTOTPStep фиксирует интервал принятого кода. false, если код этого или более позднего
+// интервала уже был принят: так один и тот же код нельзя предъявить дважды
+func (r *mfaRepository) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.TOTPCredential{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *mfaRepository) DeleteTOTPCredential(ctx context.Context, userID uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).Delete(&models.TOTPCredential{}, "user_id = ?", userID)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReplaceRecoveryCodes сохраняет хеши нового набора кодов восстановления, прежний набор удаляется
+func (r *mfaRepository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.RecoveryCode{}, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		records := make([]models.RecoveryCode, 0, len(codes))
+		for _, code := range codes {
+			records = append(records, models.RecoveryCode{
+				ID:       uuid.New(),
+				UserID:   userID,
+				CodeHash: r.hasher.Hash(code),
+			})
+		}
+		return tx.Create(&records).Error
+	})
+}
+
+// UseRecoveryCode гасит код восстановления; false, если код не найден или уже использован
+func (r *mfaRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, code string) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, r.hasher.Hash(code)).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// CountRecoveryCodes возвращает число неиспользованных кодов восстановления
+func (r *mfaRepository) CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *mfaRepository) DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result := r.db.WithContext(ctx).Delete(&models.RecoveryCode{}, "user_id = ?", userID)
+	return result.RowsAffected, result.Error
+}
+
+func (r *mfaRepository) CreateChallenge(ctx context.Context, challenge *models.MFAChallenge) error {
+	return r.db.WithContext(ctx).Create(challenge).Error
+}
+
+// CreateEmailChallenge сохраняет challenge, который подтверждается кодом из письма; хранится только хеш кода
+func (r *mfaRepository) CreateEmailChallenge(ctx context.Context, challenge *models.MFAChallenge, code string) error {
+	challenge.CodeHash = r.hasher.Hash(code)
+	return r.db.WithContext(ctx).Create(challenge).Error
+}
+
+func (r *mfaRepository) MatchesEmailCode(challenge *models.MFAChallenge, code string) bool {
+	return challenge.CodeHash != "" && code != "" && r.hasher.Matches(challenge.CodeHash, code)
+}
+
+// GetChallenge возвращает challenge или nil, если он не найден
+func (r *mfaRepository) GetChallenge(ctx context.Context, id uuid.UUID) (*models.MFAChallenge, error) {
+	var challenge models.MFAChallenge
+	err := r.db.WithContext(ctx).First(&challenge, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &challenge, err
+}
+
+// SetChallengeNonce сохраняет challenge WebAuthn для второго шага входа; новый вызов
+// заменяет предыдущий. false, если challenge входа истек или уже использован
+func (r *mfaRepository) SetChallengeNonce(ctx context.Context, id uuid.UUID, challenge string) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.MFAChallenge{}).
+		Where("id = ? AND completed_at IS NULL AND expires_at > ?", id, time.Now()).
+		Update("challenge", challenge)
+	return result.RowsAffected > 0, result.Error
+}
+
+// RecordChallengeAttempt учитывает попытку ввода кода; false, если попытки исчерпаны,
+// challenge истек или уже использован
+func (r *mfaRepository) RecordChallengeAttempt(ctx context.Context, id uuid.UUID, maxAttempts int) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.MFAChallenge{}).
+		Where("id = ? AND attempts < ? AND completed_at IS NULL AND expires_at > ?", id, maxAttempts, time.Now()).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	return result.RowsAffected > 0, result.Error
+}
+
+// CompleteChallenge гасит challenge; false, если он уже был использован
+func (r *mfaRepository) CompleteChallenge(ctx context.Context, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.MFAChallenge{}).
+		Where("id = ? AND completed_at IS NULL", id).
+		Update("completed_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
@@ -2,22 +2,33 @@ package repository
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"jiko-auth/internal/models"
+	"jiko-auth/internal/utils"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// OAuthClientRepository хранит секреты клиентов в виде HMAC-хешей
 type OAuthClientRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	hasher *utils.TokenHasher
 }
 
-func NewOAuthClientRepository(db *gorm.DB) *OAuthClientRepository {
-	return &OAuthClientRepository{db: db}
+func NewOAuthClientRepository(db *gorm.DB, hasher *utils.TokenHasher) *OAuthClientRepository {
+	return &OAuthClientRepository{db: db, hasher: hasher}
 }
 
-func (r *OAuthClientRepository) CreateClient(client *models.OAuthClient) error {
+// CreateClient сохраняет клиента, секрет сохраняется только в виде хеша.
+// Пустой секрет (публичный клиент) не хешируется
+func (r *OAuthClientRepository) CreateClient(client *models.OAuthClient, secret string) error {
+	client.Secret = ""
+	if secret != "" {
+		client.Secret = r.hasher.Hash(secret)
+	}
 	return r.db.Create(client).Error
 }
 
@@ -27,12 +38,45 @@ func (r *OAuthClientRepository) GetClient(clientID string) (*models.OAuthClient,
 	return &client, err
 }
 
+// ValidateClientSecret сравнивает хеш секрета за постоянное время. Предыдущий
+// секрет принимается, пока не истек льготный период после ротации
 func (r *OAuthClientRepository) ValidateClientSecret(clientID, clientSecret string) (bool, error) {
-	var count int64
-	err := r.db.Model(&models.OAuthClient{}).
-		Where("id = ? AND secret = ?", clientID, clientSecret).
-		Count(&count).Error
-	return count > 0, err
+	if clientSecret == "" {
+		return false, nil
+	}
+
+	var client models.OAuthClient
+	if err := r.db.First(&client, "id = ?", clientID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	hash := []byte(r.hasher.Hash(clientSecret))
+	if subtle.ConstantTimeCompare(hash, []byte(client.Secret)) == 1 {
+		return true, nil
+	}
+
+	if client.PreviousSecret != "" && client.PreviousSecretExpiresAt != nil && time.Now().Before(*client.PreviousSecretExpiresAt) {
+		return subtle.ConstantTimeCompare(hash, []byte(client.PreviousSecret)) == 1, nil
+	}
+
+	return false, nil
+}
+
+// RotateClientSecret устанавливает новый секрет, старый остается действительным в течение grace
+func (r *OAuthClientRepository) RotateClientSecret(client *models.OAuthClient, newSecret string, grace time.Duration) error {
+	now := time.Now()
+	graceUntil := now.Add(grace)
+
+	client.PreviousSecret = client.Secret
+	client.PreviousSecretExpiresAt = &graceUntil
+	client.Secret = r.hasher.Hash(newSecret)
+	client.SecretRotatedAt = &now
+	client.UpdatedAt = now
+
+	return r.db.Save(client).Error
 }
 
 func (r *OAuthClientRepository) GetUserClients(userID uuid.UUID) ([]*models.OAuthClient, error) {
@@ -82,15 +126,17 @@ func (r *OAuthClientRepository) GetClientsWithPagination(ctx context.Context, li
 	return clients, nil
 }
 
+// AuthCodeRepository хранит коды авторизации в виде HMAC-хешей
 type AuthCodeRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	hasher *utils.TokenHasher
 }
 
-func NewAuthCodeRepository(db *gorm.DB) *AuthCodeRepository {
-	return &AuthCodeRepository{db: db}
+func NewAuthCodeRepository(db *gorm.DB, hasher *utils.TokenHasher) *AuthCodeRepository {
+	return &AuthCodeRepository{db: db, hasher: hasher}
 }
 
-func (r *AuthCodeRepository) SaveAuthorizationCode(code, clientID, userID, redirectURI, scope string, expiresAt time.Time) error {
+func (r *AuthCodeRepository) SaveAuthorizationCode(code, clientID, userID, redirectURI, scope string, resources []string, expiresAt time.Time) error {
 	clientUUID, err := uuid.Parse(clientID)
 	if err != nil {
 		return err
@@ -102,11 +148,12 @@ func (r *AuthCodeRepository) SaveAuthorizationCode(code, clientID, userID, redir
 	}
 
 	authCode := &models.AuthorizationCode{
-		Code:        code,
+		Code:        r.hasher.Hash(code),
 		ClientID:    clientUUID,
 		UserID:      userUUID,
 		RedirectURI: redirectURI,
 		Scope:       scope,
+		Resources:   utils.EncodeStringList(resources),
 		ExpiresAt:   expiresAt,
 		Used:        false,
 		CreatedAt:   time.Now(),
@@ -117,25 +164,28 @@ func (r *AuthCodeRepository) SaveAuthorizationCode(code, clientID, userID, redir
 
 func (r *AuthCodeRepository) GetAuthorizationCode(code string) (*models.AuthorizationCode, error) {
 	var authCode models.AuthorizationCode
-	err := r.db.First(&authCode, "code = ?", code).Error
+	err := r.db.First(&authCode, "code = ?", r.hasher.Hash(code)).Error
 	return &authCode, err
 }
 
 func (r *AuthCodeRepository) MarkAuthorizationCodeUsed(code string) error {
 	return r.db.Model(&models.AuthorizationCode{}).
-		Where("code = ?", code).
+		Where("code = ?", r.hasher.Hash(code)).
 		Update("used", true).Error
 }
 
+// TokenRepository хранит access и refresh токены в виде HMAC-хешей,
+// поиск выполняется по хешу переданного токена
 type TokenRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	hasher *utils.TokenHasher
 }
 
-func NewTokenRepository(db *gorm.DB) *TokenRepository {
-	return &TokenRepository{db: db}
+func NewTokenRepository(db *gorm.DB, hasher *utils.TokenHasher) *TokenRepository {
+	return &TokenRepository{db: db, hasher: hasher}
 }
 
-func (r *TokenRepository) SaveAccessToken(token, clientID, userID, scope string, expiresAt time.Time) error {
+func (r *TokenRepository) SaveAccessToken(token, clientID, userID, scope string, audience []string, expiresAt time.Time) error {
 	clientUUID, err := uuid.Parse(clientID)
 	if err != nil {
 		return err
@@ -147,18 +197,20 @@ func (r *TokenRepository) SaveAccessToken(token, clientID, userID, scope string,
 	}
 
 	accessToken := &models.AccessToken{
-		Token:     token,
-		ClientID:  clientUUID,
-		UserID:    userUUID,
-		Scope:     scope,
-		ExpiresAt: expiresAt,
-		CreatedAt: time.Now(),
+		Token:       r.hasher.Hash(token),
+		TokenPrefix: utils.TokenPrefix(token),
+		ClientID:    clientUUID,
+		UserID:      userUUID,
+		Scope:       scope,
+		Audience:    utils.EncodeStringList(audience),
+		ExpiresAt:   expiresAt,
+		CreatedAt:   time.Now(),
 	}
 
 	return r.db.Create(accessToken).Error
 }
 
-func (r *TokenRepository) SaveRefreshToken(token, accessToken, clientID, userID, scope string, expiresAt time.Time) error {
+func (r *TokenRepository) SaveRefreshToken(token, accessToken, clientID, userID, scope string, resources []string, expiresAt time.Time, absoluteExpiresAt *time.Time) error {
 	clientUUID, err := uuid.Parse(clientID)
 	if err != nil {
 		return err
@@ -170,30 +222,60 @@ func (r *TokenRepository) SaveRefreshToken(token, accessToken, clientID, userID,
 	}
 
 	refreshToken := &models.RefreshToken{
-		Token:       token,
-		AccessToken: accessToken,
-		ClientID:    clientUUID,
-		UserID:      userUUID,
-		Scope:       scope,
-		ExpiresAt:   expiresAt,
-		CreatedAt:   time.Now(),
+		Token:             r.hasher.Hash(token),
+		TokenPrefix:       utils.TokenPrefix(token),
+		AccessToken:       r.hasher.Hash(accessToken),
+		ClientID:          clientUUID,
+		UserID:            userUUID,
+		Scope:             scope,
+		Resources:         utils.EncodeStringList(resources),
+		ExpiresAt:         expiresAt,
+		CreatedAt:         time.Now(),
+		AbsoluteExpiresAt: absoluteExpiresAt,
 	}
 
 	return r.db.Create(refreshToken).Error
 }
 
+// ExtendRefreshToken продлевает срок действия refresh token по неактивности
+func (r *TokenRepository) ExtendRefreshToken(token string, expiresAt time.Time) error {
+	return r.db.Model(&models.RefreshToken{}).
+		Where("token = ?", r.hasher.Hash(token)).
+		Update("expires_at", expiresAt).Error
+}
+
 func (r *TokenRepository) GetRefreshToken(token string) (*models.RefreshToken, error) {
 	var refreshToken models.RefreshToken
-	err := r.db.First(&refreshToken, "token = ?", token).Error
+	err := r.db.First(&refreshToken, "token = ?", r.hasher.Hash(token)).Error
 	return &refreshToken, err
 }
 
 func (r *TokenRepository) GetAccessToken(token string) (*models.AccessToken, error) {
 	var accessToken models.AccessToken
-	err := r.db.First(&accessToken, "token = ?", token).Error
+	err := r.db.First(&accessToken, "token = ?", r.hasher.Hash(token)).Error
 	return &accessToken, err
 }
 
+// Admin methods
+func (r *TokenRepository) GetActiveAccessTokens(ctx context.Context, limit, offset int) ([]*models.AccessToken, error) {
+	var tokens []*models.AccessToken
+	err := r.db.WithContext(ctx).
+		Where("expires_at > ?", time.Now()).
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *TokenRepository) GetActiveAccessTokenCount(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.AccessToken{}).
+		Where("expires_at > ?", time.Now()).
+		Count(&count).Error
+	return count, err
+}
+
 func (r *TokenRepository) DeleteExpiredTokens() error {
 	now := time.Now()
 	// Удалить expired access tokens
@@ -212,7 +294,7 @@ func (r *TokenRepository) DeleteExpiredTokens() error {
 }
 
 // internal/repository/oauth_repository.go
-func (r *AuthCodeRepository) SaveAuthorizationCodeWithPKCE(code, clientID, userID, redirectURI, scope string, expiresAt time.Time, codeChallenge, codeChallengeMethod, nonce string) error {
+func (r *AuthCodeRepository) SaveAuthorizationCodeWithPKCE(code, clientID, userID, redirectURI, scope string, resources []string, expiresAt time.Time, codeChallenge, codeChallengeMethod, nonce string) error {
 	clientUUID, err := uuid.Parse(clientID)
 	if err != nil {
 		return err
@@ -224,11 +306,12 @@ func (r *AuthCodeRepository) SaveAuthorizationCodeWithPKCE(code, clientID, userI
 	}
 
 	authCode := &models.AuthorizationCode{
-		Code:                code,
+		Code:                r.hasher.Hash(code),
 		ClientID:            clientUUID,
 		UserID:              userUUID,
 		RedirectURI:         redirectURI,
 		Scope:               scope,
+		Resources:           utils.EncodeStringList(resources),
 		ExpiresAt:           expiresAt,
 		Used:                false,
 		CodeChallenge:       codeChallenge,
@@ -242,14 +325,43 @@ func (r *AuthCodeRepository) SaveAuthorizationCodeWithPKCE(code, clientID, userI
 
 func (r *AuthCodeRepository) GetAuthorizationCodeWithPKCE(code string) (*models.AuthorizationCode, error) {
 	var authCode models.AuthorizationCode
-	err := r.db.First(&authCode, "code = ?", code).Error
+	err := r.db.First(&authCode, "code = ?", r.hasher.Hash(code)).Error
 	return &authCode, err
 }
 
 func (r *TokenRepository) HasRefreshTokenForUserAndClient(userID, clientID string) (bool, error) {
 	var count int64
 	err := r.db.Model(&models.RefreshToken{}).
-		Where("user_id = ? AND client_id = ? AND expires_at > ?", userID, clientID, time.Now()).
+		Where("user_id = ? AND client_id = ? AND expires_at > ? AND revoked = ?", userID, clientID, time.Now(), false).
 		Count(&count).Error
 	return count > 0, err
 }
+
+// RevokeRefreshToken отзывает действующий refresh токен. false, если токен уже отозван:
+// из параллельных ротаций одного токена успешна только одна
+func (r *TokenRepository) RevokeRefreshToken(token string) (bool, error) {
+	result := r.db.Model(&models.RefreshToken{}).
+		Where("token = ? AND revoked = ?", r.hasher.Hash(token), false).
+		Update("revoked", true)
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeRefreshTokensForUserAndClient отзывает все refresh токены пользователя у клиента,
+// используется при обнаружении повторного использования ротированного токена
+func (r *TokenRepository) RevokeRefreshTokensForUserAndClient(userID, clientID string) error {
+	return r.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND client_id = ?", userID, clientID).
+		Update("revoked", true).Error
+}
+
+// RevokeTokensForUser удаляет access токены пользователя и отзывает его refresh токены
+func (r *TokenRepository) RevokeTokensForUser(userID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.AccessToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ?", userID).
+			Update("revoked", true).Error
+	})
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"jiko-auth/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type PasswordHistoryRepository interface {
+	Recent(ctx context.Context, userID uuid.UUID, limit int) ([]string, error)
+	Add(ctx context.Context, userID uuid.UUID, passwordHash string, keep int) error
+}
+
+type passwordHistoryRepository struct {
+	db *gorm.DB
+}
+
+func NewPasswordHistoryRepository(db *gorm.DB) PasswordHistoryRepository {
+	return &passwordHistoryRepository{db: db}
+}
+
+// Recent возвращает limit последних прежних хешей пароля пользователя, новые первыми
+func (r *passwordHistoryRepository) Recent(ctx context.Context, userID uuid.UUID, limit int) ([]string, error) {
+	var hashes []string
+	if limit <= 0 {
+		return hashes, nil
+	}
+	err := r.db.WithContext(ctx).
+		Model(&models.PasswordHistory{}).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Pluck("password_hash", &hashes).Error
+	return hashes, err
+}
+
+// Add сохраняет прежний хеш пароля и удаляет записи старше keep последних.
+// При keep <= 0 история пользователя очищается
+func (r *passwordHistoryRepository) Add(ctx context.Context, userID uuid.UUID, passwordHash string, keep int) error {
+	if keep <= 0 {
+		return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.PasswordHistory{}).Error
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.PasswordHistory{UserID: userID, PasswordHash: passwordHash}).Error; err != nil {
+			return err
+		}
+
+		keepIDs := tx.Model(&models.PasswordHistory{}).
+			Select("id").
+			Where("user_id = ?", userID).
+			Order("created_at DESC").
+			Limit(keep)
+		return tx.Where("user_id = ? AND id NOT IN (?)", userID, keepIDs).
+			Delete(&models.PasswordHistory{}).Error
+	})
+}
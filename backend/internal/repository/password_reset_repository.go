@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PasswordResetRepository interface {
+	CreateToken(ctx context.Context, reset *models.PasswordResetToken, token string) error
+	FindToken(ctx context.Context, token string) (*models.PasswordResetToken, error)
+	ConsumeToken(ctx context.Context, token string) (*models.PasswordResetToken, error)
+	CountRecentTokens(ctx context.Context, userID uuid.UUID, since time.Time) (int64, error)
+	ExpireUserTokens(ctx context.Context, userID uuid.UUID) error
+}
+
+type passwordResetRepository struct {
+	db     *gorm.DB
+	hasher *utils.TokenHasher
+}
+
+func NewPasswordResetRepository(db *gorm.DB, hasher *utils.TokenHasher) PasswordResetRepository {
+	return &passwordResetRepository{db: db, hasher: hasher}
+}
+
+// CreateToken сохраняет хеш нового токена. Ранее выданные неиспользованные токены пользователя
+// истекают, действует только ссылка из последнего письма. Строки остаются для учета частоты писем
+func (r *passwordResetRepository) CreateToken(ctx context.Context, reset *models.PasswordResetToken, token string) error {
+	reset.TokenHash = r.hasher.Hash(token)
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := expirePasswordResetTokens(tx, reset.UserID); err != nil {
+			return err
+		}
+		return tx.Create(reset).Error
+	})
+}
+
+// FindToken возвращает действующий токен, не погашая его; nil, если токен не найден, истек или уже использован
+func (r *passwordResetRepository) FindToken(ctx context.Context, token string) (*models.PasswordResetToken, error) {
+	var reset models.PasswordResetToken
+	err := r.db.WithContext(ctx).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", r.hasher.Hash(token), time.Now()).
+		First(&reset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reset, nil
+}
+
+// ConsumeToken гасит токен и возвращает его; nil, если токен не найден, истек или уже использован
+func (r *passwordResetRepository) ConsumeToken(ctx context.Context, token string) (*models.PasswordResetToken, error) {
+	var reset models.PasswordResetToken
+	result := r.db.WithContext(ctx).
+		Model(&reset).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", r.hasher.Hash(token), time.Now()).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &reset, nil
+}
+
+// CountRecentTokens число писем сброса пользователю с момента since, для ограничения частоты
+func (r *passwordResetRepository) CountRecentTokens(ctx context.Context, userID uuid.UUID, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND created_at > ?", userID, since).
+		Count(&count).Error
+	return count, err
+}
+
+// ExpireUserTokens делает недействительными неиспользованные токены, например после смены пароля
+func (r *passwordResetRepository) ExpireUserTokens(ctx context.Context, userID uuid.UUID) error {
+	return expirePasswordResetTokens(r.db.WithContext(ctx), userID)
+}
+
+func expirePasswordResetTokens(db *gorm.DB, userID uuid.UUID) error {
+	return db.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Update("expires_at", time.Now()).Error
+}
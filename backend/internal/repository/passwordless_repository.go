@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type PasswordlessRepository interface {
+	CreateLogin(ctx context.Context, login *models.PasswordlessLogin, token, code, browser string) error
+	GetLogin(ctx context.Context, id uuid.UUID) (*models.PasswordlessLogin, error)
+	GetLoginByToken(ctx context.Context, token string) (*models.PasswordlessLogin, error)
+	CountRecentLogins(ctx context.Context, email string, since time.Time) (int64, error)
+	RecordAttempt(ctx context.Context, id uuid.UUID, maxAttempts int) (bool, error)
+	ConsumeLogin(ctx context.Context, id uuid.UUID) (bool, error)
+	MatchesCode(login *models.PasswordlessLogin, code string) bool
+	MatchesBrowser(login *models.PasswordlessLogin, browser string) bool
+}
+
+type passwordlessRepository struct {
+	db     *gorm.DB
+	hasher *utils.TokenHasher
+}
+
+func NewPasswordlessRepository(db *gorm.DB, hasher *utils.TokenHasher) PasswordlessRepository {
+	return &passwordlessRepository{db: db, hasher: hasher}
+}
+
+// CreateLogin сохраняет запрос входа; токен ссылки, код и секрет браузера хранятся только хешами
+func (r *passwordlessRepository) CreateLogin(ctx context.Context, login *models.PasswordlessLogin, token, code, browser string) error {
+	login.TokenHash = r.hasher.Hash(token)
+	login.CodeHash = r.hasher.Hash(login.ID.String() + ":" + code)
+	login.BrowserHash = r.hasher.Hash(browser)
+	return r.db.WithContext(ctx).Create(login).Error
+}
+
+// GetLogin возвращает запрос входа или nil, если он не найден
+func (r *passwordlessRepository) GetLogin(ctx context.Context, id uuid.UUID) (*models.PasswordlessLogin, error) {
+	var login models.PasswordlessLogin
+	err := r.db.WithContext(ctx).First(&login, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &login, err
+}
+
+func (r *passwordlessRepository) GetLoginByToken(ctx context.Context, token string) (*models.PasswordlessLogin, error) {
+	var login models.PasswordlessLogin
+	err := r.db.WithContext(ctx).First(&login, "token_hash = ?", r.hasher.Hash(token)).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &login, err
+}
+
+// CountRecentLogins число писем входа на адрес с момента since, для ограничения частоты
+func (r *passwordlessRepository) CountRecentLogins(ctx context.Context, email string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.PasswordlessLogin{}).
+		Where("email = ? AND created_at > ?", email, since).
+		Count(&count).Error
+	return count, err
+}
+
+// RecordAttempt учитывает попытку ввода кода; false, если попытки исчерпаны,
+// запрос истек или уже использован
+func (r *passwordlessRepository) RecordAttempt(ctx context.Context, id uuid.UUID, maxAttempts int) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.PasswordlessLogin{}).
+		Where("id = ? AND attempts < ? AND consumed_at IS NULL AND expires_at > ?", id, maxAttempts, time.Now()).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	return result.RowsAffected > 0, result.Error
+}
+
+// ConsumeLogin гасит запрос входа; false, если он уже использован или истек
+func (r *passwordlessRepository) ConsumeLogin(ctx context.Context, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.PasswordlessLogin{}).
+		Where("id = ? AND consumed_at IS NULL AND expires_at > ?", id, time.Now()).
+		Update("consumed_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// MatchesCode сравнивает код с хешем; код привязан к ID запроса, поэтому совпадение
+// кодов разных запросов ничего не дает
+func (r *passwordlessRepository) MatchesCode(login *models.PasswordlessLogin, code string) bool {
+	return r.hasher.Matches(login.CodeHash, login.ID.String()+":"+code)
+}
+
+func (r *passwordlessRepository) MatchesBrowser(login *models.PasswordlessLogin, browser string) bool {
+	return browser != "" && r.hasher.Matches(login.BrowserHash, browser)
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RateLimitResult итог учета запроса в скользящем окне
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	ResetAt   time.Time // когда в окне освободится место
+}
+
+type RateLimitRepository interface {
+	Hit(ctx context.Context, key string, limit int, window time.Duration) (*RateLimitResult, error)
+	Cleanup(ctx context.Context, before time.Time) error
+}
+
+type rateLimitRepository struct {
+	db     *gorm.DB
+	hasher *utils.TokenHasher
+}
+
+func NewRateLimitRepository(db *gorm.DB, hasher *utils.TokenHasher) RateLimitRepository {
+	return &rateLimitRepository{db: db, hasher: hasher}
+}
+
+// Hit учитывает запрос по ключу, если в окне window еще нет limit запросов. Учет по одному
+// ключу сериализуется advisory lock, поэтому лимит соблюдается на всех репликах
+func (r *rateLimitRepository) Hit(ctx context.Context, key string, limit int, window time.Duration) (*RateLimitResult, error) {
+	keyHash := r.hasher.Hash(key)
+	result := &RateLimitResult{}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", keyHash).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		windowStart := now.Add(-window)
+		if err := tx.Where("key_hash = ? AND created_at <= ?", keyHash, windowStart).
+			Delete(&models.RateLimitHit{}).Error; err != nil {
+			return err
+		}
+
+		var hits []time.Time
+		if err := tx.Model(&models.RateLimitHit{}).
+			Where("key_hash = ?", keyHash).
+			Order("created_at").
+			Limit(limit).
+			Pluck("created_at", &hits).Error; err != nil {
+			return err
+		}
+
+		if len(hits) >= limit {
+			result.ResetAt = hits[0].Add(window)
+			return nil
+		}
+
+		if err := tx.Create(&models.RateLimitHit{KeyHash: keyHash, CreatedAt: now}).Error; err != nil {
+			return err
+		}
+
+		result.Allowed = true
+		result.Remaining = limit - len(hits) - 1
+		result.ResetAt = now.Add(window)
+		if len(hits) > 0 {
+			result.ResetAt = hits[0].Add(window)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Cleanup удаляет запросы, которые вышли за пределы всех окон
+func (r *rateLimitRepository) Cleanup(ctx context.Context, before time.Time) error {
+	return r.db.WithContext(ctx).
+		Where("created_at < ?", before).
+		Delete(&models.RateLimitHit{}).Error
+}
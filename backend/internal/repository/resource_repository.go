@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"jiko-auth/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ResourceRepository реестр защищаемых ресурсов (RFC 8707)
+type ResourceRepository struct {
+	db *gorm.DB
+}
+
+func NewResourceRepository(db *gorm.DB) *ResourceRepository {
+	return &ResourceRepository{db: db}
+}
+
+func (r *ResourceRepository) CreateResource(ctx context.Context, resource *models.ProtectedResource) error {
+	return r.db.WithContext(ctx).Create(resource).Error
+}
+
+func (r *ResourceRepository) GetResource(ctx context.Context, id string) (*models.ProtectedResource, error) {
+	var resource models.ProtectedResource
+	err := r.db.WithContext(ctx).First(&resource, "id = ?", id).Error
+	return &resource, err
+}
+
+func (r *ResourceRepository) GetResourcesByURIs(uris []string) ([]*models.ProtectedResource, error) {
+	var resources []*models.ProtectedResource
+	if len(uris) == 0 {
+		return resources, nil
+	}
+	err := r.db.Where("uri IN ?", uris).Find(&resources).Error
+	return resources, err
+}
+
+func (r *ResourceRepository) GetAllResources(ctx context.Context) ([]*models.ProtectedResource, error) {
+	var resources []*models.ProtectedResource
+	err := r.db.WithContext(ctx).Order("uri").Find(&resources).Error
+	return resources, err
+}
+
+func (r *ResourceRepository) UpdateResource(ctx context.Context, resource *models.ProtectedResource) error {
+	return r.db.WithContext(ctx).Save(resource).Error
+}
+
+func (r *ResourceRepository) DeleteResource(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).Where("id = ?", id).Delete(&models.ProtectedResource{}).Error
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"jiko-auth/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// SAMLRepository реестр SAML Service Provider'ов
+type SAMLRepository struct {
+	db *gorm.DB
+}
+
+func NewSAMLRepository(db *gorm.DB) *SAMLRepository {
+	return &SAMLRepository{db: db}
+}
+
+func (r *SAMLRepository) CreateServiceProvider(ctx context.Context, sp *models.SAMLServiceProvider) error {
+	return r.db.WithContext(ctx).Create(sp).Error
+}
+
+func (r *SAMLRepository) GetServiceProvider(ctx context.Context, id string) (*models.SAMLServiceProvider, error) {
+	var sp models.SAMLServiceProvider
+	err := r.db.WithContext(ctx).First(&sp, "id = ?", id).Error
+	return &sp, err
+}
+
+func (r *SAMLRepository) GetServiceProviderByEntityID(ctx context.Context, entityID string) (*models.SAMLServiceProvider, error) {
+	var sp models.SAMLServiceProvider
+	err := r.db.WithContext(ctx).First(&sp, "entity_id = ?", entityID).Error
+	return &sp, err
+}
+
+func (r *SAMLRepository) GetAllServiceProviders(ctx context.Context) ([]*models.SAMLServiceProvider, error) {
+	var providers []*models.SAMLServiceProvider
+	err := r.db.WithContext(ctx).Order("name").Find(&providers).Error
+	return providers, err
+}
+
+func (r *SAMLRepository) UpdateServiceProvider(ctx context.Context, sp *models.SAMLServiceProvider) error {
+	return r.db.WithContext(ctx).Save(sp).Error
+}
+
+func (r *SAMLRepository) DeleteServiceProvider(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).Where("id = ?", id).Delete(&models.SAMLServiceProvider{}).Error
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"jiko-auth/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SCIMQuery параметры выборки ресурсов SCIM: условие, полученное из фильтра, сортировка
+// и пагинация
+type SCIMQuery struct {
+	Where  string
+	Args   []interface{}
+	Order  string
+	Offset int
+	Limit  int
+}
+
+// SCIMUserRole единственная роль, учетными записями которой управляет SCIM. Администраторы
+// не видны клиентам provisioning, чтобы токен SCIM не позволял сменить их email или пароль
+const SCIMUserRole = "user"
+
+// SCIMRepository запросы для SCIM provisioning: поиск пользователей по фильтру и группы
+type SCIMRepository struct {
+	db *gorm.DB
+}
+
+func NewSCIMRepository(db *gorm.DB) *SCIMRepository {
+	return &SCIMRepository{db: db}
+}
+
+func (r *SCIMRepository) FindUsers(ctx context.Context, q SCIMQuery) ([]*models.User, int64, error) {
+	var users []*models.User
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.User{}).Where("role = ?", SCIMUserRole)
+	if q.Where != "" {
+		query = query.Where(q.Where, q.Args...)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Order(q.Order).Offset(q.Offset).Limit(q.Limit).Find(&users).Error
+	return users, total, err
+}
+
+func (r *SCIMRepository) FindGroups(ctx context.Context, q SCIMQuery) ([]*models.Group, int64, error) {
+	var groups []*models.Group
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.Group{})
+	if q.Where != "" {
+		query = query.Where(q.Where, q.Args...)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Preload("Members").Order(q.Order).Offset(q.Offset).Limit(q.Limit).Find(&groups).Error
+	return groups, total, err
+}
+
+// GetGroup возвращает группу с участниками или nil, если группа не найдена
+func (r *SCIMRepository) GetGroup(ctx context.Context, id uuid.UUID) (*models.Group, error) {
+	var group models.Group
+	err := r.db.WithContext(ctx).Preload("Members").First(&group, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &group, err
+}
+
+func (r *SCIMRepository) GetGroupsForUser(ctx context.Context, userID uuid.UUID) ([]*models.Group, error) {
+	var groups []*models.Group
+	err := r.db.WithContext(ctx).
+		Joins("JOIN group_members ON group_members.group_id = groups.id").
+		Where("group_members.user_id = ?", userID).
+		Order("groups.display_name").
+		Find(&groups).Error
+	return groups, err
+}
+
+// GroupDisplayNameExists проверяет уникальность displayName, исключая группу excludeID
+func (r *SCIMRepository) GroupDisplayNameExists(ctx context.Context, displayName string, excludeID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Group{}).
+		Where("LOWER(display_name) = LOWER(?) AND id <> ?", displayName, excludeID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// UserExternalIDExists проверяет уникальность externalId пользователя
+func (r *SCIMRepository) UserExternalIDExists(ctx context.Context, externalID string, excludeID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("external_id = ? AND id <> ?", externalID, excludeID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *SCIMRepository) GetUsersByIDs(ctx context.Context, ids []uuid.UUID) ([]models.User, error) {
+	var users []models.User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := r.db.WithContext(ctx).Where("id IN ? AND role = ?", ids, SCIMUserRole).Find(&users).Error
+	return users, err
+}
+
+// SaveGroup сохраняет группу и заменяет список участников в одной транзакции
+func (r *SCIMRepository) SaveGroup(ctx context.Context, group *models.Group) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		members := group.Members
+		if err := tx.Omit("Members").Save(group).Error; err != nil {
+			return err
+		}
+		association := tx.Model(group).Association("Members")
+		if len(members) == 0 {
+			if err := association.Clear(); err != nil {
+				return err
+			}
+		} else if err := association.Replace(members); err != nil {
+			return err
+		}
+		group.Members = members
+		return nil
+	})
+}
+
+func (r *SCIMRepository) DeleteGroup(ctx context.Context, group *models.Group) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(group).Association("Members").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"jiko-auth/internal/models"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -12,9 +13,13 @@ type SecurityRepository interface {
 	CreateLoginAttempt(ctx context.Context, attempt *models.LoginAttempt) error
 	GetUserLoginHistory(ctx context.Context, userID uuid.UUID, limit int) ([]*models.LoginAttempt, error)
 	GetLoginAttemptByID(ctx context.Context, id uuid.UUID) (*models.LoginAttempt, error)
+	GetRecentSuccessfulLogins(ctx context.Context, userID uuid.UUID, limit int) ([]*models.LoginAttempt, error)
+	CountRecentFailures(ctx context.Context, userID uuid.UUID, ipAddress string, since time.Time) (int64, error)
 	CreateNotification(ctx context.Context, notification *models.SecurityNotification) error
-	GetUserNotifications(ctx context.Context, userID uuid.UUID, unreadOnly bool) ([]*models.SecurityNotification, error)
-	MarkNotificationAsRead(ctx context.Context, notificationID uuid.UUID) error
+	GetUserNotifications(ctx context.Context, userID uuid.UUID, unreadOnly bool, limit int) ([]*models.SecurityNotification, error)
+	CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int64, error)
+	MarkNotificationAsRead(ctx context.Context, userID, notificationID uuid.UUID) (bool, error)
+	MarkAllNotificationsAsRead(ctx context.Context, userID uuid.UUID) (int64, error)
 }
 
 type securityRepository struct {
@@ -45,11 +50,34 @@ func (r *securityRepository) GetLoginAttemptByID(ctx context.Context, id uuid.UU
 	return &attempt, err
 }
 
+// GetRecentSuccessfulLogins последние входы пользователя, завершившиеся выдачей токенов,
+// в том числе отмеченные подозрительными
+func (r *securityRepository) GetRecentSuccessfulLogins(ctx context.Context, userID uuid.UUID, limit int) ([]*models.LoginAttempt, error) {
+	var attempts []*models.LoginAttempt
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND status IN ?", userID, []string{"success", "suspicious"}).
+		Order("timestamp DESC").
+		Limit(limit).
+		Find(&attempts).Error
+	return attempts, err
+}
+
+// CountRecentFailures число неудачных попыток входа в учетную запись или с адреса ipAddress,
+// включая попытки с неизвестными идентификаторами
+func (r *securityRepository) CountRecentFailures(ctx context.Context, userID uuid.UUID, ipAddress string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.LoginAttempt{}).
+		Where("(user_id = ? OR ip_address = ?) AND status IN ? AND timestamp > ?", userID, ipAddress, []string{"failed", "locked"}, since).
+		Count(&count).Error
+	return count, err
+}
+
 func (r *securityRepository) CreateNotification(ctx context.Context, notification *models.SecurityNotification) error {
 	return r.db.WithContext(ctx).Create(notification).Error
 }
 
-func (r *securityRepository) GetUserNotifications(ctx context.Context, userID uuid.UUID, unreadOnly bool) ([]*models.SecurityNotification, error) {
+func (r *securityRepository) GetUserNotifications(ctx context.Context, userID uuid.UUID, unreadOnly bool, limit int) ([]*models.SecurityNotification, error) {
 	var notifications []*models.SecurityNotification
 	query := r.db.WithContext(ctx).Where("user_id = ?", userID)
 
@@ -57,13 +85,33 @@ func (r *securityRepository) GetUserNotifications(ctx context.Context, userID uu
 		query = query.Where("read = ?", false)
 	}
 
-	err := query.Order("sent_at DESC").Find(&notifications).Error
+	err := query.Order("sent_at DESC").Limit(limit).Find(&notifications).Error
 	return notifications, err
 }
 
-func (r *securityRepository) MarkNotificationAsRead(ctx context.Context, notificationID uuid.UUID) error {
-	return r.db.WithContext(ctx).
+func (r *securityRepository) CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.SecurityNotification{}).
+		Where("user_id = ? AND read = ?", userID, false).
+		Count(&count).Error
+	return count, err
+}
+
+// MarkNotificationAsRead отмечает уведомление прочитанным; false, если у пользователя нет такого уведомления
+func (r *securityRepository) MarkNotificationAsRead(ctx context.Context, userID, notificationID uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.SecurityNotification{}).
+		Where("id = ? AND user_id = ?", notificationID, userID).
+		Update("read", true)
+	return result.RowsAffected > 0, result.Error
+}
+
+// MarkAllNotificationsAsRead отмечает прочитанными все уведомления пользователя и возвращает их число
+func (r *securityRepository) MarkAllNotificationsAsRead(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result := r.db.WithContext(ctx).
 		Model(&models.SecurityNotification{}).
-		Where("id = ?", notificationID).
-		Update("read", true).Error
+		Where("user_id = ? AND read = ?", userID, false).
+		Update("read", true)
+	return result.RowsAffected, result.Error
 }
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"jiko-auth/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// lastSeenResolution как часто обновляется время последней активности сессии,
+// чтобы не писать в БД на каждый запрос
+const lastSeenResolution = time.Minute
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetSession(ctx context.Context, id uuid.UUID) (*models.Session, error)
+	GetUserSessions(ctx context.Context, userID uuid.UUID) ([]*models.Session, error)
+	TouchSession(ctx context.Context, id uuid.UUID, seenAt time.Time) error
+	RotateSession(ctx context.Context, id uuid.UUID, oldJTI, newJTI string, expiresAt time.Time, maxLifetime time.Duration) (bool, error)
+	RevokeSession(ctx context.Context, userID, id uuid.UUID) (bool, error)
+	RevokeUserSessions(ctx context.Context, userID uuid.UUID, exceptID uuid.UUID) (int64, error)
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+// GetSession возвращает сессию или nil, если она не найдена
+func (r *sessionRepository) GetSession(ctx context.Context, id uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	err := r.db.WithContext(ctx).First(&session, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &session, err
+}
+
+// GetUserSessions возвращает активные сессии пользователя, последние использованные первыми
+func (r *sessionRepository) GetUserSessions(ctx context.Context, userID uuid.UUID) ([]*models.Session, error) {
+	var sessions []*models.Session
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *sessionRepository) TouchSession(ctx context.Context, id uuid.UUID, seenAt time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&models.Session{}).
+		Where("id = ? AND last_seen_at < ?", id, seenAt.Add(-lastSeenResolution)).
+		Update("last_seen_at", seenAt).Error
+}
+
+// RotateSession привязывает к сессии новый refresh токен. Обновление выполняется только если
+// предъявленный токен последний выданный, поэтому параллельная ротация одного токена не пройдет.
+// Срок сессии не выходит за created_at + maxLifetime, сколько бы раз ее ни продлевали
+func (r *sessionRepository) RotateSession(ctx context.Context, id uuid.UUID, oldJTI, newJTI string, expiresAt time.Time, maxLifetime time.Duration) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.Session{}).
+		Where("id = ? AND refresh_jti = ? AND revoked_at IS NULL", id, oldJTI).
+		Updates(map[string]interface{}{
+			"refresh_jti":  newJTI,
+			"expires_at":   gorm.Expr("LEAST(?, created_at + make_interval(secs => ?))", expiresAt, maxLifetime.Seconds()),
+			"last_seen_at": time.Now(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeSession отзывает сессию пользователя; false, если активной сессии с таким ID нет
+func (r *sessionRepository) RevokeSession(ctx context.Context, userID, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeUserSessions отзывает все сессии пользователя, кроме exceptID (uuid.Nil - без исключений)
+func (r *sessionRepository) RevokeUserSessions(ctx context.Context, userID uuid.UUID, exceptID uuid.UUID) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, exceptID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"jiko-auth/internal/models"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Ключи настроек в таблице settings
+const (
+	SettingPasswordlessEnabled = "passwordless_enabled"
+	SettingPasswordPolicy      = "password_policy"
+)
+
+type SettingsRepository interface {
+	GetBool(ctx context.Context, key string, defaultValue bool) (bool, error)
+	SetBool(ctx context.Context, key string, value bool) error
+	GetJSON(ctx context.Context, key string, value interface{}) (bool, error)
+	SetJSON(ctx context.Context, key string, value interface{}) error
+}
+
+type settingsRepository struct {
+	db *gorm.DB
+}
+
+func NewSettingsRepository(db *gorm.DB) SettingsRepository {
+	return &settingsRepository{db: db}
+}
+
+// GetBool возвращает значение настройки или defaultValue, если администратор ее не менял
+func (r *settingsRepository) GetBool(ctx context.Context, key string, defaultValue bool) (bool, error) {
+	var setting models.Setting
+	err := r.db.WithContext(ctx).First(&setting, "key = ?", key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return defaultValue, nil
+	}
+	if err != nil {
+		return defaultValue, err
+	}
+
+	value, err := strconv.ParseBool(setting.Value)
+	if err != nil {
+		return defaultValue, nil
+	}
+	return value, nil
+}
+
+func (r *settingsRepository) SetBool(ctx context.Context, key string, value bool) error {
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&models.Setting{Key: key, Value: strconv.FormatBool(value)}).Error
+}
+
+// GetJSON читает настройку-структуру в value. false, если администратор ее не задавал
+func (r *settingsRepository) GetJSON(ctx context.Context, key string, value interface{}) (bool, error) {
+	var setting models.Setting
+	err := r.db.WithContext(ctx).First(&setting, "key = ?", key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := json.Unmarshal([]byte(setting.Value), value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *settingsRepository) SetJSON(ctx context.Context, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&models.Setting{Key: key, Value: string(data)}).Error
+}
@@ -19,6 +19,7 @@ type UserRepository interface {
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
 	UpdateUser(ctx context.Context, user *models.User) error
+	UpdatePasswordHash(ctx context.Context, userID uuid.UUID, oldHash, newHash string) error
 	GetUserByVerificationToken(ctx context.Context, token string) (*models.User, error)
 	DeleteUser(ctx context.Context, id uuid.UUID) error // Изменено на uuid.UUID
 	ListUsers(ctx context.Context, limit, offset int) ([]*models.User, error)
@@ -106,6 +107,17 @@ func (r *userRepository) UpdateUser(ctx context.Context, user *models.User) erro
 	return nil
 }
 
+// UpdatePasswordHash заменяет хеш пароля, только если он не изменился с момента чтения
+func (r *userRepository) UpdatePasswordHash(ctx context.Context, userID uuid.UUID, oldHash, newHash string) error {
+	if err := r.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ? AND password = ?", userID, oldHash).
+		Update("password", newHash).Error; err != nil {
+		return fmt.Errorf("failed to update password hash: %w", err)
+	}
+	return nil
+}
+
 func (r *userRepository) ListUsers(ctx context.Context, limit, offset int) ([]*models.User, error) {
 	var users []*models.User
 	if err := r.db.WithContext(ctx).Limit(limit).Offset(offset).Find(&users).Error; err != nil {
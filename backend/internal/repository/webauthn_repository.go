@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"jiko-auth/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebAuthnRepository interface {
+	CreateCredential(ctx context.Context, credential *models.WebAuthnCredential) error
+	GetCredential(ctx context.Context, credentialID string) (*models.WebAuthnCredential, error)
+	GetUserCredentials(ctx context.Context, userID uuid.UUID) ([]models.WebAuthnCredential, error)
+	CountUserCredentials(ctx context.Context, userID uuid.UUID) (int64, error)
+	UpdateCredentialUsage(ctx context.Context, id uuid.UUID, oldSignCount, newSignCount int64, backupState bool) (bool, error)
+	RenameCredential(ctx context.Context, userID, id uuid.UUID, name string) (bool, error)
+	DeleteCredential(ctx context.Context, userID, id uuid.UUID) (bool, error)
+	DeleteUserCredentials(ctx context.Context, userID uuid.UUID) (int64, error)
+
+	CreateCeremony(ctx context.Context, ceremony *models.WebAuthnCeremony) error
+	ConsumeCeremony(ctx context.Context, id uuid.UUID, purpose string) (*models.WebAuthnCeremony, error)
+}
+
+type webAuthnRepository struct {
+	db *gorm.DB
+}
+
+func NewWebAuthnRepository(db *gorm.DB) WebAuthnRepository {
+	return &webAuthnRepository{db: db}
+}
+
+func (r *webAuthnRepository) CreateCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	return r.db.WithContext(ctx).Create(credential).Error
+}
+
+// GetCredential ищет ключ по его WebAuthn ID (base64url); nil, если ключ не зарегистрирован
+func (r *webAuthnRepository) GetCredential(ctx context.Context, credentialID string) (*models.WebAuthnCredential, error) {
+	var credential models.WebAuthnCredential
+	err := r.db.WithContext(ctx).First(&credential, "credential_id = ?", credentialID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &credential, err
+}
+
+func (r *webAuthnRepository) GetUserCredentials(ctx context.Context, userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	var credentials []models.WebAuthnCredential
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at ASC").
+		Find(&credentials).Error
+	return credentials, err
+}
+
+func (r *webAuthnRepository) CountUserCredentials(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.WebAuthnCredential{}).
+		Where("user_id = ?", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// UpdateCredentialUsage сохраняет новый счетчик подписей. Обновление условное: false, если
+// параллельный вход уже изменил счетчик, и это же подписанное утверждение повторно не примется
+func (r *webAuthnRepository) UpdateCredentialUsage(ctx context.Context, id uuid.UUID, oldSignCount, newSignCount int64, backupState bool) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.WebAuthnCredential{}).
+		Where("id = ? AND sign_count = ?", id, oldSignCount).
+		Updates(map[string]interface{}{
+			"sign_count":   newSignCount,
+			"backup_state": backupState,
+			"last_used_at": time.Now(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *webAuthnRepository) RenameCredential(ctx context.Context, userID, id uuid.UUID, name string) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.WebAuthnCredential{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Update("name", name)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *webAuthnRepository) DeleteCredential(ctx context.Context, userID, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).Delete(&models.WebAuthnCredential{}, "id = ? AND user_id = ?", id, userID)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *webAuthnRepository) DeleteUserCredentials(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result := r.db.WithContext(ctx).Delete(&models.WebAuthnCredential{}, "user_id = ?", userID)
+	return result.RowsAffected, result.Error
+}
+
+func (r *webAuthnRepository) CreateCeremony(ctx context.Context, ceremony *models.WebAuthnCeremony) error {
+	return r.db.WithContext(ctx).Create(ceremony).Error
+}
+
+// ConsumeCeremony удаляет церемонию и возвращает ее; nil, если она не найдена, истекла
+// или уже использована. Так каждый challenge принимается не более одного раза
+func (r *webAuthnRepository) ConsumeCeremony(ctx context.Context, id uuid.UUID, purpose string) (*models.WebAuthnCeremony, error) {
+	var ceremony models.WebAuthnCeremony
+	result := r.db.WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Where("id = ? AND purpose = ? AND expires_at > ?", id, purpose, time.Now()).
+		Delete(&ceremony)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &ceremony, nil
+}
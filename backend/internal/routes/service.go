@@ -1,30 +1,54 @@
 package routes
 
 import (
+	"jiko-auth/internal/config"
 	"jiko-auth/internal/handlers"
 	"jiko-auth/internal/middleware"
 	"jiko-auth/internal/repository"
 	"jiko-auth/pkg/auth"
 	"jiko-auth/pkg/jwt"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func SetupRouter(
+	cfg *config.Config,
 	authHandler *auth.AuthService,
 	oauthHandler *handlers.OAuthHandler,
 	codesHandler *handlers.CodesHandler,
 	adminHandler *handlers.AdminHandler,
+	samlHandler *handlers.SAMLHandler,
+	scimHandler *handlers.SCIMHandler,
+	sessionHandler *handlers.SessionHandler,
+	settingsHandler *handlers.SettingsHandler,
+	securityHandler *handlers.SecurityHandler,
+	deviceHandler *handlers.DeviceHandler,
 	jwtService *jwt.Service,
 	tokenRepo *repository.TokenRepository,
+	clientRepo *repository.OAuthClientRepository,
+	sessionRepo repository.SessionRepository,
 	userRepo repository.UserRepository,
+	rateLimitStore middleware.RateLimitStore,
 ) *gin.Engine {
 	router := gin.Default()
 
 	// Добавляем CORS middleware
 	router.Use(middleware.CORSMiddleware())
 
-	router.GET("/verify-email", func(c *gin.Context) {
+	// Ограничение частоты запросов, окна общие для всех реплик через хранилище
+	limiter := middleware.NewRateLimiter(rateLimitStore, rateLimitPolicies(cfg, clientRepo.ValidateClientSecret)...)
+	loginLimit := limiter.Limit("login")
+	mfaLimit := limiter.Limit("mfa")
+	passwordlessLimit := limiter.Limit("passwordless")
+	passwordResetLimit := limiter.Limit("password_reset")
+	emailChangeLimit := limiter.Limit("email_change")
+	verifyEmailLimit := limiter.Limit("verify_email")
+
+	// В профиле OAuth 2.1 bearer токены в query string не принимаются
+	flexibleAuth := middleware.FlexibleAuthMiddleware(jwtService, sessionRepo, !cfg.OAuth21Profile)
+
+	router.GET("/verify-email", verifyEmailLimit, func(c *gin.Context) {
 		token := c.Query("token")
 		success := c.Query("success")
 
@@ -58,25 +82,100 @@ func SetupRouter(
 	api := router.Group("/api/v1")
 	{
 		// Auth routes
-		api.POST("/auth/register", authHandler.Register)
-		api.POST("/auth/login", authHandler.Login)
-		api.GET("/auth/verify-email", authHandler.VerifyEmail)
+		api.POST("/auth/register", limiter.Limit("register"), authHandler.Register)
+		api.POST("/auth/login", loginLimit, authHandler.Login)
+		api.POST("/auth/refresh", limiter.Limit("refresh"), authHandler.Refresh)
+		api.POST("/auth/logout", middleware.AuthMiddleware(jwtService, sessionRepo), authHandler.Logout)
+		api.POST("/auth/mfa/verify", mfaLimit, authHandler.VerifyMFA)
+		api.POST("/auth/mfa/webauthn/begin", mfaLimit, authHandler.BeginMFAWebAuthn)
+		api.POST("/auth/webauthn/login/begin", loginLimit, authHandler.BeginWebAuthnLogin)
+		api.POST("/auth/webauthn/login/finish", loginLimit, authHandler.FinishWebAuthnLogin)
+		api.GET("/auth/passwordless", authHandler.PasswordlessStatus)
+		api.POST("/auth/passwordless/start", passwordlessLimit, authHandler.StartPasswordless)
+		api.POST("/auth/passwordless/verify", passwordlessLimit, authHandler.VerifyPasswordless)
+		api.GET("/auth/password-policy", authHandler.PasswordPolicy)
+		api.POST("/auth/password/forgot", passwordResetLimit, authHandler.ForgotPassword)
+		api.POST("/auth/password/reset", passwordResetLimit, authHandler.ResetPassword)
+		api.POST("/auth/password/change", middleware.AuthMiddleware(jwtService, sessionRepo), limiter.Limit("password_change"), authHandler.ChangePassword)
+		api.POST("/auth/email/change", middleware.AuthMiddleware(jwtService, sessionRepo), emailChangeLimit, authHandler.RequestEmailChange)
+		api.POST("/auth/email/confirm", emailChangeLimit, authHandler.ConfirmEmailChange)
+		api.POST("/auth/email/cancel", emailChangeLimit, authHandler.CancelEmailChange)
+		api.POST("/auth/unlock", limiter.Limit("unlock"), authHandler.UnlockAccount)
+
+		// Управление вторым фактором текущего пользователя
+		mfa := api.Group("/auth/mfa")
+		mfa.Use(middleware.AuthMiddleware(jwtService, sessionRepo))
+		{
+			mfa.GET("", authHandler.MFAStatus)
+			mfa.POST("/totp/enroll", authHandler.EnrollTOTP)
+			mfa.POST("/totp/confirm", authHandler.ConfirmTOTP)
+			mfa.POST("/totp/disable", authHandler.DisableTOTP)
+			mfa.POST("/recovery-codes", authHandler.GenerateRecoveryCodes)
+		}
+
+		// Ключи WebAuthn (passkeys) текущего пользователя
+		webauthn := api.Group("/auth/webauthn")
+		webauthn.Use(middleware.AuthMiddleware(jwtService, sessionRepo))
+		{
+			webauthn.GET("/credentials", authHandler.ListWebAuthnCredentials)
+			webauthn.POST("/register/begin", authHandler.BeginWebAuthnRegistration)
+			webauthn.POST("/register/finish", authHandler.FinishWebAuthnRegistration)
+			webauthn.PATCH("/credentials/:id", authHandler.RenameWebAuthnCredential)
+			webauthn.DELETE("/credentials/:id", authHandler.DeleteWebAuthnCredential)
+		}
+		api.GET("/auth/verify-email", verifyEmailLimit, authHandler.VerifyEmail)
 
 		// OAuth routes
-		api.GET("/oauth/authorize", middleware.FlexibleAuthMiddleware(jwtService), oauthHandler.Authorize)
-		api.POST("/oauth/authorize", middleware.FlexibleAuthMiddleware(jwtService), oauthHandler.AuthorizeApproval)
+		api.GET("/oauth/authorize", flexibleAuth, oauthHandler.Authorize)
+		api.POST("/oauth/authorize", flexibleAuth, oauthHandler.AuthorizeApproval)
 		api.GET("/oauth/client", oauthHandler.GetClientInfo)
-		api.GET("/oauth/has_refresh_token", middleware.FlexibleAuthMiddleware(jwtService), oauthHandler.HasRefreshToken)
-		api.POST("/oauth/token", oauthHandler.Token)
-		api.POST("/oauth/introspect", oauthHandler.Introspect)
+		api.GET("/oauth/has_refresh_token", flexibleAuth, oauthHandler.HasRefreshToken)
+		api.POST("/oauth/token", limiter.Limit("token"), oauthHandler.Token)
+		api.POST("/oauth/introspect", limiter.Limit("introspect"), oauthHandler.Introspect)
 		api.GET("/oauth/userinfo", middleware.OAuthMiddleware(tokenRepo, userRepo), oauthHandler.UserInfo)
 
+		// Сессии текущего пользователя
+		sessions := api.Group("/auth/sessions")
+		sessions.Use(middleware.AuthMiddleware(jwtService, sessionRepo))
+		{
+			sessions.GET("", sessionHandler.ListSessions)
+			sessions.DELETE("", sessionHandler.RevokeOtherSessions)
+			sessions.DELETE("/:id", sessionHandler.RevokeSession)
+		}
+
+		// История входов и уведомления безопасности текущего пользователя
+		me := api.Group("/me")
+		me.Use(middleware.AuthMiddleware(jwtService, sessionRepo))
+		{
+			me.GET("/login-history", securityHandler.GetLoginHistory)
+			me.GET("/notifications", securityHandler.GetNotifications)
+			me.POST("/notifications/read", securityHandler.MarkAllNotificationsRead)
+			me.POST("/notifications/:id/read", securityHandler.MarkNotificationRead)
+			me.GET("/devices", deviceHandler.ListDevices)
+			me.PATCH("/devices/:id", deviceHandler.UpdateDevice)
+			me.DELETE("/devices/:id", deviceHandler.DeleteDevice)
+		}
+
+		// OAuth client self-service
+		clients := api.Group("/oauth/clients")
+		clients.Use(middleware.AuthMiddleware(jwtService, sessionRepo))
+		{
+			clients.POST("/:id/rotate-secret", oauthHandler.RotateClientSecret)
+		}
+
+		// SAML 2.0 Identity Provider
+		api.GET("/saml/metadata", samlHandler.Metadata)
+		api.GET("/saml/sso", flexibleAuth, samlHandler.SSO)
+		api.POST("/saml/sso", flexibleAuth, samlHandler.SSO)
+		api.POST("/saml/sso/complete", flexibleAuth, samlHandler.CompleteSSO)
+		api.GET("/saml/idp/:id", flexibleAuth, samlHandler.IdPInitiated)
+
 		// OIDC Discovery
 		api.GET("/.well-known/openid-configuration", oauthHandler.OpenIDConfiguration)
 
 		// Admin routes
 		admin := api.Group("/admin")
-		admin.Use(middleware.AdminMiddleware(jwtService))
+		admin.Use(middleware.AdminMiddleware(jwtService, sessionRepo), limiter.Limit("admin"))
 		{
 			// Dashboard & Statistics
 			admin.GET("/stats", adminHandler.GetStats)
@@ -87,12 +186,46 @@ func SetupRouter(
 			admin.POST("/users", adminHandler.CreateUser)
 			admin.PUT("/users/:id", adminHandler.UpdateUser)
 			admin.DELETE("/users/:id", adminHandler.DeleteUser)
+			admin.GET("/users/:id/sessions", sessionHandler.AdminListUserSessions)
+			admin.DELETE("/users/:id/sessions", sessionHandler.AdminRevokeUserSessions)
+			admin.DELETE("/users/:id/sessions/:session_id", sessionHandler.AdminRevokeUserSession)
+			admin.GET("/users/:id/mfa", adminHandler.GetUserMFA)
+			admin.DELETE("/users/:id/mfa", adminHandler.ResetUserMFA)
+			admin.GET("/users/:id/webauthn", adminHandler.GetUserWebAuthnCredentials)
+			admin.DELETE("/users/:id/webauthn/:credential_id", adminHandler.DeleteUserWebAuthnCredential)
+			admin.POST("/users/:id/unlock", adminHandler.UnlockUser)
 
 			// Client Management (enhanced)
 			admin.GET("/clients", adminHandler.GetAllClientsWithUsers)
 			admin.POST("/clients", oauthHandler.AdminCreateClient)
 			admin.PUT("/clients/:id", oauthHandler.AdminUpdateClient)
 			admin.DELETE("/clients/:id", oauthHandler.AdminDeleteClient)
+			admin.POST("/clients/:id/rotate-secret", oauthHandler.RotateClientSecret)
+			admin.GET("/clients/:id/token-policy", oauthHandler.AdminGetClientTokenPolicy)
+			admin.PUT("/clients/:id/token-policy", oauthHandler.AdminUpdateClientTokenPolicy)
+			admin.GET("/token-policy/defaults", oauthHandler.AdminGetDefaultTokenPolicy)
+			admin.POST("/clients/:id/provisioning-token", oauthHandler.AdminIssueProvisioningToken)
+
+			// Token Management
+			admin.GET("/tokens", adminHandler.GetActiveTokens)
+
+			// Authentication settings
+			admin.GET("/settings", settingsHandler.GetSettings)
+			admin.PUT("/settings", settingsHandler.UpdateSettings)
+			admin.GET("/settings/password-policy", settingsHandler.GetPasswordPolicy)
+			admin.PUT("/settings/password-policy", settingsHandler.UpdatePasswordPolicy)
+
+			// Protected Resources (RFC 8707)
+			admin.GET("/resources", adminHandler.GetResources)
+			admin.POST("/resources", adminHandler.CreateResource)
+			admin.PUT("/resources/:id", adminHandler.UpdateResource)
+			admin.DELETE("/resources/:id", adminHandler.DeleteResource)
+
+			// SAML Service Providers
+			admin.GET("/saml/providers", samlHandler.GetServiceProviders)
+			admin.POST("/saml/providers", samlHandler.CreateServiceProvider)
+			admin.PUT("/saml/providers/:id", samlHandler.UpdateServiceProvider)
+			admin.DELETE("/saml/providers/:id", samlHandler.DeleteServiceProvider)
 
 			// OAuth Client management for admins
 			admin.GET("/oauth/clients", oauthHandler.GetClients)
@@ -106,5 +239,124 @@ func SetupRouter(
 		})
 	}
 
+	// SCIM 2.0 provisioning (RFC 7644)
+	scimAPI := router.Group("/scim/v2")
+	scimAPI.Use(middleware.SCIMAuthMiddleware(tokenRepo, clientRepo))
+	{
+		scimAPI.GET("/ServiceProviderConfig", scimHandler.ServiceProviderConfig)
+		scimAPI.GET("/ResourceTypes", scimHandler.ResourceTypes)
+		scimAPI.GET("/Schemas", scimHandler.Schemas)
+		scimAPI.GET("/Schemas/:id", scimHandler.Schema)
+
+		scimAPI.GET("/Users", scimHandler.ListUsers)
+		scimAPI.POST("/Users", scimHandler.CreateUser)
+		scimAPI.GET("/Users/:id", scimHandler.GetUser)
+		scimAPI.PUT("/Users/:id", scimHandler.ReplaceUser)
+		scimAPI.PATCH("/Users/:id", scimHandler.PatchUser)
+		scimAPI.DELETE("/Users/:id", scimHandler.DeleteUser)
+
+		scimAPI.GET("/Groups", scimHandler.ListGroups)
+		scimAPI.POST("/Groups", scimHandler.CreateGroup)
+		scimAPI.GET("/Groups/:id", scimHandler.GetGroup)
+		scimAPI.PUT("/Groups/:id", scimHandler.ReplaceGroup)
+		scimAPI.PATCH("/Groups/:id", scimHandler.PatchGroup)
+		scimAPI.DELETE("/Groups/:id", scimHandler.DeleteGroup)
+
+		scimAPI.POST("/Bulk", scimHandler.Bulk)
+	}
+
 	return router
 }
+
+// rateLimitPolicies политики ограничения частоты с лимитами из конфигурации.
+// Клиент OAuth учитывается отдельно только после проверки его секрета
+func rateLimitPolicies(cfg *config.Config, validateClient middleware.ClientSecretValidator) []middleware.RateLimitPolicy {
+	byClient := middleware.KeyByAuthenticatedClient(validateClient)
+
+	return []middleware.RateLimitPolicy{
+		{
+			// Вход по паролю и ключу WebAuthn: по IP и по учетной записи
+			Name:   "login",
+			Limit:  cfg.RateLimits["login"],
+			Window: time.Minute,
+			Keys:   []middleware.RateLimitKey{middleware.KeyByIP, middleware.KeyByAccount("identifier", "email")},
+		},
+		{
+			// Число попыток на один MFA challenge ограничено отдельно
+			Name:   "mfa",
+			Limit:  cfg.RateLimits["mfa"],
+			Window: time.Minute,
+			Keys:   []middleware.RateLimitKey{middleware.KeyByIP},
+		},
+		{
+			// Ограничение по учетной записи не дает засыпать ее владельца письмами со ссылками входа
+			Name:   "passwordless",
+			Limit:  cfg.RateLimits["passwordless"],
+			Window: time.Minute,
+			Keys:   []middleware.RateLimitKey{middleware.KeyByIP, middleware.KeyByAccount("email")},
+		},
+		{
+			// Восстановление доступа не ограничивается по одной учетной записи, иначе любой
+			// мог бы исчерпать лимит и не дать владельцу сбросить пароль
+			Name:   "password_reset",
+			Limit:  cfg.RateLimits["password_reset"],
+			Window: time.Minute,
+			Keys:   []middleware.RateLimitKey{middleware.KeyByIP, middleware.KeyByIPAndAccount("email")},
+		},
+		{
+			Name:   "password_change",
+			Limit:  cfg.RateLimits["password_change"],
+			Window: time.Minute,
+			Keys:   []middleware.RateLimitKey{middleware.KeyByIP, middleware.KeyByUser},
+		},
+		{
+			Name:   "email_change",
+			Limit:  cfg.RateLimits["email_change"],
+			Window: time.Minute,
+			Keys:   []middleware.RateLimitKey{middleware.KeyByIP, middleware.KeyByUser},
+		},
+		{
+			// Как и сброс пароля, разблокировка учитывается только по IP
+			Name:   "unlock",
+			Limit:  cfg.RateLimits["unlock"],
+			Window: time.Minute,
+			Keys:   []middleware.RateLimitKey{middleware.KeyByIP},
+		},
+		{
+			Name:   "register",
+			Limit:  cfg.RateLimits["register"],
+			Window: time.Minute,
+			Keys:   []middleware.RateLimitKey{middleware.KeyByIP},
+		},
+		{
+			Name:   "token",
+			Limit:  cfg.RateLimits["token"],
+			Window: time.Minute,
+			Keys:   []middleware.RateLimitKey{middleware.KeyByIP, byClient},
+		},
+		{
+			Name:   "introspect",
+			Limit:  cfg.RateLimits["introspect"],
+			Window: time.Minute,
+			Keys:   []middleware.RateLimitKey{middleware.KeyByIP, byClient},
+		},
+		{
+			Name:   "refresh",
+			Limit:  cfg.RateLimits["refresh"],
+			Window: time.Minute,
+			Keys:   []middleware.RateLimitKey{middleware.KeyByIP},
+		},
+		{
+			Name:   "verify_email",
+			Limit:  cfg.RateLimits["verify_email"],
+			Window: time.Minute,
+			Keys:   []middleware.RateLimitKey{middleware.KeyByIP},
+		},
+		{
+			Name:   "admin",
+			Limit:  cfg.RateLimits["admin"],
+			Window: time.Minute,
+			Keys:   []middleware.RateLimitKey{middleware.KeyByUser},
+		},
+	}
+}
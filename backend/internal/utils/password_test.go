@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2Params небольшие параметры, чтобы тесты не тратили память и время
+var testArgon2Params = Argon2Params{Memory: 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func newTestHasher(t *testing.T, algorithm string, params Argon2Params, bcryptCost int) PasswordHasher {
+	t.Helper()
+	hasher, err := NewPasswordHasher(algorithm, params, bcryptCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hasher
+}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	hasher := newTestHasher(t, PasswordAlgorithmArgon2id, testArgon2Params, bcrypt.DefaultCost)
+
+	encoded, err := hasher.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=2,p=1$") {
+		t.Errorf("hash %q is not in PHC format", encoded)
+	}
+
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params != testArgon2Params || len(salt) != 16 || len(key) != 32 {
+		t.Errorf("decoded params = %+v, salt %d bytes, key %d bytes", params, len(salt), len(key))
+	}
+
+	if ok, err := hasher.Verify(encoded, "correct horse battery staple"); err != nil || !ok {
+		t.Errorf("Verify(correct) = %v, %v", ok, err)
+	}
+	if ok, err := hasher.Verify(encoded, "correct horse battery stapler"); err != nil || ok {
+		t.Errorf("Verify(wrong) = %v, %v", ok, err)
+	}
+	if hasher.NeedsRehash(encoded) {
+		t.Error("fresh hash needs rehash")
+	}
+
+	// Соль случайная: одинаковые пароли дают разные хеши
+	if other, _ := hasher.Hash("correct horse battery staple"); other == encoded {
+		t.Error("two hashes of the same password are equal")
+	}
+}
+
+func TestVerifyLegacyBcrypt(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasher := newTestHasher(t, PasswordAlgorithmArgon2id, testArgon2Params, bcrypt.DefaultCost)
+
+	// Хеши $2y$ (PHP) и $2b$ отличаются от $2a$ только префиксом
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		encoded := prefix + string(legacy)[4:]
+		if ok, err := hasher.Verify(encoded, "hunter2"); err != nil || !ok {
+			t.Errorf("Verify(%s, correct) = %v, %v", prefix, ok, err)
+		}
+		if ok, err := hasher.Verify(encoded, "hunter3"); err != nil || ok {
+			t.Errorf("Verify(%s, wrong) = %v, %v", prefix, ok, err)
+		}
+		if !hasher.NeedsRehash(encoded) {
+			t.Errorf("bcrypt hash %s does not need rehash under argon2id", prefix)
+		}
+	}
+}
+
+func TestBcryptHasher(t *testing.T) {
+	hasher := newTestHasher(t, PasswordAlgorithmBcrypt, Argon2Params{}, bcrypt.MinCost)
+	encoded, err := hasher.Hash("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := hasher.Verify(encoded, "hunter2"); err != nil || !ok {
+		t.Errorf("Verify = %v, %v", ok, err)
+	}
+	if hasher.NeedsRehash(encoded) {
+		t.Error("fresh bcrypt hash needs rehash")
+	}
+
+	stronger := newTestHasher(t, PasswordAlgorithmBcrypt, Argon2Params{}, bcrypt.MinCost+1)
+	if !stronger.NeedsRehash(encoded) {
+		t.Error("bcrypt cost change does not require rehash")
+	}
+
+	argon2Hash, _ := newTestHasher(t, PasswordAlgorithmArgon2id, testArgon2Params, 0).Hash("hunter2")
+	if !hasher.NeedsRehash(argon2Hash) {
+		t.Error("argon2id hash does not need rehash under bcrypt")
+	}
+	if ok, err := hasher.Verify(argon2Hash, "hunter2"); err != nil || !ok {
+		t.Errorf("bcrypt hasher cannot verify argon2id hash: %v, %v", ok, err)
+	}
+}
+
+func TestArgon2idNeedsRehash(t *testing.T) {
+	encoded, err := newTestHasher(t, PasswordAlgorithmArgon2id, testArgon2Params, 0).Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Argon2Params)
+	}{
+		{"memory", func(p *Argon2Params) { p.Memory *= 2 }},
+		{"iterations", func(p *Argon2Params) { p.Iterations++ }},
+		{"parallelism", func(p *Argon2Params) { p.Parallelism++ }},
+		{"salt length", func(p *Argon2Params) { p.SaltLength = 32 }},
+		{"key length", func(p *Argon2Params) { p.KeyLength = 64 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := testArgon2Params
+			tt.modify(&params)
+			hasher := newTestHasher(t, PasswordAlgorithmArgon2id, params, 0)
+			if !hasher.NeedsRehash(encoded) {
+				t.Errorf("%s change does not require rehash", tt.name)
+			}
+			// Старый хеш по-прежнему проверяется, иначе перехеширование при входе невозможно
+			if ok, err := hasher.Verify(encoded, "password"); err != nil || !ok {
+				t.Errorf("Verify = %v, %v", ok, err)
+			}
+		})
+	}
+}
+
+func TestVerifyMalformedHash(t *testing.T) {
+	hasher := newTestHasher(t, PasswordAlgorithmArgon2id, testArgon2Params, 0)
+	tests := []string{
+		"",
+		"plaintext",
+		"$argon2i$v=19$m=1024,t=2,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+		"$argon2id$v=16$m=1024,t=2,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=2$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=2,p=1$!!!$a2V5",
+		"$argon2id$v=19$m=1024,t=2,p=1$c2FsdHNhbHRzYWx0c2FsdA$",
+	}
+	for _, encoded := range tests {
+		ok, err := hasher.Verify(encoded, "password")
+		if ok || !errors.Is(err, ErrUnknownPasswordHash) {
+			t.Errorf("Verify(%q) = %v, %v, want ErrUnknownPasswordHash", encoded, ok, err)
+		}
+		if !hasher.NeedsRehash(encoded) {
+			t.Errorf("NeedsRehash(%q) = false", encoded)
+		}
+	}
+}
+
+func TestNewPasswordHasherValidation(t *testing.T) {
+	if _, err := NewPasswordHasher("scrypt", testArgon2Params, 0); err == nil {
+		t.Error("unsupported algorithm accepted")
+	}
+	if _, err := NewPasswordHasher(PasswordAlgorithmArgon2id, Argon2Params{Memory: 1024, Iterations: 0, Parallelism: 1}, 0); err == nil {
+		t.Error("zero iterations accepted")
+	}
+	if _, err := NewPasswordHasher(PasswordAlgorithmBcrypt, Argon2Params{}, bcrypt.MaxCost+1); err == nil {
+		t.Error("bcrypt cost above maximum accepted")
+	}
+}
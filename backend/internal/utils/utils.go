@@ -1,10 +1,20 @@
 package utils
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 )
 
+// TokenPrefixLength длина префикса токена, который хранится в открытом виде для идентификации
+const TokenPrefixLength = 8
+
 func GenerateRandomString(length int) (string, error) {
 	b := make([]byte, length)
 	_, err := rand.Read(b)
@@ -13,3 +23,99 @@ func GenerateRandomString(length int) (string, error) {
 	}
 	return base64.URLEncoding.EncodeToString(b), nil
 }
+
+// TokenHasher вычисляет ключевой хеш (HMAC-SHA256) токенов для хранения в БД
+type TokenHasher struct {
+	key []byte
+}
+
+func NewTokenHasher(key string) *TokenHasher {
+	return &TokenHasher{key: []byte(key)}
+}
+
+// Hash возвращает hex-представление HMAC-SHA256 от токена
+func (h *TokenHasher) Hash(token string) string {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Matches сравнивает токен с сохраненным хешем за постоянное время
+func (h *TokenHasher) Matches(hash, token string) bool {
+	return hmac.Equal([]byte(hash), []byte(h.Hash(token)))
+}
+
+// SecretBox шифрует секреты для хранения в БД (AES-256-GCM), ключ выводится из строки конфигурации
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+func NewSecretBox(key string) (*SecretBox, error) {
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretBox{aead: aead}, nil
+}
+
+// Encrypt возвращает base64(nonce || ciphertext)
+func (b *SecretBox) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (b *SecretBox) Decrypt(ciphertext string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < b.aead.NonceSize() {
+		return "", ErrInvalidCiphertext
+	}
+	nonce, sealed := data[:b.aead.NonceSize()], data[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+	return string(plaintext), nil
+}
+
+// TokenPrefix возвращает короткий префикс токена для отображения в админке
+func TokenPrefix(token string) string {
+	if len(token) <= TokenPrefixLength {
+		return token
+	}
+	return token[:TokenPrefixLength]
+}
+
+// EncodeStringList сериализует список строк в JSON для хранения в text-колонке
+func EncodeStringList(list []string) string {
+	if list == nil {
+		list = []string{}
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return "[]"
+	}
+	return string(data)
+}
+
+// DecodeStringList разбирает JSON список строк, пустое или некорректное значение дает пустой список
+func DecodeStringList(data string) []string {
+	var list []string
+	if data == "" {
+		return []string{}
+	}
+	if err := json.Unmarshal([]byte(data), &list); err != nil || list == nil {
+		return []string{}
+	}
+	return list
+}
@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/utils"
+	"jiko-auth/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	emailChangeTTL = 24 * time.Hour
+	// Ссылка отмены живет дольше подтверждения: владелец может не сразу заметить письмо
+	emailChangeCancelTTL = 7 * 24 * time.Hour
+)
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+type EmailChangeTokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ChangePassword меняет пароль текущего пользователя и завершает остальные его сессии
+func (s *AuthService) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+	ctx := c.Request.Context()
+
+	if !s.verifyPassword(user, req.CurrentPassword) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"})
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "new password must differ from the current one"})
+		return
+	}
+	if err := s.passwordValidator.Validate(ctx, req.NewPassword, user); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := s.passwordHasher.Hash(req.NewPassword)
+	if err != nil {
+		logger.Error("Failed to hash password", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password"})
+		return
+	}
+	previousHash := user.Password
+	now := time.Now()
+	user.Password = hashedPassword
+	user.PasswordChangedAt = &now
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		logger.Error("Failed to update password", zap.Error(err), zap.String("user_id", user.ID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password"})
+		return
+	}
+	s.passwordValidator.Remember(ctx, user, previousHash)
+
+	// Текущая сессия остается, остальные устройства придется заново авторизовать
+	currentID, _ := uuid.Parse(c.GetString("session_id"))
+	if _, err := s.sessionRepo.RevokeUserSessions(ctx, user.ID, currentID); err != nil {
+		logger.Error("Failed to revoke sessions", zap.Error(err), zap.String("user_id", user.ID.String()))
+	}
+	if err := s.passwordResetRepo.ExpireUserTokens(ctx, user.ID); err != nil {
+		logger.Error("Failed to expire password reset tokens", zap.Error(err), zap.String("user_id", user.ID.String()))
+	}
+	if err := s.tokenRepo.RevokeTokensForUser(user.ID.String()); err != nil {
+		logger.Error("Failed to revoke OAuth tokens", zap.Error(err), zap.String("user_id", user.ID.String()))
+	}
+
+	logger.Info("Password changed", zap.String("user_id", user.ID.String()), zap.String("ip", c.ClientIP()))
+	s.notifyPasswordChanged(c, user)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed. Other sessions and application tokens have been signed out."})
+}
+
+// RequestEmailChange отправляет ссылку подтверждения на новый адрес и уведомление со ссылкой
+// отмены на текущий. Адрес меняется только после подтверждения
+func (s *AuthService) RequestEmailChange(c *gin.Context) {
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+	ctx := c.Request.Context()
+
+	if !s.verifyPassword(user, req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "password is incorrect"})
+		return
+	}
+
+	newEmail := strings.TrimSpace(req.NewEmail)
+	if strings.EqualFold(newEmail, user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "new email must differ from the current one"})
+		return
+	}
+	if existing, err := s.userRepo.GetUserByEmail(ctx, newEmail); err != nil {
+		logger.Error("Failed to check email", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change email"})
+		return
+	} else if existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "email is already in use"})
+		return
+	}
+
+	token, err := utils.GenerateRandomString(32)
+	if err != nil {
+		logger.Error("Failed to generate email change token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change email"})
+		return
+	}
+	cancelToken, err := utils.GenerateRandomString(32)
+	if err != nil {
+		logger.Error("Failed to generate email change token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change email"})
+		return
+	}
+
+	request := &models.EmailChangeRequest{
+		ID:              uuid.New(),
+		UserID:          user.ID,
+		OldEmail:        user.Email,
+		NewEmail:        newEmail,
+		ExpiresAt:       time.Now().Add(emailChangeTTL),
+		CancelExpiresAt: time.Now().Add(emailChangeCancelTTL),
+	}
+	if err := s.emailChangeRepo.CreateRequest(ctx, request, token, cancelToken); err != nil {
+		logger.Error("Failed to save email change request", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change email"})
+		return
+	}
+
+	if err := s.emailService.SendEmailChangeConfirmation(newEmail, token, emailChangeTTL); err != nil {
+		logger.Warn("Failed to send email change confirmation", zap.Error(err), zap.String("email", newEmail))
+	}
+	if err := s.emailService.SendEmailChangeNotice(user.Email, newEmail, cancelToken, emailChangeCancelTTL); err != nil {
+		logger.Warn("Failed to send email change notice", zap.Error(err), zap.String("email", user.Email))
+	}
+
+	logger.Info("Email change requested", zap.String("user_id", user.ID.String()), zap.String("ip", c.ClientIP()))
+	c.JSON(http.StatusAccepted, gin.H{"message": "A confirmation link has been sent to the new address."})
+}
+
+// ConfirmEmailChange применяет смену email по ссылке с нового адреса
+func (s *AuthService) ConfirmEmailChange(c *gin.Context) {
+	var req EmailChangeTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	request, err := s.emailChangeRepo.ConfirmRequest(ctx, req.Token)
+	if err != nil {
+		logger.Error("Failed to confirm email change", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to confirm email"})
+		return
+	}
+	if request == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired confirmation link"})
+		return
+	}
+
+	// Адрес успел измениться другим путем или учетная запись заблокирована - запрос устарел
+	user, err := s.userRepo.GetUserByID(ctx, request.UserID)
+	if err != nil || user == nil || user.Disabled || user.SecurityLockedAt != nil || user.Email != request.OldEmail {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired confirmation link"})
+		return
+	}
+
+	user.Email = request.NewEmail
+	user.EmailVerified = true
+	user.EmailVerificationToken = nil
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "23505") {
+			c.JSON(http.StatusConflict, gin.H{"error": "email is already in use"})
+			return
+		}
+		logger.Error("Failed to update email", zap.Error(err), zap.String("user_id", user.ID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to confirm email"})
+		return
+	}
+
+	logger.Info("Email changed", zap.String("user_id", user.ID.String()), zap.String("ip", c.ClientIP()))
+	c.JSON(http.StatusOK, gin.H{"message": "Email address has been changed."})
+}
+
+// CancelEmailChange отменяет смену email по ссылке со старого адреса: возвращает прежний адрес,
+// завершает все сеансы и блокирует учетную запись до сброса пароля
+func (s *AuthService) CancelEmailChange(c *gin.Context) {
+	var req EmailChangeTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	request, err := s.emailChangeRepo.CancelRequest(ctx, req.Token)
+	if err != nil {
+		logger.Error("Failed to cancel email change", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel email change"})
+		return
+	}
+	if request == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired link"})
+		return
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, request.UserID)
+	if err != nil || user == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired link"})
+		return
+	}
+
+	if user.Email == request.NewEmail {
+		user.Email = request.OldEmail
+	}
+	now := time.Now()
+	user.SecurityLockedAt = &now
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		logger.Error("Failed to lock account", zap.Error(err), zap.String("user_id", user.ID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel email change"})
+		return
+	}
+
+	s.revokeUserAccess(ctx, user.ID)
+	if err := s.emailChangeRepo.ExpireUserRequests(ctx, user.ID); err != nil {
+		logger.Error("Failed to expire email change requests", zap.Error(err), zap.String("user_id", user.ID.String()))
+	}
+
+	logger.Warn("Email change cancelled, account locked",
+		zap.String("user_id", user.ID.String()),
+		zap.String("new_email", request.NewEmail),
+		zap.String("ip", c.ClientIP()))
+	c.JSON(http.StatusOK, gin.H{"message": "The email change was cancelled and the account is locked. Reset your password to unlock it."})
+}
@@ -4,72 +4,114 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"net"
 	"net/http"
-	"strconv"
-	"strings"
+	"slices"
+	"sync"
 	"time"
-	"unicode"
 
 	"jiko-auth/internal/config"
+	"jiko-auth/internal/middleware"
 	"jiko-auth/internal/models"
 	"jiko-auth/internal/repository"
+	"jiko-auth/internal/utils"
 	"jiko-auth/pkg/email"
+	"jiko-auth/pkg/jwt"
 	"jiko-auth/pkg/logger"
+	"jiko-auth/pkg/passwords"
+	"jiko-auth/pkg/risk"
 	"jiko-auth/pkg/services"
+	"jiko-auth/pkg/webauthn"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthService struct {
 	userRepo            repository.UserRepository
-	jwtSecret           string
+	jwtService          *jwt.Service
 	emailService        *email.EmailService
 	cfg                 *config.Config
 	securityRepo        repository.SecurityRepository
+	sessionRepo         repository.SessionRepository
+	mfaRepo             repository.MFARepository
+	mfaSecrets          *utils.SecretBox
+	webauthnRepo        repository.WebAuthnRepository
+	relyingParty        *webauthn.RelyingParty
+	passwordlessRepo    repository.PasswordlessRepository
+	settingsRepo        repository.SettingsRepository
+	passwordResetRepo   repository.PasswordResetRepository
+	tokenRepo           *repository.TokenRepository
+	emailChangeRepo     repository.EmailChangeRepository
+	lockoutRepo         repository.LockoutRepository
+	deviceRepo          repository.DeviceRepository
+	tokenHasher         *utils.TokenHasher
+	passwordHasher      utils.PasswordHasher
+	passwordValidator   *passwords.Validator
+	riskEngine          *risk.Engine
 	userAgentParser     *services.UserAgentParser
 	geoLocationService  *services.GeoLocationService
 	notificationService *services.NotificationService
+
+	// Хеш случайного пароля для проверки, когда сверять не с чем
+	dummyHash     string
+	dummyHashOnce sync.Once
 }
 
 func NewAuthService(userRepo repository.UserRepository,
 	cfg *config.Config,
-	jwtSecret string,
+	jwtService *jwt.Service,
 	emailService *email.EmailService,
 	securityRepo repository.SecurityRepository,
+	sessionRepo repository.SessionRepository,
+	mfaRepo repository.MFARepository,
+	mfaSecrets *utils.SecretBox,
+	webauthnRepo repository.WebAuthnRepository,
+	relyingParty *webauthn.RelyingParty,
+	passwordlessRepo repository.PasswordlessRepository,
+	settingsRepo repository.SettingsRepository,
+	passwordResetRepo repository.PasswordResetRepository,
+	tokenRepo *repository.TokenRepository,
+	emailChangeRepo repository.EmailChangeRepository,
+	lockoutRepo repository.LockoutRepository,
+	deviceRepo repository.DeviceRepository,
+	tokenHasher *utils.TokenHasher,
+	passwordHasher utils.PasswordHasher,
+	passwordValidator *passwords.Validator,
+	riskEngine *risk.Engine,
 	userAgentParser *services.UserAgentParser,
 	geoLocationService *services.GeoLocationService,
 	notificationService *services.NotificationService,
 ) *AuthService {
 	return &AuthService{
 		userRepo:            userRepo,
-		jwtSecret:           jwtSecret,
+		jwtService:          jwtService,
 		emailService:        emailService,
 		cfg:                 cfg,
 		securityRepo:        securityRepo,
+		sessionRepo:         sessionRepo,
+		mfaRepo:             mfaRepo,
+		mfaSecrets:          mfaSecrets,
+		webauthnRepo:        webauthnRepo,
+		relyingParty:        relyingParty,
+		passwordlessRepo:    passwordlessRepo,
+		settingsRepo:        settingsRepo,
+		passwordResetRepo:   passwordResetRepo,
+		tokenRepo:           tokenRepo,
+		emailChangeRepo:     emailChangeRepo,
+		lockoutRepo:         lockoutRepo,
+		deviceRepo:          deviceRepo,
+		tokenHasher:         tokenHasher,
+		passwordHasher:      passwordHasher,
+		passwordValidator:   passwordValidator,
+		riskEngine:          riskEngine,
 		userAgentParser:     userAgentParser,
 		geoLocationService:  geoLocationService,
 		notificationService: notificationService,
 	}
 }
 
-func generateSessionID() string {
-	// Generate a cryptographically secure random string for the session
-	bytes := make([]byte, 32) // 32 bytes = 256 bits
-	if _, err := rand.Read(bytes); err != nil {
-		// Fallback to UUID if there's an error with crypto/rand
-		return uuid.New().String() + "-" + strconv.FormatInt(time.Now().UnixNano(), 10)
-	}
-	return hex.EncodeToString(bytes)
-}
-
 // InitializeAdmin создает администратора при первом запуске приложения
 func (s *AuthService) InitializeAdmin(ctx context.Context) error {
 	// Проверяем, заданы ли переменные окружения для админа
@@ -101,7 +143,7 @@ func (s *AuthService) InitializeAdmin(ctx context.Context) error {
 	}
 
 	// Создаем нового администратора
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(s.cfg.AppPassword), bcrypt.DefaultCost)
+	hashedPassword, err := s.passwordHasher.Hash(s.cfg.AppPassword)
 	if err != nil {
 		logger.Error("Failed to hash admin password", zap.Error(err))
 		return fmt.Errorf("failed to hash admin password: %w", err)
@@ -110,7 +152,7 @@ func (s *AuthService) InitializeAdmin(ctx context.Context) error {
 	newAdmin := &models.User{
 		Username:      s.cfg.AppUser,
 		Email:         s.cfg.AppUser,
-		Password:      string(hashedPassword),
+		Password:      hashedPassword,
 		Role:          "admin",
 		EmailVerified: true,
 	}
@@ -127,7 +169,7 @@ func (s *AuthService) InitializeAdmin(ctx context.Context) error {
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Password string `json:"password" binding:"required"`
 }
 
 type LoginRequest struct {
@@ -136,85 +178,62 @@ type LoginRequest struct {
 }
 
 type AuthResponse struct {
-	AccessToken string       `json:"access_token"`
-	ExpiresAt   int64        `json:"expires_at"`
-	User        *models.User `json:"user"`
+	*jwt.TokenPair
+	User *models.User `json:"user"`
 }
 
-// ValidatePasswordStrength проверяет сложность пароля
-var (
-	ErrPasswordTooShort  = errors.New("password must be at least 12 characters long")
-	ErrPasswordNoUpper   = errors.New("password must contain uppercase letters")
-	ErrPasswordNoLower   = errors.New("password must contain lowercase letters")
-	ErrPasswordNoNumber  = errors.New("password must contain numbers")
-	ErrPasswordNoSpecial = errors.New("password must contain special characters")
-	ErrPasswordCommon    = errors.New("password is too common")
-)
-
-func ValidatePasswordStrength(password string) error {
-	if len(password) < 12 {
-		return ErrPasswordTooShort
-	}
-
-	var hasUpper, hasLower, hasNumber, hasSpecial bool
-	for _, char := range password {
-		switch {
-		case unicode.IsUpper(char):
-			hasUpper = true
-		case unicode.IsLower(char):
-			hasLower = true
-		case unicode.IsNumber(char):
-			hasNumber = true
-		case unicode.IsPunct(char) || unicode.IsSymbol(char):
-			hasSpecial = true
-		}
-	}
-
-	if !hasUpper {
-		return ErrPasswordNoUpper
-	}
-	if !hasLower {
-		return ErrPasswordNoLower
-	}
-	if !hasNumber {
-		return ErrPasswordNoNumber
-	}
-	if !hasSpecial {
-		return ErrPasswordNoSpecial
-	}
-
-	// Check against common passwords
-	if isCommonPassword(password) {
-		return ErrPasswordCommon
-	}
-
-	return nil
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// verifyPassword сверяет пароль с хешем пользователя. Учетные записи без пароля
+// (созданные через SSO) и хеши неизвестного формата не проходят проверку
+func (s *AuthService) verifyPassword(user *models.User, password string) bool {
+	if user == nil || user.Password == "" {
+		// Хеш проверяется и без учетной записи, чтобы время ответа ее не выдавало
+		_, _ = s.passwordHasher.Verify(s.dummyPasswordHash(), password)
+		return false
+	}
+	ok, err := s.passwordHasher.Verify(user.Password, password)
 	if err != nil {
-		return "", err
+		logger.Error("Failed to verify password hash", zap.Error(err), zap.String("user_id", user.ID.String()))
+		return false
 	}
-	return string(hashedPassword), nil
+	return ok
 }
 
-func ComparePassword(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+// dummyPasswordHash хеш случайного пароля с текущими параметрами хеширования
+func (s *AuthService) dummyPasswordHash() string {
+	s.dummyHashOnce.Do(func() {
+		password, err := utils.GenerateRandomString(32)
+		if err == nil {
+			s.dummyHash, err = s.passwordHasher.Hash(password)
+		}
+		if err != nil {
+			logger.Error("Failed to create dummy password hash", zap.Error(err))
+		}
+	})
+	return s.dummyHash
 }
 
-func isCommonPassword(password string) bool {
-	commonPasswords := []string{
-		"password", "123456", "12345678", "123456789", "qwerty",
-		"abc123", "password1", "admin", "welcome", "monkey",
+// upgradePasswordHash перехеширует пароль текущим алгоритмом после успешного входа,
+// если сохраненный хеш создан bcrypt или с прежними параметрами
+func (s *AuthService) upgradePasswordHash(ctx context.Context, user *models.User, password string) {
+	if !s.passwordHasher.NeedsRehash(user.Password) {
+		return
 	}
 
-	for _, common := range commonPasswords {
-		if password == common {
-			return true
-		}
+	hashedPassword, err := s.passwordHasher.Hash(password)
+	if err != nil {
+		logger.Error("Failed to rehash password", zap.Error(err), zap.String("user_id", user.ID.String()))
+		return
+	}
+	if err := s.userRepo.UpdatePasswordHash(ctx, user.ID, user.Password, hashedPassword); err != nil {
+		logger.Error("Failed to upgrade password hash", zap.Error(err), zap.String("user_id", user.ID.String()))
+		return
 	}
-	return false
+	user.Password = hashedPassword
+	logger.Info("Password hash upgraded", zap.String("user_id", user.ID.String()))
 }
 
 // GenerateVerificationToken создает безопасный токен для верификации
@@ -234,15 +253,16 @@ func (s *AuthService) Register(c *gin.Context) {
 		return
 	}
 
-	// Валидация пароля
-	if err := ValidatePasswordStrength(req.Password); err != nil {
+	ctx := c.Request.Context()
+
+	// Валидация пароля по политике роли новых пользователей
+	candidate := &models.User{Username: req.Username, Email: req.Email, Role: "user"}
+	if err := s.passwordValidator.Validate(ctx, req.Password, candidate); err != nil {
 		logger.Error("Invalid registration request", zap.Error(err))
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx := c.Request.Context()
-
 	// Проверка существования пользователя по email
 	exitingUserByEmail, err := s.userRepo.GetUserByEmail(ctx, req.Email)
 	if err != nil {
@@ -314,7 +334,7 @@ func (s *AuthService) Register(c *gin.Context) {
 	}
 
 	// Хеширование пароля
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := s.passwordHasher.Hash(req.Password)
 	if err != nil {
 		logger.Error("Failed to hash password", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Registration failed"})
@@ -333,7 +353,7 @@ func (s *AuthService) Register(c *gin.Context) {
 	newUser := &models.User{
 		Username:                req.Username,
 		Email:                   req.Email,
-		Password:                string(hashedPassword),
+		Password:                hashedPassword,
 		Role:                    "user",
 		EmailVerified:           false,
 		EmailVerificationToken:  &verificationToken,
@@ -381,98 +401,286 @@ func (s *AuthService) Login(c *gin.Context) {
 		// Если не найдено по email, попробуем по username
 		user, err = s.userRepo.GetUserByUsername(ctx, req.Identifier)
 		if err != nil || user == nil {
-			time.Sleep(time.Millisecond * 100)
+			s.verifyPassword(nil, req.Password)
+			s.saveLoginAttempt(c, s.newLoginAttempt(c, uuid.Nil, req.Identifier, LoginStatusFailed))
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 			return
 		}
 	}
 
-	// Проверка верификации email
+	// Пароль проверяется и во время блокировки, чтобы время ответа не выдавало блокировку.
+	// Ответ заблокированной учетной записи тот же, что при неверном пароле
+	passwordOK := s.verifyPassword(user, req.Password)
+
+	// Неподтвержденный адрес получает тот же ответ, что и неверный пароль. Владельцу,
+	// знающему пароль, письмо подтверждения отправляется повторно вне запроса
 	if !user.EmailVerified {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "email not verified"})
-
-		// Если пользователь существует но не верифицирован, отправляем письмо повторно
-		if !user.EmailVerified && time.Since(user.EmailVerificationSentAt) > 3*time.Minute {
-			newToken, err := GenerateVerificationToken()
-			if err != nil {
-				logger.Error("Failed to generate verification token", zap.Error(err))
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Registration failed"})
-				return
-			}
+		s.recordLoginAttempt(c, user, LoginStatusDenied)
+		if passwordOK && time.Since(user.EmailVerificationSentAt) > 3*time.Minute {
+			runInBackground("verification_email", func(ctx context.Context) error {
+				return s.resendVerificationEmail(ctx, user)
+			})
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		s.recordLoginAttempt(c, user, LoginStatusLocked)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+	if !passwordOK {
+		s.loginFailed(c, user)
+		return
+	}
+	s.upgradePasswordHash(ctx, user, req.Password)
+	if user.LoginAttempts > 0 || user.LockedUntil != nil {
+		if err := s.lockoutRepo.Reset(ctx, user.ID); err != nil {
+			logger.Error("Failed to reset login attempts", zap.Error(err), zap.String("user_id", user.ID.String()))
+		}
+	}
 
-			// Обновляем токен и время отправки
-			user.EmailVerificationToken = &newToken
-			user.EmailVerificationSentAt = time.Now()
+	if !checkAccountAccess(c, user) {
+		s.recordLoginAttempt(c, user, LoginStatusDenied)
+		return
+	}
 
-			if err := s.userRepo.UpdateUser(ctx, user); err != nil {
-				logger.Error("Failed to update user verification token", zap.Error(err))
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Registration failed"})
-				return
-			}
+	// При подключенном втором факторе вместо токенов выдается MFA challenge. С доверенного
+	// устройства второй фактор не запрашивается, вход по паролю проходит обычную оценку риска
+	methods, err := s.mfaMethods(ctx, user.ID)
+	if err != nil {
+		logger.Error("Failed to get MFA methods", zap.Error(err), zap.String("user_id", user.ID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+	if len(methods) > 0 {
+		if device, _ := s.lookupDevice(c, user); s.deviceTrusted(user, device) {
+			logger.Info("MFA skipped for trusted device", zap.String("user_id", user.ID.String()), zap.String("device_id", device.ID.String()))
+			s.completeLogin(c, user, []string{AMRPassword})
+			return
+		}
 
-			// Отправляем письмо
-			if s.cfg.AppEnv == "production" {
-				if err := s.emailService.SendVerificationEmail(user.Email, newToken); err != nil {
-					logger.Error("Не удалось отправить письмо подтверждения",
-						zap.Error(err),
-						zap.String("email", user.Email))
-				}
-			}
+		s.recordLoginAttempt(c, user, LoginStatusMFARequired)
+		s.startMFAChallenge(c, user, methods, AMRPassword)
+		return
+	}
 
-			c.JSON(http.StatusOK, gin.H{
-				"message": "Письмо с подтверждением отправлено повторно. Проверьте вашу почту.",
-			})
-			return
+	s.completeLogin(c, user, []string{AMRPassword})
+}
 
-		}
+// checkAccountAccess отвечает клиенту, если учетной записи запрещен вход: она деактивирована
+// через SCIM или заблокирована владельцем после отмены смены email
+func checkAccountAccess(c *gin.Context, user *models.User) bool {
+	if user.Disabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account disabled"})
+		return false
+	}
+	if user.SecurityLockedAt != nil {
+		c.JSON(http.StatusLocked, gin.H{"error": "account locked, reset your password to unlock it"})
+		return false
+	}
+	return true
+}
 
-		logger.Info("Registration attempt with existing email", zap.String("identifier", req.Identifier))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Пользователь с таким email уже зарегистрирован"})
+// completeLogin создает сессию и возвращает пару токенов после успешной аутентификации.
+// amr - методы, которыми подтверждена личность; они сохраняются в сессии и попадают в токены
+func (s *AuthService) completeLogin(c *gin.Context, user *models.User, amr []string) {
+	ctx := c.Request.Context()
+
+	if slices.Contains(amr, AMRPassword) && s.rejectExpiredPassword(c, user) {
 		return
 	}
 
-	// Проверка пароля
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+	// Риск оценивается до выдачи токенов. Вход по одному паролю с высокой оценкой
+	// подтверждается кодом из письма, второй фактор и ключи уже подтверждают владельца
+	attempt := s.newLoginAttempt(c, user.ID, user.Email, LoginStatusSuccess)
+	assessment := s.riskEngine.Assess(ctx, attempt)
+	if assessment.StepUp && slices.Equal(amr, []string{AMRPassword}) {
+		attempt.Status = LoginStatusStepUpRequired
+		s.saveLoginAttempt(c, attempt)
+		s.startLoginVerification(c, user)
 		return
 	}
+	if assessment.Suspicious {
+		attempt.Status = LoginStatusSuspicious
+	}
 
-	// Генерация JWT токена
-	token, expiresAt, err := s.GenerateJWTToken(user.ID, user.Role)
+	device, knownDevice := s.registerDevice(c, user)
+
+	// Генерация пары JWT токенов, привязанных к новой сессии
+	now := time.Now()
+	sessionID := uuid.New()
+	tokens, err := s.jwtService.GenerateTokenPair(user.ID.String(), user.Email, user.Role, sessionID.String(), amr, now.Add(s.cfg.RefreshMaxLifetime))
 	if err != nil {
 		logger.Error("Failed to generate JWT token", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
 		return
 	}
 
+	session := &models.Session{
+		ID:         sessionID,
+		UserID:     user.ID,
+		Device:     s.describeDevice(c.Request.UserAgent()),
+		UserAgent:  c.Request.UserAgent(),
+		IPAddress:  c.ClientIP(),
+		RefreshJTI: tokens.RefreshTokenID,
+		AMR:        utils.EncodeStringList(amr),
+		LastSeenAt: now,
+		ExpiresAt:  tokens.RefreshExpiresAt,
+		CreatedAt:  now,
+	}
+	if device != nil {
+		session.DeviceID = &device.ID
+	}
+	if err := s.sessionRepo.CreateSession(ctx, session); err != nil {
+		logger.Error("Failed to create session", zap.Error(err), zap.String("user_id", user.ID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
+		return
+	}
+	attempt.SessionID = sessionID.String()
+	s.recordSuccessfulLogin(c, user, attempt, assessment, knownDevice)
+
 	// Не возвращаем пароль в ответе
 	user.Password = ""
 
 	c.JSON(http.StatusOK, AuthResponse{
-		AccessToken: token,
-		ExpiresAt:   expiresAt,
-		User:        user,
+		TokenPair: tokens,
+		User:      user,
 	})
 }
 
-func (s *AuthService) GenerateJWTToken(userID uuid.UUID, role string) (string, int64, error) {
-	expiresAt := time.Now().Add(time.Hour * 24).Unix()
+// Refresh обменивает refresh токен на новую пару токенов той же сессии. Refresh токен
+// одноразовый: повторное предъявление уже замененного токена отзывает всю сессию.
+// Ротация не продлевает сессию дольше RefreshMaxLifetime с момента входа
+func (s *AuthService) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	claims, err := s.jwtService.ValidateRefreshToken(req.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	session, err := middleware.ValidateSession(ctx, s.sessionRepo, claims.SessionID, claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "session revoked or expired"})
+		return
+	}
+
+	if session.RefreshJTI != claims.ID {
+		s.revokeReusedSession(c, session)
+		return
+	}
+
+	deadline := session.CreatedAt.Add(s.cfg.RefreshMaxLifetime)
+	if !time.Now().Before(deadline) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "session revoked or expired"})
+		return
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, session.UserID)
+	if err != nil || user == nil || user.Disabled || user.SecurityLockedAt != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return
+	}
+
+	tokens, err := s.jwtService.GenerateTokenPair(user.ID.String(), user.Email, user.Role, session.ID.String(), utils.DecodeStringList(session.AMR), deadline)
+	if err != nil {
+		logger.Error("Failed to generate JWT token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	rotated, err := s.sessionRepo.RotateSession(ctx, session.ID, claims.ID, tokens.RefreshTokenID, tokens.RefreshExpiresAt, s.cfg.RefreshMaxLifetime)
+	if err != nil {
+		logger.Error("Failed to rotate session refresh token", zap.Error(err), zap.String("session_id", session.ID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh token"})
+		return
+	}
+
+	// Токен успели заменить параллельным запросом
+	if !rotated {
+		s.revokeReusedSession(c, session)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (s *AuthService) revokeReusedSession(c *gin.Context, session *models.Session) {
+	logger.Warn("Refresh token reuse detected, revoking session",
+		zap.String("session_id", session.ID.String()),
+		zap.String("user_id", session.UserID.String()),
+		zap.String("ip", c.ClientIP()))
+
+	if _, err := s.sessionRepo.RevokeSession(c.Request.Context(), session.UserID, session.ID); err != nil {
+		logger.Error("Failed to revoke session", zap.Error(err), zap.String("session_id", session.ID.String()))
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reuse detected"})
+}
+
+// Logout отзывает сессию, которой выполнен запрос; выданные для нее токены перестают действовать
+func (s *AuthService) Logout(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
+		return
+	}
+
+	if _, err := s.sessionRepo.RevokeSession(c.Request.Context(), userID, sessionID); err != nil {
+		logger.Error("Failed to revoke session", zap.Error(err), zap.String("session_id", sessionID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to logout"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// describeDevice формирует название устройства для списка сессий, например "Chrome on Windows"
+func (s *AuthService) describeDevice(userAgent string) string {
+	device := s.userAgentParser.Parse(userAgent)
+	name := s.userAgentParser.GetFriendlyBrowserName(device)
+	if device.OS != "" && device.OS != "Unknown" {
+		name += " on " + device.OS
+	}
+	return name
+}
 
-	claims := jwt.MapClaims{
-		"sub":  userID.String(),
-		"role": role,
-		"exp":  expiresAt,
-		"iat":  time.Now().Unix(),
+// resendVerificationEmail выпускает новый токен подтверждения адреса и отправляет письмо
+func (s *AuthService) resendVerificationEmail(ctx context.Context, user *models.User) error {
+	newToken, err := GenerateVerificationToken()
+	if err != nil {
+		return err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(s.jwtSecret))
-	return tokenString, expiresAt, err
+	user.EmailVerificationToken = &newToken
+	user.EmailVerificationSentAt = time.Now()
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+
+	if s.cfg.AppEnv != "production" {
+		return nil
+	}
+	return s.emailService.SendVerificationEmail(user.Email, newToken)
 }
 
 func (s *AuthService) VerifyEmail(c *gin.Context) {
 	token := c.Query("token")
-	logger.Info("VerifyEmail called", zap.String("token", token))
+	logger.Info("VerifyEmail called", zap.String("ip", c.ClientIP()))
 	if token == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -543,27 +751,20 @@ func (s *AuthService) AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(s.jwtSecret), nil
-		})
-
-		if err != nil || token == nil || !token.Valid {
+		claims, err := s.jwtService.ValidateToken(tokenString)
+		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token claims"})
+		userID, err := uuid.Parse(claims.UserID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
 			return
 		}
 
-		userID, err := uuid.Parse(claims["sub"].(string))
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID"})
+		if _, err := middleware.ValidateSession(c.Request.Context(), s.sessionRepo, claims.SessionID, claims.UserID); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session revoked or expired"})
 			return
 		}
 
@@ -608,157 +809,3 @@ func CurrentUserHandler(c *gin.Context) {
 		"role":     user.Role,
 	})
 }
-
-func (h *AuthService) LoginHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var loginRequest struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-		UserID   string `json:"user_id"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&loginRequest); err != nil {
-		http.Error(w, "Неверный формат JSON", http.StatusBadRequest)
-		return
-	}
-
-	// Аутентификация пользователя
-	if !h.authenticateUser(loginRequest.Email, loginRequest.Password) {
-		http.Error(w, "Неверные учетные данные", http.StatusUnauthorized)
-		return
-	}
-
-	// Собираем информацию о входе
-	loginAttempt, err := h.createLoginAttempt(r, loginRequest.Email, loginRequest.UserID)
-	if err != nil {
-		http.Error(w, "Ошибка обработки запроса", http.StatusInternalServerError)
-		return
-	}
-
-	// Сохраняем попытку входа
-	if err := h.securityRepo.CreateLoginAttempt(r.Context(), &loginAttempt); err != nil {
-		http.Error(w, "Ошибка сохранения попытки входа", http.StatusInternalServerError)
-		return
-	}
-
-	// Создаем и сохраняем уведомление
-	user, err := h.userRepo.GetUserByEmail(r.Context(), loginRequest.Email)
-	if err == nil && user != nil {
-		notification := h.notificationService.CreateLoginNotification(&loginAttempt, user)
-		if err := h.securityRepo.CreateNotification(r.Context(), notification); err != nil {
-			// Логируем ошибку, но не прерываем выполнение
-			logger.Error("Failed to save notification", zap.Error(err))
-		}
-	}
-
-	// Возвращаем успешный ответ
-	response := map[string]interface{}{
-		"success":           true,
-		"message":           "Вход выполнен успешно",
-		"attempt_id":        loginAttempt.ID,
-		"notification_sent": true,
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
-
-// createLoginAttempt создает запись о попытке входа
-func (h *AuthService) createLoginAttempt(r *http.Request, email, userID string) (models.LoginAttempt, error) {
-	ip := h.getClientIP(r)
-	userAgent := r.Header.Get("User-Agent")
-
-	// Парсим User-Agent
-	deviceInfo := h.userAgentParser.Parse(userAgent)
-
-	// Определяем местоположение
-	geoLocation, err := h.geoLocationService.GetLocationByIP(ip)
-	if err != nil {
-		fmt.Printf("Ошибка определения местоположения: %v\n", err)
-	}
-
-	//Конвертируем строку UserID к uuid.UUID
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		return models.LoginAttempt{}, fmt.Errorf("invalid user ID format: %w", err)
-	}
-
-	attempt := models.LoginAttempt{
-		ID:          uuid.New(),
-		UserID:      userUUID,
-		Email:       email,
-		Timestamp:   time.Now(),
-		IPAddress:   ip,
-		UserAgent:   userAgent,
-		DeviceInfo:  deviceInfo,
-		GeoLocation: geoLocation,
-		SessionID:   generateSessionID(),
-		Status:      "success",
-	}
-
-	return attempt, nil
-}
-
-// getClientIP извлекает реальный IP-адрес клиента
-func (h *AuthService) getClientIP(r *http.Request) string {
-	// Пробуем получить IP из заголовков (если за прокси)
-	if ip := r.Header.Get("X-Real-IP"); ip != "" {
-		return ip
-	}
-	if ip := r.Header.Get("X-Forwarded-For"); ip != "" {
-		// Берем первый IP из списка
-		ips := strings.Split(ip, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
-	}
-
-	// Безопасное извлечение IP из RemoteAddr
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		// Если SplitHostPort возвращает ошибку, возможно это просто IP без порта
-		if strings.Contains(r.RemoteAddr, ":") {
-			// IPv6 адрес без порта
-			return r.RemoteAddr
-		}
-		// IPv4 адрес без порта
-		return r.RemoteAddr
-	}
-	return host
-}
-
-// authenticateUser заглушка аутентификации
-func (h *AuthService) authenticateUser(email, password string) bool {
-	// В реальном приложении здесь должна быть проверка в базе данных
-	return email != "" && password != ""
-}
-
-// GetLoginHistoryHandler возвращает историю входов пользователя
-func (h *AuthService) GetLoginHistoryHandler(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		http.Error(w, "user_id обязателен", http.StatusBadRequest)
-		return
-	}
-
-	// Convert string userID to uuid.UUID
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		http.Error(w, "invalid user_id format", http.StatusBadRequest)
-		return
-	}
-
-	// Use the securityRepo field instead of a non-existent 'repository' field
-	history, err := h.securityRepo.GetUserLoginHistory(r.Context(), userUUID, 50) // Specify a limit
-	if err != nil {
-		http.Error(w, "failed to get login history", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(history)
-}
@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"jiko-auth/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// backgroundTimeout ограничивает работу, вынесенную из запроса, например отправку письма
+const backgroundTimeout = time.Minute
+
+// runInBackground выполняет task вне запроса. Ответ на запрос не ждет SMTP и базу,
+// поэтому по времени ответа нельзя узнать, существует ли учетная запись
+func runInBackground(name string, task func(ctx context.Context) error) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundTimeout)
+		defer cancel()
+
+		if err := task(ctx); err != nil {
+			logger.Warn("Background task failed", zap.String("task", name), zap.Error(err))
+		}
+	}()
+}
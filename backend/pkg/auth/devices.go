@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"jiko-auth/internal/models"
+	"jiko-auth/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// deviceCookieName cookie браузера "<ключ>.<подпись>", общая для всех пользователей этого браузера
+	deviceCookieName = "jiko_device"
+	// deviceSignaturePrefix отделяет подписи cookie от других хешей того же ключа
+	deviceSignaturePrefix = "device:"
+)
+
+// deviceKeyFromCookie возвращает ключ браузера из cookie; пустую строку, если cookie нет или подпись неверна
+func (s *AuthService) deviceKeyFromCookie(c *gin.Context) string {
+	value, err := c.Cookie(deviceCookieName)
+	if err != nil {
+		return ""
+	}
+	key, signature, found := strings.Cut(value, ".")
+	if !found {
+		return ""
+	}
+	if _, err := uuid.Parse(key); err != nil {
+		return ""
+	}
+	if !s.tokenHasher.Matches(signature, deviceSignaturePrefix+key) {
+		logger.Warn("Invalid device cookie signature", zap.String("ip", c.ClientIP()))
+		return ""
+	}
+	return key
+}
+
+func (s *AuthService) setDeviceCookie(c *gin.Context, key string) {
+	value := key + "." + s.tokenHasher.Hash(deviceSignaturePrefix+key)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(deviceCookieName, value, int(s.cfg.DeviceCookieTTL.Seconds()), "/", "", s.cfg.AppEnv == "production", true)
+}
+
+// lookupDevice находит устройство пользователя по cookie браузера. Вместе с устройством возвращается
+// ключ из cookie, под которым можно зарегистрировать новое устройство. Cookie, перенесенная в другой
+// браузер или ОС, устройство не подтверждает, и ключ для нее не возвращается
+func (s *AuthService) lookupDevice(c *gin.Context, user *models.User) (*models.UserDevice, string) {
+	key := s.deviceKeyFromCookie(c)
+	if key == "" {
+		return nil, ""
+	}
+
+	device, err := s.deviceRepo.FindDevice(c.Request.Context(), user.ID, key)
+	if err != nil {
+		logger.Error("Failed to find user device", zap.Error(err), zap.String("user_id", user.ID.String()))
+		return nil, ""
+	}
+	if device == nil {
+		return nil, key
+	}
+
+	info := s.userAgentParser.Parse(c.Request.UserAgent())
+	if device.Browser != info.Browser || device.OS != info.OS {
+		logger.Warn("Device cookie presented from a different browser",
+			zap.String("user_id", user.ID.String()),
+			zap.String("device_id", device.ID.String()),
+			zap.String("ip", c.ClientIP()))
+		return nil, ""
+	}
+	return device, key
+}
+
+// deviceTrusted вход с устройства не требует второго фактора, пока не истек срок доверия.
+// Смена пароля отменяет доверие, выданное до нее
+func (s *AuthService) deviceTrusted(user *models.User, device *models.UserDevice) bool {
+	if device == nil || device.TrustedAt == nil || s.cfg.DeviceTrustTTL <= 0 {
+		return false
+	}
+	if user.PasswordChangedAt != nil && !device.TrustedAt.After(*user.PasswordChangedAt) {
+		return false
+	}
+	return time.Since(*device.TrustedAt) < s.cfg.DeviceTrustTTL
+}
+
+// registerDevice отмечает вход в реестре устройств и продлевает cookie браузера.
+// Возвращает устройство (nil, если реестр недоступен) и признак того, что оно уже было известно
+func (s *AuthService) registerDevice(c *gin.Context, user *models.User) (*models.UserDevice, bool) {
+	ctx := c.Request.Context()
+	now := time.Now()
+
+	device, key := s.lookupDevice(c, user)
+	if device != nil {
+		if err := s.deviceRepo.TouchDevice(ctx, device.ID, c.ClientIP(), now); err != nil {
+			logger.Error("Failed to update user device", zap.Error(err), zap.String("device_id", device.ID.String()))
+		}
+		s.setDeviceCookie(c, key)
+		return device, true
+	}
+
+	if key == "" {
+		key = uuid.NewString()
+	}
+	info := s.userAgentParser.Parse(c.Request.UserAgent())
+	device = &models.UserDevice{
+		ID:         uuid.New(),
+		UserID:     user.ID,
+		DeviceKey:  key,
+		Name:       s.describeDevice(c.Request.UserAgent()),
+		Browser:    info.Browser,
+		OS:         info.OS,
+		DeviceType: info.DeviceType,
+		IPAddress:  c.ClientIP(),
+		LastSeenAt: now,
+	}
+	if err := s.deviceRepo.CreateDevice(ctx, device); err != nil {
+		logger.Error("Failed to register user device", zap.Error(err), zap.String("user_id", user.ID.String()))
+		return nil, false
+	}
+	s.setDeviceCookie(c, key)
+	return device, false
+}
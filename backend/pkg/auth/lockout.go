@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/repository"
+	"jiko-auth/internal/utils"
+	"jiko-auth/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxLockoutDuration предел роста срока блокировки при повторных неудачах
+	maxLockoutDuration = 24 * time.Hour
+	unlockTokenTTL     = 24 * time.Hour
+)
+
+type UnlockAccountRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// UnlockAccount снимает блокировку по ссылке из письма о блокировке
+func (s *AuthService) UnlockAccount(c *gin.Context) {
+	var req UnlockAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	unlock, err := s.lockoutRepo.ConsumeUnlockToken(ctx, req.Token)
+	if err != nil {
+		logger.Error("Failed to consume unlock token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock account"})
+		return
+	}
+	if unlock == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired unlock link"})
+		return
+	}
+
+	if err := s.lockoutRepo.Reset(ctx, unlock.UserID); err != nil {
+		logger.Error("Failed to unlock account", zap.Error(err), zap.String("user_id", unlock.UserID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock account"})
+		return
+	}
+
+	logger.Info("Account unlocked by email link", zap.String("user_id", unlock.UserID.String()), zap.String("ip", c.ClientIP()))
+	c.JSON(http.StatusOK, gin.H{"message": "Your account has been unlocked. You can sign in again."})
+}
+
+// lockoutPolicy параметры блокировки из конфигурации
+func (s *AuthService) lockoutPolicy() repository.LockoutPolicy {
+	return repository.LockoutPolicy{
+		MaxAttempts:  s.cfg.MaxLoginAttempts,
+		BaseDuration: s.cfg.LockoutDuration,
+		MaxDuration:  maxLockoutDuration,
+	}
+}
+
+// loginFailed учитывает неверный пароль и при достижении лимита блокирует вход
+// с письмом для разблокировки. Ответ не отличается от ответа для неизвестного пользователя
+func (s *AuthService) loginFailed(c *gin.Context, user *models.User) {
+	status := LoginStatusFailed
+	lockedUntil, err := s.lockoutRepo.RecordFailure(c.Request.Context(), user.ID, s.lockoutPolicy())
+	if err != nil {
+		logger.Error("Failed to record login failure", zap.Error(err), zap.String("user_id", user.ID.String()))
+	}
+	if lockedUntil != nil {
+		status = LoginStatusLocked
+		logger.Warn("Account locked after failed logins",
+			zap.String("user_id", user.ID.String()),
+			zap.String("ip", c.ClientIP()),
+			zap.Time("locked_until", *lockedUntil))
+		userID, email, until, ip := user.ID, user.Email, *lockedUntil, c.ClientIP()
+		runInBackground("account_unlock", func(ctx context.Context) error {
+			return s.sendUnlockEmail(ctx, userID, email, until, ip)
+		})
+	}
+
+	s.recordLoginAttempt(c, user, status)
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+}
+
+// sendUnlockEmail выпускает токен разблокировки и отправляет владельцу письмо о блокировке
+func (s *AuthService) sendUnlockEmail(ctx context.Context, userID uuid.UUID, email string, lockedUntil time.Time, ip string) error {
+	token, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return err
+	}
+
+	unlock := &models.AccountUnlockToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(unlockTokenTTL),
+	}
+	if err := s.lockoutRepo.CreateUnlockToken(ctx, unlock, token); err != nil {
+		return err
+	}
+
+	return s.emailService.SendAccountLockedEmail(email, token, lockedUntil, ip)
+}
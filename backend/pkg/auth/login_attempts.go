@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"jiko-auth/internal/models"
+	"jiko-auth/pkg/logger"
+	"jiko-auth/pkg/risk"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Статусы записей LoginAttempt
+const (
+	LoginStatusSuccess         = "success"
+	LoginStatusFailed          = "failed"
+	LoginStatusLocked          = "locked"
+	LoginStatusDenied          = "denied"
+	LoginStatusMFARequired     = "mfa_required"
+	LoginStatusPasswordExpired = "password_expired"
+	LoginStatusStepUpRequired  = "step_up_required"
+	LoginStatusSuspicious      = "suspicious"
+)
+
+// recordLoginAttempt сохраняет попытку входа в историю пользователя
+func (s *AuthService) recordLoginAttempt(c *gin.Context, user *models.User, status string) {
+	s.saveLoginAttempt(c, s.newLoginAttempt(c, user.ID, user.Email, status))
+}
+
+// newLoginAttempt собирает запись о попытке входа с данными устройства и местоположения.
+// Для неизвестного идентификатора userID пустой, а вместо email сохраняется введенный идентификатор
+func (s *AuthService) newLoginAttempt(c *gin.Context, userID uuid.UUID, email, status string) *models.LoginAttempt {
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+
+	location, err := s.geoLocationService.GetLocationByIP(c.Request.Context(), ip)
+	if err != nil {
+		logger.Warn("Failed to resolve login location", zap.Error(err), zap.String("ip", ip))
+	}
+
+	return &models.LoginAttempt{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Email:       email,
+		Timestamp:   time.Now(),
+		IPAddress:   ip,
+		UserAgent:   userAgent,
+		DeviceInfo:  s.userAgentParser.Parse(userAgent),
+		GeoLocation: location,
+		Status:      status,
+	}
+}
+
+func (s *AuthService) saveLoginAttempt(c *gin.Context, attempt *models.LoginAttempt) {
+	if err := s.securityRepo.CreateLoginAttempt(c.Request.Context(), attempt); err != nil {
+		logger.Error("Failed to save login attempt", zap.Error(err), zap.String("user_id", attempt.UserID.String()))
+	}
+}
+
+// recordSuccessfulLogin сохраняет вход в новую сессию и уведомляет пользователя о входе
+// с нового устройства и о подозрительном входе, в том числе по почте. Обычный вход
+// с известного устройства уведомления не создает
+func (s *AuthService) recordSuccessfulLogin(c *gin.Context, user *models.User, attempt *models.LoginAttempt, assessment risk.Assessment, knownDevice bool) {
+	s.saveLoginAttempt(c, attempt)
+
+	if !assessment.Suspicious {
+		if knownDevice {
+			return
+		}
+		notification := s.notificationService.CreateLoginNotification(attempt, user)
+		if err := s.securityRepo.CreateNotification(c.Request.Context(), notification); err != nil {
+			logger.Error("Failed to save login notification", zap.Error(err), zap.String("user_id", user.ID.String()))
+		}
+		if err := s.emailService.SendSecurityNotification(user.Email, notification); err != nil {
+			logger.Warn("Failed to send new device login email", zap.Error(err), zap.String("email", user.Email))
+		}
+		return
+	}
+
+	logger.Warn("Suspicious login",
+		zap.String("user_id", user.ID.String()),
+		zap.String("ip", attempt.IPAddress),
+		zap.Int("risk_score", assessment.Score),
+		zap.Strings("signals", assessment.Signals))
+
+	notification := s.notificationService.CreateSuspiciousLoginNotification(attempt, user, assessment.Signals)
+	if err := s.securityRepo.CreateNotification(c.Request.Context(), notification); err != nil {
+		logger.Error("Failed to save suspicious login notification", zap.Error(err), zap.String("user_id", user.ID.String()))
+	}
+	if err := s.emailService.SendSecurityNotification(user.Email, notification); err != nil {
+		logger.Warn("Failed to send suspicious login email", zap.Error(err), zap.String("email", user.Email))
+	}
+}
+
+// startLoginVerification вместо токенов выдает MFA токен, который подтверждается кодом из письма.
+// Так подтверждается вход по одному паролю, оценка риска которого выше порога
+func (s *AuthService) startLoginVerification(c *gin.Context, user *models.User) {
+	ctx := c.Request.Context()
+
+	code, err := generateLoginCode()
+	if err != nil {
+		logger.Error("Failed to generate login verification code", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+
+	challenge := &models.MFAChallenge{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		AMR:       AMRPassword,
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+	}
+	if err := s.mfaRepo.CreateEmailChallenge(ctx, challenge, code); err != nil {
+		logger.Error("Failed to create login verification challenge", zap.Error(err), zap.String("user_id", user.ID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+
+	token, err := s.jwtService.GenerateMFAToken(user.ID.String(), challenge.ID.String(), mfaChallengeTTL)
+	if err != nil {
+		logger.Error("Failed to generate MFA token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+
+	if err := s.emailService.SendLoginVerificationEmail(user.Email, code, mfaChallengeTTL, c.ClientIP()); err != nil {
+		logger.Warn("Failed to send login verification email", zap.Error(err), zap.String("email", user.Email))
+	}
+
+	c.JSON(http.StatusOK, MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		Methods:     []string{MFAMethodEmail},
+		ExpiresIn:   int64(mfaChallengeTTL.Seconds()),
+	})
+}
@@ -0,0 +1,534 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"jiko-auth/internal/models"
+	"jiko-auth/pkg/logger"
+	"jiko-auth/pkg/totp"
+	"jiko-auth/pkg/webauthn"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	mfaIssuer       = "Jiko Auth"
+	mfaChallengeTTL = 5 * time.Minute
+	mfaMaxAttempts  = 5
+
+	MFAMethodTOTP     = "totp"
+	MFAMethodWebAuthn = "webauthn"
+	MFAMethodEmail    = "email" // код из письма для подтверждения подозрительного входа
+)
+
+// Значения claim amr (RFC 8176) в выдаваемых токенах
+const (
+	AMRPassword    = "pwd"
+	AMROTP         = "otp"
+	AMRHardwareKey = "hwk" // ключ, привязанный к устройству
+	AMRSoftwareKey = "swk" // синхронизируемый passkey
+	AMRMultiFactor = "mfa"
+	// Значений для кодов из письма и кодов восстановления в RFC 8176 нет. Они отличаются
+	// от otp, чтобы доверие к устройству выдавалось только после аутентификатора или ключа
+	AMREmail        = "email"
+	AMRRecoveryCode = "recovery"
+)
+
+// MFAChallengeResponse ответ Login, когда для входа нужен второй фактор
+type MFAChallengeResponse struct {
+	MFARequired bool     `json:"mfa_required"`
+	MFAToken    string   `json:"mfa_token"`
+	Methods     []string `json:"methods"`
+	ExpiresIn   int64    `json:"expires_in"`
+}
+
+// MFAVerifyRequest второй шаг входа: код аутентификатора, ответ ключа WebAuthn
+// либо код восстановления
+type MFAVerifyRequest struct {
+	MFAToken     string                      `json:"mfa_token" binding:"required"`
+	Code         string                      `json:"code"`
+	WebAuthn     *webauthn.AssertionResponse `json:"webauthn"`
+	RecoveryCode string                      `json:"recovery_code"`
+}
+
+// factors число вторых факторов в запросе, должен быть ровно один
+func (r *MFAVerifyRequest) factors() int {
+	count := 0
+	if r.Code != "" {
+		count++
+	}
+	if r.WebAuthn != nil {
+		count++
+	}
+	if r.RecoveryCode != "" {
+		count++
+	}
+	return count
+}
+
+type MFATokenRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TOTPEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// startMFAChallenge сохраняет challenge и возвращает токен второго шага вместо токенов доступа.
+// firstFactor - значение amr уже пройденного первого шага (пароль или код из письма)
+func (s *AuthService) startMFAChallenge(c *gin.Context, user *models.User, methods []string, firstFactor string) {
+	recoveryCodes, err := s.mfaRepo.CountRecoveryCodes(c.Request.Context(), user.ID)
+	if err != nil {
+		logger.Error("Failed to count recovery codes", zap.Error(err), zap.String("user_id", user.ID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+	if recoveryCodes > 0 {
+		methods = append(methods, MFAMethodRecoveryCode)
+	}
+
+	challenge := &models.MFAChallenge{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		AMR:       firstFactor,
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+	}
+	if err := s.mfaRepo.CreateChallenge(c.Request.Context(), challenge); err != nil {
+		logger.Error("Failed to create MFA challenge", zap.Error(err), zap.String("user_id", user.ID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+
+	token, err := s.jwtService.GenerateMFAToken(user.ID.String(), challenge.ID.String(), mfaChallengeTTL)
+	if err != nil {
+		logger.Error("Failed to generate MFA token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		Methods:     methods,
+		ExpiresIn:   int64(mfaChallengeTTL.Seconds()),
+	})
+}
+
+// VerifyMFA второй шаг входа: проверяет код аутентификатора или ответ ключа WebAuthn
+// по MFA токену из Login и выдает токены доступа
+func (s *AuthService) VerifyMFA(c *gin.Context) {
+	var req MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.factors() != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	challenge, user := s.loadMFAChallenge(c, req.MFAToken)
+	if challenge == nil {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	allowed, err := s.mfaRepo.RecordChallengeAttempt(ctx, challenge.ID, mfaMaxAttempts)
+	if err != nil {
+		logger.Error("Failed to record MFA attempt", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "verification failed"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "MFA challenge expired or too many attempts, please log in again"})
+		return
+	}
+
+	var amr []string
+	switch {
+	case challenge.CodeHash != "":
+		// Подозрительный вход подтверждается только кодом из письма
+		if !s.mfaRepo.MatchesEmailCode(challenge, req.Code) {
+			logger.Warn("Invalid login verification code", zap.String("user_id", user.ID.String()), zap.String("ip", c.ClientIP()))
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+			return
+		}
+		amr = []string{AMREmail}
+	case req.WebAuthn != nil:
+		credential := s.verifyMFAWebAuthn(c, user, challenge, req.WebAuthn)
+		if credential == nil {
+			return
+		}
+		amr = []string{webAuthnAMR(credential)}
+	case req.RecoveryCode != "":
+		if !s.useRecoveryCode(c, user, req.RecoveryCode) {
+			return
+		}
+		amr = []string{AMRRecoveryCode}
+	default:
+		credential, err := s.mfaRepo.GetTOTPCredential(ctx, user.ID)
+		if err != nil || credential == nil || !credential.Confirmed {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "MFA is not enabled"})
+			return
+		}
+
+		if !s.useTOTPCode(c, credential, req.Code) {
+			logger.Warn("Invalid MFA code", zap.String("user_id", user.ID.String()), zap.String("ip", c.ClientIP()))
+			return
+		}
+		amr = []string{AMROTP}
+	}
+
+	// Первый шаг - пароль или одноразовый код из письма, amr значения не повторяются
+	firstFactor := challenge.AMR
+	if firstFactor == "" {
+		firstFactor = AMRPassword
+	}
+	if amr[0] != firstFactor {
+		amr = append([]string{firstFactor}, amr...)
+	}
+	amr = append(amr, AMRMultiFactor)
+
+	completed, err := s.mfaRepo.CompleteChallenge(ctx, challenge.ID)
+	if err != nil || !completed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired MFA token"})
+		return
+	}
+
+	s.completeLogin(c, user, amr)
+}
+
+// BeginMFAWebAuthn выдает параметры navigator.credentials.get() для второго шага входа
+// ключом WebAuthn. Challenge сохраняется в MFA challenge входа
+func (s *AuthService) BeginMFAWebAuthn(c *gin.Context) {
+	var req MFATokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	challenge, user := s.loadMFAChallenge(c, req.MFAToken)
+	if challenge == nil {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	credentials, err := s.webauthnRepo.GetUserCredentials(ctx, user.ID)
+	if err != nil {
+		logger.Error("Failed to get WebAuthn credentials", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start verification"})
+		return
+	}
+	if len(credentials) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no security keys registered"})
+		return
+	}
+
+	nonce, err := webauthn.NewChallenge()
+	if err != nil {
+		logger.Error("Failed to generate WebAuthn challenge", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start verification"})
+		return
+	}
+
+	updated, err := s.mfaRepo.SetChallengeNonce(ctx, challenge.ID, nonce)
+	if err != nil {
+		logger.Error("Failed to save WebAuthn challenge", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start verification"})
+		return
+	}
+	if !updated {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired MFA token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, WebAuthnLoginOptions{
+		PublicKey: s.relyingParty.RequestOptions(nonce, credentialDescriptors(credentials), webauthn.UserVerificationPreferred),
+	})
+}
+
+// loadMFAChallenge проверяет MFA токен и загружает challenge и пользователя.
+// При ошибке ответ клиенту уже отправлен
+func (s *AuthService) loadMFAChallenge(c *gin.Context, token string) (*models.MFAChallenge, *models.User) {
+	claims, err := s.jwtService.ValidateMFAToken(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired MFA token"})
+		return nil, nil
+	}
+
+	challengeID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired MFA token"})
+		return nil, nil
+	}
+
+	ctx := c.Request.Context()
+
+	challenge, err := s.mfaRepo.GetChallenge(ctx, challengeID)
+	if err != nil {
+		logger.Error("Failed to get MFA challenge", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "verification failed"})
+		return nil, nil
+	}
+	if challenge == nil || challenge.UserID.String() != claims.UserID {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired MFA token"})
+		return nil, nil
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, challenge.UserID)
+	if err != nil || user == nil || user.Disabled || user.SecurityLockedAt != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired MFA token"})
+		return nil, nil
+	}
+	return challenge, user
+}
+
+// mfaMethods возвращает подключенные вторые факторы пользователя
+func (s *AuthService) mfaMethods(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	var methods []string
+
+	credential, err := s.mfaRepo.GetTOTPCredential(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if credential != nil && credential.Confirmed {
+		methods = append(methods, MFAMethodTOTP)
+	}
+
+	keys, err := s.webauthnRepo.CountUserCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if keys > 0 {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+	return methods, nil
+}
+
+// MFAStatus возвращает состояние второго фактора текущего пользователя
+func (s *AuthService) MFAStatus(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	credential, err := s.mfaRepo.GetTOTPCredential(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to get TOTP credential", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get MFA status"})
+		return
+	}
+
+	keys, err := s.webauthnRepo.CountUserCredentials(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to count WebAuthn credentials", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get MFA status"})
+		return
+	}
+
+	recoveryCodes, err := s.mfaRepo.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to count recovery codes", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get MFA status"})
+		return
+	}
+
+	status := models.MFAStatusResponse{WebAuthnCredentials: keys, RecoveryCodes: recoveryCodes}
+	if credential != nil && credential.Confirmed {
+		status.TOTPEnabled = true
+		status.ConfirmedAt = credential.ConfirmedAt
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// EnrollTOTP создает новый секрет аутентификатора. До подтверждения кодом он не действует,
+// повторный вызов заменяет неподтвержденный секрет
+func (s *AuthService) EnrollTOTP(c *gin.Context) {
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	existing, err := s.mfaRepo.GetTOTPCredential(ctx, user.ID)
+	if err != nil {
+		logger.Error("Failed to get TOTP credential", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enroll"})
+		return
+	}
+	if existing != nil && existing.Confirmed {
+		c.JSON(http.StatusConflict, gin.H{"error": "MFA is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		logger.Error("Failed to generate TOTP secret", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enroll"})
+		return
+	}
+
+	encrypted, err := s.mfaSecrets.Encrypt(secret)
+	if err != nil {
+		logger.Error("Failed to encrypt TOTP secret", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enroll"})
+		return
+	}
+
+	credential := &models.TOTPCredential{
+		UserID: user.ID,
+		Secret: encrypted,
+	}
+	if err := s.mfaRepo.SaveTOTPCredential(ctx, credential); err != nil {
+		logger.Error("Failed to save TOTP credential", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enroll"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TOTPEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(mfaIssuer, user.Email, secret),
+	})
+}
+
+// ConfirmTOTP включает второй фактор после ввода первого кода из приложения
+func (s *AuthService) ConfirmTOTP(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	credential, err := s.mfaRepo.GetTOTPCredential(ctx, user.ID)
+	if err != nil {
+		logger.Error("Failed to get TOTP credential", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to confirm"})
+		return
+	}
+	if credential == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA enrollment not started"})
+		return
+	}
+	if credential.Confirmed {
+		c.JSON(http.StatusConflict, gin.H{"error": "MFA is already enabled"})
+		return
+	}
+
+	if !s.useTOTPCode(c, credential, req.Code) {
+		return
+	}
+
+	now := time.Now()
+	credential.Confirmed = true
+	credential.ConfirmedAt = &now
+	if err := s.mfaRepo.SaveTOTPCredential(ctx, credential); err != nil {
+		logger.Error("Failed to confirm TOTP credential", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to confirm"})
+		return
+	}
+
+	logger.Info("TOTP MFA enabled", zap.String("user_id", user.ID.String()))
+	c.JSON(http.StatusOK, gin.H{"message": "MFA enabled"})
+}
+
+// DisableTOTP отключает второй фактор; требуется действующий код
+func (s *AuthService) DisableTOTP(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	credential, err := s.mfaRepo.GetTOTPCredential(ctx, user.ID)
+	if err != nil || credential == nil || !credential.Confirmed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA is not enabled"})
+		return
+	}
+
+	if !s.useTOTPCode(c, credential, req.Code) {
+		return
+	}
+
+	if _, err := s.mfaRepo.DeleteTOTPCredential(ctx, user.ID); err != nil {
+		logger.Error("Failed to delete TOTP credential", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to disable MFA"})
+		return
+	}
+
+	s.dropUnusedRecoveryCodes(ctx, user.ID)
+
+	logger.Info("TOTP MFA disabled", zap.String("user_id", user.ID.String()))
+	c.JSON(http.StatusOK, gin.H{"message": "MFA disabled"})
+}
+
+// useTOTPCode проверяет код и помечает его интервал использованным. При ошибке
+// ответ клиенту уже отправлен
+func (s *AuthService) useTOTPCode(c *gin.Context, credential *models.TOTPCredential, code string) bool {
+	secret, err := s.mfaSecrets.Decrypt(credential.Secret)
+	if err != nil {
+		logger.Error("Failed to decrypt TOTP secret", zap.Error(err), zap.String("user_id", credential.UserID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify code"})
+		return false
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), credential.LastUsedStep)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return false
+	}
+
+	used, err := s.mfaRepo.UseTOTPStep(c.Request.Context(), credential.UserID, step)
+	if err != nil {
+		logger.Error("Failed to record TOTP step", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify code"})
+		return false
+	}
+	if !used {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "code already used"})
+		return false
+	}
+
+	credential.LastUsedStep = step
+	return true
+}
+
+// currentUser загружает пользователя из контекста AuthMiddleware
+func (s *AuthService) currentUser(c *gin.Context) *models.User {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
+		return nil
+	}
+
+	user, err := s.userRepo.GetUserByID(c.Request.Context(), userID)
+	if err != nil || user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return nil
+	}
+	return user
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/utils"
+	"jiko-auth/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// PasswordPolicy возвращает политику паролей новых пользователей, чтобы форма регистрации
+// показывала требования до отправки
+func (s *AuthService) PasswordPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, s.passwordValidator.PolicyFor(c.Request.Context(), "user"))
+}
+
+// rejectExpiredPassword вместо токенов выдает ссылку сброса, если срок действия пароля истек.
+// Вход по паролю продолжится только после его смены
+func (s *AuthService) rejectExpiredPassword(c *gin.Context, user *models.User) bool {
+	ctx := c.Request.Context()
+	if !s.passwordValidator.Expired(ctx, user) {
+		return false
+	}
+
+	token, err := utils.GenerateRandomString(32)
+	if err != nil {
+		logger.Error("Failed to generate password reset token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return true
+	}
+
+	reset := &models.PasswordResetToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		IPAddress: c.ClientIP(),
+		ExpiresAt: time.Now().Add(s.cfg.PasswordResetTTL),
+	}
+	if err := s.passwordResetRepo.CreateToken(ctx, reset, token); err != nil {
+		logger.Error("Failed to save password reset token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return true
+	}
+
+	s.recordLoginAttempt(c, user, LoginStatusPasswordExpired)
+	logger.Info("Password expired, reset required", zap.String("user_id", user.ID.String()), zap.String("ip", c.ClientIP()))
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":            "password expired",
+		"password_expired": true,
+		"reset_token":      token,
+	})
+	return true
+}
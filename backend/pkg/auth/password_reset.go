@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/utils"
+	"jiko-auth/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// passwordResetPerHour лимит писем сброса пароля одному пользователю
+const passwordResetPerHour = 3
+
+const forgotPasswordMessage = "If an account exists for this address, a password reset link has been sent."
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ForgotPassword отправляет ссылку сброса пароля. Поиск учетной записи, выпуск токена и письмо
+// выполняются вне запроса, поэтому ни ответ, ни время ответа не зависят от того, существует ли
+// учетная запись, и по ним нельзя перебирать адреса
+func (s *AuthService) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	ip := c.ClientIP()
+	runInBackground("password_reset", func(ctx context.Context) error {
+		return s.sendPasswordReset(ctx, email, ip)
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
+}
+
+// sendPasswordReset выпускает токен сброса и отправляет письмо, если учетная запись существует
+func (s *AuthService) sendPasswordReset(ctx context.Context, email, ip string) error {
+	user, err := s.userRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.Disabled {
+		return nil
+	}
+
+	sent, err := s.passwordResetRepo.CountRecentTokens(ctx, user.ID, time.Now().Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+	if sent >= passwordResetPerHour {
+		logger.Warn("Password reset rate limit exceeded", zap.String("user_id", user.ID.String()), zap.String("ip", ip))
+		return nil
+	}
+
+	token, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return err
+	}
+
+	reset := &models.PasswordResetToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		IPAddress: ip,
+		ExpiresAt: time.Now().Add(s.cfg.PasswordResetTTL),
+	}
+	if err := s.passwordResetRepo.CreateToken(ctx, reset, token); err != nil {
+		return err
+	}
+
+	logger.Info("Password reset requested", zap.String("user_id", user.ID.String()), zap.String("ip", ip))
+	return s.emailService.SendPasswordResetEmail(user.Email, token, s.cfg.PasswordResetTTL)
+}
+
+// ResetPassword задает новый пароль по токену из письма и завершает все сеансы пользователя
+func (s *AuthService) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	reset, err := s.passwordResetRepo.FindToken(ctx, req.Token)
+	if err != nil {
+		logger.Error("Failed to find password reset token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+	if reset == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset link"})
+		return
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, reset.UserID)
+	if err != nil || user == nil || user.Disabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset link"})
+		return
+	}
+
+	// Пароль проверяется по политике пользователя до погашения токена, чтобы слабый пароль не сжигал ссылку
+	if err := s.passwordValidator.Validate(ctx, req.Password, user); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reset, err = s.passwordResetRepo.ConsumeToken(ctx, req.Token)
+	if err != nil {
+		logger.Error("Failed to consume password reset token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+	if reset == nil || reset.UserID != user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset link"})
+		return
+	}
+
+	hashedPassword, err := s.passwordHasher.Hash(req.Password)
+	if err != nil {
+		logger.Error("Failed to hash password", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+
+	previousHash := user.Password
+	now := time.Now()
+	user.Password = hashedPassword
+	user.PasswordChangedAt = &now
+	// Сброс пароля снимает блокировку после отмены смены email: письмо получил владелец адреса
+	user.SecurityLockedAt = nil
+	user.LoginAttempts = 0
+	user.LockedUntil = nil
+	// Переход по ссылке из письма подтверждает владение адресом
+	if !user.EmailVerified {
+		user.EmailVerified = true
+		user.EmailVerificationToken = nil
+	}
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		logger.Error("Failed to update password", zap.Error(err), zap.String("user_id", user.ID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+
+	s.passwordValidator.Remember(ctx, user, previousHash)
+
+	s.revokeUserAccess(ctx, user.ID)
+	if err := s.passwordResetRepo.ExpireUserTokens(ctx, user.ID); err != nil {
+		logger.Error("Failed to expire password reset tokens", zap.Error(err), zap.String("user_id", user.ID.String()))
+	}
+
+	logger.Info("Password reset completed", zap.String("user_id", user.ID.String()), zap.String("ip", c.ClientIP()))
+	s.notifyPasswordChanged(c, user)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset. Please sign in with your new password."})
+}
+
+// revokeUserAccess завершает все сессии входа и отзывает OAuth токены пользователя
+func (s *AuthService) revokeUserAccess(ctx context.Context, userID uuid.UUID) {
+	if _, err := s.sessionRepo.RevokeUserSessions(ctx, userID, uuid.Nil); err != nil {
+		logger.Error("Failed to revoke sessions", zap.Error(err), zap.String("user_id", userID.String()))
+	}
+	if err := s.tokenRepo.RevokeTokensForUser(userID.String()); err != nil {
+		logger.Error("Failed to revoke tokens", zap.Error(err), zap.String("user_id", userID.String()))
+	}
+}
+
+// notifyPasswordChanged сохраняет уведомление безопасности и отправляет его на почту
+func (s *AuthService) notifyPasswordChanged(c *gin.Context, user *models.User) {
+	notification := s.notificationService.CreatePasswordChangedNotification(user, c.ClientIP())
+	if err := s.securityRepo.CreateNotification(c.Request.Context(), notification); err != nil {
+		logger.Error("Failed to save notification", zap.Error(err))
+	}
+	if err := s.emailService.SendSecurityNotification(user.Email, notification); err != nil {
+		logger.Warn("Failed to send password changed email", zap.Error(err), zap.String("email", user.Email))
+	}
+}
@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/repository"
+	"jiko-auth/internal/utils"
+	"jiko-auth/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	passwordlessMaxAttempts = 5
+	passwordlessRateWindow  = time.Hour
+)
+
+type PasswordlessStartRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// PasswordlessStartResponse browser_token клиент сохраняет у себя и предъявляет при входе:
+// ссылка из письма, открытая в другом браузере, не сработает
+type PasswordlessStartResponse struct {
+	Message      string `json:"message"`
+	LoginID      string `json:"login_id"`
+	BrowserToken string `json:"browser_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// PasswordlessVerifyRequest вход по токену из ссылки либо по login_id и коду из письма
+type PasswordlessVerifyRequest struct {
+	Token        string `json:"token"`
+	LoginID      string `json:"login_id"`
+	Code         string `json:"code"`
+	BrowserToken string `json:"browser_token" binding:"required"`
+}
+
+// PasswordlessStatus сообщает клиенту, включен ли вход без пароля
+func (s *AuthService) PasswordlessStatus(c *gin.Context) {
+	enabled, err := s.passwordlessEnabled(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get status"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": enabled})
+}
+
+// StartPasswordless отправляет ссылку и код входа на адрес. Ответ одинаков для известных
+// и неизвестных адресов, а лимит писем считается по адресу независимо от наличия учетной записи
+func (s *AuthService) StartPasswordless(c *gin.Context) {
+	var req PasswordlessStartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	enabled, err := s.passwordlessEnabled(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "passwordless login is disabled"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	address := strings.ToLower(strings.TrimSpace(req.Email))
+
+	sent, err := s.passwordlessRepo.CountRecentLogins(ctx, address, time.Now().Add(-passwordlessRateWindow))
+	if err != nil {
+		logger.Error("Failed to count passwordless logins", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	if sent >= int64(s.cfg.MagicLinkPerHour) {
+		logger.Warn("Passwordless rate limit exceeded", zap.String("email", address), zap.String("ip", c.ClientIP()))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many login emails, please try again later"})
+		return
+	}
+
+	token, err := utils.GenerateRandomString(32)
+	if err != nil {
+		logger.Error("Failed to generate passwordless token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	browserToken, err := utils.GenerateRandomString(32)
+	if err != nil {
+		logger.Error("Failed to generate browser token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	code, err := generateLoginCode()
+	if err != nil {
+		logger.Error("Failed to generate passwordless code", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	// Письмо получают только подтвержденные адреса: иначе вход по ссылке открыл бы
+	// учетную запись, заранее зарегистрированную кем-то другим на чужой адрес
+	user, err := s.userRepo.GetUserByEmail(ctx, strings.TrimSpace(req.Email))
+	if err != nil || user == nil || !user.EmailVerified || user.Disabled || user.SecurityLockedAt != nil {
+		user = nil
+	}
+
+	login := &models.PasswordlessLogin{
+		ID:        uuid.New(),
+		Email:     address,
+		IPAddress: c.ClientIP(),
+		ExpiresAt: time.Now().Add(s.cfg.MagicLinkTTL),
+	}
+	if user != nil {
+		login.UserID = &user.ID
+	}
+	if err := s.passwordlessRepo.CreateLogin(ctx, login, token, code, browserToken); err != nil {
+		logger.Error("Failed to save passwordless login", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	// Письмо уходит вне запроса: иначе время ответа выдавало бы существование учетной записи
+	if user != nil {
+		email := user.Email
+		runInBackground("passwordless_email", func(context.Context) error {
+			return s.emailService.SendPasswordlessLoginEmail(email, token, code, s.cfg.MagicLinkTTL)
+		})
+	}
+
+	c.JSON(http.StatusOK, PasswordlessStartResponse{
+		Message:      "If an account exists for this address, a sign-in link and code have been sent.",
+		LoginID:      login.ID.String(),
+		BrowserToken: browserToken,
+		ExpiresIn:    int64(s.cfg.MagicLinkTTL.Seconds()),
+	})
+}
+
+// VerifyPasswordless гасит ссылку или код из письма и завершает вход. При подключенном
+// втором факторе, как и после пароля, выдается MFA challenge
+func (s *AuthService) VerifyPasswordless(c *gin.Context) {
+	var req PasswordlessVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Token == "") == (req.Code == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	enabled, err := s.passwordlessEnabled(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "passwordless login is disabled"})
+		return
+	}
+
+	login := s.findPasswordlessLogin(c, &req)
+	if login == nil {
+		return
+	}
+
+	if !s.passwordlessRepo.MatchesBrowser(login, req.BrowserToken) {
+		logger.Warn("Passwordless login from another browser", zap.String("login_id", login.ID.String()), zap.String("ip", c.ClientIP()))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "open the link in the browser where you requested it"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	if login.UserID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired login"})
+		return
+	}
+
+	consumed, err := s.passwordlessRepo.ConsumeLogin(ctx, login.ID)
+	if err != nil {
+		logger.Error("Failed to consume passwordless login", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+	if !consumed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired login"})
+		return
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, *login.UserID)
+	if err != nil || user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired login"})
+		return
+	}
+	if !checkAccountAccess(c, user) {
+		return
+	}
+
+	methods, err := s.mfaMethods(ctx, user.ID)
+	if err != nil {
+		logger.Error("Failed to get MFA methods", zap.Error(err), zap.String("user_id", user.ID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+	if len(methods) > 0 {
+		s.startMFAChallenge(c, user, methods, AMREmail)
+		return
+	}
+
+	s.completeLogin(c, user, []string{AMREmail})
+}
+
+// findPasswordlessLogin загружает запрос входа по токену ссылки или по ID и коду.
+// Попытки ввода кода ограничены. При ошибке ответ клиенту уже отправлен
+func (s *AuthService) findPasswordlessLogin(c *gin.Context, req *PasswordlessVerifyRequest) *models.PasswordlessLogin {
+	ctx := c.Request.Context()
+
+	if req.Token != "" {
+		login, err := s.passwordlessRepo.GetLoginByToken(ctx, req.Token)
+		if err != nil {
+			logger.Error("Failed to get passwordless login", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+			return nil
+		}
+		if login == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired login"})
+			return nil
+		}
+		return login
+	}
+
+	loginID, err := uuid.Parse(req.LoginID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return nil
+	}
+
+	allowed, err := s.passwordlessRepo.RecordAttempt(ctx, loginID, passwordlessMaxAttempts)
+	if err != nil {
+		logger.Error("Failed to record passwordless attempt", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return nil
+	}
+	if !allowed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "code expired or too many attempts, please request a new one"})
+		return nil
+	}
+
+	login, err := s.passwordlessRepo.GetLogin(ctx, loginID)
+	if err != nil {
+		logger.Error("Failed to get passwordless login", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return nil
+	}
+	if login == nil || !s.passwordlessRepo.MatchesCode(login, strings.TrimSpace(req.Code)) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return nil
+	}
+	return login
+}
+
+// passwordlessEnabled читает настройку администратора, по умолчанию значение из конфигурации
+func (s *AuthService) passwordlessEnabled(c *gin.Context) (bool, error) {
+	enabled, err := s.settingsRepo.GetBool(c.Request.Context(), repository.SettingPasswordlessEnabled, s.cfg.MagicLinkEnabled)
+	if err != nil {
+		logger.Error("Failed to get passwordless setting", zap.Error(err))
+	}
+	return enabled, err
+}
+
+// generateLoginCode возвращает случайный 6-значный код
+func generateLoginCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
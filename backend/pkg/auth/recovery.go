@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"jiko-auth/internal/models"
+	"jiko-auth/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+	// Без символов, которые легко спутать при вводе с бумаги: 0/o, 1/l/i
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+	MFAMethodRecoveryCode = "recovery_code"
+)
+
+type RecoveryCodesResponse struct {
+	Codes []string `json:"codes"`
+}
+
+// GenerateRecoveryCodes выдает новый набор кодов восстановления, прежние коды перестают действовать.
+// Коды показываются один раз, в БД хранятся только их хеши
+func (s *AuthService) GenerateRecoveryCodes(c *gin.Context) {
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	methods, err := s.mfaMethods(ctx, user.ID)
+	if err != nil {
+		logger.Error("Failed to get MFA methods", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+	if len(methods) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA is not enabled"})
+		return
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			logger.Error("Failed to generate recovery code", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+			return
+		}
+		codes = append(codes, code)
+	}
+
+	normalized := make([]string, 0, len(codes))
+	for _, code := range codes {
+		normalized = append(normalized, normalizeRecoveryCode(code))
+	}
+	if err := s.mfaRepo.ReplaceRecoveryCodes(ctx, user.ID, normalized); err != nil {
+		logger.Error("Failed to save recovery codes", zap.Error(err), zap.String("user_id", user.ID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+
+	logger.Info("Recovery codes generated", zap.String("user_id", user.ID.String()))
+	c.JSON(http.StatusOK, RecoveryCodesResponse{Codes: codes})
+}
+
+// useRecoveryCode гасит код восстановления и уведомляет пользователя о его использовании.
+// При ошибке ответ клиенту уже отправлен
+func (s *AuthService) useRecoveryCode(c *gin.Context, user *models.User, code string) bool {
+	ctx := c.Request.Context()
+
+	used, err := s.mfaRepo.UseRecoveryCode(ctx, user.ID, normalizeRecoveryCode(code))
+	if err != nil {
+		logger.Error("Failed to use recovery code", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "verification failed"})
+		return false
+	}
+	if !used {
+		logger.Warn("Invalid recovery code", zap.String("user_id", user.ID.String()), zap.String("ip", c.ClientIP()))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid recovery code"})
+		return false
+	}
+
+	remaining, err := s.mfaRepo.CountRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		logger.Warn("Failed to count recovery codes", zap.Error(err))
+	}
+
+	logger.Info("Recovery code used",
+		zap.String("user_id", user.ID.String()),
+		zap.String("ip", c.ClientIP()),
+		zap.Int64("remaining", remaining))
+
+	notification := s.notificationService.CreateRecoveryCodeUsedNotification(user, remaining, c.ClientIP())
+	if err := s.securityRepo.CreateNotification(ctx, notification); err != nil {
+		logger.Error("Failed to save notification", zap.Error(err))
+	}
+	if err := s.emailService.SendSecurityNotification(user.Email, notification); err != nil {
+		logger.Warn("Failed to send recovery code email", zap.Error(err), zap.String("email", user.Email))
+	}
+	return true
+}
+
+// dropUnusedRecoveryCodes удаляет коды восстановления, когда у пользователя не осталось второго
+// фактора: иначе старые коды снова заработали бы после повторного подключения MFA
+func (s *AuthService) dropUnusedRecoveryCodes(ctx context.Context, userID uuid.UUID) {
+	methods, err := s.mfaMethods(ctx, userID)
+	if err != nil || len(methods) > 0 {
+		return
+	}
+	if _, err := s.mfaRepo.DeleteRecoveryCodes(ctx, userID); err != nil {
+		logger.Error("Failed to delete recovery codes", zap.Error(err), zap.String("user_id", userID.String()))
+	}
+}
+
+// generateRecoveryCode возвращает код вида "abcde-fghjk"
+func generateRecoveryCode() (string, error) {
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	var b strings.Builder
+	for i := 0; i < recoveryCodeLength; i++ {
+		if i == recoveryCodeLength/2 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(recoveryCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// normalizeRecoveryCode приводит введенный код к виду, от которого считается хеш
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,471 @@
+package auth
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/utils"
+	"jiko-auth/pkg/logger"
+	"jiko-auth/pkg/webauthn"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Назначение церемонии WebAuthn: challenge регистрации нельзя использовать для входа
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+)
+
+type WebAuthnRegistrationOptions struct {
+	CeremonyID string                    `json:"ceremony_id"`
+	PublicKey  *webauthn.CreationOptions `json:"publicKey"`
+}
+
+type WebAuthnLoginOptions struct {
+	CeremonyID string                   `json:"ceremony_id,omitempty"`
+	PublicKey  *webauthn.RequestOptions `json:"publicKey"`
+}
+
+type WebAuthnRegisterRequest struct {
+	CeremonyID string                        `json:"ceremony_id" binding:"required"`
+	Name       string                        `json:"name" binding:"max=100"`
+	Credential *webauthn.AttestationResponse `json:"credential" binding:"required"`
+}
+
+// WebAuthnLoginBeginRequest identifier необязателен: без него браузер предложит passkey,
+// сохраненные для домена
+type WebAuthnLoginBeginRequest struct {
+	Identifier string `json:"identifier"`
+}
+
+type WebAuthnLoginRequest struct {
+	CeremonyID string                      `json:"ceremony_id" binding:"required"`
+	Credential *webauthn.AssertionResponse `json:"credential" binding:"required"`
+}
+
+type WebAuthnRenameRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// BeginWebAuthnRegistration выдает параметры navigator.credentials.create() для нового ключа
+// текущего пользователя
+func (s *AuthService) BeginWebAuthnRegistration(c *gin.Context) {
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	credentials, err := s.webauthnRepo.GetUserCredentials(ctx, user.ID)
+	if err != nil {
+		logger.Error("Failed to get WebAuthn credentials", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start registration"})
+		return
+	}
+
+	ceremony := s.createCeremony(c, &user.ID, ceremonyRegistration)
+	if ceremony == nil {
+		return
+	}
+
+	displayName := user.DisplayName
+	if displayName == "" {
+		displayName = user.Username
+	}
+
+	c.JSON(http.StatusOK, WebAuthnRegistrationOptions{
+		CeremonyID: ceremony.ID.String(),
+		PublicKey:  s.relyingParty.CreationOptions(user.ID[:], user.Email, displayName, ceremony.Challenge, credentialDescriptors(credentials)),
+	})
+}
+
+// FinishWebAuthnRegistration проверяет ответ аутентификатора и сохраняет ключ
+func (s *AuthService) FinishWebAuthnRegistration(c *gin.Context) {
+	var req WebAuthnRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	user := s.currentUser(c)
+	if user == nil {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	ceremony := s.consumeCeremony(c, req.CeremonyID, ceremonyRegistration)
+	if ceremony == nil {
+		return
+	}
+	if ceremony.UserID == nil || *ceremony.UserID != user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "registration expired, please try again"})
+		return
+	}
+
+	result, err := s.relyingParty.VerifyRegistration(req.Credential, ceremony.Challenge, false)
+	if err != nil {
+		logger.Warn("WebAuthn registration rejected", zap.Error(err), zap.String("user_id", user.ID.String()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credential"})
+		return
+	}
+
+	existing, err := s.webauthnRepo.GetCredential(ctx, result.ID)
+	if err != nil {
+		logger.Error("Failed to get WebAuthn credential", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to register credential"})
+		return
+	}
+	if existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "credential already registered"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Security key"
+		if result.BackupEligible {
+			name = "Passkey"
+		}
+	}
+
+	credential := &models.WebAuthnCredential{
+		ID:             uuid.New(),
+		UserID:         user.ID,
+		CredentialID:   result.ID,
+		PublicKey:      result.PublicKey,
+		Algorithm:      result.Algorithm,
+		SignCount:      int64(result.SignCount),
+		Name:           name,
+		AAGUID:         result.AAGUID,
+		Transports:     utils.EncodeStringList(result.Transports),
+		BackupEligible: result.BackupEligible,
+		BackupState:    result.BackupState,
+	}
+	if err := s.webauthnRepo.CreateCredential(ctx, credential); err != nil {
+		logger.Error("Failed to save WebAuthn credential", zap.Error(err), zap.String("user_id", user.ID.String()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to register credential"})
+		return
+	}
+
+	logger.Info("WebAuthn credential registered",
+		zap.String("user_id", user.ID.String()),
+		zap.String("credential_id", credential.ID.String()),
+		zap.Bool("backup_eligible", credential.BackupEligible))
+
+	c.JSON(http.StatusCreated, credential)
+}
+
+// ListWebAuthnCredentials возвращает ключи текущего пользователя
+func (s *AuthService) ListWebAuthnCredentials(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
+		return
+	}
+
+	credentials, err := s.webauthnRepo.GetUserCredentials(c.Request.Context(), userID)
+	if err != nil {
+		logger.Error("Failed to get WebAuthn credentials", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get credentials"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"credentials": credentials})
+}
+
+func (s *AuthService) RenameWebAuthnCredential(c *gin.Context) {
+	var req WebAuthnRenameRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credential ID"})
+		return
+	}
+
+	renamed, err := s.webauthnRepo.RenameCredential(c.Request.Context(), userID, id, strings.TrimSpace(req.Name))
+	if err != nil {
+		logger.Error("Failed to rename WebAuthn credential", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rename credential"})
+		return
+	}
+	if !renamed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "credential not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "credential renamed"})
+}
+
+func (s *AuthService) DeleteWebAuthnCredential(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credential ID"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	deleted, err := s.webauthnRepo.DeleteCredential(ctx, userID, id)
+	if err != nil {
+		logger.Error("Failed to delete WebAuthn credential", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete credential"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "credential not found"})
+		return
+	}
+
+	s.dropUnusedRecoveryCodes(ctx, userID)
+
+	logger.Info("WebAuthn credential deleted", zap.String("user_id", userID.String()), zap.String("credential_id", id.String()))
+	c.JSON(http.StatusOK, gin.H{"message": "credential deleted"})
+}
+
+// BeginWebAuthnLogin выдает параметры navigator.credentials.get() для входа без пароля.
+// Для неизвестного identifier ответ такой же, как без него, чтобы не раскрывать учетные записи
+func (s *AuthService) BeginWebAuthnLogin(c *gin.Context) {
+	var req WebAuthnLoginBeginRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	var userID *uuid.UUID
+	var allow []webauthn.CredentialDescriptor
+	if req.Identifier != "" {
+		user, err := s.userRepo.GetUserByEmail(ctx, req.Identifier)
+		if err != nil || user == nil {
+			user, _ = s.userRepo.GetUserByUsername(ctx, req.Identifier)
+		}
+		if user != nil && !user.Disabled {
+			credentials, err := s.webauthnRepo.GetUserCredentials(ctx, user.ID)
+			if err != nil {
+				logger.Error("Failed to get WebAuthn credentials", zap.Error(err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+				return
+			}
+			if len(credentials) > 0 {
+				userID = &user.ID
+				allow = credentialDescriptors(credentials)
+			}
+		}
+	}
+
+	ceremony := s.createCeremony(c, userID, ceremonyLogin)
+	if ceremony == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, WebAuthnLoginOptions{
+		CeremonyID: ceremony.ID.String(),
+		PublicKey:  s.relyingParty.RequestOptions(ceremony.Challenge, allow, webauthn.UserVerificationRequired),
+	})
+}
+
+// FinishWebAuthnLogin вход без пароля: ключ с проверкой пользователя заменяет оба фактора
+func (s *AuthService) FinishWebAuthnLogin(c *gin.Context) {
+	var req WebAuthnLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	ceremony := s.consumeCeremony(c, req.CeremonyID, ceremonyLogin)
+	if ceremony == nil {
+		return
+	}
+
+	credentialID, err := req.Credential.CredentialID()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credential"})
+		return
+	}
+
+	credential, err := s.webauthnRepo.GetCredential(ctx, credentialID)
+	if err != nil {
+		logger.Error("Failed to get WebAuthn credential", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+	if credential == nil || (ceremony.UserID != nil && *ceremony.UserID != credential.UserID) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credential"})
+		return
+	}
+
+	assertion := s.useWebAuthnCredential(c, credential, ceremony.Challenge, req.Credential, true)
+	if assertion == nil {
+		return
+	}
+
+	// Обнаруживаемый ключ возвращает user handle, он должен совпадать с владельцем ключа
+	if err := assertion.VerifyUserHandle(credential.UserID[:]); err != nil {
+		logger.Warn("WebAuthn user handle mismatch", zap.String("credential_id", credential.ID.String()))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credential"})
+		return
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, credential.UserID)
+	if err != nil || user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credential"})
+		return
+	}
+	if !checkAccountAccess(c, user) {
+		return
+	}
+
+	s.completeLogin(c, user, []string{webAuthnAMR(credential)})
+}
+
+// verifyMFAWebAuthn проверяет ключ пользователя на втором шаге входа по challenge,
+// выданному BeginMFAWebAuthn. При ошибке ответ клиенту уже отправлен
+func (s *AuthService) verifyMFAWebAuthn(c *gin.Context, user *models.User, challenge *models.MFAChallenge, resp *webauthn.AssertionResponse) *models.WebAuthnCredential {
+	if challenge.Challenge == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "security key verification not started"})
+		return nil
+	}
+
+	credentialID, err := resp.CredentialID()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credential"})
+		return nil
+	}
+
+	credential, err := s.webauthnRepo.GetCredential(c.Request.Context(), credentialID)
+	if err != nil {
+		logger.Error("Failed to get WebAuthn credential", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "verification failed"})
+		return nil
+	}
+	if credential == nil || credential.UserID != user.ID {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credential"})
+		return nil
+	}
+
+	if s.useWebAuthnCredential(c, credential, challenge.Challenge, resp, false) == nil {
+		return nil
+	}
+	return credential
+}
+
+// useWebAuthnCredential проверяет подпись сохраненным ключом и сдвигает счетчик подписей.
+// При ошибке ответ клиенту уже отправлен
+func (s *AuthService) useWebAuthnCredential(c *gin.Context, credential *models.WebAuthnCredential, challenge string, resp *webauthn.AssertionResponse, requireUV bool) *webauthn.Assertion {
+	assertion, err := s.relyingParty.VerifyAssertion(resp, challenge, credential.PublicKey, uint32(credential.SignCount), requireUV)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCount) {
+			logger.Warn("WebAuthn signature counter did not increase, possible cloned authenticator",
+				zap.String("user_id", credential.UserID.String()),
+				zap.String("credential_id", credential.ID.String()),
+				zap.Int64("stored_sign_count", credential.SignCount))
+		} else {
+			logger.Warn("WebAuthn assertion rejected", zap.Error(err), zap.String("user_id", credential.UserID.String()))
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credential"})
+		return nil
+	}
+
+	updated, err := s.webauthnRepo.UpdateCredentialUsage(c.Request.Context(), credential.ID, credential.SignCount, int64(assertion.SignCount), assertion.BackupState)
+	if err != nil {
+		logger.Error("Failed to update WebAuthn credential", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "verification failed"})
+		return nil
+	}
+	if !updated {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credential"})
+		return nil
+	}
+	return assertion
+}
+
+func (s *AuthService) createCeremony(c *gin.Context, userID *uuid.UUID, purpose string) *models.WebAuthnCeremony {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		logger.Error("Failed to generate WebAuthn challenge", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start ceremony"})
+		return nil
+	}
+
+	ceremony := &models.WebAuthnCeremony{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Purpose:   purpose,
+		Challenge: challenge,
+		ExpiresAt: time.Now().Add(webauthn.Timeout),
+	}
+	if err := s.webauthnRepo.CreateCeremony(c.Request.Context(), ceremony); err != nil {
+		logger.Error("Failed to save WebAuthn ceremony", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start ceremony"})
+		return nil
+	}
+	return ceremony
+}
+
+func (s *AuthService) consumeCeremony(c *gin.Context, id, purpose string) *models.WebAuthnCeremony {
+	ceremonyID, err := uuid.Parse(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ceremony ID"})
+		return nil
+	}
+
+	ceremony, err := s.webauthnRepo.ConsumeCeremony(c.Request.Context(), ceremonyID, purpose)
+	if err != nil {
+		logger.Error("Failed to consume WebAuthn ceremony", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "verification failed"})
+		return nil
+	}
+	if ceremony == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ceremony expired, please try again"})
+		return nil
+	}
+	return ceremony
+}
+
+func credentialDescriptors(credentials []models.WebAuthnCredential) []webauthn.CredentialDescriptor {
+	descriptors := make([]webauthn.CredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		descriptors = append(descriptors, webauthn.CredentialDescriptor{
+			Type:       "public-key",
+			ID:         credential.CredentialID,
+			Transports: utils.DecodeStringList(credential.Transports),
+		})
+	}
+	return descriptors
+}
+
+// webAuthnAMR различает аппаратный ключ и синхронизируемый между устройствами passkey
+func webAuthnAMR(credential *models.WebAuthnCredential) string {
+	if credential.BackupEligible {
+		return AMRSoftwareKey
+	}
+	return AMRHardwareKey
+}
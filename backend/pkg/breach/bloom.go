@@ -0,0 +1,150 @@
+// pkg/breach/bloom.go
+package breach
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Формат файла фильтра: магическая строка, число хеш-функций k (uint32), размер в битах m (uint64),
+// затем ceil(m/64) слов uint64. Все числа little-endian
+const (
+	bloomMagic      = "JKBF"
+	bloomHeaderSize = len(bloomMagic) + 4 + 8
+)
+
+// BloomFilter фильтр Блума по SHA-1 паролей. Позиции битов вычисляются двойным хешированием
+// из самого SHA-1, который уже равномерно распределен
+type BloomFilter struct {
+	k    uint32
+	m    uint64
+	bits []uint64
+}
+
+// NewBloomFilter создает пустой фильтр для expected хешей с долей ложных срабатываний fpRate
+func NewBloomFilter(expected uint64, fpRate float64) (*BloomFilter, error) {
+	if expected == 0 {
+		return nil, errors.New("bloom filter: expected count must be positive")
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		return nil, errors.New("bloom filter: false positive rate must be between 0 and 1")
+	}
+
+	m := uint64(math.Ceil(-float64(expected) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Max(1, math.Round(float64(m)/float64(expected)*math.Ln2)))
+	return &BloomFilter{k: k, m: m, bits: make([]uint64, (m+63)/64)}, nil
+}
+
+// AddHash добавляет SHA-1 в hex (40 символов, регистр не важен)
+func (f *BloomFilter) AddHash(hash string) error {
+	var sum [sha1.Size]byte
+	if len(hash) != hex.EncodedLen(sha1.Size) {
+		return fmt.Errorf("bloom filter: invalid SHA-1 %q", hash)
+	}
+	if _, err := hex.Decode(sum[:], []byte(hash)); err != nil {
+		return fmt.Errorf("bloom filter: invalid SHA-1 %q", hash)
+	}
+
+	h1, h2 := bloomHashes(sum)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	return nil
+}
+
+// WriteTo сохраняет фильтр в формате, который читает Open
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, bloomHeaderSize)
+	copy(header, bloomMagic)
+	binary.LittleEndian.PutUint32(header[len(bloomMagic):], f.k)
+	binary.LittleEndian.PutUint64(header[len(bloomMagic)+4:], f.m)
+
+	n, err := w.Write(header)
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+
+	buf := make([]byte, 8*4096)
+	for i := 0; i < len(f.bits); i += 4096 {
+		end := min(i+4096, len(f.bits))
+		chunk := buf[:8*(end-i)]
+		for j, word := range f.bits[i:end] {
+			binary.LittleEndian.PutUint64(chunk[8*j:], word)
+		}
+		n, err := w.Write(chunk)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// K число хеш-функций фильтра
+func (f *BloomFilter) K() uint32 { return f.k }
+
+// M размер фильтра в битах
+func (f *BloomFilter) M() uint64 { return f.m }
+
+func bloomHashes(sum [sha1.Size]byte) (uint64, uint64) {
+	h1 := binary.LittleEndian.Uint64(sum[0:8])
+	// Нечетный шаг не вырождается в ноль
+	h2 := binary.LittleEndian.Uint64(sum[8:16]) | 1
+	return h1, h2
+}
+
+// bloomFile читает биты фильтра с диска по требованию, не загружая файл в память
+type bloomFile struct {
+	file *os.File
+	k    uint32
+	m    uint64
+}
+
+func openBloomFile(file *os.File) (*bloomFile, error) {
+	header := make([]byte, bloomHeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("bloom filter: failed to read header: %w", err)
+	}
+
+	filter := &bloomFile{
+		file: file,
+		k:    binary.LittleEndian.Uint32(header[len(bloomMagic):]),
+		m:    binary.LittleEndian.Uint64(header[len(bloomMagic)+4:]),
+	}
+	if filter.k == 0 || filter.m == 0 {
+		return nil, errors.New("bloom filter: corrupted header")
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if expected := int64(bloomHeaderSize) + int64(8*((filter.m+63)/64)); info.Size() != expected {
+		return nil, fmt.Errorf("bloom filter: file size %d, expected %d", info.Size(), expected)
+	}
+	return filter, nil
+}
+
+func (f *bloomFile) Breached(password string) (bool, error) {
+	h1, h2 := bloomHashes(sha1.Sum([]byte(password)))
+
+	word := make([]byte, 8)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % f.m
+		if _, err := f.file.ReadAt(word, int64(bloomHeaderSize)+int64(8*(bit/64))); err != nil {
+			return false, err
+		}
+		if binary.LittleEndian.Uint64(word)&(1<<(bit%64)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,201 @@
+// pkg/breach/breach.go
+package breach
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrPasswordBreached = errors.New("password has appeared in a data breach, choose a different one")
+
+// Checker проверяет пароль по локальной базе утекших паролей без обращений к сети
+type Checker interface {
+	// Breached сообщает, что пароль встречается в базе не реже заданного порога
+	Breached(password string) (bool, error)
+}
+
+// Open открывает базу утекших паролей по пути path. Поддерживаются:
+//   - фильтр Блума, собранный командой breachfilter (порог применяется при сборке);
+//   - отсортированный по хешу файл HIBP со строками "SHA1:COUNT";
+//   - каталог файлов диапазонов HIBP "<ПРЕФИКС>.txt" со строками "СУФФИКС:COUNT".
+//
+// Для файлов HIBP учитываются пароли, встретившиеся не менее minCount раз.
+// Пустой путь отключает проверку
+func Open(path string, minCount int) (Checker, error) {
+	if path == "" {
+		return disabled{}, nil
+	}
+	if minCount < 1 {
+		minCount = 1
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &rangeDir{dir: path, minCount: minCount}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, len(bloomMagic))
+	if _, err := file.ReadAt(magic, 0); err == nil && string(magic) == bloomMagic {
+		filter, err := openBloomFile(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return filter, nil
+	}
+
+	return &sortedFile{file: file, size: info.Size(), minCount: minCount}, nil
+}
+
+// HashPassword возвращает SHA-1 пароля в верхнем регистре, как в базах HIBP
+func HashPassword(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+type disabled struct{}
+
+func (disabled) Breached(string) (bool, error) {
+	return false, nil
+}
+
+// sortedFile поиск делением пополам по отсортированному файлу HIBP прямо на диске
+type sortedFile struct {
+	file     *os.File
+	size     int64
+	minCount int
+}
+
+// maxLineLength с запасом вмещает "SHA1:COUNT\r\n"
+const maxLineLength = 128
+
+func (f *sortedFile) Breached(password string) (bool, error) {
+	hash := HashPassword(password)
+
+	lo, hi := int64(0), f.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, err := f.lineFrom(mid)
+		if err != nil {
+			return false, err
+		}
+		if line == nil || start >= hi {
+			hi = mid
+			continue
+		}
+
+		lineHash, count, err := parseHashLine(line)
+		if err != nil {
+			return false, err
+		}
+		switch strings.Compare(lineHash, hash) {
+		case 0:
+			return count >= f.minCount, nil
+		case -1:
+			lo = start + int64(len(line)) + 1
+		default:
+			hi = mid
+		}
+	}
+	return false, nil
+}
+
+// lineFrom возвращает первую строку, которая начинается в позиции offset или после нее;
+// nil, если таких строк нет
+func (f *sortedFile) lineFrom(offset int64) (int64, []byte, error) {
+	readAt := offset
+	if offset > 0 {
+		readAt = offset - 1
+	}
+
+	buf := make([]byte, 2*maxLineLength)
+	n, err := f.file.ReadAt(buf, readAt)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, nil, err
+	}
+	buf = buf[:n]
+
+	start := 0
+	if offset > 0 {
+		newline := bytes.IndexByte(buf, '\n')
+		if newline < 0 {
+			return 0, nil, nil
+		}
+		start = newline + 1
+	}
+	if start >= len(buf) {
+		return 0, nil, nil
+	}
+
+	line := buf[start:]
+	if end := bytes.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	} else if len(line) > maxLineLength {
+		return 0, nil, fmt.Errorf("breached password file: line at offset %d is too long", readAt+int64(start))
+	}
+	return readAt + int64(start), line, nil
+}
+
+// rangeDir каталог файлов диапазонов, как их сохраняет загрузчик HIBP
+type rangeDir struct {
+	dir      string
+	minCount int
+}
+
+func (d *rangeDir) Breached(password string) (bool, error) {
+	hash := HashPassword(password)
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(d.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineSuffix, count, err := parseHashLine(scanner.Bytes())
+		if err != nil {
+			return false, err
+		}
+		if lineSuffix == suffix {
+			return count >= d.minCount, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// parseHashLine разбирает строку "HASH:COUNT"; без счетчика пароль считается встретившимся один раз
+func parseHashLine(line []byte) (string, int, error) {
+	text := strings.TrimSpace(string(line))
+	hash, countText, found := strings.Cut(text, ":")
+	if !found {
+		return strings.ToUpper(hash), 1, nil
+	}
+
+	count, err := strconv.Atoi(countText)
+	if err != nil {
+		return "", 0, fmt.Errorf("breached password file: invalid count in %q", text)
+	}
+	return strings.ToUpper(hash), count, nil
+}
@@ -0,0 +1,287 @@
+package breach
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testCorpus пароли и число их появлений в утечках
+func testCorpus() map[string]int {
+	corpus := map[string]int{
+		"password":  3861493,
+		"123456":    37359195,
+		"qwerty":    10556095,
+		"rare-one":  2,
+		"threshold": 10,
+	}
+	for i := 0; i < 200; i++ {
+		corpus[fmt.Sprintf("leaked-%d", i)] = 100 + i
+	}
+	return corpus
+}
+
+// writeSortedFile сохраняет корпус в формате HIBP "SHA1:COUNT", отсортированный по хешу
+func writeSortedFile(t *testing.T, corpus map[string]int, newline string, trailing bool) string {
+	t.Helper()
+	lines := make([]string, 0, len(corpus))
+	for password, count := range corpus {
+		lines = append(lines, fmt.Sprintf("%s:%d", HashPassword(password), count))
+	}
+	sort.Strings(lines)
+
+	content := strings.Join(lines, newline)
+	if trailing {
+		content += newline
+	}
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// boundaryMisses подбирает отсутствующие в корпусе пароли, хеши которых меньше первого и больше последнего
+func boundaryMisses(corpus map[string]int) (string, string) {
+	first, last := "", ""
+	for password := range corpus {
+		hash := HashPassword(password)
+		if first == "" || hash < first {
+			first = hash
+		}
+		if hash > last {
+			last = hash
+		}
+	}
+
+	var below, above string
+	for i := 0; below == "" || above == ""; i++ {
+		candidate := fmt.Sprintf("missing-%d", i)
+		hash := HashPassword(candidate)
+		if below == "" && hash < first {
+			below = candidate
+		}
+		if above == "" && hash > last {
+			above = candidate
+		}
+	}
+	return below, above
+}
+
+func TestSortedFile(t *testing.T) {
+	corpus := testCorpus()
+	below, above := boundaryMisses(corpus)
+
+	formats := []struct {
+		name     string
+		newline  string
+		trailing bool
+	}{
+		{"lf", "\n", true},
+		{"lf without trailing newline", "\n", false},
+		{"crlf", "\r\n", true},
+		{"crlf without trailing newline", "\r\n", false},
+	}
+	for _, format := range formats {
+		t.Run(format.name, func(t *testing.T) {
+			checker, err := Open(writeSortedFile(t, corpus, format.newline, format.trailing), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := checker.(*sortedFile); !ok {
+				t.Fatalf("Open returned %T, want *sortedFile", checker)
+			}
+
+			// Каждая строка, включая первую и последнюю в файле, находится поиском
+			for password := range corpus {
+				if breached, err := checker.Breached(password); err != nil || !breached {
+					t.Errorf("Breached(%q) = %v, %v, want true", password, breached, err)
+				}
+			}
+			for _, password := range []string{below, above, "correct horse battery staple"} {
+				if breached, err := checker.Breached(password); err != nil || breached {
+					t.Errorf("Breached(%q) = %v, %v, want false", password, breached, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSortedFileSingleLine(t *testing.T) {
+	path := writeSortedFile(t, map[string]int{"password": 5}, "\n", false)
+	checker, err := Open(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if breached, err := checker.Breached("password"); err != nil || !breached {
+		t.Errorf("Breached(password) = %v, %v, want true", breached, err)
+	}
+	if breached, err := checker.Breached("other"); err != nil || breached {
+		t.Errorf("Breached(other) = %v, %v, want false", breached, err)
+	}
+}
+
+func TestMinCount(t *testing.T) {
+	corpus := testCorpus()
+	path := writeSortedFile(t, corpus, "\r\n", true)
+	dir := writeRangeDir(t, corpus)
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"rare-one", false}, // 2 < 10
+		{"threshold", true}, // ровно на пороге
+		{"password", true},
+	}
+	for _, source := range []string{path, dir} {
+		checker, err := Open(source, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range tests {
+			if breached, err := checker.Breached(tt.password); err != nil || breached != tt.want {
+				t.Errorf("%T.Breached(%q) = %v, %v, want %v", checker, tt.password, breached, err, tt.want)
+			}
+		}
+	}
+}
+
+// writeRangeDir сохраняет корпус как каталог диапазонов HIBP "<ПРЕФИКС>.txt"
+func writeRangeDir(t *testing.T, corpus map[string]int) string {
+	t.Helper()
+	ranges := map[string][]string{}
+	for password, count := range corpus {
+		hash := HashPassword(password)
+		ranges[hash[:5]] = append(ranges[hash[:5]], fmt.Sprintf("%s:%d", hash[5:], count))
+	}
+
+	dir := t.TempDir()
+	for prefix, lines := range ranges {
+		// Ответы API диапазонов HIBP приходят с CRLF
+		content := strings.Join(append(lines, "0000000000000000000000000000000000A:1"), "\r\n")
+		if err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRangeDir(t *testing.T) {
+	corpus := testCorpus()
+	checker, err := Open(writeRangeDir(t, corpus), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := checker.(*rangeDir); !ok {
+		t.Fatalf("Open returned %T, want *rangeDir", checker)
+	}
+
+	for password := range corpus {
+		if breached, err := checker.Breached(password); err != nil || !breached {
+			t.Errorf("Breached(%q) = %v, %v, want true", password, breached, err)
+		}
+	}
+	// Нет файла диапазона или нет суффикса в существующем файле
+	for _, password := range []string{"correct horse battery staple", "missing-1", "missing-2"} {
+		if breached, err := checker.Breached(password); err != nil || breached {
+			t.Errorf("Breached(%q) = %v, %v, want false", password, breached, err)
+		}
+	}
+}
+
+func TestBloomFilterRoundTrip(t *testing.T) {
+	corpus := testCorpus()
+	filter, err := NewBloomFilter(uint64(len(corpus)), 1e-6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for password := range corpus {
+		if err := filter.AddHash(strings.ToLower(HashPassword(password))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "pwned.bloom")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written, err := filter.WriteTo(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(bloomHeaderSize) + int64(8*((filter.M()+63)/64)); written != want {
+		t.Errorf("WriteTo wrote %d bytes, want %d", written, want)
+	}
+
+	checker, err := Open(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := checker.(*bloomFile); !ok {
+		t.Fatalf("Open returned %T, want *bloomFile", checker)
+	}
+	for password := range corpus {
+		if breached, err := checker.Breached(password); err != nil || !breached {
+			t.Errorf("Breached(%q) = %v, %v, want true", password, breached, err)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		password := fmt.Sprintf("missing-%d", i)
+		if breached, err := checker.Breached(password); err != nil || breached {
+			t.Errorf("Breached(%q) = %v, %v, want false", password, breached, err)
+		}
+	}
+}
+
+func TestBloomFilterErrors(t *testing.T) {
+	filter, err := NewBloomFilter(10, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := filter.AddHash("not-a-hash"); err == nil {
+		t.Error("AddHash accepted an invalid hash")
+	}
+
+	// Обрезанный файл фильтра не открывается
+	path := filepath.Join(t.TempDir(), "truncated.bloom")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := filter.WriteTo(file); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	info, _ := os.Stat(path)
+	if err := os.Truncate(path, info.Size()-8); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, 1); err == nil {
+		t.Error("Open accepted a truncated bloom filter")
+	}
+
+	if _, err := NewBloomFilter(0, 0.01); err == nil {
+		t.Error("NewBloomFilter accepted zero expected count")
+	}
+	if _, err := NewBloomFilter(10, 1); err == nil {
+		t.Error("NewBloomFilter accepted false positive rate 1")
+	}
+}
+
+func TestOpenDisabled(t *testing.T) {
+	checker, err := Open("", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if breached, err := checker.Breached("password"); err != nil || breached {
+		t.Errorf("disabled checker reported %v, %v", breached, err)
+	}
+}
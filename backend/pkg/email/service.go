@@ -1,12 +1,17 @@
 package email
 
 import (
+	"errors"
 	"fmt"
+	"html"
 	"jiko-auth/internal/config"
 	"jiko-auth/internal/models"
 	"jiko-auth/pkg/logger"
+	"mime"
 	"net/smtp"
+	"net/url"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -18,6 +23,7 @@ type EmailService struct {
 	smtpPassword string
 	fromEmail    string
 	baseURL      string
+	appEnv       string
 }
 
 func NewEmailService(cfg *config.Config) *EmailService {
@@ -28,15 +34,67 @@ func NewEmailService(cfg *config.Config) *EmailService {
 		smtpPassword: cfg.SmtpPassword,
 		fromEmail:    cfg.SmtpFromEmail,
 		baseURL:      cfg.AppUrl,
+		appEnv:       cfg.AppEnv,
 	}
 }
 
+// secretField добавляет в лог токен или код из письма только в окружении development,
+// где без SMTP иначе не пройти подтверждение. В остальных окружениях секреты не логируются
+func (s *EmailService) secretField(key, value string) zap.Field {
+	if s.appEnv != "development" {
+		return zap.Skip()
+	}
+	return zap.String(key, value)
+}
+
+// ErrNotConfigured SMTP сервер не задан, письма не отправляются
+var ErrNotConfigured = errors.New("SMTP не настроен")
+
+func (s *EmailService) configured() bool {
+	return s.smtpHost != "" && s.smtpUsername != "" && s.smtpPassword != ""
+}
+
+// send отправляет HTML письмо одному получателю
+func (s *EmailService) send(to, subject, htmlBody string) error {
+	msg, err := s.message(to, subject, htmlBody)
+	if err != nil {
+		return err
+	}
+
+	auth := smtp.PlainAuth("", s.smtpUsername, s.smtpPassword, s.smtpHost)
+	if err := smtp.SendMail(s.smtpHost+":"+s.smtpPort, auth, s.fromEmail, []string{to}, msg); err != nil {
+		logger.Error("Ошибка отправки письма",
+			zap.String("to", to),
+			zap.String("subject", subject),
+			zap.Error(err))
+		return fmt.Errorf("ошибка отправки: %w", err)
+	}
+
+	logger.Info("Письмо отправлено", zap.String("to", to), zap.String("subject", subject))
+	return nil
+}
+
+// message собирает письмо. Тема кодируется по RFC 2047, переводы строк в адресе и теме
+// отклоняются, чтобы через них нельзя было добавить заголовки
+func (s *EmailService) message(to, subject, htmlBody string) ([]byte, error) {
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return nil, errors.New("недопустимый адрес или тема письма")
+	}
+
+	return []byte("From: " + s.fromEmail + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("UTF-8", subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/html; charset=UTF-8\r\n" +
+		"\r\n" + htmlBody), nil
+}
+
 func (s *EmailService) SendVerificationEmail(to, token string) error {
-	if s.smtpHost == "" || s.smtpUsername == "" || s.smtpPassword == "" {
+	if !s.configured() {
 		logger.Info("SMTP не настроен, письмо не отправлено",
 			zap.String("to", to),
-			zap.String("token", token))
-		return fmt.Errorf("SMTP не настроен")
+			s.secretField("token", token))
+		return ErrNotConfigured
 	}
 
 	verificationLink := fmt.Sprintf("%s/verify-email?token=%s",
@@ -98,41 +156,16 @@ func (s *EmailService) SendVerificationEmail(to, token string) error {
         </html>
     `, verificationLink, verificationLink)
 
-	// Create email message
-	from := s.fromEmail
-	toList := []string{to}
-
-	msg := []byte(fmt.Sprintf("From: %s\r\n"+
-		"To: %s\r\n"+
-		"Subject: Подтверждение email для JIKO\r\n"+
-		"Content-Type: text/html; charset=UTF-8\r\n"+
-		"\r\n%s",
-		from, strings.Join(toList, ","), htmlBody))
-
-	// Authenticate with SMTP server
-	auth := smtp.PlainAuth("", s.smtpUsername, s.smtpPassword, s.smtpHost)
-
-	// Send email
-	err := smtp.SendMail(s.smtpHost+":"+s.smtpPort, auth, from, toList, msg)
-	if err != nil {
-		logger.Error("Ошибка отправки письма",
-			zap.String("to", to),
-			zap.Error(err))
-		return fmt.Errorf("ошибка отправки: %w", err)
-	}
-
-	logger.Info("Письмо подтверждения отправлено",
-		zap.String("to", to))
-	return nil
+	return s.send(to, "Подтверждение email для JIKO", htmlBody)
 }
 
 // Метод по отправке письма о входе
 func (s *EmailService) SendSecurityNotification(email string, notification *models.SecurityNotification) error {
-	if s.smtpHost == "" || s.smtpUsername == "" || s.smtpPassword == "" {
+	if !s.configured() {
 		logger.Info("SMTP не настроен, письмо безопасности не отправлено",
 			zap.String("to", email),
 			zap.String("type", notification.Type))
-		return fmt.Errorf("SMTP не настроен")
+		return ErrNotConfigured
 	}
 
 	htmlBody := fmt.Sprintf(`
@@ -158,28 +191,258 @@ func (s *EmailService) SendSecurityNotification(email string, notification *mode
             </div>
         </body>
         </html>
-    `, notification.Title, notification.Title, notification.Message)
+    `, html.EscapeString(notification.Title), html.EscapeString(notification.Title), html.EscapeString(notification.Message))
 
-	from := s.fromEmail
-	toList := []string{email}
+	return s.send(email, notification.Title, htmlBody)
+}
 
-	msg := []byte(fmt.Sprintf("From: %s\r\n"+
-		"To: %s\r\n"+
-		"Subject: %s\r\n"+
-		"Content-Type: text/html; charset=UTF-8\r\n"+
-		"\r\n%s",
-		from, strings.Join(toList, ","), notification.Title, htmlBody))
+// SendPasswordlessLoginEmail отправляет ссылку и код для входа без пароля
+func (s *EmailService) SendPasswordlessLoginEmail(to, token, code string, ttl time.Duration) error {
+	if !s.configured() {
+		logger.Info("SMTP не настроен, письмо входа не отправлено",
+			zap.String("to", to),
+			s.secretField("token", token),
+			s.secretField("code", code))
+		return ErrNotConfigured
+	}
 
-	auth := smtp.PlainAuth("", s.smtpUsername, s.smtpPassword, s.smtpHost)
+	loginLink := fmt.Sprintf("%s/sign-in?magic_token=%s", s.baseURL, url.QueryEscape(token))
 
-	err := smtp.SendMail(s.smtpHost+":"+s.smtpPort, auth, from, toList, msg)
-	if err != nil {
-		logger.Error("Ошибка отправки письма безопасности",
-			zap.String("to", email),
-			zap.Error(err))
-		return fmt.Errorf("ошибка отправки: %w", err)
+	htmlBody := fmt.Sprintf(`
+        <!DOCTYPE html>
+        <html>
+        <head>
+            <meta charset="UTF-8">
+            <title>Вход в JIKO</title>
+            <style>
+                body { font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto; padding: 20px; color: #333; line-height: 1.5; }
+                .login-link { display: inline-block; margin: 20px 0; padding: 12px 24px; background-color: #2563eb; color: white; text-decoration: none; border-radius: 6px; font-weight: bold; font-size: 16px; }
+                .code { font-size: 28px; font-weight: bold; letter-spacing: 6px; margin: 10px 0; }
+                .footer { margin-top: 20px; padding-top: 20px; border-top: 1px solid #eee; color: #666; font-size: 14px; }
+            </style>
+        </head>
+        <body>
+            <h2>Вход в JIKO</h2>
+            <p>Нажмите на кнопку ниже, чтобы войти. Откройте ссылку в том же браузере, в котором запросили вход:</p>
+            <p>
+                <a href="%s" class="login-link">Войти</a>
+            </p>
+            <p>Или введите код на странице входа:</p>
+            <p class="code">%s</p>
+            <p>Ссылка и код действительны %d минут и могут быть использованы один раз.</p>
+            <div class="footer">
+                <p>Если вы не запрашивали вход, проигнорируйте это письмо.</p>
+            </div>
+        </body>
+        </html>
+    `, loginLink, code, int(ttl.Minutes()))
+
+	return s.send(to, "Вход в JIKO", htmlBody)
+}
+
+// SendPasswordResetEmail отправляет ссылку для сброса пароля
+func (s *EmailService) SendPasswordResetEmail(to, token string, ttl time.Duration) error {
+	if !s.configured() {
+		logger.Info("SMTP не настроен, письмо сброса пароля не отправлено",
+			zap.String("to", to),
+			s.secretField("token", token))
+		return ErrNotConfigured
 	}
 
-	logger.Info("Письмо безопасности отправлено", zap.String("to", email))
-	return nil
+	resetLink := fmt.Sprintf("%s/reset-password?token=%s", s.baseURL, url.QueryEscape(token))
+
+	htmlBody := fmt.Sprintf(`
+        <!DOCTYPE html>
+        <html>
+        <head>
+            <meta charset="UTF-8">
+            <title>Сброс пароля JIKO</title>
+            <style>
+                body { font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto; padding: 20px; color: #333; line-height: 1.5; }
+                .reset-link { display: inline-block; margin: 20px 0; padding: 12px 24px; background-color: #2563eb; color: white; text-decoration: none; border-radius: 6px; font-weight: bold; font-size: 16px; }
+                .link-text { word-break: break-all; color: #666; font-size: 14px; margin-top: 10px; }
+                .footer { margin-top: 20px; padding-top: 20px; border-top: 1px solid #eee; color: #666; font-size: 14px; }
+            </style>
+        </head>
+        <body>
+            <h2>Сброс пароля</h2>
+            <p>Мы получили запрос на сброс пароля вашего аккаунта JIKO. Нажмите на кнопку ниже, чтобы задать новый пароль:</p>
+            <p>
+                <a href="%s" class="reset-link">Задать новый пароль</a>
+            </p>
+            <p class="link-text">Или скопируйте ссылку в браузер: %s</p>
+            <p>Ссылка действительна %d минут и может быть использована один раз. После смены пароля все сеансы будут завершены.</p>
+            <div class="footer">
+                <p>Если вы не запрашивали сброс пароля, проигнорируйте это письмо, пароль останется прежним.</p>
+            </div>
+        </body>
+        </html>
+    `, resetLink, resetLink, int(ttl.Minutes()))
+
+	return s.send(to, "Сброс пароля JIKO", htmlBody)
+}
+
+// SendEmailChangeConfirmation отправляет на новый адрес ссылку подтверждения смены email
+func (s *EmailService) SendEmailChangeConfirmation(to, token string, ttl time.Duration) error {
+	if !s.configured() {
+		logger.Info("SMTP не настроен, письмо подтверждения смены email не отправлено",
+			zap.String("to", to),
+			s.secretField("token", token))
+		return ErrNotConfigured
+	}
+
+	confirmLink := fmt.Sprintf("%s/confirm-email-change?token=%s", s.baseURL, url.QueryEscape(token))
+
+	htmlBody := fmt.Sprintf(`
+        <!DOCTYPE html>
+        <html>
+        <head>
+            <meta charset="UTF-8">
+            <title>Подтверждение нового email JIKO</title>
+            <style>
+                body { font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto; padding: 20px; color: #333; line-height: 1.5; }
+                .action-link { display: inline-block; margin: 20px 0; padding: 12px 24px; background-color: #2563eb; color: white; text-decoration: none; border-radius: 6px; font-weight: bold; font-size: 16px; }
+                .link-text { word-break: break-all; color: #666; font-size: 14px; margin-top: 10px; }
+                .footer { margin-top: 20px; padding-top: 20px; border-top: 1px solid #eee; color: #666; font-size: 14px; }
+            </style>
+        </head>
+        <body>
+            <h2>Подтверждение нового email</h2>
+            <p>Этот адрес указан как новый email аккаунта JIKO. Нажмите на кнопку ниже, чтобы подтвердить смену:</p>
+            <p>
+                <a href="%s" class="action-link">Подтвердить email</a>
+            </p>
+            <p class="link-text">Или скопируйте ссылку в браузер: %s</p>
+            <p>Ссылка действительна %d часов.</p>
+            <div class="footer">
+                <p>Если вы не меняли email, проигнорируйте это письмо.</p>
+            </div>
+        </body>
+        </html>
+    `, confirmLink, confirmLink, int(ttl.Hours()))
+
+	return s.send(to, "Подтверждение нового email JIKO", htmlBody)
+}
+
+// SendEmailChangeNotice сообщает на старый адрес о запрошенной смене email. Ссылка отмены
+// возвращает прежний адрес и блокирует учетную запись до сброса пароля
+func (s *EmailService) SendEmailChangeNotice(to, newEmail, cancelToken string, ttl time.Duration) error {
+	if !s.configured() {
+		logger.Info("SMTP не настроен, уведомление о смене email не отправлено",
+			zap.String("to", to),
+			s.secretField("cancel_token", cancelToken))
+		return ErrNotConfigured
+	}
+
+	cancelLink := fmt.Sprintf("%s/cancel-email-change?token=%s", s.baseURL, url.QueryEscape(cancelToken))
+
+	htmlBody := fmt.Sprintf(`
+        <!DOCTYPE html>
+        <html>
+        <head>
+            <meta charset="UTF-8">
+            <title>Смена email JIKO</title>
+            <style>
+                body { font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto; padding: 20px; color: #333; line-height: 1.5; }
+                .action-link { display: inline-block; margin: 20px 0; padding: 12px 24px; background-color: #dc2626; color: white; text-decoration: none; border-radius: 6px; font-weight: bold; font-size: 16px; }
+                .link-text { word-break: break-all; color: #666; font-size: 14px; margin-top: 10px; }
+                .footer { margin-top: 20px; padding-top: 20px; border-top: 1px solid #eee; color: #666; font-size: 14px; }
+            </style>
+        </head>
+        <body>
+            <h2>Запрошена смена email</h2>
+            <p>Для вашего аккаунта JIKO запрошена смена email на адрес <b>%s</b>.</p>
+            <p>Если это были не вы, нажмите на кнопку ниже: смена будет отменена, а аккаунт заблокирован до сброса пароля.</p>
+            <p>
+                <a href="%s" class="action-link">Это был не я</a>
+            </p>
+            <p class="link-text">Или скопируйте ссылку в браузер: %s</p>
+            <p>Ссылка действительна %d дней.</p>
+            <div class="footer">
+                <p>Если смену email запросили вы, ничего делать не нужно.</p>
+            </div>
+        </body>
+        </html>
+    `, html.EscapeString(newEmail), cancelLink, cancelLink, int(ttl.Hours()/24))
+
+	return s.send(to, "Смена email JIKO", htmlBody)
+}
+
+// SendAccountLockedEmail сообщает о блокировке после неудачных попыток входа и отправляет
+// ссылку разблокировки
+func (s *EmailService) SendAccountLockedEmail(to, token string, lockedUntil time.Time, ipAddress string) error {
+	if !s.configured() {
+		logger.Info("SMTP не настроен, письмо о блокировке не отправлено",
+			zap.String("to", to),
+			s.secretField("token", token))
+		return ErrNotConfigured
+	}
+
+	unlockLink := fmt.Sprintf("%s/unlock-account?token=%s", s.baseURL, url.QueryEscape(token))
+
+	htmlBody := fmt.Sprintf(`
+        <!DOCTYPE html>
+        <html>
+        <head>
+            <meta charset="UTF-8">
+            <title>Аккаунт JIKO заблокирован</title>
+            <style>
+                body { font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto; padding: 20px; color: #333; line-height: 1.5; }
+                .unlock-link { display: inline-block; margin: 20px 0; padding: 12px 24px; background-color: #2563eb; color: white; text-decoration: none; border-radius: 6px; font-weight: bold; font-size: 16px; }
+                .link-text { word-break: break-all; color: #666; font-size: 14px; margin-top: 10px; }
+                .footer { margin-top: 20px; padding-top: 20px; border-top: 1px solid #eee; color: #666; font-size: 14px; }
+            </style>
+        </head>
+        <body>
+            <h2>Вход в аккаунт временно заблокирован</h2>
+            <p>Было сделано несколько неудачных попыток входа в ваш аккаунт JIKO, последняя с IP адреса %s. Вход заблокирован до %s.</p>
+            <p>Если это были вы, нажмите на кнопку ниже, чтобы снять блокировку сразу:</p>
+            <p>
+                <a href="%s" class="unlock-link">Разблокировать аккаунт</a>
+            </p>
+            <p class="link-text">Или скопируйте ссылку в браузер: %s</p>
+            <div class="footer">
+                <p>Если это были не вы, кто-то пытается подобрать ваш пароль. Не переходите по ссылке и смените пароль после окончания блокировки.</p>
+            </div>
+        </body>
+        </html>
+    `, html.EscapeString(ipAddress), lockedUntil.Format("2 January 2006 в 15:04"), unlockLink, unlockLink)
+
+	return s.send(to, "Аккаунт JIKO заблокирован", htmlBody)
+}
+
+// SendLoginVerificationEmail отправляет код подтверждения входа, который показался подозрительным
+func (s *EmailService) SendLoginVerificationEmail(to, code string, ttl time.Duration, ipAddress string) error {
+	if !s.configured() {
+		logger.Info("SMTP не настроен, письмо подтверждения входа не отправлено",
+			zap.String("to", to),
+			s.secretField("code", code))
+		return ErrNotConfigured
+	}
+
+	htmlBody := fmt.Sprintf(`
+        <!DOCTYPE html>
+        <html>
+        <head>
+            <meta charset="UTF-8">
+            <title>Подтвердите вход в JIKO</title>
+            <style>
+                body { font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto; padding: 20px; color: #333; line-height: 1.5; }
+                .code { font-size: 28px; font-weight: bold; letter-spacing: 6px; margin: 10px 0; }
+                .footer { margin-top: 20px; padding-top: 20px; border-top: 1px solid #eee; color: #666; font-size: 14px; }
+            </style>
+        </head>
+        <body>
+            <h2>Подтвердите вход</h2>
+            <p>Мы заметили необычный вход в ваш аккаунт JIKO с IP адреса %s. Чтобы продолжить, введите код на странице входа:</p>
+            <p class="code">%s</p>
+            <p>Код действителен %d минут.</p>
+            <div class="footer">
+                <p>Если это были не вы, не сообщайте код никому и срочно смените пароль: он известен постороннему.</p>
+            </div>
+        </body>
+        </html>
+    `, html.EscapeString(ipAddress), code, int(ttl.Minutes()))
+
+	return s.send(to, "Подтвердите вход в JIKO", htmlBody)
 }
@@ -0,0 +1,72 @@
+package email
+
+import (
+	"errors"
+	"mime"
+	"strings"
+	"testing"
+)
+
+func TestMessage(t *testing.T) {
+	s := &EmailService{fromEmail: "noreply@example.com"}
+	msg, err := s.message("user@example.com", "Сброс пароля JIKO", "<p>body</p>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers, body, ok := strings.Cut(string(msg), "\r\n\r\n")
+	if !ok || body != "<p>body</p>" {
+		t.Fatalf("message = %q", msg)
+	}
+	want := map[string]string{
+		"From":         "noreply@example.com",
+		"To":           "user@example.com",
+		"Subject":      "Сброс пароля JIKO",
+		"MIME-Version": "1.0",
+		"Content-Type": "text/html; charset=UTF-8",
+	}
+	lines := strings.Split(headers, "\r\n")
+	if len(lines) != len(want) {
+		t.Errorf("headers = %q", lines)
+	}
+	for _, line := range lines {
+		name, value, _ := strings.Cut(line, ": ")
+		if name == "Subject" {
+			// Заголовок содержит только ASCII, тема восстанавливается декодером RFC 2047
+			if strings.ContainsFunc(value, func(r rune) bool { return r > 127 }) {
+				t.Errorf("Subject is not encoded: %q", value)
+			}
+			decoded, err := new(mime.WordDecoder).DecodeHeader(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value = decoded
+		}
+		if want[name] != value {
+			t.Errorf("%s = %q, want %q", name, value, want[name])
+		}
+	}
+}
+
+func TestMessageHeaderInjection(t *testing.T) {
+	s := &EmailService{fromEmail: "noreply@example.com"}
+	tests := []struct {
+		to      string
+		subject string
+	}{
+		{"user@example.com\r\nBcc: attacker@example.com", "Subject"},
+		{"user@example.com", "Subject\nBcc: attacker@example.com"},
+	}
+	for _, tt := range tests {
+		if _, err := s.message(tt.to, tt.subject, "body"); err == nil {
+			t.Errorf("message(%q, %q) accepted a line break", tt.to, tt.subject)
+		}
+	}
+}
+
+func TestSendNotConfigured(t *testing.T) {
+	s := &EmailService{}
+	if err := s.SendPasswordResetEmail("user@example.com", "token", 0); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("SendPasswordResetEmail error = %v, want ErrNotConfigured", err)
+	}
+}
@@ -0,0 +1,92 @@
+// pkg/geoip/cache.go
+package geoip
+
+import (
+	"container/list"
+	"net/netip"
+	"sync"
+	"time"
+
+	"jiko-auth/internal/models"
+)
+
+// Cache LRU кеш результатов геолокации. Записи устаревают через ttl, чтобы ответы внешнего
+// провайдера не жили дольше обновлений базы
+type Cache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	items map[netip.Addr]*list.Element
+	order *list.List // в начале последние использованные
+}
+
+type cacheEntry struct {
+	addr      netip.Addr
+	location  models.Location
+	expiresAt time.Time
+}
+
+// NewCache создает кеш на size адресов, size 0 отключает кеш. ttl 0 - записи не устаревают
+func NewCache(size int, ttl time.Duration) *Cache {
+	return &Cache{
+		size:  size,
+		ttl:   ttl,
+		items: make(map[netip.Addr]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (c *Cache) Get(addr netip.Addr) (models.Location, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[addr]
+	if !ok {
+		return models.Location{}, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.items, addr)
+		return models.Location{}, false
+	}
+	c.order.MoveToFront(element)
+	return entry.location, true
+}
+
+func (c *Cache) Add(addr netip.Addr, location models.Location) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expiresAt time.Time
+	if c.ttl > 0 {
+		expiresAt = time.Now().Add(c.ttl)
+	}
+
+	if element, ok := c.items[addr]; ok {
+		entry := element.Value.(*cacheEntry)
+		entry.location, entry.expiresAt = location, expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.items[addr] = c.order.PushFront(&cacheEntry{addr: addr, location: location, expiresAt: expiresAt})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).addr)
+	}
+}
+
+// Purge очищает кеш, например после обновления базы
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[netip.Addr]*list.Element)
+	c.order.Init()
+}
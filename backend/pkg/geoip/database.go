@@ -0,0 +1,96 @@
+// pkg/geoip/database.go
+package geoip
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"jiko-auth/internal/models"
+	"jiko-auth/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Database локальная база геолокации MaxMind DB (.mmdb). Файл читается в память целиком
+// и заменяется без остановки сервиса, когда меняется на диске
+type Database struct {
+	path   string
+	reader atomic.Pointer[mmdbReader]
+
+	// Состояние файла при последней загрузке, меняется только в Watch
+	modTime time.Time
+	size    int64
+}
+
+// OpenDatabase загружает базу из файла path
+func OpenDatabase(path string) (*Database, error) {
+	db := &Database{path: path}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.load(); err != nil {
+		return nil, err
+	}
+	db.modTime, db.size = info.ModTime(), info.Size()
+	return db, nil
+}
+
+func (db *Database) load() error {
+	buf, err := os.ReadFile(db.path)
+	if err != nil {
+		return err
+	}
+	reader, err := parseMMDB(buf)
+	if err != nil {
+		return err
+	}
+	db.reader.Store(reader)
+	return nil
+}
+
+func (db *Database) Lookup(_ context.Context, addr netip.Addr) (models.Location, error) {
+	record, err := db.reader.Load().lookup(addr)
+	if err != nil {
+		return models.Location{}, err
+	}
+	if record == nil {
+		return models.Location{}, ErrNotFound
+	}
+	return recordLocation(record), nil
+}
+
+// Watch раз в interval проверяет файл базы и перечитывает его после изменения, затем вызывает onReload.
+// Если новый файл не читается, например еще дописывается, остается прежняя база до следующего изменения
+func (db *Database) Watch(interval time.Duration, onReload func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		info, err := os.Stat(db.path)
+		if err != nil {
+			logger.Warn("Failed to check geolocation database", zap.Error(err), zap.String("path", db.path))
+			continue
+		}
+		if info.ModTime().Equal(db.modTime) && info.Size() == db.size {
+			continue
+		}
+		db.modTime, db.size = info.ModTime(), info.Size()
+
+		if err := db.load(); err != nil {
+			logger.Warn("Failed to reload geolocation database", zap.Error(err), zap.String("path", db.path))
+			continue
+		}
+		reader := db.reader.Load()
+		logger.Info("Geolocation database reloaded",
+			zap.String("path", db.path),
+			zap.String("type", reader.databaseType),
+			zap.Time("built_at", time.Unix(int64(reader.buildEpoch), 0)))
+		if onReload != nil {
+			onReload()
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// pkg/geoip/geoip.go
+package geoip
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+
+	"jiko-auth/internal/models"
+)
+
+// ErrNotFound адрес отсутствует в базе провайдера
+var ErrNotFound = errors.New("geoip: address not found")
+
+// Provider источник геолокации по IP-адресу
+type Provider interface {
+	Lookup(ctx context.Context, addr netip.Addr) (models.Location, error)
+}
+
+// Адреса, не маршрутизируемые в интернете, которых нет в базах геолокации
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // CGNAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// IsPrivate адрес локальной сети: loopback, частные диапазоны (10/8, 172.16/12, 192.168/16, IPv6 ULA),
+// link-local, multicast и зарезервированные диапазоны. IPv4 в IPv6 (::ffff:a.b.c.d) проверяется как IPv4
+func IsPrivate(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
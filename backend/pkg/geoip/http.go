@@ -0,0 +1,85 @@
+// pkg/geoip/http.go
+package geoip
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"time"
+
+	"jiko-auth/internal/models"
+)
+
+// maxResponseSize ограничивает чтение ответа внешнего сервиса
+const maxResponseSize = 64 << 10
+
+// HTTPProvider запрашивает геолокацию у ipapi.co. Сетевой запрос на пути входа ограничен таймаутом,
+// поэтому провайдер подключается только как запасной к локальной базе
+type HTTPProvider struct {
+	client *http.Client
+	apiKey string
+}
+
+func NewHTTPProvider(apiKey string, timeout time.Duration) *HTTPProvider {
+	return &HTTPProvider{
+		client: &http.Client{Timeout: timeout},
+		apiKey: apiKey,
+	}
+}
+
+// ipapiResponse ответ сервиса ipapi.co
+type ipapiResponse struct {
+	City        string  `json:"city"`
+	Region      string  `json:"region"`
+	CountryName string  `json:"country_name"`
+	CountryCode string  `json:"country_code"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Timezone    string  `json:"timezone"`
+	Error       bool    `json:"error"`
+	Reason      string  `json:"reason"`
+}
+
+func (p *HTTPProvider) Lookup(ctx context.Context, addr netip.Addr) (models.Location, error) {
+	endpoint := fmt.Sprintf("https://ipapi.co/%s/json/", addr.String())
+	if p.apiKey != "" {
+		endpoint += "?key=" + url.QueryEscape(p.apiKey)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return models.Location{}, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return models.Location{}, fmt.Errorf("ошибка запроса к API геолокации: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return models.Location{}, fmt.Errorf("API геолокации вернул статус %d", resp.StatusCode)
+	}
+
+	var apiResponse ipapiResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&apiResponse); err != nil {
+		return models.Location{}, fmt.Errorf("ошибка разбора ответа API геолокации: %w", err)
+	}
+	// Зарезервированные адреса и превышение квоты приходят с кодом 200 и флагом error
+	if apiResponse.Error {
+		return models.Location{}, fmt.Errorf("API геолокации: %s", apiResponse.Reason)
+	}
+
+	return models.Location{
+		City:        apiResponse.City,
+		Country:     apiResponse.CountryName,
+		CountryCode: apiResponse.CountryCode,
+		Region:      apiResponse.Region,
+		Latitude:    apiResponse.Latitude,
+		Longitude:   apiResponse.Longitude,
+		Timezone:    apiResponse.Timezone,
+	}, nil
+}
@@ -0,0 +1,372 @@
+// pkg/geoip/mmdb.go
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+
+	"jiko-auth/internal/models"
+)
+
+// Чтение баз в формате MaxMind DB (GeoLite2/GeoIP2 City, DB-IP City Lite).
+// Формат: дерево поиска по битам адреса, 16 нулевых байт, секция данных и метаданные в конце файла
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+const (
+	dataSectionSeparator = 16
+	// maxDecodeDepth защищает от зацикленных указателей в поврежденной базе
+	maxDecodeDepth = 32
+)
+
+// Типы значений секции данных
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEndMarker = 13
+	typeBool      = 14
+	typeFloat     = 15
+)
+
+var errCorrupt = errors.New("mmdb: corrupt database")
+
+type mmdbReader struct {
+	buf          []byte
+	data         []byte // секция данных
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	ipv4Start    uint // узел, с которого начинается поиск IPv4 в базе IPv6
+	databaseType string
+	buildEpoch   uint64
+}
+
+func parseMMDB(buf []byte) (*mmdbReader, error) {
+	start := bytes.LastIndex(buf, metadataMarker)
+	if start < 0 {
+		return nil, errors.New("mmdb: metadata not found")
+	}
+	value, _, err := decoder{buf: buf[start+len(metadataMarker):]}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("mmdb: metadata: %w", err)
+	}
+	metadata, ok := value.(map[string]any)
+	if !ok {
+		return nil, errors.New("mmdb: invalid metadata")
+	}
+
+	r := &mmdbReader{
+		buf:          buf,
+		nodeCount:    uint(toUint(metadata["node_count"])),
+		recordSize:   uint(toUint(metadata["record_size"])),
+		ipVersion:    uint(toUint(metadata["ip_version"])),
+		databaseType: toString(metadata["database_type"]),
+		buildEpoch:   toUint(metadata["build_epoch"]),
+	}
+	if major := toUint(metadata["binary_format_major_version"]); major != 2 {
+		return nil, fmt.Errorf("mmdb: unsupported format version %d", major)
+	}
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("mmdb: unsupported record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("mmdb: unsupported ip version %d", r.ipVersion)
+	}
+
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(start) {
+		return nil, errCorrupt
+	}
+	r.data = buf[treeSize+dataSectionSeparator : start]
+
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// record возвращает левую (bit 0) или правую (bit 1) запись узла
+func (r *mmdbReader) record(node, bit uint) uint {
+	switch r.recordSize {
+	case 24:
+		b := r.buf[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.buf[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(r.buf[node*8+bit*4:]))
+	}
+}
+
+// lookup возвращает запись адреса, nil если адреса нет в базе
+func (r *mmdbReader) lookup(addr netip.Addr) (map[string]any, error) {
+	addr = addr.Unmap()
+	node := uint(0)
+	if addr.Is4() && r.ipVersion == 6 {
+		node = r.ipv4Start
+	}
+	if addr.Is6() && r.ipVersion == 4 {
+		return nil, nil
+	}
+
+	ip := addr.AsSlice()
+	for i := 0; i < len(ip)*8 && node < r.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-i%8)) & 1
+		node = r.record(node, bit)
+	}
+
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, errCorrupt
+	}
+	offset := node - r.nodeCount - dataSectionSeparator
+	value, _, err := decoder{buf: r.data}.decode(offset, 0)
+	if err != nil {
+		return nil, err
+	}
+	record, ok := value.(map[string]any)
+	if !ok {
+		return nil, errCorrupt
+	}
+	return record, nil
+}
+
+type decoder struct {
+	buf []byte
+}
+
+// decode разбирает значение по смещению offset и возвращает смещение следующего значения
+func (d decoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > maxDecodeDepth || offset >= uint(len(d.buf)) {
+		return nil, 0, errCorrupt
+	}
+	ctrl := d.buf[offset]
+	offset++
+
+	kind := uint(ctrl >> 5)
+	if kind == typePointer {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+	if kind == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, errCorrupt
+		}
+		kind = 7 + uint(d.buf[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.buf)) {
+			return nil, 0, errCorrupt
+		}
+		extra := uint(0)
+		for _, b := range d.buf[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += n
+		size = [...]uint{29, 285, 65821}[n-1] + extra
+	}
+	return d.decodeValue(kind, size, offset, depth)
+}
+
+func (d decoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl>>3)&0x3 + 1
+	if offset+size > uint(len(d.buf)) {
+		return 0, 0, errCorrupt
+	}
+	b := d.buf[offset : offset+size]
+	high := uint(ctrl & 0x7)
+
+	var pointer uint
+	switch size {
+	case 1:
+		pointer = high<<8 | uint(b[0])
+	case 2:
+		pointer = (high<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+	case 3:
+		pointer = (high<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+	default:
+		pointer = uint(binary.BigEndian.Uint32(b))
+	}
+	return pointer, offset + size, nil
+}
+
+func (d decoder) decodeValue(kind, size, offset uint, depth int) (any, uint, error) {
+	if kind != typeMap && kind != typeArray && kind != typeBool && offset+size > uint(len(d.buf)) {
+		return nil, 0, errCorrupt
+	}
+
+	switch kind {
+	case typeMap:
+		values := make(map[string]any, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errCorrupt
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			values[name] = value
+			offset = next
+		}
+		return values, offset, nil
+	case typeArray:
+		values := make([]any, 0, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			values = append(values, value)
+			offset = next
+		}
+		return values, offset, nil
+	case typeString:
+		return string(d.buf[offset : offset+size]), offset + size, nil
+	case typeBytes:
+		return bytes.Clone(d.buf[offset : offset+size]), offset + size, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(d.buf[offset:])), offset + size, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errCorrupt
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(d.buf[offset:]))), offset + size, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, errCorrupt
+		}
+		return decodeUint(d.buf[offset : offset+size]), offset + size, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, errCorrupt
+		}
+		return int32(decodeUint(d.buf[offset : offset+size])), offset + size, nil
+	case typeUint128:
+		if size > 16 {
+			return nil, 0, errCorrupt
+		}
+		return new(big.Int).SetBytes(d.buf[offset : offset+size]), offset + size, nil
+	case typeBool:
+		if size > 1 {
+			return nil, 0, errCorrupt
+		}
+		return size == 1, offset, nil
+	default:
+		return nil, 0, fmt.Errorf("mmdb: unexpected data type %d", kind)
+	}
+}
+
+func decodeUint(b []byte) uint64 {
+	var value uint64
+	for _, c := range b {
+		value = value<<8 | uint64(c)
+	}
+	return value
+}
+
+func toUint(value any) uint64 {
+	switch v := value.(type) {
+	case uint64:
+		return v
+	case int32:
+		return uint64(max(v, 0))
+	}
+	return 0
+}
+
+func toString(value any) string {
+	s, _ := value.(string)
+	return s
+}
+
+func toFloat(value any) float64 {
+	f, _ := value.(float64)
+	return f
+}
+
+// field возвращает значение по пути ключей во вложенных словарях
+func field(value any, keys ...string) any {
+	for _, key := range keys {
+		values, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = values[key]
+	}
+	return value
+}
+
+// localizedName английское название из names, иначе любое доступное
+func localizedName(value any) string {
+	names, ok := field(value, "names").(map[string]any)
+	if !ok {
+		return ""
+	}
+	if name := toString(names["en"]); name != "" {
+		return name
+	}
+	for _, name := range names {
+		if s := toString(name); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// recordLocation переводит запись базы City в местоположение
+func recordLocation(record map[string]any) models.Location {
+	location := models.Location{
+		City:        localizedName(record["city"]),
+		Country:     localizedName(record["country"]),
+		CountryCode: toString(field(record, "country", "iso_code")),
+		Latitude:    toFloat(field(record, "location", "latitude")),
+		Longitude:   toFloat(field(record, "location", "longitude")),
+		Timezone:    toString(field(record, "location", "time_zone")),
+	}
+	if subdivisions, ok := record["subdivisions"].([]any); ok && len(subdivisions) > 0 {
+		location.Region = localizedName(subdivisions[0])
+	}
+	return location
+}
@@ -0,0 +1,571 @@
+package geoip
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"jiko-auth/internal/models"
+)
+
+// mmdbWriter собирает небольшую базу MaxMind DB для тестов
+type mmdbWriter struct {
+	ipVersion  int
+	recordSize int
+	data       []byte
+	root       *trieNode
+	metadata   map[string]any
+}
+
+// trieNode узел дерева поиска: ребенок или смещение записи в секции данных для каждого бита
+type trieNode struct {
+	child [2]*trieNode
+	data  [2]int
+	index int
+}
+
+func newTrieNode() *trieNode {
+	return &trieNode{data: [2]int{-1, -1}}
+}
+
+func newMMDBWriter(ipVersion, recordSize int) *mmdbWriter {
+	return &mmdbWriter{
+		ipVersion:  ipVersion,
+		recordSize: recordSize,
+		root:       newTrieNode(),
+		metadata: map[string]any{
+			"binary_format_major_version": uint16(2),
+			"binary_format_minor_version": uint16(0),
+			"build_epoch":                 uint64(1700000000),
+			"database_type":               "Test-City",
+			"description":                 map[string]any{"en": "Test database"},
+			"languages":                   []any{"en"},
+		},
+	}
+}
+
+// store добавляет значение в секцию данных и возвращает его смещение
+func (w *mmdbWriter) store(value any) int {
+	offset := len(w.data)
+	w.data = append(w.data, encodeMMDB(value)...)
+	return offset
+}
+
+// insert направляет адреса prefix на запись по смещению offset. IPv4 в базе IPv6 хранится в ::/96
+func (w *mmdbWriter) insert(prefix netip.Prefix, offset int) {
+	ip := prefix.Addr().AsSlice()
+	bits := prefix.Bits()
+	if prefix.Addr().Is4() && w.ipVersion == 6 {
+		ip = append(make([]byte, 12), ip...)
+		bits += 96
+	}
+
+	node := w.root
+	for i := 0; i < bits; i++ {
+		bit := ip[i/8] >> (7 - i%8) & 1
+		if i == bits-1 {
+			node.data[bit] = offset
+			return
+		}
+		if node.child[bit] == nil {
+			node.child[bit] = newTrieNode()
+		}
+		node = node.child[bit]
+	}
+}
+
+func (w *mmdbWriter) bytes() []byte {
+	var nodes []*trieNode
+	var number func(*trieNode)
+	number = func(n *trieNode) {
+		n.index = len(nodes)
+		nodes = append(nodes, n)
+		for _, child := range n.child {
+			if child != nil {
+				number(child)
+			}
+		}
+	}
+	number(w.root)
+	nodeCount := len(nodes)
+
+	var buf []byte
+	for _, n := range nodes {
+		var records [2]uint32
+		for bit := range records {
+			switch {
+			case n.child[bit] != nil:
+				records[bit] = uint32(n.child[bit].index)
+			case n.data[bit] >= 0:
+				records[bit] = uint32(nodeCount + dataSectionSeparator + n.data[bit])
+			default:
+				records[bit] = uint32(nodeCount)
+			}
+		}
+		buf = append(buf, w.encodeNode(records[0], records[1])...)
+	}
+
+	buf = append(buf, make([]byte, dataSectionSeparator)...)
+	buf = append(buf, w.data...)
+	buf = append(buf, metadataMarker...)
+
+	metadata := map[string]any{
+		"node_count":  uint32(nodeCount),
+		"record_size": uint16(w.recordSize),
+		"ip_version":  uint16(w.ipVersion),
+	}
+	for key, value := range w.metadata {
+		metadata[key] = value
+	}
+	return append(buf, encodeMMDB(metadata)...)
+}
+
+func (w *mmdbWriter) encodeNode(left, right uint32) []byte {
+	switch w.recordSize {
+	case 24:
+		return []byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)}
+	case 28:
+		return []byte{
+			byte(left >> 16), byte(left >> 8), byte(left),
+			byte(left>>24)<<4 | byte(right>>24)&0x0f,
+			byte(right >> 16), byte(right >> 8), byte(right),
+		}
+	}
+	return binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, left), right)
+}
+
+// mmdbPointer ссылка на значение секции данных
+type mmdbPointer int
+
+func encodeMMDB(value any) []byte {
+	switch v := value.(type) {
+	case mmdbPointer:
+		return encodePointer(int(v))
+	case string:
+		return append(mmdbControl(typeString, len(v)), v...)
+	case []byte:
+		return append(mmdbControl(typeBytes, len(v)), v...)
+	case float64:
+		return binary.BigEndian.AppendUint64(mmdbControl(typeDouble, 8), math.Float64bits(v))
+	case float32:
+		return binary.BigEndian.AppendUint32(mmdbControl(typeFloat, 4), math.Float32bits(v))
+	case uint16:
+		return encodeUint(typeUint16, uint64(v))
+	case uint32:
+		return encodeUint(typeUint32, uint64(v))
+	case uint64:
+		return encodeUint(typeUint64, v)
+	case int32:
+		return append(mmdbControl(typeInt32, 4), binary.BigEndian.AppendUint32(nil, uint32(v))...)
+	case *big.Int:
+		return append(mmdbControl(typeUint128, len(v.Bytes())), v.Bytes()...)
+	case bool:
+		if v {
+			return mmdbControl(typeBool, 1)
+		}
+		return mmdbControl(typeBool, 0)
+	case []any:
+		out := mmdbControl(typeArray, len(v))
+		for _, item := range v {
+			out = append(out, encodeMMDB(item)...)
+		}
+		return out
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out := mmdbControl(typeMap, len(v))
+		for _, key := range keys {
+			out = append(out, encodeMMDB(key)...)
+			out = append(out, encodeMMDB(v[key])...)
+		}
+		return out
+	}
+	panic("unsupported mmdb value")
+}
+
+// encodeUint записывает число минимальным числом байт
+func encodeUint(kind int, value uint64) []byte {
+	b := binary.BigEndian.AppendUint64(nil, value)
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	return append(mmdbControl(kind, len(b)), b...)
+}
+
+func mmdbControl(kind, size int) []byte {
+	var ctrl byte
+	var extended []byte
+	if kind > 7 {
+		extended = []byte{byte(kind - 7)}
+	} else {
+		ctrl = byte(kind) << 5
+	}
+
+	var extra []byte
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+		extra = []byte{byte(size - 29)}
+	case size < 65821:
+		ctrl |= 30
+		extra = binary.BigEndian.AppendUint16(nil, uint16(size-285))
+	default:
+		ctrl |= 31
+		n := size - 65821
+		extra = []byte{byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+	return append(append([]byte{ctrl}, extended...), extra...)
+}
+
+func encodePointer(p int) []byte {
+	switch {
+	case p < 2048:
+		return []byte{0x20 | byte(p>>8), byte(p)}
+	case p < 526336:
+		v := p - 2048
+		return []byte{0x28 | byte(v>>16), byte(v >> 8), byte(v)}
+	case p < 134744064:
+		v := p - 526336
+		return []byte{0x30 | byte(v>>24), byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+	return binary.BigEndian.AppendUint32([]byte{0x38}, uint32(p))
+}
+
+// cityRecord запись базы City; названия стран хранятся один раз и подставляются указателями
+func cityRecord(city string, country, countryCode any, latitude, longitude float64, timezone string) map[string]any {
+	return map[string]any{
+		"city":         map[string]any{"names": map[string]any{"en": city, "de": city + "-de"}},
+		"country":      map[string]any{"iso_code": countryCode, "names": country},
+		"location":     map[string]any{"latitude": latitude, "longitude": longitude, "time_zone": timezone},
+		"subdivisions": []any{map[string]any{"names": map[string]any{"ru": city + " область"}}},
+	}
+}
+
+// buildTestDatabase база с двумя сетями IPv4 и, для IPv6, одной сетью IPv6
+func buildTestDatabase(ipVersion, recordSize int, london string) []byte {
+	w := newMMDBWriter(ipVersion, recordSize)
+	gbNames := mmdbPointer(w.store(map[string]any{"en": "United Kingdom"}))
+	gbCode := mmdbPointer(w.store("GB"))
+
+	w.insert(netip.MustParsePrefix("81.2.69.0/24"), w.store(cityRecord(london, gbNames, gbCode, 51.5142, -0.0931, "Europe/London")))
+	w.insert(netip.MustParsePrefix("2.125.160.216/29"), w.store(cityRecord("Boxford", gbNames, gbCode, 51.75, -1.25, "Europe/London")))
+	if ipVersion == 6 {
+		jp := w.store(map[string]any{"en": "Japan"})
+		w.insert(netip.MustParsePrefix("2001:218::/32"), w.store(cityRecord("Tokyo", mmdbPointer(jp), "JP", 35.685, 139.7514, "Asia/Tokyo")))
+	}
+	return w.bytes()
+}
+
+func TestMMDBLookup(t *testing.T) {
+	london := models.Location{
+		City: "London", Country: "United Kingdom", CountryCode: "GB", Region: "London область",
+		Latitude: 51.5142, Longitude: -0.0931, Timezone: "Europe/London",
+	}
+	tokyo := models.Location{
+		City: "Tokyo", Country: "Japan", CountryCode: "JP", Region: "Tokyo область",
+		Latitude: 35.685, Longitude: 139.7514, Timezone: "Asia/Tokyo",
+	}
+
+	for _, ipVersion := range []int{4, 6} {
+		for _, recordSize := range []int{24, 28, 32} {
+			reader, err := parseMMDB(buildTestDatabase(ipVersion, recordSize, "London"))
+			if err != nil {
+				t.Fatalf("ipv%d/%d: parseMMDB: %v", ipVersion, recordSize, err)
+			}
+
+			tests := []struct {
+				addr string
+				want *models.Location
+			}{
+				{"81.2.69.142", &london},
+				{"81.2.69.0", &london},
+				{"81.2.69.255", &london},
+				{"::ffff:81.2.69.142", &london},
+				{"81.2.68.255", nil},
+				{"81.2.70.0", nil},
+				{"2.125.160.215", nil},
+				{"2.125.160.224", nil},
+				{"8.8.8.8", nil},
+				{"2001:218:1::1", nil},
+				{"2001:219::1", nil},
+			}
+			if ipVersion == 6 {
+				tests[9].want = &tokyo
+			}
+
+			for _, tt := range tests {
+				record, err := reader.lookup(netip.MustParseAddr(tt.addr))
+				if err != nil {
+					t.Errorf("ipv%d/%d: lookup(%s): %v", ipVersion, recordSize, tt.addr, err)
+					continue
+				}
+				if tt.want == nil {
+					if record != nil {
+						t.Errorf("ipv%d/%d: lookup(%s) = %v, want not found", ipVersion, recordSize, tt.addr, record)
+					}
+					continue
+				}
+				if got := recordLocation(record); got != *tt.want {
+					t.Errorf("ipv%d/%d: lookup(%s) = %+v, want %+v", ipVersion, recordSize, tt.addr, got, *tt.want)
+				}
+			}
+
+			// Сеть /29 покрывает ровно восемь адресов
+			for last := 216; last <= 223; last++ {
+				addr := netip.AddrFrom4([4]byte{2, 125, 160, byte(last)})
+				if record, err := reader.lookup(addr); err != nil || recordLocation(record).City != "Boxford" {
+					t.Errorf("ipv%d/%d: lookup(%s) = %v, %v", ipVersion, recordSize, addr, record, err)
+				}
+			}
+		}
+	}
+}
+
+func TestMMDBMetadata(t *testing.T) {
+	reader, err := parseMMDB(buildTestDatabase(6, 28, "London"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.databaseType != "Test-City" || reader.buildEpoch != 1700000000 || reader.ipVersion != 6 || reader.recordSize != 28 {
+		t.Errorf("metadata = type %q, epoch %d, ip v%d, record %d", reader.databaseType, reader.buildEpoch, reader.ipVersion, reader.recordSize)
+	}
+	// Поиск IPv4 начинается с узла после 96 нулевых бит
+	if reader.ipv4Start == 0 || reader.ipv4Start >= reader.nodeCount {
+		t.Errorf("ipv4Start = %d of %d nodes", reader.ipv4Start, reader.nodeCount)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(w *mmdbWriter)
+	}{
+		{"unsupported major version", func(w *mmdbWriter) { w.metadata["binary_format_major_version"] = uint16(3) }},
+		{"unsupported record size", func(w *mmdbWriter) { w.recordSize = 16 }},
+		{"unsupported ip version", func(w *mmdbWriter) { w.ipVersion = 5 }},
+		{"node count beyond the file", func(w *mmdbWriter) { w.metadata["node_count"] = uint32(1 << 20) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newMMDBWriter(4, 24)
+			w.insert(netip.MustParsePrefix("81.2.69.0/24"), w.store(map[string]any{}))
+			tt.modify(w)
+			if w.recordSize == 16 {
+				// Дерево записывается как 24-битное, метаданные сообщают неподдерживаемый размер
+				w.recordSize = 24
+				w.metadata["record_size"] = uint16(16)
+			}
+			if _, err := parseMMDB(w.bytes()); err == nil {
+				t.Error("parseMMDB accepted invalid metadata")
+			}
+		})
+	}
+
+	if _, err := parseMMDB([]byte("not a database")); err == nil {
+		t.Error("parseMMDB accepted a file without metadata")
+	}
+}
+
+func TestMMDBDecode(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), 300)
+	tests := []struct {
+		name  string
+		value any
+		want  any
+	}{
+		{"string", "hello", "hello"},
+		{"empty string", "", ""},
+		{"string with one-byte size", string(large[:100]), string(large[:100])},
+		{"string with two-byte size", string(large), string(large)},
+		{"bytes", []byte{1, 2, 3}, []byte{1, 2, 3}},
+		{"double", 51.5142, 51.5142},
+		{"float", float32(1.5), 1.5},
+		{"uint16", uint16(443), uint64(443)},
+		{"uint32", uint32(1 << 30), uint64(1 << 30)},
+		{"uint64", uint64(1 << 60), uint64(1 << 60)},
+		{"zero", uint32(0), uint64(0)},
+		{"int32", int32(-42), int32(-42)},
+		{"uint128", new(big.Int).Lsh(big.NewInt(1), 100), new(big.Int).Lsh(big.NewInt(1), 100)},
+		{"true", true, true},
+		{"false", false, false},
+		{"array", []any{"a", uint16(1)}, []any{"a", uint64(1)}},
+		{"map", map[string]any{"a": map[string]any{"b": "c"}}, map[string]any{"a": map[string]any{"b": "c"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := append(encodeMMDB(tt.value), 0xff)
+			got, next, err := decoder{buf: buf}.decode(0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalMMDB(got, tt.want) {
+				t.Errorf("decode = %#v, want %#v", got, tt.want)
+			}
+			if next != uint(len(buf)-1) {
+				t.Errorf("next offset = %d, want %d", next, len(buf)-1)
+			}
+		})
+	}
+}
+
+func equalMMDB(a, b any) bool {
+	switch av := a.(type) {
+	case []byte:
+		bv, ok := b.([]byte)
+		return ok && bytes.Equal(av, bv)
+	case *big.Int:
+		bv, ok := b.(*big.Int)
+		return ok && av.Cmp(bv) == 0
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !equalMMDB(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, value := range av {
+			if !equalMMDB(value, bv[key]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func TestMMDBPointers(t *testing.T) {
+	// Указатель каждого из четырех размеров: смещение 2048 и больше требует двух байт и т.д.
+	for _, target := range []int{0, 2047, 2048, 526335, 526336, 134744064} {
+		pointer := encodePointer(target)
+		got, next, err := decoder{buf: pointer}.pointer(pointer[0], 1)
+		if err != nil || got != uint(target) || next != uint(len(pointer)) {
+			t.Errorf("pointer(%x) = %d, %d, %v, want %d", pointer, got, next, err, target)
+		}
+	}
+
+	// Значение по указателю подставляется, а разбор продолжается после самого указателя
+	buf := encodeMMDB("shared")
+	sharedAt := 0
+	recordAt := len(buf)
+	buf = append(buf, encodeMMDB([]any{mmdbPointer(sharedAt), mmdbPointer(sharedAt), "own"})...)
+	got, _, err := decoder{buf: buf}.decode(uint(recordAt), 0)
+	if err != nil || !equalMMDB(got, []any{"shared", "shared", "own"}) {
+		t.Errorf("decode = %#v, %v", got, err)
+	}
+
+	corrupt := []struct {
+		name string
+		buf  []byte
+	}{
+		{"pointer to itself", encodePointer(0)},
+		{"pointer beyond the data", encodePointer(1000)},
+		{"truncated pointer", encodePointer(5000)[:2]},
+		{"truncated string", encodeMMDB("hello")[:3]},
+		{"truncated map", encodeMMDB(map[string]any{"a": "b"})[:3]},
+		{"map with a non-string key", append(mmdbControl(typeMap, 1), append(encodeMMDB(uint16(1)), encodeMMDB("v")...)...)},
+		{"double of wrong size", append(mmdbControl(typeDouble, 4), 0, 0, 0, 0)},
+		{"end marker", mmdbControl(typeEndMarker, 0)},
+	}
+	for _, tt := range corrupt {
+		if _, _, err := (decoder{buf: tt.buf}).decode(0, 0); err == nil {
+			t.Errorf("%s: decode accepted corrupt data", tt.name)
+		}
+	}
+}
+
+func TestDatabaseLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	if err := os.WriteFile(path, buildTestDatabase(6, 24, "London"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	location, err := db.Lookup(context.Background(), netip.MustParseAddr("81.2.69.142"))
+	if err != nil || location.City != "London" {
+		t.Errorf("Lookup = %+v, %v", location, err)
+	}
+	if _, err := db.Lookup(context.Background(), netip.MustParseAddr("8.8.8.8")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup(8.8.8.8) error = %v, want ErrNotFound", err)
+	}
+
+	if _, err := OpenDatabase(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Error("OpenDatabase accepted a missing file")
+	}
+}
+
+func TestDatabaseWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	if err := os.WriteFile(path, buildTestDatabase(4, 24, "London"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan struct{}, 1)
+	go db.Watch(10*time.Millisecond, func() { reloaded <- struct{}{} })
+
+	city := func() string {
+		location, err := db.Lookup(context.Background(), netip.MustParseAddr("81.2.69.142"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return location.City
+	}
+	// Время изменения сдвигается явно: на некоторых файловых системах его точность - секунда
+	replace := func(content []byte, modTime time.Time) {
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Недописанный файл не заменяет рабочую базу
+	replace([]byte("partial"), time.Now().Add(time.Minute))
+	time.Sleep(50 * time.Millisecond)
+	if got := city(); got != "London" {
+		t.Fatalf("city after a broken update = %q, want London", got)
+	}
+	select {
+	case <-reloaded:
+		t.Fatal("onReload called for a broken database")
+	default:
+	}
+
+	replace(buildTestDatabase(4, 24, "City of London"), time.Now().Add(2*time.Minute))
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("database was not reloaded")
+	}
+	if got := city(); got != "City of London" {
+		t.Errorf("city after reload = %q, want City of London", got)
+	}
+}
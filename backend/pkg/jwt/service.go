@@ -5,36 +5,70 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
+// Назначение токена в claim token_use: refresh токен нельзя предъявить вместо access токена
+const (
+	TokenUseAccess  = "access"
+	TokenUseRefresh = "refresh"
+	TokenUseMFA     = "mfa" // промежуточный токен входа до проверки второго фактора
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
 type Service struct {
-	secret string
+	secret     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
 }
 
 type Claims struct {
-	UserID    string `json:"sub"`
-	Email     string `json:"email"`
-	Role      string `json:"role"`
-	SessionID string `json:"sid"`
+	UserID    string   `json:"sub"`
+	Email     string   `json:"email"`
+	Role      string   `json:"role"`
+	SessionID string   `json:"sid"`
+	TokenUse  string   `json:"token_use"`
+	AMR       []string `json:"amr,omitempty"` // методы аутентификации (RFC 8176): pwd, otp, hwk, swk
 	jwt.RegisteredClaims
 }
 
-func NewService(secret string) *Service {
-	return &Service{secret: secret}
+// TokenPair access и refresh токены одной сессии. RefreshTokenID (jti) сохраняется в сессии
+// для ротации: предъявить можно только последний выданный refresh токен
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresIn        int64     `json:"expires_in"`
+	ExpiresAt        int64     `json:"expires_at"`
+	RefreshTokenID   string    `json:"-"`
+	RefreshExpiresAt time.Time `json:"-"`
 }
 
-func (s *Service) GenerateTokenPair(userID, email, role string) (map[string]interface{}, error) {
+func NewService(secret string, accessTTL, refreshTTL time.Duration) *Service {
+	return &Service{secret: secret, accessTTL: accessTTL, refreshTTL: refreshTTL}
+}
 
-	sessionID := generateSessionID()
+// GenerateTokenPair выпускает access и refresh токены сессии. amr попадает в access токен.
+// Refresh токен не переживает notAfter - предельный срок жизни сессии
+func (s *Service) GenerateTokenPair(userID, email, role, sessionID string, amr []string, notAfter time.Time) (*TokenPair, error) {
+	now := time.Now()
+	accessExpiresAt := now.Add(s.accessTTL)
+	refreshExpiresAt := now.Add(s.refreshTTL)
+	if notAfter.Before(refreshExpiresAt) {
+		refreshExpiresAt = notAfter
+	}
 
 	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
 		UserID:    userID,
 		Email:     email,
 		Role:      role,
 		SessionID: sessionID,
+		TokenUse:  TokenUseAccess,
+		AMR:       amr,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(accessExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
 			Issuer:    "jiko-auth",
 		},
 	})
@@ -45,12 +79,15 @@ func (s *Service) GenerateTokenPair(userID, email, role string) (map[string]inte
 	}
 
 	// Refresh token (long-lived)
+	refreshTokenID := uuid.NewString()
 	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
 		UserID:    userID,
 		SessionID: sessionID,
+		TokenUse:  TokenUseRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        refreshTokenID,
+			ExpiresAt: jwt.NewNumericDate(refreshExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
 			Issuer:    "jiko-auth",
 		},
 	})
@@ -60,15 +97,49 @@ func (s *Service) GenerateTokenPair(userID, email, role string) (map[string]inte
 		return nil, err
 	}
 
-	return map[string]interface{}{
-		"access_token":  accessTokenString,
-		"refresh_token": refreshTokenString,
-		"token_type":    "Bearer",
-		"expires_in":    900, // 15 minutes
+	return &TokenPair{
+		AccessToken:      accessTokenString,
+		RefreshToken:     refreshTokenString,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(s.accessTTL.Seconds()),
+		ExpiresAt:        accessExpiresAt.Unix(),
+		RefreshTokenID:   refreshTokenID,
+		RefreshExpiresAt: refreshExpiresAt,
 	}, nil
 }
 
+// GenerateMFAToken выпускает токен второго шага входа, jti совпадает с ID challenge в БД
+func (s *Service) GenerateMFAToken(userID, challengeID string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		UserID:   userID,
+		TokenUse: TokenUseMFA,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        challengeID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "jiko-auth",
+		},
+	})
+	return token.SignedString([]byte(s.secret))
+}
+
+// ValidateToken проверяет access токен
 func (s *Service) ValidateToken(tokenString string) (*Claims, error) {
+	return s.validate(tokenString, TokenUseAccess)
+}
+
+// ValidateRefreshToken проверяет refresh токен
+func (s *Service) ValidateRefreshToken(tokenString string) (*Claims, error) {
+	return s.validate(tokenString, TokenUseRefresh)
+}
+
+// ValidateMFAToken проверяет токен второго шага входа
+func (s *Service) ValidateMFAToken(tokenString string) (*Claims, error) {
+	return s.validate(tokenString, TokenUseMFA)
+}
+
+func (s *Service) validate(tokenString, tokenUse string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
@@ -80,11 +151,11 @@ func (s *Service) ValidateToken(tokenString string) (*Claims, error) {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.TokenUse == tokenUse {
 		return claims, nil
 	}
 
-	return nil, errors.New("invalid token")
+	return nil, ErrInvalidToken
 }
 
 type IDTokenClaims struct {
@@ -101,7 +172,7 @@ type IDTokenClaims struct {
 	jwt.RegisteredClaims
 }
 
-func (s *Service) GenerateIDToken(userID, clientID, email, username string, emailVerified bool, nonce string, authTime time.Time) (string, error) {
+func (s *Service) GenerateIDToken(userID, clientID, email, username string, emailVerified bool, nonce string, authTime time.Time, ttl time.Duration) (string, error) {
 	scheme := "http"             // TODO: get from config
 	host := "auth.with-jiko.com" // TODO: get from config
 	issuer := scheme + "://" + host + "/api/v1"
@@ -110,7 +181,7 @@ func (s *Service) GenerateIDToken(userID, clientID, email, username string, emai
 		Subject:       userID,
 		Issuer:        issuer,
 		Audience:      clientID,
-		ExpiresAt:     time.Now().Add(1 * time.Hour).Unix(),
+		ExpiresAt:     time.Now().Add(ttl).Unix(),
 		IssuedAt:      time.Now().Unix(),
 		AuthTime:      authTime.Unix(),
 		Nonce:         nonce,
@@ -122,8 +193,3 @@ func (s *Service) GenerateIDToken(userID, clientID, email, username string, emai
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(s.secret))
 }
-
-func generateSessionID() string {
-	// Implementation for cryptographically secure session ID
-	return "secure_session_id_" + time.Now().Format("20060102150405")
-}
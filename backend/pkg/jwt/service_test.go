@@ -0,0 +1,59 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGenerateTokenPairRefreshDeadline(t *testing.T) {
+	service := NewService("secret", 15*time.Minute, 7*24*time.Hour)
+
+	tests := []struct {
+		name     string
+		notAfter time.Time
+		want     time.Duration // ожидаемый срок refresh токена от текущего момента
+	}{
+		{"session far from its limit", time.Now().Add(30 * 24 * time.Hour), 7 * 24 * time.Hour},
+		{"session close to its limit", time.Now().Add(2 * time.Hour), 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := service.GenerateTokenPair("user", "user@example.com", "user", "session", []string{"pwd"}, tt.notAfter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := time.Until(tokens.RefreshExpiresAt); got > tt.want || got < tt.want-time.Minute {
+				t.Errorf("refresh token expires in %v, want %v", got, tt.want)
+			}
+
+			claims, err := service.ValidateRefreshToken(tokens.RefreshToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !claims.ExpiresAt.Time.Equal(tokens.RefreshExpiresAt.Truncate(time.Second)) {
+				t.Errorf("refresh token exp = %v, want %v", claims.ExpiresAt.Time, tokens.RefreshExpiresAt)
+			}
+			if claims.ID != tokens.RefreshTokenID || claims.SessionID != "session" {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestValidateTokenUse(t *testing.T) {
+	service := NewService("secret", 15*time.Minute, time.Hour)
+	tokens, err := service.GenerateTokenPair("user", "user@example.com", "user", "session", nil, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.ValidateToken(tokens.RefreshToken); err == nil {
+		t.Error("refresh token accepted as an access token")
+	}
+	if _, err := service.ValidateRefreshToken(tokens.AccessToken); err == nil {
+		t.Error("access token accepted as a refresh token")
+	}
+	if _, err := NewService("other", 15*time.Minute, time.Hour).ValidateToken(tokens.AccessToken); err == nil {
+		t.Error("token signed with another secret accepted")
+	}
+}
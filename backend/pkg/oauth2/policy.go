@@ -0,0 +1,109 @@
+// pkg/oauth2/policy.go
+package oauth2
+
+import (
+	"errors"
+	"jiko-auth/internal/config"
+	"jiko-auth/internal/models"
+	"time"
+)
+
+var ErrInvalidTokenPolicy = errors.New("invalid token policy")
+
+// TokenPolicy действующие сроки жизни токенов клиента
+type TokenPolicy struct {
+	CodeTTL            time.Duration
+	AccessTokenTTL     time.Duration
+	RefreshIdleTTL     time.Duration
+	RefreshAbsoluteTTL time.Duration
+	IDTokenTTL         time.Duration
+	IssueRefreshTokens bool
+}
+
+// DefaultTokenPolicy возвращает политику по умолчанию из конфигурации
+func DefaultTokenPolicy(cfg *config.Config) TokenPolicy {
+	return TokenPolicy{
+		CodeTTL:            cfg.AuthCodeExpiry,
+		AccessTokenTTL:     cfg.AccessTokenExpiry,
+		RefreshIdleTTL:     cfg.RefreshTokenExpiry,
+		RefreshAbsoluteTTL: cfg.RefreshMaxLifetime,
+		IDTokenTTL:         cfg.IDTokenExpiry,
+		IssueRefreshTokens: cfg.IssueRefreshTokens,
+	}
+}
+
+// TokenPolicyFor накладывает переопределения клиента на политику по умолчанию
+func (s *Service) TokenPolicyFor(client *models.OAuthClient) TokenPolicy {
+	policy := DefaultTokenPolicy(s.cfg)
+	overrides := client.TokenPolicy
+
+	if overrides.CodeTTL != nil {
+		policy.CodeTTL = seconds(*overrides.CodeTTL)
+	}
+	if overrides.AccessTokenTTL != nil {
+		policy.AccessTokenTTL = seconds(*overrides.AccessTokenTTL)
+	}
+	if overrides.RefreshIdleTTL != nil {
+		policy.RefreshIdleTTL = seconds(*overrides.RefreshIdleTTL)
+	}
+	if overrides.RefreshAbsoluteTTL != nil {
+		policy.RefreshAbsoluteTTL = seconds(*overrides.RefreshAbsoluteTTL)
+	}
+	if overrides.IDTokenTTL != nil {
+		policy.IDTokenTTL = seconds(*overrides.IDTokenTTL)
+	}
+	if overrides.IssueRefreshTokens != nil {
+		policy.IssueRefreshTokens = *overrides.IssueRefreshTokens
+	}
+
+	return policy
+}
+
+// Model возвращает политику в представлении для API (сроки в секундах)
+func (p TokenPolicy) Model() models.TokenPolicy {
+	codeTTL := int(p.CodeTTL.Seconds())
+	accessTokenTTL := int(p.AccessTokenTTL.Seconds())
+	refreshIdleTTL := int(p.RefreshIdleTTL.Seconds())
+	refreshAbsoluteTTL := int(p.RefreshAbsoluteTTL.Seconds())
+	idTokenTTL := int(p.IDTokenTTL.Seconds())
+	issueRefreshTokens := p.IssueRefreshTokens
+
+	return models.TokenPolicy{
+		CodeTTL:            &codeTTL,
+		AccessTokenTTL:     &accessTokenTTL,
+		RefreshIdleTTL:     &refreshIdleTTL,
+		RefreshAbsoluteTTL: &refreshAbsoluteTTL,
+		IDTokenTTL:         &idTokenTTL,
+		IssueRefreshTokens: &issueRefreshTokens,
+	}
+}
+
+// ValidateTokenPolicy проверяет переопределения клиента: сроки положительны,
+// а абсолютный срок refresh токена не меньше срока неактивности
+func (s *Service) ValidateTokenPolicy(overrides models.TokenPolicy) error {
+	for _, ttl := range []*int{overrides.CodeTTL, overrides.AccessTokenTTL, overrides.RefreshIdleTTL, overrides.RefreshAbsoluteTTL, overrides.IDTokenTTL} {
+		if ttl != nil && *ttl <= 0 {
+			return ErrInvalidTokenPolicy
+		}
+	}
+
+	effective := s.TokenPolicyFor(&models.OAuthClient{TokenPolicy: overrides})
+	if effective.RefreshAbsoluteTTL < effective.RefreshIdleTTL {
+		return ErrInvalidTokenPolicy
+	}
+	return nil
+}
+
+// refreshExpiry вычисляет срок истечения refresh токена по неактивности,
+// не выходящий за абсолютный срок жизни цепочки
+func refreshExpiry(idleTTL time.Duration, absoluteExpiresAt *time.Time) time.Time {
+	expiresAt := time.Now().Add(idleTTL)
+	if absoluteExpiresAt != nil && absoluteExpiresAt.Before(expiresAt) {
+		return *absoluteExpiresAt
+	}
+	return expiresAt
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
@@ -0,0 +1,62 @@
+// pkg/oauth2/profile.go
+package oauth2
+
+import (
+	"errors"
+	"jiko-auth/internal/models"
+)
+
+var (
+	ErrInvalidClient       = errors.New("invalid client credentials")
+	ErrInvalidRedirectURI  = errors.New("invalid redirect_uri")
+	ErrPKCERequired        = errors.New("PKCE with S256 is required")
+	ErrUnsupportedResponse = errors.New("unsupported response_type")
+)
+
+// ProfileEnabled сообщает, действует ли для клиента строгий профиль OAuth 2.1:
+// глобально через конфигурацию или индивидуально для клиента
+func (s *Service) ProfileEnabled(client *models.OAuthClient) bool {
+	return s.cfg.OAuth21Profile || client.OAuth21Profile
+}
+
+// ValidateAuthorizationRequest проверяет redirect_uri и параметры PKCE запроса авторизации.
+// В профиле OAuth 2.1 PKCE с методом S256 обязателен для всех клиентов
+func (s *Service) ValidateAuthorizationRequest(client *models.OAuthClient, redirectURI, responseType, codeChallenge, codeChallengeMethod string) error {
+	if !s.isRegisteredRedirectURI(client, redirectURI) {
+		return ErrInvalidRedirectURI
+	}
+
+	if responseType != "code" {
+		return ErrUnsupportedResponse
+	}
+
+	if s.ProfileEnabled(client) || client.IsPublic() {
+		if codeChallenge == "" {
+			return ErrPKCERequired
+		}
+	}
+
+	if s.ProfileEnabled(client) && codeChallengeMethod != "S256" {
+		return ErrPKCERequired
+	}
+
+	return nil
+}
+
+// authenticateClient аутентифицирует клиента на token endpoint. Публичные клиенты секрета
+// не имеют. Вне профиля OAuth 2.1 конфиденциальный клиент может пропустить секрет при PKCE
+func (s *Service) authenticateClient(client *models.OAuthClient, clientSecret string, allowPKCEOnly bool) error {
+	if client.IsPublic() {
+		return nil
+	}
+
+	if clientSecret == "" && allowPKCEOnly && !s.ProfileEnabled(client) {
+		return nil
+	}
+
+	isValid, err := s.clientRepo.ValidateClientSecret(client.ID.String(), clientSecret)
+	if err != nil || !isValid {
+		return ErrInvalidClient
+	}
+	return nil
+}
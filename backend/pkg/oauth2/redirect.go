@@ -0,0 +1,146 @@
+// pkg/oauth2/redirect.go
+package oauth2
+
+import (
+	"fmt"
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/utils"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// wildcardPrefix метка подстановки в шаблонах redirect_uri для preview-окружений
+const wildcardPrefix = "*."
+
+// ValidateRedirectURIs проверяет redirect_uri клиента при создании и изменении.
+// Допускаются https, http только на loopback IP (RFC 8252, 7.3), private-use схемы
+// в стиле reverse domain для публичных клиентов (RFC 8252, 7.1) и, если администратор
+// разрешил, https шаблоны с подстановкой поддомена вида https://*.preview.example.com
+func ValidateRedirectURIs(uris []string, clientType string, allowWildcard bool) error {
+	if len(uris) == 0 {
+		return fmt.Errorf("at least one redirect_uri is required")
+	}
+	for _, uri := range uris {
+		if err := validateRedirectURI(uri, clientType, allowWildcard); err != nil {
+			return fmt.Errorf("invalid redirect_uri %q: %w", uri, err)
+		}
+	}
+	return nil
+}
+
+func validateRedirectURI(uri, clientType string, allowWildcard bool) error {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() {
+		return fmt.Errorf("must be an absolute URI")
+	}
+	if u.Fragment != "" || strings.Contains(uri, "#") {
+		return fmt.Errorf("must not contain a fragment")
+	}
+	if u.User != nil {
+		return fmt.Errorf("must not contain user info")
+	}
+
+	switch u.Scheme {
+	case "https":
+		if u.Host == "" {
+			return fmt.Errorf("host is required")
+		}
+		if strings.Contains(u.Hostname(), "*") {
+			return validateWildcardHost(u.Hostname(), allowWildcard)
+		}
+		return nil
+	case "http":
+		if !isLoopbackHost(u.Hostname()) {
+			return fmt.Errorf("http is only allowed for loopback IP addresses")
+		}
+		return nil
+	default:
+		if clientType != models.ClientTypePublic {
+			return fmt.Errorf("custom schemes are only allowed for public clients")
+		}
+		// Private-use схема должна быть в стиле reverse domain, например com.example.app
+		if !strings.Contains(u.Scheme, ".") {
+			return fmt.Errorf("private-use scheme must be a reverse domain name")
+		}
+		return nil
+	}
+}
+
+// validateWildcardHost допускает подстановку только крайней левой метки над доменом
+// минимум второго уровня
+func validateWildcardHost(host string, allowWildcard bool) error {
+	if !allowWildcard {
+		return fmt.Errorf("wildcard redirect URIs are not enabled for this client")
+	}
+	suffix := strings.TrimPrefix(host, wildcardPrefix)
+	if !strings.HasPrefix(host, wildcardPrefix) || strings.Contains(suffix, "*") || strings.Count(suffix, ".") < 1 {
+		return fmt.Errorf("wildcard must replace a single leftmost label")
+	}
+	return nil
+}
+
+// matchRedirectURI сравнивает запрошенный redirect_uri с зарегистрированным.
+// Для loopback адресов порт не учитывается (RFC 8252, 7.3). Шаблоны с подстановкой
+// работают только вне профиля OAuth 2.1, где требуется точное совпадение
+func matchRedirectURI(registered, requested string, allowWildcard, strict bool) bool {
+	if registered == requested {
+		return true
+	}
+
+	reg, err := url.Parse(registered)
+	if err != nil {
+		return false
+	}
+	req, err := url.Parse(requested)
+	if err != nil || req.Fragment != "" || req.User != nil {
+		return false
+	}
+	if reg.Scheme != req.Scheme || reg.Path != req.Path || reg.RawQuery != req.RawQuery {
+		return false
+	}
+
+	if reg.Scheme == "http" && isLoopbackHost(reg.Hostname()) {
+		return reg.Hostname() == req.Hostname()
+	}
+
+	if !strict && allowWildcard && reg.Scheme == "https" && strings.HasPrefix(reg.Hostname(), wildcardPrefix) {
+		if reg.Port() != req.Port() {
+			return false
+		}
+		suffix := strings.TrimPrefix(reg.Hostname(), "*")
+		label := strings.TrimSuffix(req.Hostname(), suffix)
+		return strings.HasSuffix(req.Hostname(), suffix) && isDNSLabel(label)
+	}
+
+	return false
+}
+
+// isRegisteredRedirectURI проверяет redirect_uri по списку клиента с учетом правил для
+// нативных приложений и шаблонов
+func (s *Service) isRegisteredRedirectURI(client *models.OAuthClient, redirectURI string) bool {
+	strict := s.ProfileEnabled(client)
+	for _, uri := range utils.DecodeStringList(client.RedirectURIs) {
+		if matchRedirectURI(uri, redirectURI, client.AllowWildcardRedirects, strict) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDNSLabel(label string) bool {
+	if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+		return false
+	}
+	for _, r := range label {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func isLoopbackHost(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
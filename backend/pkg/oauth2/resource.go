@@ -0,0 +1,140 @@
+// pkg/oauth2/resource.go
+package oauth2
+
+import (
+	"errors"
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/utils"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrInvalidTarget = errors.New("invalid_target")
+	ErrInvalidScope  = errors.New("invalid_scope")
+)
+
+// oidcScopes не относятся к конкретному ресурсу и разрешены для любого audience
+var oidcScopes = map[string]bool{
+	"openid":         true,
+	"profile":        true,
+	"email":          true,
+	"offline_access": true,
+}
+
+type ResourceRepository interface {
+	GetResourcesByURIs(uris []string) ([]*models.ProtectedResource, error)
+}
+
+// ValidateResourceIndicator проверяет формат resource по RFC 8707: абсолютный URI без фрагмента
+func ValidateResourceIndicator(resource string) error {
+	u, err := url.Parse(resource)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" || strings.Contains(resource, "#") {
+		return ErrInvalidTarget
+	}
+	return nil
+}
+
+// ResolveResources проверяет, что все ресурсы зарегистрированы и каждый запрошенный scope
+// разрешен хотя бы одному из них
+func (s *Service) ResolveResources(uris []string, scope string) ([]*models.ProtectedResource, error) {
+	resources, err := s.lookupResources(uris)
+	if err != nil || len(resources) == 0 {
+		return resources, err
+	}
+
+	allowed := allowedScopes(resources)
+	for _, sc := range strings.Fields(scope) {
+		if !oidcScopes[sc] && !allowed[sc] {
+			return nil, ErrInvalidScope
+		}
+	}
+
+	return resources, nil
+}
+
+func (s *Service) lookupResources(uris []string) ([]*models.ProtectedResource, error) {
+	uris = uniqueStrings(uris)
+	for _, uri := range uris {
+		if err := ValidateResourceIndicator(uri); err != nil {
+			return nil, err
+		}
+	}
+
+	resources, err := s.resourceRepo.GetResourcesByURIs(uris)
+	if err != nil {
+		return nil, err
+	}
+	if len(resources) != len(uris) {
+		return nil, ErrInvalidTarget
+	}
+	return resources, nil
+}
+
+// selectAudience определяет audience выдаваемого токена. Без параметра resource токен
+// получает все ресурсы из гранта, иначе — только запрошенные, а scope сужается до разрешенных им
+func (s *Service) selectAudience(granted, requested []string, scope string) ([]string, string, error) {
+	if len(requested) == 0 {
+		return granted, scope, nil
+	}
+
+	requested = uniqueStrings(requested)
+	if len(granted) > 0 && !isSubset(requested, granted) {
+		return nil, "", ErrInvalidTarget
+	}
+
+	resources, err := s.lookupResources(requested)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return requested, narrowScope(scope, resources), nil
+}
+
+// narrowScope оставляет только scope, разрешенные ресурсам, и OIDC scope
+func narrowScope(scope string, resources []*models.ProtectedResource) string {
+	allowed := allowedScopes(resources)
+	var narrowed []string
+	for _, sc := range strings.Fields(scope) {
+		if oidcScopes[sc] || allowed[sc] {
+			narrowed = append(narrowed, sc)
+		}
+	}
+	return strings.Join(narrowed, " ")
+}
+
+func allowedScopes(resources []*models.ProtectedResource) map[string]bool {
+	allowed := make(map[string]bool)
+	for _, resource := range resources {
+		for _, sc := range utils.DecodeStringList(resource.Scopes) {
+			allowed[sc] = true
+		}
+	}
+	return allowed
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	return result
+}
+
+func isSubset(subset, set []string) bool {
+	contains := make(map[string]bool, len(set))
+	for _, v := range set {
+		contains[v] = true
+	}
+	for _, v := range subset {
+		if !contains[v] {
+			return false
+		}
+	}
+	return true
+}
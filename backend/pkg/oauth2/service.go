@@ -8,6 +8,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"jiko-auth/internal/config"
 	"jiko-auth/internal/models"
 	"jiko-auth/internal/utils"
 	"jiko-auth/pkg/jwt"
@@ -18,20 +19,23 @@ import (
 )
 
 type AuthCodeRepository interface {
-	SaveAuthorizationCode(code, clientID, userID, redirectURI, scope string, expiresAt time.Time) error
+	SaveAuthorizationCode(code, clientID, userID, redirectURI, scope string, resources []string, expiresAt time.Time) error
 	GetAuthorizationCode(code string) (*models.AuthorizationCode, error)
 	MarkAuthorizationCodeUsed(code string) error
-	SaveAuthorizationCodeWithPKCE(code, clientID, userID, redirectURI, scope string, expiresAt time.Time, codeChallenge, codeChallengeMethod, nonce string) error
+	SaveAuthorizationCodeWithPKCE(code, clientID, userID, redirectURI, scope string, resources []string, expiresAt time.Time, codeChallenge, codeChallengeMethod, nonce string) error
 	GetAuthorizationCodeWithPKCE(code string) (*models.AuthorizationCode, error)
 }
 
 type TokenRepository interface {
-	SaveAccessToken(token, clientID, userID, scope string, expiresAt time.Time) error
-	SaveRefreshToken(token, accessToken, clientID, userID, scope string, expiresAt time.Time) error
+	SaveAccessToken(token, clientID, userID, scope string, audience []string, expiresAt time.Time) error
+	SaveRefreshToken(token, accessToken, clientID, userID, scope string, resources []string, expiresAt time.Time, absoluteExpiresAt *time.Time) error
+	ExtendRefreshToken(token string, expiresAt time.Time) error
 	GetRefreshToken(token string) (*models.RefreshToken, error)
 	GetAccessToken(token string) (*models.AccessToken, error)
 	DeleteExpiredTokens() error
 	HasRefreshTokenForUserAndClient(userID, clientID string) (bool, error)
+	RevokeRefreshToken(token string) (bool, error)
+	RevokeRefreshTokensForUserAndClient(userID, clientID string) error
 }
 
 type ClientRepository interface {
@@ -48,33 +52,52 @@ type Service struct {
 	tokenRepo    TokenRepository
 	clientRepo   ClientRepository
 	userRepo     UserRepository
+	resourceRepo ResourceRepository
 	jwtService   *jwt.Service
+	cfg          *config.Config
 }
 
-func NewService(authCodeRepo AuthCodeRepository, tokenRepo TokenRepository, clientRepo ClientRepository, userRepo UserRepository, jwtService *jwt.Service) *Service {
+func NewService(authCodeRepo AuthCodeRepository, tokenRepo TokenRepository, clientRepo ClientRepository, userRepo UserRepository, resourceRepo ResourceRepository, jwtService *jwt.Service, cfg *config.Config) *Service {
 	return &Service{
 		authCodeRepo: authCodeRepo,
 		tokenRepo:    tokenRepo,
 		clientRepo:   clientRepo,
 		userRepo:     userRepo,
+		resourceRepo: resourceRepo,
 		jwtService:   jwtService,
+		cfg:          cfg,
 	}
 }
 
-func (s *Service) GenerateAuthorizationCode(clientID, userID, redirectURI, scope, codeChallenge, codeChallengeMethod, nonce string) (string, error) {
+func (s *Service) GenerateAuthorizationCode(clientID, userID, redirectURI, scope, codeChallenge, codeChallengeMethod, nonce string, resources []string) (string, error) {
+	client, err := s.clientRepo.GetClient(clientID)
+	if err != nil {
+		return "", ErrInvalidClient
+	}
+
+	if _, err := s.ResolveResources(resources, scope); err != nil {
+		return "", err
+	}
+	resources = uniqueStrings(resources)
+
 	code, err := generateCryptoSecureToken(32)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate authorization code: %w", err)
 	}
 
-	expiresAt := time.Now().Add(10 * time.Minute)
+	expiresAt := time.Now().Add(s.TokenPolicyFor(client).CodeTTL)
+
+	// По RFC 7636 при отсутствии code_challenge_method используется plain
+	if codeChallenge != "" && codeChallengeMethod == "" {
+		codeChallengeMethod = "plain"
+	}
 
 	if codeChallenge != "" && codeChallengeMethod != "" {
 		// PKCE flow
-		err = s.authCodeRepo.SaveAuthorizationCodeWithPKCE(code, clientID, userID, redirectURI, scope, expiresAt, codeChallenge, codeChallengeMethod, nonce)
+		err = s.authCodeRepo.SaveAuthorizationCodeWithPKCE(code, clientID, userID, redirectURI, scope, resources, expiresAt, codeChallenge, codeChallengeMethod, nonce)
 	} else {
 		// Classic flow
-		err = s.authCodeRepo.SaveAuthorizationCode(code, clientID, userID, redirectURI, scope, expiresAt)
+		err = s.authCodeRepo.SaveAuthorizationCode(code, clientID, userID, redirectURI, scope, resources, expiresAt)
 	}
 
 	if err != nil {
@@ -84,11 +107,19 @@ func (s *Service) GenerateAuthorizationCode(clientID, userID, redirectURI, scope
 	return code, nil
 }
 
-func (s *Service) RefreshToken(refreshToken, clientID, clientSecret string) (map[string]interface{}, error) {
+// RefreshToken выпускает новый access token. Параметр resources позволяет сузить audience
+// токена до части ресурсов, на которые было выдано согласие.
+// Публичные клиенты в профиле OAuth 2.1 получают новый refresh token (ротация),
+// остальным срок действия refresh token продлевается в пределах абсолютного срока
+func (s *Service) RefreshToken(refreshToken, clientID, clientSecret string, resources []string) (map[string]interface{}, error) {
+	client, err := s.clientRepo.GetClient(clientID)
+	if err != nil {
+		return nil, ErrInvalidClient
+	}
+
 	// Проверяем client_id и client_secret
-	isValid, err := s.clientRepo.ValidateClientSecret(clientID, clientSecret)
-	if err != nil || !isValid {
-		return nil, errors.New("invalid client credentials")
+	if err := s.authenticateClient(client, clientSecret, false); err != nil {
+		return nil, err
 	}
 
 	// Получаем информацию о refresh token
@@ -97,44 +128,103 @@ func (s *Service) RefreshToken(refreshToken, clientID, clientSecret string) (map
 		return nil, errors.New("invalid refresh token")
 	}
 
+	// Чужой клиент не должен ни пользоваться токеном, ни отзывать его цепочку
+	if refreshTokenInfo.ClientID.String() != clientID {
+		return nil, errors.New("client_id mismatch")
+	}
+
+	// Повторное использование отозванного (ротированного) токена — отзываем всю цепочку
+	if refreshTokenInfo.Revoked {
+		return nil, s.refreshTokenReused(refreshTokenInfo)
+	}
+
 	// Проверяем, не истек ли срок действия refresh token
 	if time.Now().After(refreshTokenInfo.ExpiresAt) {
 		return nil, errors.New("refresh token expired")
 	}
 
+	audience, scope, err := s.selectAudience(utils.DecodeStringList(refreshTokenInfo.Resources), resources, refreshTokenInfo.Scope)
+	if err != nil {
+		return nil, err
+	}
+
 	// Генерируем новый access token
 	accessToken, err := utils.GenerateRandomString(32)
 	if err != nil {
 		return nil, err
 	}
-	accessTokenExp := time.Now().Add(1 * time.Hour)
+	policy := s.TokenPolicyFor(client)
+	accessTokenExp := time.Now().Add(policy.AccessTokenTTL)
+	refreshTokenExp := refreshExpiry(policy.RefreshIdleTTL, refreshTokenInfo.AbsoluteExpiresAt)
+	rotate := client.IsPublic() && s.ProfileEnabled(client)
+
+	// Старый токен отзывается до выпуска новых: если параллельный запрос уже ротировал его,
+	// это повторное использование
+	if rotate {
+		revoked, err := s.tokenRepo.RevokeRefreshToken(refreshToken)
+		if err != nil {
+			return nil, err
+		}
+		if !revoked {
+			return nil, s.refreshTokenReused(refreshTokenInfo)
+		}
+	}
 
 	// Сохраняем новый access token
-	err = s.tokenRepo.SaveAccessToken(accessToken, clientID, refreshTokenInfo.UserID.String(), refreshTokenInfo.Scope, accessTokenExp)
+	err = s.tokenRepo.SaveAccessToken(accessToken, clientID, refreshTokenInfo.UserID.String(), scope, audience, accessTokenExp)
 	if err != nil {
 		return nil, err
 	}
 
-	// Возвращаем новый access token
-	return map[string]interface{}{
+	response := map[string]interface{}{
 		"access_token": accessToken,
 		"token_type":   "Bearer",
 		"expires_in":   int64(time.Until(accessTokenExp).Seconds()),
-		"scope":        refreshTokenInfo.Scope,
-	}, nil
-}
+		"scope":        scope,
+	}
 
-func (s *Service) ExchangeCodeForToken(code, redirectURI, clientID, clientSecret string, codeVerifier string) (map[string]interface{}, error) {
-	if codeVerifier == "" {
-		// Проверяем client_id и client_secret для classic flow
-		isValid, err := s.clientRepo.ValidateClientSecret(clientID, clientSecret)
-		if err != nil || !isValid {
+	if rotate {
+		newRefreshToken, err := utils.GenerateRandomString(32)
+		if err != nil {
 			return nil, err
 		}
+
+		err = s.tokenRepo.SaveRefreshToken(newRefreshToken, accessToken, clientID, refreshTokenInfo.UserID.String(), refreshTokenInfo.Scope, utils.DecodeStringList(refreshTokenInfo.Resources), refreshTokenExp, refreshTokenInfo.AbsoluteExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+
+		response["refresh_token"] = newRefreshToken
+	} else if err := s.tokenRepo.ExtendRefreshToken(refreshToken, refreshTokenExp); err != nil {
+		return nil, err
+	}
+
+	// Возвращаем новый access token
+	return response, nil
+}
+
+// refreshTokenReused отзывает все refresh токены пользователя у клиента после повторного
+// использования ротированного токена: один из предъявивших его мог украсть токен
+func (s *Service) refreshTokenReused(info *models.RefreshToken) error {
+	if err := s.tokenRepo.RevokeRefreshTokensForUserAndClient(info.UserID.String(), info.ClientID.String()); err != nil {
+		return err
+	}
+	return errors.New("invalid refresh token")
+}
+
+func (s *Service) ExchangeCodeForToken(code, redirectURI, clientID, clientSecret string, codeVerifier string, resources []string) (map[string]interface{}, error) {
+	client, err := s.clientRepo.GetClient(clientID)
+	if err != nil {
+		return nil, ErrInvalidClient
+	}
+	strict := s.ProfileEnabled(client)
+
+	// Проверяем client_id и client_secret (вне профиля OAuth 2.1 PKCE может заменить секрет)
+	if err := s.authenticateClient(client, clientSecret, codeVerifier != ""); err != nil {
+		return nil, err
 	}
 
 	var authCode *models.AuthorizationCode
-	var err error
 
 	if codeVerifier != "" {
 		// PKCE flow: get code with PKCE data
@@ -144,7 +234,7 @@ func (s *Service) ExchangeCodeForToken(code, redirectURI, clientID, clientSecret
 		}
 
 		// Validate PKCE
-		if err := validatePKCE(authCode.CodeChallenge, authCode.CodeChallengeMethod, codeVerifier); err != nil {
+		if err := validatePKCE(authCode.CodeChallenge, authCode.CodeChallengeMethod, codeVerifier, strict); err != nil {
 			return nil, err
 		}
 	} else {
@@ -153,6 +243,11 @@ func (s *Service) ExchangeCodeForToken(code, redirectURI, clientID, clientSecret
 		if err != nil {
 			return nil, err
 		}
+
+		// Код, выданный с code_challenge, нельзя обменять без code_verifier
+		if authCode.CodeChallenge != "" || strict || client.IsPublic() {
+			return nil, ErrPKCERequired
+		}
 	}
 
 	// Проверяем client_id
@@ -175,44 +270,54 @@ func (s *Service) ExchangeCodeForToken(code, redirectURI, clientID, clientSecret
 		return nil, errors.New("redirect_uri mismatch")
 	}
 
-	// Помечаем код как использованный
-	err = s.authCodeRepo.MarkAuthorizationCodeUsed(code)
+	grantedResources := utils.DecodeStringList(authCode.Resources)
+	audience, accessScope, err := s.selectAudience(grantedResources, resources, authCode.Scope)
 	if err != nil {
 		return nil, err
 	}
 
-	// Генерируем access token
-	accessToken, err := utils.GenerateRandomString(32)
+	// Помечаем код как использованный
+	err = s.authCodeRepo.MarkAuthorizationCodeUsed(code)
 	if err != nil {
 		return nil, err
 	}
-	accessTokenExp := time.Now().Add(1 * time.Hour)
 
-	// Генерируем refresh token
-	refreshToken, err := utils.GenerateRandomString(32)
+	// Генерируем access token
+	accessToken, err := utils.GenerateRandomString(32)
 	if err != nil {
 		return nil, err
 	}
-	refreshTokenExp := time.Now().Add(7 * 24 * time.Hour)
+	policy := s.TokenPolicyFor(client)
+	accessTokenExp := time.Now().Add(policy.AccessTokenTTL)
 
 	// Сохраняем токены
-	err = s.tokenRepo.SaveAccessToken(accessToken, clientID, authCode.UserID.String(), authCode.Scope, accessTokenExp)
-	if err != nil {
-		return nil, err
-	}
-
-	err = s.tokenRepo.SaveRefreshToken(refreshToken, accessToken, clientID, authCode.UserID.String(), authCode.Scope, refreshTokenExp)
+	err = s.tokenRepo.SaveAccessToken(accessToken, clientID, authCode.UserID.String(), accessScope, audience, accessTokenExp)
 	if err != nil {
 		return nil, err
 	}
 
 	// Подготавливаем ответ
 	response := map[string]interface{}{
-		"access_token":  accessToken,
-		"token_type":    "Bearer",
-		"expires_in":    int64(time.Until(accessTokenExp).Seconds()),
-		"refresh_token": refreshToken,
-		"scope":         authCode.Scope,
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int64(time.Until(accessTokenExp).Seconds()),
+		"scope":        accessScope,
+	}
+
+	// Генерируем refresh token, если политика клиента это разрешает
+	if policy.IssueRefreshTokens {
+		refreshToken, err := utils.GenerateRandomString(32)
+		if err != nil {
+			return nil, err
+		}
+		absoluteExpiresAt := time.Now().Add(policy.RefreshAbsoluteTTL)
+		refreshTokenExp := refreshExpiry(policy.RefreshIdleTTL, &absoluteExpiresAt)
+
+		err = s.tokenRepo.SaveRefreshToken(refreshToken, accessToken, clientID, authCode.UserID.String(), authCode.Scope, grantedResources, refreshTokenExp, &absoluteExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		response["refresh_token"] = refreshToken
 	}
 
 	// Если scope содержит "openid", генерируем id_token
@@ -225,7 +330,7 @@ func (s *Service) ExchangeCodeForToken(code, redirectURI, clientID, clientSecret
 			return nil, errors.New("user not found")
 		}
 
-		idToken, err := s.jwtService.GenerateIDToken(authCode.UserID.String(), clientID, user.Email, user.Username, user.EmailVerified, authCode.Nonce, authCode.CreatedAt)
+		idToken, err := s.jwtService.GenerateIDToken(authCode.UserID.String(), clientID, user.Email, user.Username, user.EmailVerified, authCode.Nonce, authCode.CreatedAt, policy.IDTokenTTL)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate id_token: %w", err)
 		}
@@ -258,17 +363,31 @@ func (s *Service) IntrospectToken(token string) (map[string]interface{}, error)
 	}
 
 	// Возвращаем информацию о токене
-	return map[string]interface{}{
+	introspection := map[string]interface{}{
 		"active":     true,
 		"client_id":  accessToken.ClientID.String(),
 		"user_id":    accessToken.UserID.String(),
 		"scope":      accessToken.Scope,
 		"token_type": "Bearer",
 		"exp":        accessToken.ExpiresAt.Unix(),
-	}, nil
+	}
+
+	if audience := utils.DecodeStringList(accessToken.Audience); len(audience) > 0 {
+		introspection["aud"] = audience
+	}
+
+	return introspection, nil
 }
 
-func validatePKCE(codeChallenge, codeChallengeMethod, codeVerifier string) error {
+// validatePKCE проверяет code_verifier. В строгом профиле метод plain запрещен
+func validatePKCE(codeChallenge, codeChallengeMethod, codeVerifier string, strict bool) error {
+	if codeChallenge == "" {
+		return errors.New("invalid code verifier")
+	}
+	if strict && codeChallengeMethod != "S256" {
+		return ErrPKCERequired
+	}
+
 	switch codeChallengeMethod {
 	case "S256":
 		hash := sha256.Sum256([]byte(codeVerifier))
@@ -0,0 +1,267 @@
+// pkg/passwords/policy.go
+package passwords
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"jiko-auth/internal/config"
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/repository"
+	"jiko-auth/internal/utils"
+	"jiko-auth/pkg/breach"
+	"jiko-auth/pkg/logger"
+	"jiko-auth/pkg/strength"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// maxPasswordLength защищает хеширование от паролей в мегабайты
+const maxPasswordLength = 256
+
+// maxHistorySize ограничивает число проверок хешей при смене пароля
+const maxHistorySize = 24
+
+var (
+	ErrPasswordTooLong   = fmt.Errorf("password must be at most %d characters long", maxPasswordLength)
+	ErrPasswordNoUpper   = errors.New("password must contain uppercase letters")
+	ErrPasswordNoLower   = errors.New("password must contain lowercase letters")
+	ErrPasswordNoNumber  = errors.New("password must contain numbers")
+	ErrPasswordNoSpecial = errors.New("password must contain special characters")
+	ErrPasswordIdentity  = errors.New("password must not contain your username or email")
+	ErrPasswordTooWeak   = errors.New("password is too easy to guess, use a longer phrase without common words or patterns")
+	ErrPasswordReused    = errors.New("password was used recently, choose a different one")
+)
+
+// Validator применяет политику паролей роли пользователя. Политики хранятся в настройках,
+// пока администратор их не менял, действует политика по умолчанию из конфигурации
+type Validator struct {
+	settingsRepo  repository.SettingsRepository
+	historyRepo   repository.PasswordHistoryRepository
+	hasher        utils.PasswordHasher
+	breachChecker breach.Checker
+	defaults      models.PasswordPolicy
+}
+
+func NewValidator(
+	cfg *config.Config,
+	settingsRepo repository.SettingsRepository,
+	historyRepo repository.PasswordHistoryRepository,
+	hasher utils.PasswordHasher,
+	breachChecker breach.Checker,
+) *Validator {
+	return &Validator{
+		settingsRepo:  settingsRepo,
+		historyRepo:   historyRepo,
+		hasher:        hasher,
+		breachChecker: breachChecker,
+		defaults: models.PasswordPolicy{
+			MinLength:        cfg.PasswordMinLength,
+			RequireUpper:     true,
+			RequireLower:     true,
+			RequireNumber:    true,
+			RequireSpecial:   true,
+			MinScore:         cfg.PasswordMinScore,
+			DisallowIdentity: true,
+			HistorySize:      cfg.PasswordHistorySize,
+			MaxAgeDays:       cfg.PasswordMaxAgeDays,
+		},
+	}
+}
+
+// Settings возвращает действующие политики
+func (v *Validator) Settings(ctx context.Context) (models.PasswordPolicySettings, error) {
+	settings := models.PasswordPolicySettings{Default: v.defaults}
+	if _, err := v.settingsRepo.GetJSON(ctx, repository.SettingPasswordPolicy, &settings); err != nil {
+		return models.PasswordPolicySettings{Default: v.defaults}, err
+	}
+	return settings, nil
+}
+
+// UpdateSettings проверяет и сохраняет политики
+func (v *Validator) UpdateSettings(ctx context.Context, settings models.PasswordPolicySettings) error {
+	if err := CheckSettings(settings); err != nil {
+		return err
+	}
+	return v.settingsRepo.SetJSON(ctx, repository.SettingPasswordPolicy, settings)
+}
+
+// CheckSettings проверяет, что значения политик допустимы
+func CheckSettings(settings models.PasswordPolicySettings) error {
+	if err := checkPolicy(settings.Default); err != nil {
+		return fmt.Errorf("default policy: %w", err)
+	}
+	for role, policy := range settings.Roles {
+		if role != "user" && role != "admin" {
+			return fmt.Errorf("unknown role %q", role)
+		}
+		if err := checkPolicy(policy); err != nil {
+			return fmt.Errorf("%s policy: %w", role, err)
+		}
+	}
+	return nil
+}
+
+func checkPolicy(policy models.PasswordPolicy) error {
+	switch {
+	case policy.MinLength < 8 || policy.MinLength > maxPasswordLength:
+		return fmt.Errorf("min_length must be between 8 and %d", maxPasswordLength)
+	case policy.MinScore < 0 || policy.MinScore > 4:
+		return errors.New("min_score must be between 0 and 4")
+	case policy.HistorySize < 0 || policy.HistorySize > maxHistorySize:
+		return fmt.Errorf("history_size must be between 0 and %d", maxHistorySize)
+	case policy.MaxAgeDays < 0:
+		return errors.New("max_age_days must not be negative")
+	}
+	return nil
+}
+
+// PolicyFor возвращает политику роли. Если настройки недоступны, действует политика по умолчанию
+func (v *Validator) PolicyFor(ctx context.Context, role string) models.PasswordPolicy {
+	settings, err := v.Settings(ctx)
+	if err != nil {
+		logger.Error("Failed to load password policy, using defaults", zap.Error(err))
+	}
+	if policy, ok := settings.Roles[role]; ok {
+		return policy
+	}
+	return settings.Default
+}
+
+// Validate проверяет новый пароль пользователя по политике его роли. Для новой учетной записи
+// (user.ID не задан) история не проверяется. Ошибки чтения базы утечек и истории не мешают
+// смене пароля, возвращаются только нарушения политики
+func (v *Validator) Validate(ctx context.Context, password string, user *models.User) error {
+	policy := v.PolicyFor(ctx, user.Role)
+
+	length := len([]rune(password))
+	if length < policy.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", policy.MinLength)
+	}
+	if length > maxPasswordLength {
+		return ErrPasswordTooLong
+	}
+	if err := checkCharacterClasses(password, policy); err != nil {
+		return err
+	}
+	if policy.DisallowIdentity && containsIdentity(password, user) {
+		return ErrPasswordIdentity
+	}
+	if policy.MinScore > 0 {
+		result := strength.Estimate(password, user.Username, user.Email, user.GivenName, user.FamilyName, user.DisplayName)
+		if result.Score < policy.MinScore {
+			return ErrPasswordTooWeak
+		}
+	}
+
+	breached, err := v.breachChecker.Breached(password)
+	if err != nil {
+		logger.Error("Failed to check password against breach corpus", zap.Error(err))
+	} else if breached {
+		return breach.ErrPasswordBreached
+	}
+
+	if policy.HistorySize > 0 && user.ID != uuid.Nil {
+		if v.reused(ctx, password, user, policy.HistorySize) {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+func checkCharacterClasses(password string, policy models.PasswordPolicy) error {
+	var hasUpper, hasLower, hasNumber, hasSpecial bool
+	for _, char := range password {
+		switch {
+		case unicode.IsUpper(char):
+			hasUpper = true
+		case unicode.IsLower(char):
+			hasLower = true
+		case unicode.IsNumber(char):
+			hasNumber = true
+		case unicode.IsPunct(char) || unicode.IsSymbol(char) || unicode.IsSpace(char):
+			hasSpecial = true
+		}
+	}
+
+	switch {
+	case policy.RequireUpper && !hasUpper:
+		return ErrPasswordNoUpper
+	case policy.RequireLower && !hasLower:
+		return ErrPasswordNoLower
+	case policy.RequireNumber && !hasNumber:
+		return ErrPasswordNoNumber
+	case policy.RequireSpecial && !hasSpecial:
+		return ErrPasswordNoSpecial
+	}
+	return nil
+}
+
+// containsIdentity пароль содержит имя пользователя, email или его локальную часть
+func containsIdentity(password string, user *models.User) bool {
+	lower := strings.ToLower(password)
+	identities := []string{user.Username, user.Email}
+	if local, _, found := strings.Cut(user.Email, "@"); found {
+		identities = append(identities, local)
+	}
+
+	for _, identity := range identities {
+		identity = strings.ToLower(strings.TrimSpace(identity))
+		if len([]rune(identity)) >= 3 && strings.Contains(lower, identity) {
+			return true
+		}
+	}
+	return false
+}
+
+// reused пароль совпадает с текущим или одним из historySize-1 прежних
+func (v *Validator) reused(ctx context.Context, password string, user *models.User, historySize int) bool {
+	hashes := []string{}
+	if user.Password != "" {
+		hashes = append(hashes, user.Password)
+	}
+	previous, err := v.historyRepo.Recent(ctx, user.ID, historySize-1)
+	if err != nil {
+		logger.Error("Failed to load password history", zap.Error(err), zap.String("user_id", user.ID.String()))
+	}
+	hashes = append(hashes, previous...)
+
+	for _, hash := range hashes {
+		if ok, err := v.hasher.Verify(hash, password); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Remember сохраняет прежний хеш пароля после его смены. Хранится столько хешей,
+// сколько нужно для проверки истории по политике роли
+func (v *Validator) Remember(ctx context.Context, user *models.User, previousHash string) {
+	if previousHash == "" {
+		return
+	}
+	policy := v.PolicyFor(ctx, user.Role)
+	if err := v.historyRepo.Add(ctx, user.ID, previousHash, policy.HistorySize-1); err != nil {
+		logger.Error("Failed to save password history", zap.Error(err), zap.String("user_id", user.ID.String()))
+	}
+}
+
+// Expired срок действия пароля по политике роли истек. Если пароль не менялся,
+// отсчет идет от регистрации
+func (v *Validator) Expired(ctx context.Context, user *models.User) bool {
+	policy := v.PolicyFor(ctx, user.Role)
+	if policy.MaxAgeDays <= 0 {
+		return false
+	}
+
+	changedAt := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changedAt = *user.PasswordChangedAt
+	}
+	return time.Since(changedAt) > time.Duration(policy.MaxAgeDays)*24*time.Hour
+}
@@ -0,0 +1,378 @@
+package passwords
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"jiko-auth/internal/config"
+	"jiko-auth/internal/models"
+	"jiko-auth/internal/repository"
+	"jiko-auth/internal/utils"
+	"jiko-auth/pkg/breach"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeSettings хранит настройки в памяти в JSON, как settings_repository
+type fakeSettings struct {
+	values map[string]string
+	err    error
+}
+
+func (f *fakeSettings) GetBool(ctx context.Context, key string, defaultValue bool) (bool, error) {
+	return defaultValue, f.err
+}
+
+func (f *fakeSettings) SetBool(ctx context.Context, key string, value bool) error {
+	return f.err
+}
+
+func (f *fakeSettings) GetJSON(ctx context.Context, key string, value interface{}) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	raw, ok := f.values[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal([]byte(raw), value)
+}
+
+func (f *fakeSettings) SetJSON(ctx context.Context, key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if f.values == nil {
+		f.values = map[string]string{}
+	}
+	f.values[key] = string(raw)
+	return nil
+}
+
+// fakeHistory история паролей в памяти, новые хеши первыми. keep <= 0 очищает историю,
+// как password_history_repository
+type fakeHistory struct {
+	hashes map[uuid.UUID][]string
+	limits []int // limit каждого вызова Recent
+	keeps  []int // keep каждого вызова Add
+}
+
+func (f *fakeHistory) Recent(ctx context.Context, userID uuid.UUID, limit int) ([]string, error) {
+	f.limits = append(f.limits, limit)
+	hashes := f.hashes[userID]
+	if limit <= 0 {
+		return nil, nil
+	}
+	return hashes[:min(limit, len(hashes))], nil
+}
+
+func (f *fakeHistory) Add(ctx context.Context, userID uuid.UUID, passwordHash string, keep int) error {
+	f.keeps = append(f.keeps, keep)
+	if f.hashes == nil {
+		f.hashes = map[uuid.UUID][]string{}
+	}
+	if keep <= 0 {
+		delete(f.hashes, userID)
+		return nil
+	}
+	hashes := append([]string{passwordHash}, f.hashes[userID]...)
+	f.hashes[userID] = hashes[:min(keep, len(hashes))]
+	return nil
+}
+
+type fakeBreach struct{ breached string }
+
+func (f fakeBreach) Breached(password string) (bool, error) {
+	return password == f.breached, nil
+}
+
+// basePolicy политика без оценки стойкости и истории, чтобы проверять правила по отдельности
+var basePolicy = models.PasswordPolicy{
+	MinLength:      8,
+	RequireUpper:   true,
+	RequireLower:   true,
+	RequireNumber:  true,
+	RequireSpecial: true,
+}
+
+func newTestValidator(t *testing.T, settings models.PasswordPolicySettings) (*Validator, *fakeHistory) {
+	t.Helper()
+	hasher, err := utils.NewPasswordHasher(utils.PasswordAlgorithmBcrypt, utils.Argon2Params{}, bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settingsRepo := &fakeSettings{}
+	if err := settingsRepo.SetJSON(context.Background(), repository.SettingPasswordPolicy, settings); err != nil {
+		t.Fatal(err)
+	}
+	history := &fakeHistory{}
+	v := NewValidator(&config.Config{}, settingsRepo, history, hasher, fakeBreach{breached: "Breached-Passw0rd"})
+	return v, history
+}
+
+func TestPolicyForRoleOverride(t *testing.T) {
+	cfg := &config.Config{PasswordMinLength: 12, PasswordMinScore: 3, PasswordHistorySize: 5}
+	defaults := models.PasswordPolicy{
+		MinLength:        12,
+		RequireUpper:     true,
+		RequireLower:     true,
+		RequireNumber:    true,
+		RequireSpecial:   true,
+		MinScore:         3,
+		DisallowIdentity: true,
+		HistorySize:      5,
+	}
+	admin := models.PasswordPolicy{MinLength: 16, MinScore: 4, HistorySize: 10, MaxAgeDays: 90}
+	stored := models.PasswordPolicySettings{Default: basePolicy, Roles: map[string]models.PasswordPolicy{"admin": admin}}
+
+	tests := []struct {
+		name     string
+		settings *fakeSettings
+		role     string
+		want     models.PasswordPolicy
+	}{
+		{"no stored settings", &fakeSettings{}, "admin", defaults},
+		{"role override", nil, "admin", admin},
+		{"role without override", nil, "user", basePolicy},
+		{"settings unavailable", &fakeSettings{err: errors.New("db down")}, "admin", defaults},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := tt.settings
+			if settings == nil {
+				settings = &fakeSettings{}
+				if err := settings.SetJSON(context.Background(), repository.SettingPasswordPolicy, stored); err != nil {
+					t.Fatal(err)
+				}
+			}
+			v := NewValidator(cfg, settings, &fakeHistory{}, nil, fakeBreach{})
+			if got := v.PolicyFor(context.Background(), tt.role); got != tt.want {
+				t.Errorf("PolicyFor(%q) = %+v, want %+v", tt.role, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	v, _ := newTestValidator(t, models.PasswordPolicySettings{Default: basePolicy})
+	user := &models.User{Role: "user"}
+
+	tests := []struct {
+		name     string
+		password string
+		want     error
+	}{
+		{"all classes", "Passw0rd!", nil},
+		{"cyrillic letters", "Пароль-2024", nil},
+		{"space counts as special", "Pass w0rd", nil},
+		{"symbol counts as special", "Passw0rd+", nil},
+		{"no uppercase", "passw0rd!", ErrPasswordNoUpper},
+		{"no lowercase", "PASSW0RD!", ErrPasswordNoLower},
+		{"no number", "Password!", ErrPasswordNoNumber},
+		{"no special", "Passw0rd1", ErrPasswordNoSpecial},
+		{"breached", "Breached-Passw0rd", breach.ErrPasswordBreached},
+		{"too long", "Aa1!" + strings.Repeat("a", maxPasswordLength), ErrPasswordTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := v.Validate(context.Background(), tt.password, user); !errors.Is(err, tt.want) {
+				t.Errorf("Validate(%q) = %v, want %v", tt.password, err, tt.want)
+			}
+		})
+	}
+
+	if err := v.Validate(context.Background(), "Pa0!", user); err == nil {
+		t.Error("password shorter than min_length accepted")
+	}
+}
+
+func TestValidateOptionalClasses(t *testing.T) {
+	policy := models.PasswordPolicy{MinLength: 8, RequireLower: true}
+	v, _ := newTestValidator(t, models.PasswordPolicySettings{Default: policy})
+	if err := v.Validate(context.Background(), "lowercaseonly", &models.User{Role: "user"}); err != nil {
+		t.Errorf("Validate = %v, want nil when other classes are optional", err)
+	}
+}
+
+func TestContainsIdentity(t *testing.T) {
+	user := &models.User{Username: "Alice", Email: "a.smith@example.com"}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"Correct-Horse-7", false},
+		{"my-ALICE-password", true},
+		{"A.Smith#2024", true},
+		{"a.smith@example.com!", true},
+		{"example-com-1", false}, // домен email не считается именем
+	}
+	for _, tt := range tests {
+		if got := containsIdentity(tt.password, user); got != tt.want {
+			t.Errorf("containsIdentity(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+
+	// Имена короче трех символов не проверяются, иначе они запрещали бы слишком много паролей
+	short := &models.User{Username: "al", Email: "jo@example.com"}
+	if containsIdentity("always-jolly", short) {
+		t.Error("identity shorter than 3 characters matched")
+	}
+	if !containsIdentity("call-jo@example.com", short) {
+		t.Error("full email did not match")
+	}
+}
+
+func TestValidateIdentity(t *testing.T) {
+	policy := basePolicy
+	policy.DisallowIdentity = true
+	v, _ := newTestValidator(t, models.PasswordPolicySettings{Default: policy})
+	user := &models.User{Role: "user", Username: "alice", Email: "alice@example.com"}
+
+	if err := v.Validate(context.Background(), "Alice-2024!", user); !errors.Is(err, ErrPasswordIdentity) {
+		t.Errorf("Validate = %v, want ErrPasswordIdentity", err)
+	}
+
+	policy.DisallowIdentity = false
+	v, _ = newTestValidator(t, models.PasswordPolicySettings{Default: policy})
+	if err := v.Validate(context.Background(), "Alice-2024!", user); err != nil {
+		t.Errorf("Validate = %v with disallow_identity off", err)
+	}
+}
+
+func TestPasswordHistory(t *testing.T) {
+	policy := basePolicy
+	policy.HistorySize = 3
+	v, history := newTestValidator(t, models.PasswordPolicySettings{Default: policy})
+	ctx := context.Background()
+
+	// Пользователь последовательно меняет пароль: первый, второй, третий, четвертый
+	user := &models.User{ID: uuid.New(), Role: "user"}
+	passwords := []string{"First-Passw0rd", "Second-Passw0rd", "Third-Passw0rd", "Fourth-Passw0rd"}
+	for _, password := range passwords {
+		if err := v.Validate(ctx, password, user); err != nil {
+			t.Fatalf("Validate(%q) = %v", password, err)
+		}
+		hash, err := v.hasher.Hash(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.Remember(ctx, user, user.Password)
+		user.Password = hash
+	}
+
+	// Запрещены текущий пароль и два прежних, более старые снова разрешены
+	tests := []struct {
+		password string
+		reused   bool
+	}{
+		{"Fourth-Passw0rd", true},
+		{"Third-Passw0rd", true},
+		{"Second-Passw0rd", true},
+		{"First-Passw0rd", false},
+		{"Fifth-Passw0rd", false},
+	}
+	for _, tt := range tests {
+		err := v.Validate(ctx, tt.password, user)
+		if reused := errors.Is(err, ErrPasswordReused); reused != tt.reused {
+			t.Errorf("Validate(%q) = %v, want reused %v", tt.password, err, tt.reused)
+		}
+	}
+
+	// Первый вызов Remember без прежнего хеша ничего не сохраняет
+	if len(history.keeps) != len(passwords)-1 {
+		t.Errorf("Add called %d times, want %d", len(history.keeps), len(passwords)-1)
+	}
+	for _, keep := range history.keeps {
+		if keep != policy.HistorySize-1 {
+			t.Errorf("Add keep = %d, want %d", keep, policy.HistorySize-1)
+		}
+	}
+	if got := len(history.hashes[user.ID]); got != policy.HistorySize-1 {
+		t.Errorf("history holds %d hashes, want %d", got, policy.HistorySize-1)
+	}
+}
+
+func TestPasswordHistorySizeOne(t *testing.T) {
+	policy := basePolicy
+	policy.HistorySize = 1
+	v, history := newTestValidator(t, models.PasswordPolicySettings{Default: policy})
+	ctx := context.Background()
+
+	user := &models.User{ID: uuid.New(), Role: "user"}
+	oldHash, _ := v.hasher.Hash("Old-Passw0rd")
+	history.hashes = map[uuid.UUID][]string{user.ID: {oldHash}}
+	user.Password, _ = v.hasher.Hash("Current-Passw0rd")
+
+	// Размер истории 1 - запрещен только текущий пароль, прежние хеши не запрашиваются
+	if err := v.Validate(ctx, "Current-Passw0rd", user); !errors.Is(err, ErrPasswordReused) {
+		t.Errorf("Validate(current) = %v, want ErrPasswordReused", err)
+	}
+	if err := v.Validate(ctx, "Old-Passw0rd", user); err != nil {
+		t.Errorf("Validate(old) = %v, want nil", err)
+	}
+	for _, limit := range history.limits {
+		if limit != 0 {
+			t.Errorf("Recent limit = %d, want 0", limit)
+		}
+	}
+
+	// Remember передает keep 0, и репозиторий удаляет сохраненную историю
+	v.Remember(ctx, user, user.Password)
+	if len(history.keeps) != 1 || history.keeps[0] != 0 {
+		t.Errorf("Add keeps = %v, want [0]", history.keeps)
+	}
+	if _, ok := history.hashes[user.ID]; ok {
+		t.Error("history was not wiped")
+	}
+
+	// Размер истории 0 отключает проверку, даже текущий пароль можно повторить
+	policy.HistorySize = 0
+	v, history = newTestValidator(t, models.PasswordPolicySettings{Default: policy})
+	if err := v.Validate(ctx, "Current-Passw0rd", user); err != nil {
+		t.Errorf("Validate with history_size 0 = %v", err)
+	}
+	if len(history.limits) != 0 {
+		t.Error("history loaded with history_size 0")
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Now()
+	daysAgo := func(days int) *time.Time {
+		at := now.Add(-time.Duration(days) * 24 * time.Hour)
+		return &at
+	}
+
+	tests := []struct {
+		name       string
+		maxAgeDays int
+		changedAt  *time.Time
+		createdAt  time.Time
+		want       bool
+	}{
+		{"no max age", 0, daysAgo(1000), now, false},
+		{"changed recently", 30, daysAgo(10), now, false},
+		{"changed too long ago", 30, daysAgo(31), now, true},
+		{"never changed, registered recently", 30, nil, *daysAgo(5), false},
+		{"never changed, registered long ago", 30, nil, *daysAgo(45), true},
+		{"changed after old registration", 30, daysAgo(1), *daysAgo(400), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := basePolicy
+			policy.MaxAgeDays = tt.maxAgeDays
+			v, _ := newTestValidator(t, models.PasswordPolicySettings{Default: policy})
+			user := &models.User{Role: "user", PasswordChangedAt: tt.changedAt, CreatedAt: tt.createdAt}
+			if got := v.Expired(context.Background(), user); got != tt.want {
+				t.Errorf("Expired = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// pkg/risk/iplist.go
+package risk
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// IPList список адресов и подсетей из локального файла: выходные узлы Tor или известные
+// вредоносные адреса. Нулевой список пуст
+type IPList struct {
+	addrs    map[netip.Addr]struct{}
+	prefixes []netip.Prefix
+}
+
+// LoadIPList читает файл, в котором на каждой строке адрес или подсеть в нотации CIDR.
+// Пустые строки и комментарии после # пропускаются, пустой путь дает пустой список
+func LoadIPList(path string) (*IPList, error) {
+	list := &IPList{addrs: make(map[netip.Addr]struct{})}
+	if path == "" {
+		return list, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.Contains(line, "/") {
+			prefix, err := netip.ParsePrefix(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid prefix %q", path, lineNumber, line)
+			}
+			list.prefixes = append(list.prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid address %q", path, lineNumber, line)
+		}
+		list.addrs[addr.Unmap()] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Contains сообщает, входит ли адрес в список. Неразборчивый адрес не входит
+func (l *IPList) Contains(ip string) bool {
+	if l == nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	if _, ok := l.addrs[addr]; ok {
+		return true
+	}
+	for _, prefix := range l.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Len число записей списка
+func (l *IPList) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.addrs) + len(l.prefixes)
+}
@@ -0,0 +1,209 @@
+// pkg/risk/risk.go
+package risk
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"jiko-auth/internal/models"
+	"jiko-auth/pkg/logger"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Признаки риска, они сохраняются в уведомлении и попадают в логи
+const (
+	SignalNewDevice        = "new_device"
+	SignalNewCountry       = "new_country"
+	SignalImpossibleTravel = "impossible_travel"
+	SignalTorExit          = "tor_exit_node"
+	SignalBadIP            = "bad_ip"
+	SignalRecentFailures   = "recent_failures"
+)
+
+// Вклад признаков в оценку риска от 0 до 100
+const (
+	newDeviceScore        = 20
+	newCountryScore       = 30
+	impossibleTravelScore = 40
+	torExitScore          = 40
+	badIPScore            = 50
+	recentFailuresScore   = 15
+	manyFailuresScore     = 30
+	maxScore              = 100
+)
+
+const (
+	// historySize сколько последних успешных входов сравнивается с новым
+	historySize = 50
+	// failureWindow окно подсчета неудачных попыток перед входом
+	failureWindow   = 15 * time.Minute
+	recentFailures  = 3
+	manyFailures    = 10
+	maxTravelSpeed  = 900 // км/ч, быстрее пассажирского самолета
+	minTravelKm     = 500 // ближе расхождение может дать погрешность геолокации
+	earthRadiusKm   = 6371.0
+	unknownDeviceID = "unknown"
+)
+
+// History прошлые попытки входа, на которых основана оценка
+type History interface {
+	GetRecentSuccessfulLogins(ctx context.Context, userID uuid.UUID, limit int) ([]*models.LoginAttempt, error)
+	CountRecentFailures(ctx context.Context, userID uuid.UUID, ipAddress string, since time.Time) (int64, error)
+}
+
+// Config пороги оценки. StepUpThreshold 0 отключает дополнительную проверку
+type Config struct {
+	SuspiciousThreshold int
+	StepUpThreshold     int
+}
+
+// Assessment результат оценки входа
+type Assessment struct {
+	Score   int
+	Signals []string
+	// Suspicious вход отмечается подозрительным, пользователь получает уведомление
+	Suspicious bool
+	// StepUp вход нужно подтвердить дополнительно
+	StepUp bool
+}
+
+// Engine оценивает риск входа по истории пользователя и спискам адресов
+type Engine struct {
+	history  History
+	torExits *IPList
+	badIPs   *IPList
+	cfg      Config
+}
+
+func NewEngine(history History, torExits, badIPs *IPList, cfg Config) *Engine {
+	return &Engine{
+		history:  history,
+		torExits: torExits,
+		badIPs:   badIPs,
+		cfg:      cfg,
+	}
+}
+
+// Assess оценивает вход attempt, который еще не сохранен в историю. Если история недоступна,
+// оценка строится по оставшимся признакам
+func (e *Engine) Assess(ctx context.Context, attempt *models.LoginAttempt) Assessment {
+	var assessment Assessment
+	add := func(signal string, score int) {
+		assessment.Signals = append(assessment.Signals, signal)
+		assessment.Score += score
+	}
+
+	previous, err := e.history.GetRecentSuccessfulLogins(ctx, attempt.UserID, historySize)
+	if err != nil {
+		logger.Error("Failed to load login history for risk assessment", zap.Error(err), zap.String("user_id", attempt.UserID.String()))
+	}
+	// Для первого входа сравнивать не с чем
+	if len(previous) > 0 {
+		if isNewDevice(attempt, previous) {
+			add(SignalNewDevice, newDeviceScore)
+		}
+		if isNewCountry(attempt, previous) {
+			add(SignalNewCountry, newCountryScore)
+		}
+		if isImpossibleTravel(attempt, previous) {
+			add(SignalImpossibleTravel, impossibleTravelScore)
+		}
+	}
+
+	if e.torExits.Contains(attempt.IPAddress) {
+		add(SignalTorExit, torExitScore)
+	}
+	if e.badIPs.Contains(attempt.IPAddress) {
+		add(SignalBadIP, badIPScore)
+	}
+
+	failures, err := e.history.CountRecentFailures(ctx, attempt.UserID, attempt.IPAddress, attempt.Timestamp.Add(-failureWindow))
+	if err != nil {
+		logger.Error("Failed to count recent login failures", zap.Error(err), zap.String("user_id", attempt.UserID.String()))
+	}
+	switch {
+	case failures >= manyFailures:
+		add(SignalRecentFailures, manyFailuresScore)
+	case failures >= recentFailures:
+		add(SignalRecentFailures, recentFailuresScore)
+	}
+
+	assessment.Score = min(assessment.Score, maxScore)
+	assessment.Suspicious = e.cfg.SuspiciousThreshold > 0 && assessment.Score >= e.cfg.SuspiciousThreshold
+	assessment.StepUp = e.cfg.StepUpThreshold > 0 && assessment.Score >= e.cfg.StepUpThreshold
+	return assessment
+}
+
+// deviceID браузер, ОС и тип устройства без версий: обновление браузера не делает устройство новым
+func deviceID(device models.Device) string {
+	if device.Browser == "" && device.OS == "" {
+		return unknownDeviceID
+	}
+	return device.Browser + "|" + device.OS + "|" + device.DeviceType
+}
+
+func isNewDevice(attempt *models.LoginAttempt, previous []*models.LoginAttempt) bool {
+	current := deviceID(attempt.DeviceInfo)
+	for _, login := range previous {
+		if deviceID(login.DeviceInfo) == current {
+			return false
+		}
+	}
+	return true
+}
+
+func isNewCountry(attempt *models.LoginAttempt, previous []*models.LoginAttempt) bool {
+	country := attempt.GeoLocation.CountryCode
+	if country == "" {
+		return false
+	}
+
+	known := false
+	for _, login := range previous {
+		if login.GeoLocation.CountryCode == country {
+			return false
+		}
+		known = known || login.GeoLocation.CountryCode != ""
+	}
+	// Страна неизвестна ни для одного прошлого входа, например геолокация была недоступна
+	return known
+}
+
+// isImpossibleTravel расстояние от места последнего входа с координатами нельзя преодолеть
+// за прошедшее время
+func isImpossibleTravel(attempt *models.LoginAttempt, previous []*models.LoginAttempt) bool {
+	if !hasCoordinates(attempt.GeoLocation) {
+		return false
+	}
+
+	for _, login := range previous {
+		if !hasCoordinates(login.GeoLocation) {
+			continue
+		}
+
+		distance := distanceKm(attempt.GeoLocation, login.GeoLocation)
+		if distance < minTravelKm {
+			return false
+		}
+		hours := attempt.Timestamp.Sub(login.Timestamp).Hours()
+		return hours <= 0 || distance/hours > maxTravelSpeed
+	}
+	return false
+}
+
+func hasCoordinates(location models.Location) bool {
+	return location.Latitude != 0 || location.Longitude != 0
+}
+
+// distanceKm расстояние по поверхности Земли по формуле гаверсинусов
+func distanceKm(a, b models.Location) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
@@ -0,0 +1,225 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"jiko-auth/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// stubHistory история входов в памяти. previous упорядочены от новых к старым, как в репозитории
+type stubHistory struct {
+	previous    []*models.LoginAttempt
+	failures    int64
+	previousErr error
+	failuresErr error
+	since       time.Time // начало окна последнего вызова CountRecentFailures
+}
+
+func (h *stubHistory) GetRecentSuccessfulLogins(ctx context.Context, userID uuid.UUID, limit int) ([]*models.LoginAttempt, error) {
+	return h.previous, h.previousErr
+}
+
+func (h *stubHistory) CountRecentFailures(ctx context.Context, userID uuid.UUID, ipAddress string, since time.Time) (int64, error) {
+	h.since = since
+	return h.failures, h.failuresErr
+}
+
+var (
+	now        = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	chrome     = models.Device{Browser: "Chrome", BrowserVersion: "124", OS: "Windows", DeviceType: "desktop"}
+	firefox    = models.Device{Browser: "Firefox", OS: "Linux", DeviceType: "desktop"}
+	moscow     = models.Location{CountryCode: "RU", Latitude: 55.7558, Longitude: 37.6173}
+	podolsk    = models.Location{CountryCode: "RU", Latitude: 55.4312, Longitude: 37.5447}
+	berlin     = models.Location{CountryCode: "DE", Latitude: 52.52, Longitude: 13.405}
+	newYork    = models.Location{CountryCode: "US", Latitude: 40.7128, Longitude: -74.006}
+	noLocation = models.Location{}
+)
+
+func login(device models.Device, location models.Location, ago time.Duration) *models.LoginAttempt {
+	return &models.LoginAttempt{
+		UserID:      uuid.Nil,
+		IPAddress:   "203.0.113.10",
+		Timestamp:   now.Add(-ago),
+		DeviceInfo:  device,
+		GeoLocation: location,
+	}
+}
+
+func writeIPList(t *testing.T, lines string) *IPList {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(path, []byte(lines), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	list, err := LoadIPList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestAssessSignals(t *testing.T) {
+	torExits := writeIPList(t, "198.51.100.7\n")
+	badIPs := writeIPList(t, "192.0.2.0/24 # botnet\n")
+	// Привычный вход: тот же браузер (другая версия) из Москвы день назад
+	usual := []*models.LoginAttempt{login(models.Device{Browser: "Chrome", BrowserVersion: "120", OS: "Windows", DeviceType: "desktop"}, moscow, 24*time.Hour)}
+
+	tests := []struct {
+		name        string
+		history     *stubHistory
+		attempt     *models.LoginAttempt
+		ip          string
+		wantScore   int
+		wantSignals []string
+	}{
+		{"usual login", &stubHistory{previous: usual}, login(chrome, podolsk, 0), "", 0, nil},
+		{"first login", &stubHistory{}, login(firefox, newYork, 0), "", 0, nil},
+		{"history unavailable", &stubHistory{previousErr: errors.New("db down")}, login(firefox, newYork, 0), "", 0, nil},
+		{"new device", &stubHistory{previous: usual}, login(firefox, moscow, 0), "", newDeviceScore, []string{SignalNewDevice}},
+		{"unknown device", &stubHistory{previous: usual}, login(models.Device{}, moscow, 0), "", newDeviceScore, []string{SignalNewDevice}},
+		{
+			"new country reachable in time", &stubHistory{previous: usual}, login(chrome, berlin, 0), "",
+			newCountryScore, []string{SignalNewCountry},
+		},
+		{
+			"new device, country and impossible travel",
+			&stubHistory{previous: []*models.LoginAttempt{login(chrome, moscow, time.Hour)}},
+			login(firefox, newYork, 0), "",
+			newDeviceScore + newCountryScore + impossibleTravelScore,
+			[]string{SignalNewDevice, SignalNewCountry, SignalImpossibleTravel},
+		},
+		{"tor exit node", &stubHistory{previous: usual}, login(chrome, moscow, 0), "198.51.100.7", torExitScore, []string{SignalTorExit}},
+		{"bad ip subnet", &stubHistory{previous: usual}, login(chrome, moscow, 0), "192.0.2.200", badIPScore, []string{SignalBadIP}},
+		{"two failures", &stubHistory{previous: usual, failures: recentFailures - 1}, login(chrome, moscow, 0), "", 0, nil},
+		{"recent failures", &stubHistory{previous: usual, failures: recentFailures}, login(chrome, moscow, 0), "", recentFailuresScore, []string{SignalRecentFailures}},
+		{"many failures", &stubHistory{previous: usual, failures: manyFailures}, login(chrome, moscow, 0), "", manyFailuresScore, []string{SignalRecentFailures}},
+		{"failures unavailable", &stubHistory{previous: usual, failures: 0, failuresErr: errors.New("db down")}, login(chrome, moscow, 0), "", 0, nil},
+		{
+			"score capped", &stubHistory{previous: []*models.LoginAttempt{login(chrome, moscow, time.Hour)}, failures: manyFailures},
+			login(firefox, newYork, 0), "198.51.100.7", maxScore,
+			[]string{SignalNewDevice, SignalNewCountry, SignalImpossibleTravel, SignalTorExit, SignalRecentFailures},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.ip != "" {
+				tt.attempt.IPAddress = tt.ip
+			}
+			engine := NewEngine(tt.history, torExits, badIPs, Config{})
+			assessment := engine.Assess(context.Background(), tt.attempt)
+			if assessment.Score != tt.wantScore || !slices.Equal(assessment.Signals, tt.wantSignals) {
+				t.Errorf("Assess = %d %v, want %d %v", assessment.Score, assessment.Signals, tt.wantScore, tt.wantSignals)
+			}
+			if want := tt.attempt.Timestamp.Add(-failureWindow); !tt.history.since.Equal(want) {
+				t.Errorf("failures counted since %v, want %v", tt.history.since, want)
+			}
+		})
+	}
+}
+
+func TestAssessThresholds(t *testing.T) {
+	previous := []*models.LoginAttempt{login(chrome, moscow, 24*time.Hour)}
+
+	tests := []struct {
+		name           string
+		cfg            Config
+		attempt        *models.LoginAttempt // новое устройство дает 20, новая страна еще 30
+		wantSuspicious bool
+		wantStepUp     bool
+	}{
+		{"below both thresholds", Config{SuspiciousThreshold: 30, StepUpThreshold: 60}, login(firefox, moscow, 0), false, false},
+		{"at suspicious threshold", Config{SuspiciousThreshold: 20, StepUpThreshold: 60}, login(firefox, moscow, 0), true, false},
+		{"above both thresholds", Config{SuspiciousThreshold: 30, StepUpThreshold: 50}, login(firefox, berlin, 0), true, true},
+		{"thresholds disabled", Config{}, login(firefox, berlin, 0), false, false},
+		{"step-up only", Config{StepUpThreshold: 20}, login(firefox, moscow, 0), false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngine(&stubHistory{previous: previous}, nil, nil, tt.cfg)
+			assessment := engine.Assess(context.Background(), tt.attempt)
+			if assessment.Suspicious != tt.wantSuspicious || assessment.StepUp != tt.wantStepUp {
+				t.Errorf("Assess score %d = suspicious %v, step-up %v, want %v, %v",
+					assessment.Score, assessment.Suspicious, assessment.StepUp, tt.wantSuspicious, tt.wantStepUp)
+			}
+		})
+	}
+}
+
+func TestIsNewCountry(t *testing.T) {
+	tests := []struct {
+		name     string
+		country  string
+		previous []string
+		want     bool
+	}{
+		{"seen before", "RU", []string{"DE", "RU"}, false},
+		{"new country", "US", []string{"DE", "RU"}, true},
+		{"current country unknown", "", []string{"DE"}, false},
+		{"history countries unknown", "US", []string{"", ""}, false},
+		{"partly unknown history", "US", []string{"", "DE"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var previous []*models.LoginAttempt
+			for _, country := range tt.previous {
+				previous = append(previous, login(chrome, models.Location{CountryCode: country}, time.Hour))
+			}
+			attempt := login(chrome, models.Location{CountryCode: tt.country}, 0)
+			if got := isNewCountry(attempt, previous); got != tt.want {
+				t.Errorf("isNewCountry = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsImpossibleTravel(t *testing.T) {
+	tests := []struct {
+		name     string
+		location models.Location
+		previous []*models.LoginAttempt
+		want     bool
+	}{
+		{"no coordinates", noLocation, []*models.LoginAttempt{login(chrome, newYork, time.Minute)}, false},
+		{"no previous coordinates", berlin, []*models.LoginAttempt{login(chrome, noLocation, time.Minute)}, false},
+		{"nearby", moscow, []*models.LoginAttempt{login(chrome, podolsk, time.Minute)}, false},
+		{"far with enough time", berlin, []*models.LoginAttempt{login(chrome, moscow, 24*time.Hour)}, false},
+		{"far too fast", berlin, []*models.LoginAttempt{login(chrome, moscow, time.Hour)}, true},
+		{"same moment", berlin, []*models.LoginAttempt{login(chrome, moscow, 0)}, true},
+		{
+			"skips logins without coordinates", berlin,
+			[]*models.LoginAttempt{login(chrome, noLocation, time.Minute), login(chrome, moscow, time.Hour)},
+			true,
+		},
+		{
+			// Сравнивается только последний вход с координатами: более старый вход из Нью-Йорка не учитывается
+			"only latest login with coordinates", moscow,
+			[]*models.LoginAttempt{login(chrome, podolsk, time.Hour), login(chrome, newYork, 2*time.Hour)},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isImpossibleTravel(login(chrome, tt.location, 0), tt.previous); got != tt.want {
+				t.Errorf("isImpossibleTravel = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistanceKm(t *testing.T) {
+	// Москва - Берлин около 1610 км
+	if got := distanceKm(moscow, berlin); got < 1580 || got > 1640 {
+		t.Errorf("distanceKm(Moscow, Berlin) = %.0f", got)
+	}
+	if got := distanceKm(berlin, berlin); got != 0 {
+		t.Errorf("distanceKm(Berlin, Berlin) = %f", got)
+	}
+}
@@ -0,0 +1,106 @@
+// pkg/saml/attributes.go
+package saml
+
+import (
+	"encoding/json"
+	"fmt"
+	"jiko-auth/internal/models"
+	"sort"
+	"strconv"
+)
+
+// userFields поля models.User, доступные для передачи в SP
+var userFields = map[string]func(*models.User) string{
+	"id":             func(u *models.User) string { return u.ID.String() },
+	"username":       func(u *models.User) string { return u.Username },
+	"email":          func(u *models.User) string { return u.Email },
+	"email_verified": func(u *models.User) string { return strconv.FormatBool(u.EmailVerified) },
+	"role":           func(u *models.User) string { return u.Role },
+}
+
+// DefaultAttributeMapping используется, если у SP не задано собственное сопоставление
+var DefaultAttributeMapping = map[string]string{
+	"uid":      "id",
+	"username": "username",
+	"email":    "email",
+	"role":     "role",
+}
+
+var nameIDFormats = map[string]bool{
+	models.NameIDFormatEmail:       true,
+	models.NameIDFormatPersistent:  true,
+	models.NameIDFormatUnspecified: true,
+}
+
+// ValidateAttributeMapping проверяет, что все атрибуты ссылаются на известные поля пользователя
+func ValidateAttributeMapping(mapping map[string]string) error {
+	for name, field := range mapping {
+		if name == "" {
+			return fmt.Errorf("attribute name must not be empty")
+		}
+		if _, ok := userFields[field]; !ok {
+			return fmt.Errorf("unknown user field %q for attribute %q", field, name)
+		}
+	}
+	return nil
+}
+
+// ValidateNameIDFormat проверяет поддержку формата NameID
+func ValidateNameIDFormat(format string) error {
+	if !nameIDFormats[format] {
+		return fmt.Errorf("unsupported name_id_format %q", format)
+	}
+	return nil
+}
+
+// EncodeAttributeMapping сериализует сопоставление атрибутов для хранения в SP
+func EncodeAttributeMapping(mapping map[string]string) string {
+	if mapping == nil {
+		return ""
+	}
+	data, err := json.Marshal(mapping)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// DecodeAttributeMapping возвращает сопоставление SP или сопоставление по умолчанию
+func DecodeAttributeMapping(data string) map[string]string {
+	var mapping map[string]string
+	if data == "" || json.Unmarshal([]byte(data), &mapping) != nil || mapping == nil {
+		return DefaultAttributeMapping
+	}
+	return mapping
+}
+
+// mapAttributes вычисляет значения атрибутов в детерминированном порядке
+func mapAttributes(user *models.User, mapping map[string]string) []attr {
+	names := make([]string, 0, len(mapping))
+	for name := range mapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	attrs := make([]attr, 0, len(names))
+	for _, name := range names {
+		value, ok := userFields[mapping[name]]
+		if !ok {
+			continue
+		}
+		attrs = append(attrs, attr{name: name, value: value(user)})
+	}
+	return attrs
+}
+
+// nameID возвращает идентификатор субъекта в формате, согласованном с SP
+func nameID(user *models.User, format string) string {
+	switch format {
+	case models.NameIDFormatPersistent:
+		return user.ID.String()
+	case models.NameIDFormatUnspecified:
+		return user.Username
+	default:
+		return user.Email
+	}
+}
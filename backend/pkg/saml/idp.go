@@ -0,0 +1,255 @@
+// pkg/saml/idp.go
+package saml
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"jiko-auth/internal/config"
+	"jiko-auth/internal/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	BindingRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	BindingPOST     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	algExcC14N      = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped    = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algRSASHA256    = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algSHA256       = "http://www.w3.org/2001/04/xmlenc#sha256"
+	statusSuccess   = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	cmBearer        = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	acPasswordProto = "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport"
+	acSmartcardPKI  = "urn:oasis:names:tc:SAML:2.0:ac:classes:SmartcardPKI"
+	acSoftwarePKI   = "urn:oasis:names:tc:SAML:2.0:ac:classes:SoftwarePKI"
+	acUnspecified   = "urn:oasis:names:tc:SAML:2.0:ac:classes:unspecified"
+	acRefedsMFA     = "https://refeds.org/profile/mfa"
+	attrNameFormat  = "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"
+
+	// assertionTTL срок, в течение которого SP может принять утверждение
+	assertionTTL = 5 * time.Minute
+	// clockSkew допуск расхождения часов IdP и SP
+	clockSkew = 2 * time.Minute
+)
+
+// IdentityProvider выпускает подписанные SAML 2.0 утверждения для зарегистрированных SP
+type IdentityProvider struct {
+	entityID string
+	ssoURL   string
+	key      *rsa.PrivateKey
+	cert     *x509.Certificate
+}
+
+func NewIdentityProvider(cfg *config.Config) (*IdentityProvider, error) {
+	baseURL := strings.TrimRight(cfg.AppUrl, "/") + "/api/v1/saml"
+	entityID := baseURL + "/metadata"
+
+	key, cert, err := loadSigningKey(cfg.SAMLKeyFile, cfg.SAMLCertFile, entityID, cfg.AppEnv == "production")
+	if err != nil {
+		return nil, err
+	}
+
+	return &IdentityProvider{
+		entityID: entityID,
+		ssoURL:   baseURL + "/sso",
+		key:      key,
+		cert:     cert,
+	}, nil
+}
+
+func (idp *IdentityProvider) EntityID() string {
+	return idp.entityID
+}
+
+// Metadata возвращает метаданные IdP (EntityDescriptor) для импорта на стороне SP
+func (idp *IdentityProvider) Metadata() string {
+	descriptor := newElement("md:IDPSSODescriptor").
+		attr("WantAuthnRequestsSigned", "false").
+		attr("protocolSupportEnumeration", nsProtocol).
+		add(
+			newElement("md:KeyDescriptor").attr("use", "signing").add(idp.keyInfo()),
+			textElement("md:NameIDFormat", models.NameIDFormatEmail),
+			textElement("md:NameIDFormat", models.NameIDFormatPersistent),
+			textElement("md:NameIDFormat", models.NameIDFormatUnspecified),
+			newElement("md:SingleSignOnService").attr("Binding", BindingRedirect).attr("Location", idp.ssoURL),
+			newElement("md:SingleSignOnService").attr("Binding", BindingPOST).attr("Location", idp.ssoURL),
+		)
+
+	entity := newElement("md:EntityDescriptor").
+		declare("md", nsMetadata).
+		declare("ds", nsDSig).
+		attr("entityID", idp.entityID).
+		add(descriptor)
+
+	return `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + entity.canonical()
+}
+
+// authnContextClass переводит методы входа сессии (AMR, RFC 8176) в AuthnContextClassRef
+func authnContextClass(amr []string) string {
+	switch {
+	case slices.Contains(amr, "mfa"):
+		return acRefedsMFA
+	case slices.Contains(amr, "hwk"):
+		return acSmartcardPKI
+	case slices.Contains(amr, "swk"):
+		return acSoftwarePKI
+	case slices.Contains(amr, "pwd"):
+		return acPasswordProto
+	default:
+		return acUnspecified
+	}
+}
+
+// BuildResponse формирует SAML Response с подписанным утверждением о пользователе
+// и возвращает его в base64 для HTTP-POST binding. inResponseTo пуст для IdP-initiated SSO.
+// authTime и amr - время входа и методы аутентификации сессии пользователя
+func (idp *IdentityProvider) BuildResponse(sp *models.SAMLServiceProvider, user *models.User, inResponseTo string, authTime time.Time, amr []string) (string, error) {
+	now := time.Now().UTC()
+
+	assertionID, err := newID()
+	if err != nil {
+		return "", err
+	}
+	responseID, err := newID()
+	if err != nil {
+		return "", err
+	}
+
+	confirmationData := newElement("saml:SubjectConfirmationData").
+		attr("NotOnOrAfter", formatTime(now.Add(assertionTTL))).
+		attr("Recipient", sp.ACSURL)
+	if inResponseTo != "" {
+		confirmationData.attr("InResponseTo", inResponseTo)
+	}
+
+	attributes := newElement("saml:AttributeStatement")
+	for _, a := range mapAttributes(user, DecodeAttributeMapping(sp.AttributeMapping)) {
+		attributes.add(newElement("saml:Attribute").
+			attr("Name", a.name).
+			attr("NameFormat", attrNameFormat).
+			add(textElement("saml:AttributeValue", a.value)))
+	}
+
+	assertion := newElement("saml:Assertion").
+		declare("saml", nsAssertion).
+		attr("ID", assertionID).
+		attr("IssueInstant", formatTime(now)).
+		attr("Version", "2.0").
+		add(
+			textElement("saml:Issuer", idp.entityID),
+			newElement("saml:Subject").add(
+				textElement("saml:NameID", nameID(user, sp.NameIDFormat)).attr("Format", sp.NameIDFormat),
+				newElement("saml:SubjectConfirmation").attr("Method", cmBearer).add(confirmationData),
+			),
+			newElement("saml:Conditions").
+				attr("NotBefore", formatTime(now.Add(-clockSkew))).
+				attr("NotOnOrAfter", formatTime(now.Add(assertionTTL))).
+				add(newElement("saml:AudienceRestriction").add(textElement("saml:Audience", sp.EntityID))),
+			newElement("saml:AuthnStatement").
+				attr("AuthnInstant", formatTime(authTime.UTC())).
+				attr("SessionIndex", assertionID).
+				add(newElement("saml:AuthnContext").add(textElement("saml:AuthnContextClassRef", authnContextClass(amr)))),
+		)
+	// Пустой AttributeStatement не допускается схемой SAML, без атрибутов он не добавляется
+	if len(attributes.children) > 0 {
+		assertion.add(attributes)
+	}
+
+	if err := idp.sign(assertion); err != nil {
+		return "", err
+	}
+
+	response := newElement("samlp:Response").
+		declare("samlp", nsProtocol).
+		declare("saml", nsAssertion).
+		attr("Destination", sp.ACSURL).
+		attr("ID", responseID).
+		attr("IssueInstant", formatTime(now)).
+		attr("Version", "2.0").
+		add(
+			textElement("saml:Issuer", idp.entityID),
+			newElement("samlp:Status").add(newElement("samlp:StatusCode").attr("Value", statusSuccess)),
+			assertion,
+		)
+	if inResponseTo != "" {
+		response.attr("InResponseTo", inResponseTo)
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(response.canonical())), nil
+}
+
+// sign добавляет в элемент enveloped подпись XML-DSig (RSA-SHA256, exc-c14n).
+// Подпись размещается сразу после Issuer, как требует схема SAML
+func (idp *IdentityProvider) sign(e *element) error {
+	var id string
+	for _, a := range e.attrs {
+		if a.name == "ID" {
+			id = a.value
+		}
+	}
+
+	digest := sha256.Sum256([]byte(e.canonical()))
+
+	signedInfo := newElement("ds:SignedInfo").
+		declare("ds", nsDSig).
+		add(
+			newElement("ds:CanonicalizationMethod").attr("Algorithm", algExcC14N),
+			newElement("ds:SignatureMethod").attr("Algorithm", algRSASHA256),
+			newElement("ds:Reference").attr("URI", "#"+id).add(
+				newElement("ds:Transforms").add(
+					newElement("ds:Transform").attr("Algorithm", algEnveloped),
+					newElement("ds:Transform").attr("Algorithm", algExcC14N),
+				),
+				newElement("ds:DigestMethod").attr("Algorithm", algSHA256),
+				textElement("ds:DigestValue", base64.StdEncoding.EncodeToString(digest[:])),
+			),
+		)
+
+	hashed := sha256.Sum256([]byte(signedInfo.canonical()))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return fmt.Errorf("failed to sign SAML assertion: %w", err)
+	}
+
+	signatureElement := newElement("ds:Signature").
+		declare("ds", nsDSig).
+		add(
+			signedInfo,
+			textElement("ds:SignatureValue", base64.StdEncoding.EncodeToString(signature)),
+			idp.keyInfo(),
+		)
+
+	// Issuer всегда первый дочерний элемент утверждения
+	children := []*element{e.children[0], signatureElement}
+	e.children = append(children, e.children[1:]...)
+	return nil
+}
+
+func (idp *IdentityProvider) keyInfo() *element {
+	return newElement("ds:KeyInfo").add(
+		newElement("ds:X509Data").add(
+			textElement("ds:X509Certificate", base64.StdEncoding.EncodeToString(idp.cert.Raw)),
+		),
+	)
+}
+
+// newID генерирует идентификатор сообщения; xs:ID не может начинаться с цифры
+func newID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
@@ -0,0 +1,404 @@
+package saml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"jiko-auth/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Независимая проверка XML-DSig: документ разбирается encoding/xml и канонизируется
+// по Exclusive XML Canonicalization с нуля, без построителя element из xml.go
+
+type xmlNode struct {
+	parent   *xmlNode
+	prefix   string
+	local    string
+	ns       map[string]string // объявления пространств имен на элементе, "" - по умолчанию
+	attrs    []xml.Attr
+	children []any // *xmlNode или string
+}
+
+func parseXML(t *testing.T, data []byte) *xmlNode {
+	t.Helper()
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var root, current *xmlNode
+	for {
+		token, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("parse XML: %v", err)
+		}
+		switch tok := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{parent: current, prefix: tok.Name.Space, local: tok.Name.Local, ns: map[string]string{}}
+			for _, a := range tok.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					node.ns[a.Name.Local] = a.Value
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					node.ns[""] = a.Value
+				default:
+					node.attrs = append(node.attrs, a)
+				}
+			}
+			if current == nil {
+				root = node
+			} else {
+				current.children = append(current.children, node)
+			}
+			current = node
+		case xml.EndElement:
+			current = current.parent
+		case xml.CharData:
+			if current != nil {
+				current.children = append(current.children, string(tok))
+			}
+		}
+	}
+	return root
+}
+
+func (n *xmlNode) lookup(prefix string) string {
+	if prefix == "xml" {
+		return "http://www.w3.org/XML/1998/namespace"
+	}
+	for e := n; e != nil; e = e.parent {
+		if uri, ok := e.ns[prefix]; ok {
+			return uri
+		}
+	}
+	return ""
+}
+
+func (n *xmlNode) attr(name string) string {
+	for _, a := range n.attrs {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (n *xmlNode) text() string {
+	var b strings.Builder
+	for _, child := range n.children {
+		if s, ok := child.(string); ok {
+			b.WriteString(s)
+		}
+	}
+	return b.String()
+}
+
+// find ищет в поддереве первый элемент с пространством имен uri и локальным именем local
+func (n *xmlNode) find(uri, local string) *xmlNode {
+	if n.local == local && n.lookup(n.prefix) == uri {
+		return n
+	}
+	for _, child := range n.children {
+		if node, ok := child.(*xmlNode); ok {
+			if found := node.find(uri, local); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// excC14N канонизирует поддерево n (xml-exc-c14n без комментариев), пропуская exclude
+func excC14N(n, exclude *xmlNode) string {
+	var b strings.Builder
+	writeC14N(&b, n, exclude, map[string]string{})
+	return b.String()
+}
+
+func writeC14N(b *strings.Builder, n, exclude *xmlNode, rendered map[string]string) {
+	// Объявляются только видимо используемые префиксы, еще не объявленные предком в выводе
+	used := map[string]bool{n.prefix: true}
+	for _, a := range n.attrs {
+		if a.Name.Space != "" && a.Name.Space != "xml" {
+			used[a.Name.Space] = true
+		}
+	}
+	prefixes := make([]string, 0, len(used))
+	for prefix := range used {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	scope := make(map[string]string, len(rendered))
+	for k, v := range rendered {
+		scope[k] = v
+	}
+
+	name := n.local
+	if n.prefix != "" {
+		name = n.prefix + ":" + n.local
+	}
+	b.WriteString("<" + name)
+	for _, prefix := range prefixes {
+		uri := n.lookup(prefix)
+		if previous, ok := rendered[prefix]; ok && previous == uri {
+			continue
+		}
+		if prefix == "" && uri == "" && rendered[""] == "" {
+			continue
+		}
+		scope[prefix] = uri
+		if prefix == "" {
+			b.WriteString(` xmlns="` + c14nAttr(uri) + `"`)
+		} else {
+			b.WriteString(" xmlns:" + prefix + `="` + c14nAttr(uri) + `"`)
+		}
+	}
+
+	attrs := append([]xml.Attr(nil), n.attrs...)
+	sort.Slice(attrs, func(i, j int) bool {
+		ui, uj := "", ""
+		if attrs[i].Name.Space != "" {
+			ui = n.lookup(attrs[i].Name.Space)
+		}
+		if attrs[j].Name.Space != "" {
+			uj = n.lookup(attrs[j].Name.Space)
+		}
+		if ui != uj {
+			return ui < uj
+		}
+		return attrs[i].Name.Local < attrs[j].Name.Local
+	})
+	for _, a := range attrs {
+		attrName := a.Name.Local
+		if a.Name.Space != "" {
+			attrName = a.Name.Space + ":" + a.Name.Local
+		}
+		b.WriteString(" " + attrName + `="` + c14nAttr(a.Value) + `"`)
+	}
+	b.WriteString(">")
+
+	for _, child := range n.children {
+		switch c := child.(type) {
+		case string:
+			b.WriteString(c14nText(c))
+		case *xmlNode:
+			if c != exclude {
+				writeC14N(b, c, exclude, scope)
+			}
+		}
+	}
+	b.WriteString("</" + name + ">")
+}
+
+func c14nText(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;").Replace(s)
+}
+
+func c14nAttr(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;").Replace(s)
+}
+
+// verifyAssertion проверяет enveloped подпись утверждения ответа ключом cert
+func verifyAssertion(t *testing.T, response []byte, cert *x509.Certificate) error {
+	t.Helper()
+	root := parseXML(t, response)
+	assertion := root.find(nsAssertion, "Assertion")
+	if assertion == nil {
+		return errors.New("assertion not found")
+	}
+	var signature *xmlNode
+	for _, child := range assertion.children {
+		if node, ok := child.(*xmlNode); ok && node.local == "Signature" && node.lookup(node.prefix) == nsDSig {
+			signature = node
+		}
+	}
+	if signature == nil {
+		return errors.New("signature not found")
+	}
+
+	signedInfo := signature.find(nsDSig, "SignedInfo")
+	reference := signedInfo.find(nsDSig, "Reference")
+	if reference.attr("URI") != "#"+assertion.attr("ID") {
+		return fmt.Errorf("reference %q does not point to the assertion", reference.attr("URI"))
+	}
+	if alg := signedInfo.find(nsDSig, "CanonicalizationMethod").attr("Algorithm"); alg != algExcC14N {
+		return fmt.Errorf("unexpected canonicalization %q", alg)
+	}
+	if alg := signedInfo.find(nsDSig, "SignatureMethod").attr("Algorithm"); alg != algRSASHA256 {
+		return fmt.Errorf("unexpected signature method %q", alg)
+	}
+
+	digest := sha256.Sum256([]byte(excC14N(assertion, signature)))
+	if got := base64.StdEncoding.EncodeToString(digest[:]); got != reference.find(nsDSig, "DigestValue").text() {
+		return errors.New("digest mismatch")
+	}
+
+	value, err := base64.StdEncoding.DecodeString(signature.find(nsDSig, "SignatureValue").text())
+	if err != nil {
+		return err
+	}
+	hashed := sha256.Sum256([]byte(excC14N(signedInfo, nil)))
+	return rsa.VerifyPKCS1v15(cert.PublicKey.(*rsa.PublicKey), crypto.SHA256, hashed[:], value)
+}
+
+func TestExcC14N(t *testing.T) {
+	// Лишние объявления убираются, атрибуты сортируются, пустые элементы раскрываются
+	input := `<a:root xmlns:a="urn:a" xmlns:unused="urn:u" z="1" b="2"><a:child xmlns:a="urn:a" b:x="y" xmlns:b="urn:b"/>` +
+		`<plain>1 &lt; 2 &amp; "q"</plain></a:root>`
+	want := `<a:root xmlns:a="urn:a" b="2" z="1"><a:child xmlns:b="urn:b" b:x="y"></a:child><plain>1 &lt; 2 &amp; "q"</plain></a:root>`
+
+	if got := excC14N(parseXML(t, []byte(input)), nil); got != want {
+		t.Errorf("excC14N =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func newTestIdP(t *testing.T) *IdentityProvider {
+	t.Helper()
+	entityID := "https://idp.example.com/api/v1/saml/metadata"
+	key, cert, err := generateSigningKey(entityID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &IdentityProvider{entityID: entityID, ssoURL: "https://idp.example.com/api/v1/saml/sso", key: key, cert: cert}
+}
+
+func buildTestResponse(t *testing.T, idp *IdentityProvider, authTime time.Time, amr []string) []byte {
+	t.Helper()
+	sp := &models.SAMLServiceProvider{
+		EntityID:         "https://sp.example.com",
+		ACSURL:           "https://sp.example.com/acs",
+		NameIDFormat:     models.NameIDFormatEmail,
+		AttributeMapping: EncodeAttributeMapping(map[string]string{"email": "email", "role": "role"}),
+	}
+	user := &models.User{ID: uuid.New(), Username: "alice", Email: "alice@example.com", Role: "member"}
+
+	encoded, err := idp.BuildResponse(sp, user, "_request", authTime, amr)
+	if err != nil {
+		t.Fatalf("BuildResponse: %v", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestBuildResponseSignature(t *testing.T) {
+	idp := newTestIdP(t)
+	authTime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	response := buildTestResponse(t, idp, authTime, []string{"pwd", "otp", "mfa"})
+
+	if err := verifyAssertion(t, response, idp.cert); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+
+	root := parseXML(t, response)
+	statement := root.find(nsAssertion, "AuthnStatement")
+	if got := statement.attr("AuthnInstant"); got != "2024-05-06T07:08:09Z" {
+		t.Errorf("AuthnInstant = %q", got)
+	}
+	if got := statement.find(nsAssertion, "AuthnContextClassRef").text(); got != acRefedsMFA {
+		t.Errorf("AuthnContextClassRef = %q", got)
+	}
+	if got := root.attr("InResponseTo"); got != "_request" {
+		t.Errorf("InResponseTo = %q", got)
+	}
+}
+
+func TestBuildResponseWithoutAttributes(t *testing.T) {
+	idp := newTestIdP(t)
+	// Пустое сопоставление (а не отсутствующее, для которого действует сопоставление по умолчанию)
+	sp := &models.SAMLServiceProvider{
+		EntityID:         "https://sp.example.com",
+		ACSURL:           "https://sp.example.com/acs",
+		NameIDFormat:     models.NameIDFormatEmail,
+		AttributeMapping: EncodeAttributeMapping(map[string]string{}),
+	}
+	user := &models.User{ID: uuid.New(), Username: "alice", Email: "alice@example.com", Role: "member"}
+
+	encoded, err := idp.BuildResponse(sp, user, "", time.Now(), []string{"pwd"})
+	if err != nil {
+		t.Fatalf("BuildResponse: %v", err)
+	}
+	response, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifyAssertion(t, response, idp.cert); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+	if statement := parseXML(t, response).find(nsAssertion, "AttributeStatement"); statement != nil {
+		t.Error("assertion without attributes has an AttributeStatement")
+	}
+	if statement := parseXML(t, buildTestResponse(t, idp, time.Now(), []string{"pwd"})).find(nsAssertion, "AttributeStatement"); statement == nil {
+		t.Error("assertion with mapped attributes has no AttributeStatement")
+	}
+}
+
+func TestBuildResponseTampering(t *testing.T) {
+	idp := newTestIdP(t)
+	response := buildTestResponse(t, idp, time.Now(), []string{"pwd"})
+
+	tests := []struct {
+		name string
+		old  string
+		new  string
+	}{
+		{"attribute value", "<saml:AttributeValue>member</saml:AttributeValue>", "<saml:AttributeValue>admin</saml:AttributeValue>"},
+		{"name id", ">alice@example.com</saml:NameID>", ">mallory@example.com</saml:NameID>"},
+		{"audience", "<saml:Audience>https://sp.example.com</saml:Audience>", "<saml:Audience>https://evil.example.com</saml:Audience>"},
+		{"authn context", acPasswordProto, acRefedsMFA},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !bytes.Contains(response, []byte(tt.old)) {
+				t.Fatalf("response does not contain %q", tt.old)
+			}
+			tampered := bytes.Replace(response, []byte(tt.old), []byte(tt.new), 1)
+			if err := verifyAssertion(t, tampered, idp.cert); err == nil {
+				t.Error("tampered response verifies")
+			}
+		})
+	}
+
+	t.Run("other key", func(t *testing.T) {
+		if err := verifyAssertion(t, response, newTestIdP(t).cert); err == nil {
+			t.Error("response verifies with another certificate")
+		}
+	})
+}
+
+func TestAuthnContextClass(t *testing.T) {
+	tests := []struct {
+		amr  []string
+		want string
+	}{
+		{[]string{"pwd"}, acPasswordProto},
+		{[]string{"pwd", "otp", "mfa"}, acRefedsMFA},
+		{[]string{"hwk", "mfa"}, acRefedsMFA},
+		{[]string{"hwk"}, acSmartcardPKI},
+		{[]string{"swk"}, acSoftwarePKI},
+		{[]string{"otp"}, acUnspecified},
+		{nil, acUnspecified},
+	}
+	for _, tt := range tests {
+		if got := authnContextClass(tt.amr); got != tt.want {
+			t.Errorf("authnContextClass(%v) = %q, want %q", tt.amr, got, tt.want)
+		}
+	}
+}
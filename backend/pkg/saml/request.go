@@ -0,0 +1,106 @@
+// pkg/saml/request.go
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"html/template"
+	"io"
+	"jiko-auth/internal/models"
+)
+
+// maxRequestSize ограничивает размер распакованного AuthnRequest
+const maxRequestSize = 64 * 1024
+
+var (
+	ErrInvalidRequest = errors.New("invalid SAML request")
+	ErrInvalidACS     = errors.New("AssertionConsumerServiceURL does not match the registered ACS URL")
+	ErrInvalidBinding = errors.New("only the HTTP-POST binding is supported for responses")
+)
+
+// AuthnRequest поля запроса аутентификации, которые использует IdP
+type AuthnRequest struct {
+	XMLName                     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string   `xml:"ID,attr"`
+	Version                     string   `xml:"Version,attr"`
+	Destination                 string   `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string   `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string   `xml:"ProtocolBinding,attr"`
+	ForceAuthn                  bool     `xml:"ForceAuthn,attr"`
+	Issuer                      string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+}
+
+// DecodeRedirectRequest разбирает SAMLRequest из HTTP-Redirect binding (DEFLATE + base64)
+func DecodeRedirectRequest(samlRequest string) (*AuthnRequest, error) {
+	compressed, err := base64.StdEncoding.DecodeString(samlRequest)
+	if err != nil {
+		return nil, ErrInvalidRequest
+	}
+
+	data, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(compressed)), maxRequestSize+1))
+	if err != nil || len(data) > maxRequestSize {
+		return nil, ErrInvalidRequest
+	}
+	return parseAuthnRequest(data)
+}
+
+// DecodePostRequest разбирает SAMLRequest из HTTP-POST binding (base64)
+func DecodePostRequest(samlRequest string) (*AuthnRequest, error) {
+	data, err := base64.StdEncoding.DecodeString(samlRequest)
+	if err != nil || len(data) > maxRequestSize {
+		return nil, ErrInvalidRequest
+	}
+	return parseAuthnRequest(data)
+}
+
+func parseAuthnRequest(data []byte) (*AuthnRequest, error) {
+	var req AuthnRequest
+	if err := xml.Unmarshal(data, &req); err != nil {
+		return nil, ErrInvalidRequest
+	}
+	if req.ID == "" || req.Version != "2.0" || req.Issuer == "" {
+		return nil, ErrInvalidRequest
+	}
+	return &req, nil
+}
+
+// ValidateRequest сверяет запрос с регистрацией SP. Ответ отправляется только на
+// зарегистрированный ACS URL, поэтому подпись AuthnRequest не требуется
+func (idp *IdentityProvider) ValidateRequest(req *AuthnRequest, sp *models.SAMLServiceProvider) error {
+	if req.Destination != "" && req.Destination != idp.ssoURL {
+		return ErrInvalidRequest
+	}
+	if req.AssertionConsumerServiceURL != "" && req.AssertionConsumerServiceURL != sp.ACSURL {
+		return ErrInvalidACS
+	}
+	if req.ProtocolBinding != "" && req.ProtocolBinding != BindingPOST {
+		return ErrInvalidBinding
+	}
+	return nil
+}
+
+var postFormTemplate = template.Must(template.New("saml-post").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Signing in...</title></head>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.ACSURL}}">
+<input type="hidden" name="SAMLResponse" value="{{.SAMLResponse}}">
+{{if .RelayState}}<input type="hidden" name="RelayState" value="{{.RelayState}}">{{end}}
+<noscript><button type="submit">Continue</button></noscript>
+</form>
+</body>
+</html>`))
+
+// PostForm возвращает HTML страницу, отправляющую ответ на ACS через HTTP-POST binding
+func PostForm(acsURL, samlResponse, relayState string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := postFormTemplate.Execute(&buf, struct {
+		ACSURL       string
+		SAMLResponse string
+		RelayState   string
+	}{acsURL, samlResponse, relayState})
+	return buf.Bytes(), err
+}
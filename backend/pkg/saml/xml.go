@@ -0,0 +1,100 @@
+// pkg/saml/xml.go
+package saml
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	nsDSig      = "http://www.w3.org/2000/09/xmldsig#"
+)
+
+// element узел XML документа. Документы IdP строятся сразу в канонической форме
+// Exclusive XML Canonicalization (xml-exc-c14n): явные закрывающие теги, отсортированные
+// атрибуты, пространства имен объявлены на элементах, которые их используют.
+// Это позволяет подписывать утверждения без универсального канонизатора
+type element struct {
+	name     string
+	ns       []attr // объявления xmlns:*
+	attrs    []attr
+	children []*element
+	text     string
+}
+
+type attr struct {
+	name  string
+	value string
+}
+
+func newElement(name string) *element {
+	return &element{name: name}
+}
+
+func (e *element) declare(prefix, uri string) *element {
+	e.ns = append(e.ns, attr{name: "xmlns:" + prefix, value: uri})
+	return e
+}
+
+func (e *element) attr(name, value string) *element {
+	e.attrs = append(e.attrs, attr{name: name, value: value})
+	return e
+}
+
+func (e *element) add(children ...*element) *element {
+	e.children = append(e.children, children...)
+	return e
+}
+
+func (e *element) setText(text string) *element {
+	e.text = text
+	return e
+}
+
+// textElement создает элемент с текстовым содержимым
+func textElement(name, text string) *element {
+	return newElement(name).setText(text)
+}
+
+// canonical возвращает каноническое представление элемента
+func (e *element) canonical() string {
+	var b strings.Builder
+	e.write(&b)
+	return b.String()
+}
+
+func (e *element) write(b *strings.Builder) {
+	b.WriteString("<" + e.name)
+
+	ns := append([]attr(nil), e.ns...)
+	sort.Slice(ns, func(i, j int) bool { return ns[i].name < ns[j].name })
+	attrs := append([]attr(nil), e.attrs...)
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].name < attrs[j].name })
+
+	for _, a := range append(ns, attrs...) {
+		b.WriteString(" " + a.name + `="` + escapeAttr(a.value) + `"`)
+	}
+	b.WriteString(">")
+
+	b.WriteString(escapeText(e.text))
+	for _, child := range e.children {
+		child.write(b)
+	}
+
+	b.WriteString("</" + e.name + ">")
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+
+var attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func escapeAttr(s string) string {
+	return attrEscaper.Replace(s)
+}
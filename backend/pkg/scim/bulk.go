@@ -0,0 +1,95 @@
+// pkg/scim/bulk.go
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+type BulkRequest struct {
+	Schemas      []string        `json:"schemas"`
+	FailOnErrors int             `json:"failOnErrors"`
+	Operations   []BulkOperation `json:"Operations"`
+}
+
+type BulkOperation struct {
+	Method  string          `json:"method"`
+	BulkID  string          `json:"bulkId,omitempty"`
+	Version string          `json:"version,omitempty"`
+	Path    string          `json:"path"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+type BulkOperationResult struct {
+	Method   string         `json:"method"`
+	BulkID   string         `json:"bulkId,omitempty"`
+	Version  string         `json:"version,omitempty"`
+	Location string         `json:"location,omitempty"`
+	Status   string         `json:"status"`
+	Response *ErrorResponse `json:"response,omitempty"`
+}
+
+type BulkResponse struct {
+	Schemas    []string              `json:"schemas"`
+	Operations []BulkOperationResult `json:"Operations"`
+}
+
+// HasSchema проверяет наличие схемы в списке schemas запроса
+func HasSchema(schemas []string, schema string) bool {
+	return containsSchema(schemas, schema)
+}
+
+// ParseBulkRequest проверяет схему и лимиты bulk запроса (RFC 7644, раздел 3.7)
+func ParseBulkRequest(body []byte) (*BulkRequest, error) {
+	if len(body) > MaxBulkPayloadSize {
+		return nil, NewError(http.StatusRequestEntityTooLarge, "", "bulk payload exceeds %d bytes", MaxBulkPayloadSize)
+	}
+
+	var req BulkRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, BadRequest(ScimTypeInvalidSyntax, "invalid bulk request body")
+	}
+	if !containsSchema(req.Schemas, SchemaBulkRequest) {
+		return nil, BadRequest(ScimTypeInvalidSyntax, "bulk request must use the %s schema", SchemaBulkRequest)
+	}
+	if len(req.Operations) > MaxBulkOperations {
+		return nil, NewError(http.StatusRequestEntityTooLarge, ScimTypeTooMany, "bulk request exceeds %d operations", MaxBulkOperations)
+	}
+
+	for i := range req.Operations {
+		op := &req.Operations[i]
+		op.Method = strings.ToUpper(op.Method)
+		if op.Method == http.MethodPost && op.BulkID == "" {
+			return nil, BadRequest(ScimTypeInvalidSyntax, "bulkId is required for POST operations")
+		}
+	}
+	return &req, nil
+}
+
+var bulkIDReference = regexp.MustCompile(`bulkId:([A-Za-z0-9._~-]+)`)
+
+// ResolveBulkIDs заменяет ссылки bulkId:<id> в пути и данных операции на идентификаторы
+// ресурсов, созданных предыдущими операциями. Возвращает ошибку для неразрешенной ссылки
+func ResolveBulkIDs(op *BulkOperation, created map[string]string) error {
+	var unresolved string
+	replace := func(ref string) string {
+		id, ok := created[bulkIDReference.FindStringSubmatch(ref)[1]]
+		if !ok {
+			unresolved = ref
+			return ref
+		}
+		return id
+	}
+
+	op.Path = bulkIDReference.ReplaceAllStringFunc(op.Path, replace)
+	if len(op.Data) > 0 {
+		op.Data = json.RawMessage(bulkIDReference.ReplaceAllStringFunc(string(op.Data), replace))
+	}
+
+	if unresolved != "" {
+		return NewError(http.StatusConflict, ScimTypeInvalidValue, "unresolved reference %q", unresolved)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// pkg/scim/errors.go
+package scim
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Значения scimType из RFC 7644, раздел 3.12
+const (
+	ScimTypeInvalidFilter = "invalidFilter"
+	ScimTypeTooMany       = "tooMany"
+	ScimTypeUniqueness    = "uniqueness"
+	ScimTypeMutability    = "mutability"
+	ScimTypeInvalidSyntax = "invalidSyntax"
+	ScimTypeInvalidPath   = "invalidPath"
+	ScimTypeNoTarget      = "noTarget"
+	ScimTypeInvalidValue  = "invalidValue"
+)
+
+// Error ошибка протокола SCIM, которая отдается клиенту в формате RFC 7644
+type Error struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+// ErrorResponse тело ответа с ошибкой
+type ErrorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+func (e *Error) Response() ErrorResponse {
+	return ErrorResponse{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(e.Status),
+		ScimType: e.ScimType,
+		Detail:   e.Detail,
+	}
+}
+
+func NewError(status int, scimType, format string, args ...interface{}) *Error {
+	return &Error{Status: status, ScimType: scimType, Detail: fmt.Sprintf(format, args...)}
+}
+
+func BadRequest(scimType, format string, args ...interface{}) *Error {
+	return NewError(http.StatusBadRequest, scimType, format, args...)
+}
+
+func NotFound(resourceType, id string) *Error {
+	return NewError(http.StatusNotFound, "", "%s %s not found", resourceType, id)
+}
+
+func Conflict(format string, args ...interface{}) *Error {
+	return NewError(http.StatusConflict, ScimTypeUniqueness, format, args...)
+}
+
+func PreconditionFailed() *Error {
+	return NewError(http.StatusPreconditionFailed, "", "resource version does not match If-Match")
+}
@@ -0,0 +1,428 @@
+// pkg/scim/filter.go
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Filter выражение фильтра SCIM (RFC 7644, раздел 3.4.2.2)
+type Filter interface {
+	isFilter()
+}
+
+// Comparison сравнение атрибута со значением; для pr значение отсутствует
+type Comparison struct {
+	Attr  string
+	Op    string
+	Value interface{}
+}
+
+type Logical struct {
+	Op    string // and, or
+	Left  Filter
+	Right Filter
+}
+
+type Not struct {
+	Filter Filter
+}
+
+func (*Comparison) isFilter() {}
+func (*Logical) isFilter()    {}
+func (*Not) isFilter()        {}
+
+var comparisonOps = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true, "pr": true,
+}
+
+// ParseFilter разбирает выражение фильтра. Фильтры по значению (emails[type eq "work"])
+// разворачиваются в сравнения вложенных атрибутов (emails.type eq "work")
+func ParseFilter(input string) (Filter, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	f, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, BadRequest(ScimTypeInvalidFilter, "unexpected token %q", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokenLParen, "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenRParen, ")"})
+			i++
+		case r == '[':
+			tokens = append(tokens, token{tokenLBracket, "["})
+			i++
+		case r == ']':
+			tokens = append(tokens, token{tokenRBracket, "]"})
+			i++
+		case r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(runes) {
+				return nil, BadRequest(ScimTypeInvalidFilter, "unterminated string")
+			}
+			var value string
+			if err := json.Unmarshal([]byte(string(runes[i:j+1])), &value); err != nil {
+				return nil, BadRequest(ScimTypeInvalidFilter, "invalid string literal")
+			}
+			tokens = append(tokens, token{tokenString, value})
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune(`()[]"`, runes[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokenWord, string(runes[i:j])})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *filterParser) peek() *token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *filterParser) peekKeyword(keyword string) bool {
+	t := p.peek()
+	return t != nil && t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+func (p *filterParser) expect(kind tokenKind, text string) error {
+	t := p.peek()
+	if t == nil || t.kind != kind {
+		return BadRequest(ScimTypeInvalidFilter, "expected %q", text)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *filterParser) parseOr(prefix string) (Filter, error) {
+	left, err := p.parseAnd(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.pos++
+		right, err := p.parseAnd(prefix)
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd(prefix string) (Filter, error) {
+	left, err := p.parseFactor(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.pos++
+		right, err := p.parseFactor(prefix)
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseFactor(prefix string) (Filter, error) {
+	if p.peekKeyword("not") {
+		p.pos++
+		if err := p.expect(tokenLParen, "("); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseOr(prefix)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRParen, ")"); err != nil {
+			return nil, err
+		}
+		return &Not{Filter: inner}, nil
+	}
+
+	t := p.peek()
+	if t == nil {
+		return nil, BadRequest(ScimTypeInvalidFilter, "unexpected end of filter")
+	}
+
+	if t.kind == tokenLParen {
+		p.pos++
+		inner, err := p.parseOr(prefix)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRParen, ")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+
+	if t.kind != tokenWord {
+		return nil, BadRequest(ScimTypeInvalidFilter, "expected attribute name")
+	}
+	p.pos++
+	attr := prefix + t.text
+
+	// Фильтр по значению: attr[подфильтр]
+	if next := p.peek(); next != nil && next.kind == tokenLBracket {
+		p.pos++
+		inner, err := p.parseOr(attr + ".")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRBracket, "]"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+
+	opToken := p.peek()
+	if opToken == nil || opToken.kind != tokenWord || !comparisonOps[strings.ToLower(opToken.text)] {
+		return nil, BadRequest(ScimTypeInvalidFilter, "expected comparison operator after %q", attr)
+	}
+	p.pos++
+	op := strings.ToLower(opToken.text)
+
+	if op == "pr" {
+		return &Comparison{Attr: attr, Op: op}, nil
+	}
+
+	valueToken := p.peek()
+	if valueToken == nil {
+		return nil, BadRequest(ScimTypeInvalidFilter, "expected value after %q", op)
+	}
+	p.pos++
+
+	value, err := literalValue(valueToken)
+	if err != nil {
+		return nil, err
+	}
+	return &Comparison{Attr: attr, Op: op, Value: value}, nil
+}
+
+func literalValue(t *token) (interface{}, error) {
+	if t.kind == tokenString {
+		return t.text, nil
+	}
+	if t.kind != tokenWord {
+		return nil, BadRequest(ScimTypeInvalidFilter, "invalid comparison value")
+	}
+	switch strings.ToLower(t.text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	var number json.Number
+	if err := json.Unmarshal([]byte(t.text), &number); err != nil {
+		return nil, BadRequest(ScimTypeInvalidFilter, "invalid comparison value %q", t.text)
+	}
+	return number, nil
+}
+
+// AttributeType тип атрибута для трансляции фильтра в SQL
+type AttributeType int
+
+const (
+	AttrString AttributeType = iota
+	AttrBool
+	AttrDateTime
+)
+
+// Column описывает, как атрибут SCIM хранится в БД. Negate инвертирует булево
+// значение (active хранится как disabled), Wrap оборачивает условие, например
+// в подзапрос по таблице связей
+type Column struct {
+	Expr      string
+	Type      AttributeType
+	CaseExact bool
+	Negate    bool
+	Wrap      string
+}
+
+// ColumnMap сопоставление атрибутов (в нижнем регистре) колонкам
+type ColumnMap map[string]Column
+
+// Lookup ищет атрибут без учета регистра и URN-префикса схемы
+func (m ColumnMap) Lookup(attr string, schema string) (Column, bool) {
+	attr = strings.ToLower(attr)
+	attr = strings.TrimPrefix(attr, strings.ToLower(schema)+":")
+	col, ok := m[attr]
+	return col, ok
+}
+
+// ToSQL транслирует фильтр в условие WHERE с параметрами
+func ToSQL(f Filter, columns ColumnMap, schema string) (string, []interface{}, error) {
+	switch node := f.(type) {
+	case *Logical:
+		left, leftArgs, err := ToSQL(node.Left, columns, schema)
+		if err != nil {
+			return "", nil, err
+		}
+		right, rightArgs, err := ToSQL(node.Right, columns, schema)
+		if err != nil {
+			return "", nil, err
+		}
+		return "(" + left + " " + strings.ToUpper(node.Op) + " " + right + ")", append(leftArgs, rightArgs...), nil
+	case *Not:
+		inner, args, err := ToSQL(node.Filter, columns, schema)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + inner + ")", args, nil
+	case *Comparison:
+		col, ok := columns.Lookup(node.Attr, schema)
+		if !ok {
+			return "", nil, BadRequest(ScimTypeInvalidFilter, "filtering by %q is not supported", node.Attr)
+		}
+		cond, args, err := comparisonSQL(node, col)
+		if err != nil {
+			return "", nil, err
+		}
+		if col.Wrap != "" {
+			cond = fmt.Sprintf(col.Wrap, cond)
+		}
+		return cond, args, nil
+	}
+	return "", nil, BadRequest(ScimTypeInvalidFilter, "invalid filter")
+}
+
+var sqlOps = map[string]string{"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<="}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func comparisonSQL(c *Comparison, col Column) (string, []interface{}, error) {
+	if c.Op == "pr" {
+		if col.Type == AttrString {
+			return "(" + col.Expr + " IS NOT NULL AND " + col.Expr + " <> '')", nil, nil
+		}
+		return col.Expr + " IS NOT NULL", nil, nil
+	}
+
+	switch col.Type {
+	case AttrBool:
+		value, ok := c.Value.(bool)
+		if !ok || (c.Op != "eq" && c.Op != "ne") {
+			return "", nil, BadRequest(ScimTypeInvalidFilter, "%q supports only eq and ne with a boolean", c.Attr)
+		}
+		if col.Negate {
+			value = !value
+		}
+		return col.Expr + " " + sqlOps[c.Op] + " ?", []interface{}{value}, nil
+
+	case AttrDateTime:
+		raw, ok := c.Value.(string)
+		value, err := time.Parse(time.RFC3339, raw)
+		if !ok || err != nil || sqlOps[c.Op] == "" {
+			return "", nil, BadRequest(ScimTypeInvalidFilter, "%q requires a comparison with an RFC 3339 timestamp", c.Attr)
+		}
+		return col.Expr + " " + sqlOps[c.Op] + " ?", []interface{}{value}, nil
+	}
+
+	value, ok := c.Value.(string)
+	if !ok {
+		return "", nil, BadRequest(ScimTypeInvalidFilter, "%q requires a string value", c.Attr)
+	}
+
+	expr := col.Expr
+	if !col.CaseExact {
+		expr = "LOWER(" + expr + ")"
+		value = strings.ToLower(value)
+	}
+
+	switch c.Op {
+	case "co":
+		return expr + ` LIKE ? ESCAPE '\'`, []interface{}{"%" + likeEscaper.Replace(value) + "%"}, nil
+	case "sw":
+		return expr + ` LIKE ? ESCAPE '\'`, []interface{}{likeEscaper.Replace(value) + "%"}, nil
+	case "ew":
+		return expr + ` LIKE ? ESCAPE '\'`, []interface{}{"%" + likeEscaper.Replace(value)}, nil
+	}
+	return expr + " " + sqlOps[c.Op] + " ?", []interface{}{value}, nil
+}
+
+// EqualValues собирает значения сравнений attr eq "..." из фильтра вида
+// value eq "a" or value eq "b"; используется для путей PATCH members[value eq "..."]
+func EqualValues(f Filter, attr string) ([]string, bool) {
+	switch node := f.(type) {
+	case *Comparison:
+		value, ok := node.Value.(string)
+		if node.Op != "eq" || !ok || !strings.EqualFold(node.Attr, attr) {
+			return nil, false
+		}
+		return []string{value}, true
+	case *Logical:
+		if node.Op != "or" {
+			return nil, false
+		}
+		left, ok := EqualValues(node.Left, attr)
+		if !ok {
+			return nil, false
+		}
+		right, ok := EqualValues(node.Right, attr)
+		if !ok {
+			return nil, false
+		}
+		return append(left, right...), true
+	}
+	return nil, false
+}
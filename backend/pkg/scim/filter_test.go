@@ -0,0 +1,208 @@
+package scim
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testColumns = ColumnMap{
+	"id":                {Expr: "id::text", CaseExact: true},
+	"username":          {Expr: "username"},
+	"externalid":        {Expr: "external_id", CaseExact: true},
+	"emails":            {Expr: "email"},
+	"emails.value":      {Expr: "email"},
+	"active":            {Expr: "disabled", Type: AttrBool, Negate: true},
+	"meta.lastmodified": {Expr: "updated_at", Type: AttrDateTime},
+	"members.value":     {Expr: "user_id::text", CaseExact: true, Wrap: "id IN (SELECT group_id FROM group_members WHERE %s)"},
+}
+
+func TestFilterToSQL(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		where  string
+		args   []interface{}
+	}{
+		{
+			name:   "eq is case-insensitive",
+			filter: `userName eq "BJensen"`,
+			where:  "LOWER(username) = ?",
+			args:   []interface{}{"bjensen"},
+		},
+		{
+			name:   "case-exact attribute",
+			filter: `externalId eq "AbC"`,
+			where:  "external_id = ?",
+			args:   []interface{}{"AbC"},
+		},
+		{
+			name:   "and binds tighter than or",
+			filter: `userName eq "a" or userName eq "b" and active eq true`,
+			where:  "(LOWER(username) = ? OR (LOWER(username) = ? AND disabled = ?))",
+			args:   []interface{}{"a", "b", false},
+		},
+		{
+			name:   "parentheses override precedence",
+			filter: `(userName eq "a" or userName eq "b") and active eq true`,
+			where:  "((LOWER(username) = ? OR LOWER(username) = ?) AND disabled = ?)",
+			args:   []interface{}{"a", "b", false},
+		},
+		{
+			name:   "operators and keywords are case-insensitive",
+			filter: `userName EQ "a" OR userName Eq "b"`,
+			where:  "(LOWER(username) = ? OR LOWER(username) = ?)",
+			args:   []interface{}{"a", "b"},
+		},
+		{
+			name:   "not",
+			filter: `not (userName sw "adm")`,
+			where:  `NOT (LOWER(username) LIKE ? ESCAPE '\')`,
+			args:   []interface{}{"adm%"},
+		},
+		{
+			name:   "not around a logical expression",
+			filter: `not (active eq false or userName pr)`,
+			where:  `NOT ((disabled = ? OR (username IS NOT NULL AND username <> '')))`,
+			args:   []interface{}{true},
+		},
+		{
+			name:   "value path",
+			filter: `emails[value ew "@example.com"]`,
+			where:  `LOWER(email) LIKE ? ESCAPE '\'`,
+			args:   []interface{}{"%@example.com"},
+		},
+		{
+			name:   "value path with logical sub-filter",
+			filter: `emails[value co "a" or value co "b"]`,
+			where:  `(LOWER(email) LIKE ? ESCAPE '\' OR LOWER(email) LIKE ? ESCAPE '\')`,
+			args:   []interface{}{"%a%", "%b%"},
+		},
+		{
+			name:   "pr on a string",
+			filter: `externalId pr`,
+			where:  "(external_id IS NOT NULL AND external_id <> '')",
+		},
+		{
+			name:   "pr on a non-string",
+			filter: `meta.lastModified pr`,
+			where:  "updated_at IS NOT NULL",
+		},
+		{
+			name:   "schema URN prefix",
+			filter: `urn:ietf:params:scim:schemas:core:2.0:User:userName eq "a"`,
+			where:  "LOWER(username) = ?",
+			args:   []interface{}{"a"},
+		},
+		{
+			name:   "date time",
+			filter: `meta.lastModified gt "2024-01-02T03:04:05Z"`,
+			where:  "updated_at > ?",
+			args:   []interface{}{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		},
+		{
+			name:   "wrapped column",
+			filter: `members.value eq "42"`,
+			where:  "id IN (SELECT group_id FROM group_members WHERE user_id::text = ?)",
+			args:   []interface{}{"42"},
+		},
+		{
+			name:   "like wildcards are escaped",
+			filter: `userName co "50%_\\"`,
+			where:  `LOWER(username) LIKE ? ESCAPE '\'`,
+			args:   []interface{}{`%50\%\_\\%`},
+		},
+		{
+			name:   "values never reach the SQL text",
+			filter: `userName eq "x' OR '1'='1"`,
+			where:  "LOWER(username) = ?",
+			args:   []interface{}{"x' or '1'='1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("ParseFilter(%q): %v", tt.filter, err)
+			}
+			where, args, err := ToSQL(f, testColumns, SchemaUser)
+			if err != nil {
+				t.Fatalf("ToSQL(%q): %v", tt.filter, err)
+			}
+			if where != tt.where {
+				t.Errorf("where = %q, want %q", where, tt.where)
+			}
+			if len(args) != 0 || len(tt.args) != 0 {
+				if !reflect.DeepEqual(args, tt.args) {
+					t.Errorf("args = %#v, want %#v", args, tt.args)
+				}
+			}
+			if strings.Contains(where, "'1'") {
+				t.Errorf("value leaked into SQL: %q", where)
+			}
+		})
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+	}{
+		{"unknown attribute", `password eq "secret"`},
+		{"unknown attribute in value path", `emails[type eq "work"]`},
+		{"unknown attribute inside not", `not (roles pr)`},
+		{"boolean attribute with string", `active eq "yes"`},
+		{"boolean attribute with ordering", `active gt true`},
+		{"date time attribute with bad value", `meta.lastModified gt "yesterday"`},
+		{"date time attribute with co", `meta.lastModified co "2024"`},
+		{"string attribute with number", `userName eq 42`},
+		{"missing operator", `userName "a"`},
+		{"unknown operator", `userName like "a"`},
+		{"missing value", `userName eq`},
+		{"unbalanced parenthesis", `(userName eq "a"`},
+		{"unbalanced bracket", `emails[value eq "a"`},
+		{"not without parenthesis", `not userName eq "a"`},
+		{"unterminated string", `userName eq "a`},
+		{"trailing token", `userName eq "a" "b"`},
+		{"empty filter", ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFilter(tt.filter)
+			if err == nil {
+				_, _, err = ToSQL(f, testColumns, SchemaUser)
+			}
+			if err == nil {
+				t.Fatalf("filter %q accepted, want error", tt.filter)
+			}
+			var scimErr *Error
+			if !errors.As(err, &scimErr) || scimErr.ScimType != ScimTypeInvalidFilter {
+				t.Errorf("error = %v, want invalidFilter", err)
+			}
+		})
+	}
+}
+
+func TestEqualValues(t *testing.T) {
+	f, err := ParseFilter(`value eq "a" or value eq "b" or value eq "c"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, ok := EqualValues(f, "value")
+	if !ok || !reflect.DeepEqual(values, []string{"a", "b", "c"}) {
+		t.Errorf("EqualValues = %v, %v", values, ok)
+	}
+
+	f, err = ParseFilter(`value eq "a" and value eq "b"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := EqualValues(f, "value"); ok {
+		t.Error("EqualValues accepted an and expression")
+	}
+}
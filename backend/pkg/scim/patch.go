@@ -0,0 +1,140 @@
+// pkg/scim/patch.go
+package scim
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Path разобранный путь PATCH: attr[filter].subAttr
+type Path struct {
+	Attr    string // в нижнем регистре, без URN-префикса схемы
+	SubAttr string // в нижнем регистре
+	Filter  Filter
+}
+
+// ParsePatchRequest проверяет схему запроса и нормализует имена операций
+// (некоторые клиенты присылают Add/Replace/Remove с заглавной буквы)
+func ParsePatchRequest(body []byte) (*PatchRequest, error) {
+	var req PatchRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, BadRequest(ScimTypeInvalidSyntax, "invalid PATCH request body")
+	}
+	if !containsSchema(req.Schemas, SchemaPatchOp) {
+		return nil, BadRequest(ScimTypeInvalidSyntax, "PATCH request must use the %s schema", SchemaPatchOp)
+	}
+	if len(req.Operations) == 0 {
+		return nil, BadRequest(ScimTypeInvalidSyntax, "PATCH request has no operations")
+	}
+	for i := range req.Operations {
+		op := strings.ToLower(req.Operations[i].Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return nil, BadRequest(ScimTypeInvalidSyntax, "unsupported PATCH op %q", req.Operations[i].Op)
+		}
+		req.Operations[i].Op = op
+		if op != "remove" && len(req.Operations[i].Value) == 0 {
+			return nil, BadRequest(ScimTypeInvalidValue, "PATCH op %q requires a value", op)
+		}
+	}
+	return &req, nil
+}
+
+// ParsePath разбирает путь атрибута с необязательным фильтром по значению
+func ParsePath(path, schema string) (*Path, error) {
+	path = strings.TrimSpace(path)
+	if strings.HasPrefix(strings.ToLower(path), strings.ToLower(schema)+":") {
+		path = path[len(schema)+1:]
+	}
+
+	result := &Path{}
+	if open := strings.Index(path, "["); open >= 0 {
+		closing := strings.LastIndex(path, "]")
+		if closing < open {
+			return nil, BadRequest(ScimTypeInvalidPath, "invalid path %q", path)
+		}
+		filter, err := ParseFilter(path[open+1 : closing])
+		if err != nil {
+			return nil, BadRequest(ScimTypeInvalidPath, "invalid filter in path %q", path)
+		}
+		result.Attr = strings.ToLower(path[:open])
+		result.Filter = filter
+		result.SubAttr = strings.ToLower(strings.TrimPrefix(path[closing+1:], "."))
+		return result, nil
+	}
+
+	parts := strings.SplitN(path, ".", 2)
+	result.Attr = strings.ToLower(parts[0])
+	if len(parts) == 2 {
+		result.SubAttr = strings.ToLower(parts[1])
+	}
+	if result.Attr == "" {
+		return nil, BadRequest(ScimTypeInvalidPath, "invalid path %q", path)
+	}
+	return result, nil
+}
+
+// StringValue разбирает строковое значение атрибута
+func StringValue(raw json.RawMessage) (string, error) {
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", BadRequest(ScimTypeInvalidValue, "expected a string value")
+	}
+	return value, nil
+}
+
+// BoolValue разбирает булево значение; строки "True"/"False" тоже принимаются,
+// так их присылают некоторые провайдеры
+func BoolValue(raw json.RawMessage) (bool, error) {
+	var value bool
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if parsed, err := strconv.ParseBool(strings.ToLower(s)); err == nil {
+			return parsed, nil
+		}
+	}
+	return false, BadRequest(ScimTypeInvalidValue, "expected a boolean value")
+}
+
+// MemberValues разбирает список участников [{"value": "..."}] или один объект
+func MemberValues(raw json.RawMessage) ([]string, error) {
+	var members []MemberRef
+	if err := json.Unmarshal(raw, &members); err != nil {
+		var member MemberRef
+		if err := json.Unmarshal(raw, &member); err != nil {
+			return nil, BadRequest(ScimTypeInvalidValue, "expected a list of members")
+		}
+		members = []MemberRef{member}
+	}
+	values := make([]string, 0, len(members))
+	for _, m := range members {
+		if m.Value == "" {
+			return nil, BadRequest(ScimTypeInvalidValue, "member value is required")
+		}
+		values = append(values, m.Value)
+	}
+	return values, nil
+}
+
+func containsSchema(schemas []string, schema string) bool {
+	for _, s := range schemas {
+		if strings.EqualFold(s, schema) {
+			return true
+		}
+	}
+	return false
+}
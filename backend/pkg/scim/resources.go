@@ -0,0 +1,213 @@
+// pkg/scim/resources.go
+package scim
+
+import (
+	"fmt"
+	"jiko-auth/internal/models"
+	"strings"
+	"time"
+)
+
+const (
+	SchemaUser          = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup         = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp       = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaBulkRequest   = "urn:ietf:params:scim:api:messages:2.0:BulkRequest"
+	SchemaBulkResponse  = "urn:ietf:params:scim:api:messages:2.0:BulkResponse"
+	SchemaError         = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType  = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	SchemaSchema        = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+)
+
+const (
+	ResourceTypeUser  = "User"
+	ResourceTypeGroup = "Group"
+
+	DefaultCount       = 100
+	MaxResults         = 200
+	MaxBulkOperations  = 100
+	MaxBulkPayloadSize = 1 << 20
+
+	// Scope токена provisioning клиента
+	Scope = "scim"
+
+	emailTypeWork = "work"
+	timeFormat    = time.RFC3339
+)
+
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+	Version      string `json:"version,omitempty"`
+}
+
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// MemberRef ссылка на участника группы или группу пользователя
+type MemberRef struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+	Type    string `json:"type,omitempty"`
+}
+
+type User struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        *Name       `json:"name,omitempty"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Active      *bool       `json:"active,omitempty"`
+	Password    string      `json:"password,omitempty"`
+	Emails      []Email     `json:"emails,omitempty"`
+	Groups      []MemberRef `json:"groups,omitempty"`
+	Meta        *Meta       `json:"meta,omitempty"`
+}
+
+type Group struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	DisplayName string      `json:"displayName"`
+	Members     []MemberRef `json:"members"`
+	Meta        *Meta       `json:"meta,omitempty"`
+}
+
+type ListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+func NewListResponse(resources interface{}, total int64, startIndex, itemsPerPage int) ListResponse {
+	return ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: itemsPerPage,
+		Resources:    resources,
+	}
+}
+
+// Renderer строит представления ресурсов с абсолютными ссылками на базовый URL SCIM
+type Renderer struct {
+	baseURL string
+}
+
+func NewRenderer(baseURL string) *Renderer {
+	return &Renderer{baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+func (r *Renderer) UserLocation(id string) string {
+	return r.baseURL + "/Users/" + id
+}
+
+func (r *Renderer) GroupLocation(id string) string {
+	return r.baseURL + "/Groups/" + id
+}
+
+func (r *Renderer) User(user *models.User, groups []*models.Group) *User {
+	active := !user.Disabled
+	resource := &User{
+		Schemas:     []string{SchemaUser},
+		ID:          user.ID.String(),
+		UserName:    user.Username,
+		DisplayName: user.DisplayName,
+		Active:      &active,
+		Emails:      []Email{{Value: user.Email, Type: emailTypeWork, Primary: true}},
+		Meta: &Meta{
+			ResourceType: ResourceTypeUser,
+			Created:      user.CreatedAt.UTC().Format(timeFormat),
+			LastModified: user.UpdatedAt.UTC().Format(timeFormat),
+			Location:     r.UserLocation(user.ID.String()),
+			Version:      ETag(user.UpdatedAt),
+		},
+	}
+
+	if user.ExternalID != nil {
+		resource.ExternalID = *user.ExternalID
+	}
+	if user.GivenName != "" || user.FamilyName != "" {
+		resource.Name = &Name{
+			Formatted:  strings.TrimSpace(user.GivenName + " " + user.FamilyName),
+			GivenName:  user.GivenName,
+			FamilyName: user.FamilyName,
+		}
+	}
+	for _, group := range groups {
+		resource.Groups = append(resource.Groups, MemberRef{
+			Value:   group.ID.String(),
+			Display: group.DisplayName,
+			Ref:     r.GroupLocation(group.ID.String()),
+		})
+	}
+
+	return resource
+}
+
+func (r *Renderer) Group(group *models.Group) *Group {
+	resource := &Group{
+		Schemas:     []string{SchemaGroup},
+		ID:          group.ID.String(),
+		DisplayName: group.DisplayName,
+		Members:     []MemberRef{},
+		Meta: &Meta{
+			ResourceType: ResourceTypeGroup,
+			Created:      group.CreatedAt.UTC().Format(timeFormat),
+			LastModified: group.UpdatedAt.UTC().Format(timeFormat),
+			Location:     r.GroupLocation(group.ID.String()),
+			Version:      ETag(group.UpdatedAt),
+		},
+	}
+
+	if group.ExternalID != nil {
+		resource.ExternalID = *group.ExternalID
+	}
+	for _, member := range group.Members {
+		resource.Members = append(resource.Members, MemberRef{
+			Value:   member.ID.String(),
+			Display: member.Username,
+			Ref:     r.UserLocation(member.ID.String()),
+			Type:    ResourceTypeUser,
+		})
+	}
+
+	return resource
+}
+
+// ETag слабый тег версии ресурса на основе времени последнего изменения.
+// Используется микросекундная точность, с которой время хранится в PostgreSQL
+func ETag(updatedAt time.Time) string {
+	return fmt.Sprintf(`W/"%x"`, updatedAt.UnixMicro())
+}
+
+// MatchesETag проверяет заголовок If-Match; пустой заголовок и * совпадают с любой версией
+func MatchesETag(ifMatch string, updatedAt time.Time) bool {
+	if ifMatch == "" || ifMatch == "*" {
+		return true
+	}
+	current := ETag(updatedAt)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if strings.TrimSpace(tag) == current {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+// pkg/scim/schemas.go
+package scim
+
+// Описания возможностей сервиса и схем ресурсов (RFC 7643, разделы 5-7)
+
+type supported struct {
+	Supported bool `json:"supported"`
+}
+
+type bulkSupport struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type filterSupport struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type authenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Primary     bool   `json:"primary"`
+}
+
+type ServiceProviderConfig struct {
+	Schemas               []string               `json:"schemas"`
+	Patch                 supported              `json:"patch"`
+	Bulk                  bulkSupport            `json:"bulk"`
+	Filter                filterSupport          `json:"filter"`
+	ChangePassword        supported              `json:"changePassword"`
+	Sort                  supported              `json:"sort"`
+	ETag                  supported              `json:"etag"`
+	AuthenticationSchemes []authenticationScheme `json:"authenticationSchemes"`
+	Meta                  Meta                   `json:"meta"`
+}
+
+func (r *Renderer) ServiceProviderConfig() ServiceProviderConfig {
+	return ServiceProviderConfig{
+		Schemas:        []string{SchemaServiceConfig},
+		Patch:          supported{true},
+		Bulk:           bulkSupport{Supported: true, MaxOperations: MaxBulkOperations, MaxPayloadSize: MaxBulkPayloadSize},
+		Filter:         filterSupport{Supported: true, MaxResults: MaxResults},
+		ChangePassword: supported{false},
+		Sort:           supported{true},
+		ETag:           supported{true},
+		AuthenticationSchemes: []authenticationScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "OAuth Bearer Token",
+			Description: "Bearer token issued to a provisioning client",
+			Primary:     true,
+		}},
+		Meta: Meta{ResourceType: "ServiceProviderConfig", Location: r.baseURL + "/ServiceProviderConfig"},
+	}
+}
+
+type ResourceType struct {
+	Schemas  []string `json:"schemas"`
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Endpoint string   `json:"endpoint"`
+	Schema   string   `json:"schema"`
+	Meta     Meta     `json:"meta"`
+}
+
+func (r *Renderer) ResourceTypes() []ResourceType {
+	return []ResourceType{
+		{
+			Schemas:  []string{SchemaResourceType},
+			ID:       ResourceTypeUser,
+			Name:     ResourceTypeUser,
+			Endpoint: "/Users",
+			Schema:   SchemaUser,
+			Meta:     Meta{ResourceType: "ResourceType", Location: r.baseURL + "/ResourceTypes/" + ResourceTypeUser},
+		},
+		{
+			Schemas:  []string{SchemaResourceType},
+			ID:       ResourceTypeGroup,
+			Name:     ResourceTypeGroup,
+			Endpoint: "/Groups",
+			Schema:   SchemaGroup,
+			Meta:     Meta{ResourceType: "ResourceType", Location: r.baseURL + "/ResourceTypes/" + ResourceTypeGroup},
+		},
+	}
+}
+
+type Attribute struct {
+	Name          string      `json:"name"`
+	Type          string      `json:"type"`
+	MultiValued   bool        `json:"multiValued"`
+	Required      bool        `json:"required"`
+	CaseExact     bool        `json:"caseExact"`
+	Mutability    string      `json:"mutability"`
+	Returned      string      `json:"returned"`
+	Uniqueness    string      `json:"uniqueness"`
+	SubAttributes []Attribute `json:"subAttributes,omitempty"`
+}
+
+type Schema struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Attributes  []Attribute `json:"attributes"`
+	Meta        Meta        `json:"meta"`
+}
+
+func attribute(name, typ, mutability string, required bool, subAttributes ...Attribute) Attribute {
+	return Attribute{
+		Name:          name,
+		Type:          typ,
+		Required:      required,
+		Mutability:    mutability,
+		Returned:      "default",
+		Uniqueness:    "none",
+		SubAttributes: subAttributes,
+	}
+}
+
+func multiValued(a Attribute) Attribute {
+	a.MultiValued = true
+	return a
+}
+
+func unique(a Attribute) Attribute {
+	a.Uniqueness = "server"
+	return a
+}
+
+func (r *Renderer) Schemas() []Schema {
+	password := attribute("password", "string", "writeOnly", false)
+	password.Returned = "never"
+
+	user := Schema{
+		Schemas:     []string{SchemaSchema},
+		ID:          SchemaUser,
+		Name:        ResourceTypeUser,
+		Description: "User Account",
+		Attributes: []Attribute{
+			unique(attribute("userName", "string", "readWrite", true)),
+			attribute("externalId", "string", "readWrite", false),
+			attribute("name", "complex", "readWrite", false,
+				attribute("formatted", "string", "readOnly", false),
+				attribute("givenName", "string", "readWrite", false),
+				attribute("familyName", "string", "readWrite", false),
+			),
+			attribute("displayName", "string", "readWrite", false),
+			attribute("active", "boolean", "readWrite", false),
+			password,
+			multiValued(attribute("emails", "complex", "readWrite", true,
+				attribute("value", "string", "readWrite", true),
+				attribute("type", "string", "readWrite", false),
+				attribute("primary", "boolean", "readWrite", false),
+			)),
+			multiValued(attribute("groups", "complex", "readOnly", false,
+				attribute("value", "string", "readOnly", false),
+				attribute("$ref", "reference", "readOnly", false),
+				attribute("display", "string", "readOnly", false),
+			)),
+		},
+		Meta: Meta{ResourceType: "Schema", Location: r.baseURL + "/Schemas/" + SchemaUser},
+	}
+
+	group := Schema{
+		Schemas:     []string{SchemaSchema},
+		ID:          SchemaGroup,
+		Name:        ResourceTypeGroup,
+		Description: "Group",
+		Attributes: []Attribute{
+			unique(attribute("displayName", "string", "readWrite", true)),
+			attribute("externalId", "string", "readWrite", false),
+			multiValued(attribute("members", "complex", "readWrite", false,
+				attribute("value", "string", "immutable", false),
+				attribute("$ref", "reference", "immutable", false),
+				attribute("display", "string", "readOnly", false),
+				attribute("type", "string", "immutable", false),
+			)),
+		},
+		Meta: Meta{ResourceType: "Schema", Location: r.baseURL + "/Schemas/" + SchemaGroup},
+	}
+
+	return []Schema{user, group}
+}
@@ -1,76 +1,66 @@
 package services
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"jiko-auth/internal/models"
-	"net/http"
-	"strings"
+	"jiko-auth/pkg/geoip"
+	"net/netip"
 )
 
 // GeoLocationService сервис для определения местоположения по IP
 type GeoLocationService struct {
-	apiKey string
+	providers []geoip.Provider
+	cache     *geoip.Cache
 }
 
-// NewGeoLocationService создает новый сервис геолокации
-func NewGeoLocationService(apiKey string) *GeoLocationService {
-	return &GeoLocationService{apiKey: apiKey}
+// NewGeoLocationService создает новый сервис геолокации. Провайдеры опрашиваются по порядку,
+// пока один из них не найдет адрес. Без провайдеров местоположение остается пустым
+func NewGeoLocationService(cache *geoip.Cache, providers ...geoip.Provider) *GeoLocationService {
+	return &GeoLocationService{providers: providers, cache: cache}
 }
 
-// IPApiResponse ответ от сервиса ipapi.co
-type IPApiResponse struct {
-	IP          string  `json:"ip"`
-	City        string  `json:"city"`
-	Region      string  `json:"region"`
-	CountryName string  `json:"country_name"`
-	CountryCode string  `json:"country_code"`
-	Latitude    float64 `json:"latitude"`
-	Longitude   float64 `json:"longitude"`
-	Timezone    string  `json:"timezone"`
-}
-
-// GetLocationByIP определяет местоположение по IP-адресу
-func (g *GeoLocationService) GetLocationByIP(ip string) (models.Location, error) {
-	location := models.Location{}
-
-	// Для локальных IP возвращаем Unknown
-	if ip == "127.0.0.1" || ip == "::1" || strings.HasPrefix(ip, "192.168.") || strings.HasPrefix(ip, "10.") {
-		location.City = "Unknown"
-		location.Country = "Local Network"
-		return location, nil
+// GetLocationByIP определяет местоположение по IP-адресу. Адрес, которого нет ни в одном
+// провайдере, возвращается с пустым местоположением без ошибки
+func (g *GeoLocationService) GetLocationByIP(ctx context.Context, ip string) (models.Location, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return models.Location{}, fmt.Errorf("некорректный IP-адрес %q", ip)
 	}
+	addr = addr.Unmap().WithZone("")
 
-	url := fmt.Sprintf("http://ipapi.co/%s/json/", ip)
-	if g.apiKey != "" {
-		url += "?key=" + g.apiKey
+	// Для локальных IP возвращаем Unknown
+	if geoip.IsPrivate(addr) {
+		return models.Location{City: "Unknown", Country: "Local Network"}, nil
 	}
 
-	resp, err := http.Get(url)
-	if err != nil {
-		return location, fmt.Errorf("ошибка запроса к API геолокации: %v", err)
+	if location, ok := g.cache.Get(addr); ok {
+		return location, nil
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return location, fmt.Errorf("ошибка чтения ответа: %v", err)
+	var lastErr error
+	for _, provider := range g.providers {
+		location, err := provider.Lookup(ctx, addr)
+		if errors.Is(err, geoip.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		g.cache.Add(addr, location)
+		return location, nil
 	}
-
-	var apiResponse IPApiResponse
-	err = json.Unmarshal(body, &apiResponse)
-	if err != nil {
-		return location, fmt.Errorf("ошибка парсинга JSON: %v", err)
+	if lastErr != nil {
+		return models.Location{}, lastErr
 	}
 
-	location.City = apiResponse.City
-	location.Country = apiResponse.CountryName
-	location.CountryCode = apiResponse.CountryCode
-	location.Region = apiResponse.Region
-	location.Latitude = apiResponse.Latitude
-	location.Longitude = apiResponse.Longitude
-	location.Timezone = apiResponse.Timezone
+	g.cache.Add(addr, models.Location{})
+	return models.Location{}, nil
+}
 
-	return location, nil
+// Purge сбрасывает кеш, например после обновления базы геолокации
+func (g *GeoLocationService) Purge() {
+	g.cache.Purge()
 }
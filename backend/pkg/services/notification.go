@@ -3,6 +3,7 @@ package services
 import (
 	"fmt"
 	"jiko-auth/internal/models"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -24,7 +25,7 @@ func (s *NotificationService) CreateLoginNotification(attempt *models.LoginAttem
 	}
 
 	message := fmt.Sprintf(
-		"Совершён вход в ваш аккаунт %s\n\n"+
+		"Совершён вход в ваш аккаунт %s с нового устройства\n\n"+
 			"Дата входа: %s\n"+
 			"Устройство: %s\n"+
 			"Браузер: %s\n"+
@@ -41,7 +42,7 @@ func (s *NotificationService) CreateLoginNotification(attempt *models.LoginAttem
 		ID:             uuid.New(),
 		UserID:         user.ID,
 		LoginAttemptID: attempt.ID,
-		Title:          "Новый вход в ваш аккаунт",
+		Title:          "Вход с нового устройства",
 		Message:        message,
 		Type:           "login",
 		SentAt:         time.Now(),
@@ -50,3 +51,138 @@ func (s *NotificationService) CreateLoginNotification(attempt *models.LoginAttem
 		UpdatedAt:      time.Now(),
 	}
 }
+
+// suspiciousSignalDescriptions описания признаков оценки риска входа
+var suspiciousSignalDescriptions = map[string]string{
+	"new_device":        "вход с нового устройства или браузера",
+	"new_country":       "вход из новой страны",
+	"impossible_travel": "слишком быстрое перемещение с места прошлого входа",
+	"tor_exit_node":     "вход через сеть Tor",
+	"bad_ip":            "IP адрес из списка известных вредоносных",
+	"recent_failures":   "незадолго до входа были неудачные попытки",
+}
+
+func (s *NotificationService) CreateSuspiciousLoginNotification(attempt *models.LoginAttempt, user *models.User, signals []string) *models.SecurityNotification {
+	parser := NewUserAgentParser()
+	browserName := parser.GetFriendlyBrowserName(attempt.DeviceInfo)
+
+	locationInfo := attempt.GeoLocation.City
+	if locationInfo == "" {
+		locationInfo = "Местоположение неизвестно"
+	}
+
+	reasons := make([]string, 0, len(signals))
+	for _, signal := range signals {
+		if description, ok := suspiciousSignalDescriptions[signal]; ok {
+			reasons = append(reasons, "— "+description)
+		}
+	}
+
+	message := fmt.Sprintf(
+		"Совершён подозрительный вход в ваш аккаунт %s\n\n"+
+			"Дата входа: %s\n"+
+			"IP адрес: %s\n"+
+			"Браузер: %s\n"+
+			"Местоположение: %s\n\n"+
+			"Причины:\n%s\n\n"+
+			"Если это были не вы, срочно смените пароль и завершите этот сеанс.",
+		user.Email,
+		attempt.Timestamp.Format("2 January 2006 в 15:04"),
+		attempt.IPAddress,
+		browserName,
+		locationInfo,
+		strings.Join(reasons, "\n"),
+	)
+
+	return &models.SecurityNotification{
+		ID:             uuid.New(),
+		UserID:         user.ID,
+		LoginAttemptID: attempt.ID,
+		Title:          "Подозрительный вход в ваш аккаунт",
+		Message:        message,
+		Type:           "suspicious",
+		SentAt:         time.Now(),
+		Read:           false,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+}
+
+func (s *NotificationService) CreateClientSecretRotatedNotification(client *models.OAuthClient, user *models.User) *models.SecurityNotification {
+	graceInfo := "немедленно"
+	if client.PreviousSecretExpiresAt != nil {
+		graceInfo = client.PreviousSecretExpiresAt.Format("2 January 2006 в 15:04")
+	}
+
+	message := fmt.Sprintf(
+		"Секрет приложения «%s» был заменен\n\n"+
+			"Дата ротации: %s\n"+
+			"Предыдущий секрет перестанет действовать: %s\n\n"+
+			"Если вы не выполняли ротацию, срочно проверьте доступ к вашему аккаунту.",
+		client.Name,
+		time.Now().Format("2 January 2006 в 15:04"),
+		graceInfo,
+	)
+
+	return &models.SecurityNotification{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Title:     "Секрет приложения изменен",
+		Message:   message,
+		Type:      "client_secret_rotated",
+		SentAt:    time.Now(),
+		Read:      false,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+}
+
+func (s *NotificationService) CreateRecoveryCodeUsedNotification(user *models.User, remaining int64, ipAddress string) *models.SecurityNotification {
+	message := fmt.Sprintf(
+		"Для входа в ваш аккаунт %s использован код восстановления\n\n"+
+			"Дата входа: %s\n"+
+			"IP адрес: %s\n"+
+			"Осталось кодов: %d\n\n"+
+			"Если это были не вы, срочно смените пароль и создайте новые коды восстановления.",
+		user.Email,
+		time.Now().Format("2 January 2006 в 15:04"),
+		ipAddress,
+		remaining,
+	)
+
+	return &models.SecurityNotification{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Title:     "Использован код восстановления",
+		Message:   message,
+		Type:      "recovery_code_used",
+		SentAt:    time.Now(),
+		Read:      false,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+}
+
+func (s *NotificationService) CreatePasswordChangedNotification(user *models.User, ipAddress string) *models.SecurityNotification {
+	message := fmt.Sprintf(
+		"Пароль вашего аккаунта %s был изменен\n\n"+
+			"Дата изменения: %s\n"+
+			"IP адрес: %s\n\n"+
+			"Сеансы входа на других устройствах завершены. Если это были не вы, срочно восстановите доступ к аккаунту и обратитесь в поддержку.",
+		user.Email,
+		time.Now().Format("2 January 2006 в 15:04"),
+		ipAddress,
+	)
+
+	return &models.SecurityNotification{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Title:     "Пароль изменен",
+		Message:   message,
+		Type:      "password_changed",
+		SentAt:    time.Now(),
+		Read:      false,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,57 @@
+// pkg/strength/dictionary.go
+package strength
+
+// commonPasswords самые частые пароли и их основы из публичных утечек, по убыванию частоты.
+// Ранг слова - его позиция в списке, он же число попыток до него в словарной атаке
+var commonPasswords = []string{
+	"password", "123456", "12345678", "qwerty", "123456789", "12345", "1234", "111111",
+	"1234567", "dragon", "123123", "baseball", "abc123", "football", "monkey", "letmein",
+	"shadow", "master", "696969", "mustang", "666666", "qwertyuiop", "123321", "1234567890",
+	"pussy", "superman", "654321", "1qaz2wsx", "7777777", "fuckyou", "qazwsx", "jordan",
+	"jennifer", "123qwe", "121212", "killer", "trustno1", "hunter", "harley", "zxcvbnm",
+	"asdfgh", "buster", "andrew", "batman", "soccer", "tigger", "charlie", "robert",
+	"thomas", "hockey", "ranger", "daniel", "starwars", "klaster", "112233", "george",
+	"computer", "michelle", "jessica", "pepper", "zxcvbn", "555555", "11111111", "131313",
+	"freedom", "777777", "pass", "maggie", "159753", "aaaaaa", "ginger", "princess",
+	"joshua", "cheese", "amanda", "summer", "love", "ashley", "nicole", "chelsea",
+	"biteme", "matthew", "access", "yankees", "987654321", "dallas", "austin", "thunder",
+	"taylor", "matrix", "minecraft", "william", "corvette", "hello", "martin", "heather",
+	"secret", "merlin", "diamond", "1234qwer", "gfhjkm", "hammer", "silver", "222222",
+	"88888888", "anthony", "justin", "test", "bailey", "q1w2e3r4t5", "patrick", "internet",
+	"scooter", "orange", "11111", "golfer", "cookie", "richard", "samantha", "bigdog",
+	"guitar", "jackson", "whatever", "mickey", "chicken", "sparky", "snoopy", "maverick",
+	"phoenix", "camaro", "peanut", "morgan", "welcome", "falcon", "cowboy", "ferrari",
+	"samsung", "andrea", "smokey", "steelers", "joseph", "mercedes", "dakota", "arsenal",
+	"eagles", "melissa", "boomer", "booboo", "spider", "nascar", "monster", "tigers",
+	"yellow", "xxxxxx", "123123123", "gateway", "marina", "diablo", "bulldog", "qwer1234",
+	"compaq", "purple", "hardcore", "banana", "junior", "hannah", "123654", "porsche",
+	"lakers", "iceman", "money", "cowboys", "987654", "london", "tennis", "999999",
+	"ncc1701", "coffee", "scooby", "0000", "miller", "boston", "q1w2e3r4", "brandon",
+	"yamaha", "chester", "mother", "forever", "johnny", "edward", "333333", "oliver",
+	"redsox", "player", "nikita", "knight", "fender", "barney", "midnight", "please",
+	"brandy", "chicago", "badboy", "slayer", "rangers", "charles", "angel", "flower",
+	"bigdaddy", "rabbit", "wizard", "jasper", "enter", "rachel", "chris", "steven",
+	"winner", "adidas", "victoria", "natasha", "1q2w3e4r", "jasmine", "winter", "prince",
+	"panties", "marine", "ghbdtn", "fishing", "cocacola", "casper", "james", "232323",
+	"raiders", "888888", "marlboro", "gandalf", "asdfasdf", "crystal", "87654321", "12344321",
+	"golden", "8675309", "admin", "administrator", "root", "toor", "changeme", "default",
+	"guest", "login", "passw0rd", "p@ssw0rd", "password1", "qwerty123", "iloveyou", "sunshine",
+	"football1", "baseball1", "princess1", "abc123456", "letmein1", "welcome1", "monkey1", "dragon1",
+	"qwe123", "zaq12wsx", "1qazxsw2", "azerty", "qwertz", "asdf", "zxcv", "user",
+	"spring", "autumn", "fall", "january", "february", "march", "april", "may",
+	"june", "july", "august", "september", "october", "november", "december", "monday",
+	"friday", "sunday", "company", "office", "server", "system", "security", "private",
+	"public", "network", "service", "support", "manager", "account", "database", "backup",
+	"oracle", "google", "facebook", "linkedin", "twitter", "yahoo", "hotmail", "gmail",
+	"apple", "microsoft", "windows", "linux", "ubuntu", "jiko", "auth", "token",
+}
+
+var dictionary = func() map[string]int {
+	ranks := make(map[string]int, len(commonPasswords))
+	for i, word := range commonPasswords {
+		if _, ok := ranks[word]; !ok {
+			ranks[word] = i + 1
+		}
+	}
+	return ranks
+}()
@@ -0,0 +1,428 @@
+// pkg/strength/strength.go
+package strength
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Оценка стойкости пароля в духе zxcvbn: пароль раскладывается на шаблоны (словарные слова,
+// последовательности, повторы, ряды клавиатуры, годы), для каждого оценивается число попыток
+// подбора, а итог берется по самому дешевому для атакующего разбиению
+
+// maxAnalyzedLength символы сверх этой длины не анализируются, они только усиливают пароль
+const maxAnalyzedLength = 100
+
+const (
+	bruteforceCardinality      = 10
+	minSubmatchGuessesSingle   = 10
+	minSubmatchGuessesMulti    = 50
+	minGuessesBeforeGrowingSeq = 10000
+	minYearSpace               = 20
+	keyboardStartingPositions  = 94
+	keyboardAverageDegree      = 4.6
+)
+
+// Result оценка пароля: ожидаемое число попыток подбора и балл от 0 (угадывается сразу) до 4
+type Result struct {
+	Guesses float64
+	Score   int
+}
+
+// Estimate оценивает пароль. userInputs - имя пользователя, email и другие сведения о
+// владельце, которые атакующий попробует в первую очередь
+func Estimate(password string, userInputs ...string) Result {
+	runes := []rune(password)
+	if len(runes) > maxAnalyzedLength {
+		runes = runes[:maxAnalyzedLength]
+	}
+	if len(runes) == 0 {
+		return Result{Guesses: 1, Score: 0}
+	}
+
+	inputs := make(map[string]int)
+	for _, input := range userInputs {
+		for _, part := range strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+			return r == '@' || r == '.' || r == '_' || r == '-' || r == '+' || unicode.IsSpace(r)
+		}) {
+			if len([]rune(part)) >= 3 {
+				inputs[part] = 1
+			}
+		}
+		if lower := strings.ToLower(input); len([]rune(lower)) >= 3 {
+			inputs[lower] = 1
+		}
+	}
+
+	e := &estimator{inputs: inputs, year: time.Now().Year(), cache: make(map[string]float64)}
+	guesses := e.guesses(runes)
+	return Result{Guesses: guesses, Score: score(guesses)}
+}
+
+func score(guesses float64) int {
+	const delta = 5
+	switch {
+	case guesses < 1e3+delta:
+		return 0
+	case guesses < 1e6+delta:
+		return 1
+	case guesses < 1e8+delta:
+		return 2
+	case guesses < 1e10+delta:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// match шаблон, покрывающий руны [i, j]
+type match struct {
+	i, j    int
+	guesses float64
+}
+
+type estimator struct {
+	inputs map[string]int
+	year   int
+	cache  map[string]float64
+}
+
+// guesses минимальное по всем разбиениям число попыток: l! * П(попыток шаблонов) + D^(l-1),
+// где l - число шаблонов в разбиении
+func (e *estimator) guesses(runes []rune) float64 {
+	key := string(runes)
+	if cached, ok := e.cache[key]; ok {
+		return cached
+	}
+
+	n := len(runes)
+	byEnd := make([][]match, n)
+	for _, m := range e.matches(runes) {
+		byEnd[m.j] = append(byEnd[m.j], m)
+	}
+	// Перебор любого фрагмента по символам
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			byEnd[j] = append(byEnd[j], match{i: i, j: j, guesses: bruteforceGuesses(j - i + 1)})
+		}
+	}
+
+	// best[k][p] - минимальное произведение попыток k шаблонов, покрывающих первые p рун
+	best := make([][]float64, n+1)
+	for k := range best {
+		best[k] = make([]float64, n+1)
+		for p := range best[k] {
+			best[k][p] = math.Inf(1)
+		}
+	}
+	best[0][0] = 1
+
+	for end := 0; end < n; end++ {
+		for _, m := range byEnd[end] {
+			for k := 1; k <= m.i+1; k++ {
+				if prev := best[k-1][m.i]; !math.IsInf(prev, 1) {
+					if candidate := prev * m.guesses; candidate < best[k][end+1] {
+						best[k][end+1] = candidate
+					}
+				}
+			}
+		}
+	}
+
+	result := math.Inf(1)
+	factorial := 1.0
+	for k := 1; k <= n; k++ {
+		factorial *= float64(k)
+		if math.IsInf(best[k][n], 1) {
+			continue
+		}
+		total := factorial*best[k][n] + math.Pow(minGuessesBeforeGrowingSeq, float64(k-1))
+		if total < result {
+			result = total
+		}
+	}
+
+	e.cache[key] = result
+	return result
+}
+
+func (e *estimator) matches(runes []rune) []match {
+	var matches []match
+	matches = append(matches, e.dictionaryMatches(runes)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, e.repeatMatches(runes)...)
+	matches = append(matches, keyboardMatches(runes)...)
+	matches = append(matches, e.yearMatches(runes)...)
+
+	for k := range matches {
+		minimum := float64(minSubmatchGuessesMulti)
+		if matches[k].i == matches[k].j {
+			minimum = minSubmatchGuessesSingle
+		}
+		matches[k].guesses = math.Max(matches[k].guesses, minimum)
+	}
+	return matches
+}
+
+func bruteforceGuesses(length int) float64 {
+	guesses := math.Pow(bruteforceCardinality, float64(length))
+	minimum := float64(minSubmatchGuessesMulti + 1)
+	if length == 1 {
+		minimum = minSubmatchGuessesSingle + 1
+	}
+	return math.Max(guesses, minimum)
+}
+
+// leetSubstitutions частые замены букв цифрами и символами
+var leetSubstitutions = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+// dictionaryMatches слова из словаря частых паролей и сведений о владельце, в том числе
+// записанные задом наперед и с заменами символов
+func (e *estimator) dictionaryMatches(runes []rune) []match {
+	lower := []rune(strings.ToLower(string(runes)))
+	var matches []match
+
+	for i := 0; i < len(lower); i++ {
+		for j := i + 2; j < len(lower); j++ {
+			word := string(lower[i : j+1])
+			variations := uppercaseVariations(runes[i : j+1])
+
+			if rank, ok := e.rank(word); ok {
+				matches = append(matches, match{i: i, j: j, guesses: float64(rank) * variations})
+			}
+			if rank, ok := e.rank(reverse(word)); ok {
+				matches = append(matches, match{i: i, j: j, guesses: float64(rank) * variations * 2})
+			}
+
+			unleeted := []rune(word)
+			substituted := 0
+			for k, r := range unleeted {
+				if plain, ok := leetSubstitutions[r]; ok {
+					unleeted[k] = plain
+					substituted++
+				}
+			}
+			if substituted > 0 {
+				if rank, ok := e.rank(string(unleeted)); ok {
+					matches = append(matches, match{i: i, j: j, guesses: float64(rank) * variations * float64(2*substituted)})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+func (e *estimator) rank(word string) (int, bool) {
+	if rank, ok := e.inputs[word]; ok {
+		return rank, true
+	}
+	rank, ok := dictionary[word]
+	return rank, ok
+}
+
+// uppercaseVariations сколько вариантов регистра атакующему нужно перебрать для слова
+func uppercaseVariations(word []rune) float64 {
+	var upper, lower int
+	for _, r := range word {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	if upper == 0 || lower == 0 {
+		if upper == 0 {
+			return 1
+		}
+		return 2
+	}
+	// Заглавная только первая или только последняя буква
+	if upper == 1 && (unicode.IsUpper(word[0]) || unicode.IsUpper(word[len(word)-1])) {
+		return 2
+	}
+
+	variations := 0.0
+	for k := 1; k <= min(upper, lower); k++ {
+		variations += binomial(upper+lower, k)
+	}
+	return variations
+}
+
+// sequenceMatches последовательности с постоянным шагом: abcd, 2468, zyx
+func sequenceMatches(runes []rune) []match {
+	var matches []match
+	for i := 0; i+2 < len(runes); {
+		delta := runes[i+1] - runes[i]
+		j := i + 1
+		for j+1 < len(runes) && runes[j+1]-runes[j] == delta {
+			j++
+		}
+
+		if j-i >= 2 && delta != 0 && abs(delta) <= 5 {
+			first := runes[i]
+			var base float64
+			switch {
+			case strings.ContainsRune("aAzZ019", first):
+				base = 4
+			case unicode.IsDigit(first):
+				base = 10
+			default:
+				base = 26
+			}
+			if delta < 0 {
+				base *= 2
+			}
+			matches = append(matches, match{i: i, j: j, guesses: base * float64(j-i+1)})
+		}
+
+		if j == i+1 {
+			i++
+		} else {
+			i = j
+		}
+	}
+	return matches
+}
+
+// repeatMatches повторы символа или фрагмента: aaaa, abcabc
+func (e *estimator) repeatMatches(runes []rune) []match {
+	var matches []match
+	for i := 0; i < len(runes); i++ {
+		for unit := 1; i+2*unit <= len(runes); unit++ {
+			count := 1
+			for i+(count+1)*unit <= len(runes) && equalRunes(runes[i:i+unit], runes[i+count*unit:i+(count+1)*unit]) {
+				count++
+			}
+			if count < 2 || (unit == 1 && count < 3) {
+				continue
+			}
+			base := e.guesses(runes[i : i+unit])
+			matches = append(matches, match{i: i, j: i + count*unit - 1, guesses: base * float64(count)})
+		}
+	}
+	return matches
+}
+
+var keyboardRows = []string{
+	"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./",
+}
+
+var keyboardShiftedRows = []string{
+	"~!@#$%^&*()_+", "QWERTYUIOP{}|", "ASDFGHJKL:\"", "ZXCVBNM<>?",
+}
+
+// keyboardMatches соседние клавиши одного ряда: qwerty, asdf, 7890
+func keyboardMatches(runes []rune) []match {
+	var matches []match
+	for i := 0; i+2 < len(runes); {
+		row, pos, firstShifted := keyPosition(runes[i])
+		j := i
+		direction := 0
+		shifted := 0
+		if firstShifted {
+			shifted++
+		}
+		for row >= 0 && j+1 < len(runes) {
+			nextRow, nextPos, nextShifted := keyPosition(runes[j+1])
+			step := nextPos - pos
+			if nextRow != row || (step != 1 && step != -1) || (direction != 0 && step != direction) {
+				break
+			}
+			direction = step
+			pos = nextPos
+			if nextShifted {
+				shifted++
+			}
+			j++
+		}
+
+		if j-i >= 2 {
+			length := float64(j - i + 1)
+			guesses := keyboardStartingPositions * keyboardAverageDegree * length
+			if shifted > 0 {
+				guesses *= 2
+			}
+			matches = append(matches, match{i: i, j: j, guesses: guesses})
+			i = j
+		} else {
+			i++
+		}
+	}
+	return matches
+}
+
+func keyPosition(r rune) (int, int, bool) {
+	for row, keys := range keyboardRows {
+		if pos := strings.IndexRune(keys, r); pos >= 0 {
+			return row, pos, false
+		}
+	}
+	for row, keys := range keyboardShiftedRows {
+		if pos := strings.IndexRune(keys, r); pos >= 0 {
+			return row, pos, true
+		}
+	}
+	return -1, -1, false
+}
+
+// yearMatches годы 1900-2099: их легко угадать по дате рождения или текущему году
+func (e *estimator) yearMatches(runes []rune) []match {
+	var matches []match
+	for i := 0; i+3 < len(runes); i++ {
+		year := 0
+		valid := true
+		for _, r := range runes[i : i+4] {
+			if r < '0' || r > '9' {
+				valid = false
+				break
+			}
+			year = year*10 + int(r-'0')
+		}
+		if !valid || year < 1900 || year > 2099 {
+			continue
+		}
+		matches = append(matches, match{i: i, j: i + 3, guesses: math.Max(math.Abs(float64(year-e.year)), minYearSpace)})
+	}
+	return matches
+}
+
+func equalRunes(a, b []rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func abs(r rune) rune {
+	if r < 0 {
+		return -r
+	}
+	return r
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
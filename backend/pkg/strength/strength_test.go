@@ -0,0 +1,110 @@
+package strength
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEstimateScores(t *testing.T) {
+	userInputs := []string{"alice.smith@example.com"}
+	tests := []struct {
+		password   string
+		withInputs bool
+		score      int
+	}{
+		// Словарь, в том числе с регистром, заменами и задом наперед
+		{"password", false, 0},
+		{"PASSWORD", false, 0},
+		{"pAsSwOrD", false, 0},
+		{"p@ssw0rd", false, 0},
+		{"drowssap", false, 0},
+		{"Password1", false, 0},
+		{"iloveyou", false, 0},
+		{"trustno1", false, 0},
+		{"dragon123", false, 1},
+		{"letmein!", false, 1},
+		// Последовательности, ряды клавиатуры и повторы
+		{"abcdef", false, 0},
+		{"zyxwvu", false, 0},
+		{"2468", false, 0},
+		{"1234567890", false, 0},
+		{"qwertyuiop", false, 0},
+		{"zxcvbnm,./", false, 1},
+		{"!@#$%^", false, 1},
+		{"aaaaaa", false, 0},
+		{"abcabcabc", false, 0},
+		{"19841984", false, 0},
+		// Сведения о владельце угадываются первыми
+		{"alicesmith", false, 3},
+		{"alicesmith", true, 1},
+		{"alice", true, 0},
+		// Случайные строки
+		{"xk9qmz", false, 1},
+		{"kE9#vL2q", false, 2},
+		{"mp4!Rg7zWq", false, 3},
+		{"Tr0ub4dor&3", false, 4},
+		{"jwi8Ej#kq92!Lmz", false, 4},
+		{"correct horse battery staple", false, 4},
+	}
+	for _, tt := range tests {
+		var inputs []string
+		if tt.withInputs {
+			inputs = userInputs
+		}
+		if got := Estimate(tt.password, inputs...); got.Score != tt.score {
+			t.Errorf("Estimate(%q, %v).Score = %d (%.3g guesses), want %d", tt.password, inputs, got.Score, got.Guesses, tt.score)
+		}
+	}
+}
+
+func TestEstimateGuesses(t *testing.T) {
+	tests := []struct {
+		password string
+		guesses  float64
+	}{
+		{"", 1},
+		// Одиночный шаблон: его попытки плюс D^0 = 1. Первое слово словаря поднимается
+		// до минимума для шаблона из нескольких символов
+		{"password", minSubmatchGuessesMulti + 1},
+		// Перебор: 10^длина
+		{"xk9qmz", 1e6 + 1},
+	}
+	for _, tt := range tests {
+		if got := Estimate(tt.password).Guesses; got != tt.guesses {
+			t.Errorf("Estimate(%q).Guesses = %g, want %g", tt.password, got, tt.guesses)
+		}
+	}
+}
+
+func TestEstimateLongPassword(t *testing.T) {
+	// Символы сверх maxAnalyzedLength не анализируются
+	long := Estimate(strings.Repeat("a", 10*maxAnalyzedLength))
+	capped := Estimate(strings.Repeat("a", maxAnalyzedLength))
+	if long != capped {
+		t.Errorf("Estimate of a long password = %+v, want %+v", long, capped)
+	}
+	if math.IsInf(long.Guesses, 0) || math.IsNaN(long.Guesses) {
+		t.Errorf("Estimate of a long password = %+v", long)
+	}
+}
+
+func TestScoreThresholds(t *testing.T) {
+	tests := []struct {
+		guesses float64
+		score   int
+	}{
+		{1, 0},
+		{1e3 + 4, 0},
+		{1e3 + 5, 1},
+		{1e6 + 5, 2},
+		{1e8 + 5, 3},
+		{1e10 + 4, 3},
+		{1e10 + 5, 4},
+	}
+	for _, tt := range tests {
+		if got := score(tt.guesses); got != tt.score {
+			t.Errorf("score(%g) = %d, want %d", tt.guesses, got, tt.score)
+		}
+	}
+}
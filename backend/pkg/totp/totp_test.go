@@ -0,0 +1,120 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret ключ SHA1 из приложения B RFC 6238
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+// Векторы приложения B RFC 6238 (SHA1). RFC приводит 8 цифр, шестизначный код - их младшие разряды
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	for _, v := range rfcVectors {
+		now := time.Unix(v.unix, 0)
+		if got := generate(key, Step(now)); got != v.code {
+			t.Errorf("generate at %d = %s, want %s", v.unix, got, v.code)
+		}
+		step, ok := Validate(rfcSecret, v.code, now, 0)
+		if !ok || step != Step(now) {
+			t.Errorf("Validate at %d = %d, %v, want %d, true", v.unix, step, ok, Step(now))
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	key := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name string
+		step int64
+		want bool
+	}{
+		{"current step", current, true},
+		{"previous step", current - 1, true},
+		{"next step", current + 1, true},
+		{"two steps behind", current - 2, false},
+		{"two steps ahead", current + 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, generate(key, tt.step), now, 0)
+			if ok != tt.want || (ok && step != tt.step) {
+				t.Errorf("Validate = %d, %v, want %d, %v", step, ok, tt.step, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReplay(t *testing.T) {
+	key := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+	code := generate(key, current)
+
+	// Первое использование сохраняется как LastUsedStep
+	lastUsedStep, ok := Validate(rfcSecret, code, now, 0)
+	if !ok {
+		t.Fatal("first use rejected")
+	}
+	if _, ok := Validate(rfcSecret, code, now, lastUsedStep); ok {
+		t.Error("code accepted twice in the same step")
+	}
+	// Код предыдущего интервала в пределах расхождения часов тоже больше не принимается
+	if _, ok := Validate(rfcSecret, generate(key, current-1), now, lastUsedStep); ok {
+		t.Error("code of an earlier step accepted after a later one was used")
+	}
+	// Код следующего интервала остается действительным
+	if step, ok := Validate(rfcSecret, generate(key, current+1), now, lastUsedStep); !ok || step != current+1 {
+		t.Errorf("next step code = %d, %v, want %d, true", step, ok, current+1)
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		want   bool
+	}{
+		{"surrounding whitespace", rfcSecret, " 287082\n", true},
+		{"lowercase secret", strings.ToLower(rfcSecret), "287082", true},
+		{"short code", rfcSecret, "28708", false},
+		{"eight digit code", rfcSecret, "94287082", false},
+		{"wrong code", rfcSecret, "287083", false},
+		{"invalid secret", "not base32!", "287082", false},
+	}
+	for _, tt := range tests {
+		if _, ok := Validate(tt.secret, tt.code, now, 0); ok != tt.want {
+			t.Errorf("%s: Validate = %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != SecretSize {
+		t.Errorf("secret %q decodes to %d bytes, %v", secret, len(key), err)
+	}
+}
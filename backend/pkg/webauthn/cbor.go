@@ -0,0 +1,136 @@
+// pkg/webauthn/cbor.go
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errCBOR = errors.New("malformed CBOR")
+
+const maxCBORDepth = 16
+
+// decodeCBOR разбирает один элемент CBOR (RFC 8949) и возвращает остаток данных.
+// Поддерживается подмножество, которое используют WebAuthn и COSE: целые числа, байтовые
+// и текстовые строки, массивы, словари и простые значения. Неопределенная длина не поддерживается
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeItem(data, 0)
+}
+
+func decodeItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > maxCBORDepth || len(data) == 0 {
+		return nil, nil, errCBOR
+	}
+
+	major := data[0] >> 5
+	arg, rest, err := readArgument(data[0]&0x1f, data[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, errCBOR
+		}
+		return int64(arg), rest, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, errCBOR
+		}
+		return -1 - int64(arg), rest, nil
+	case 2, 3:
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBOR
+		}
+		value := rest[:arg]
+		if major == 3 {
+			return string(value), rest[arg:], nil
+		}
+		return append([]byte(nil), value...), rest[arg:], nil
+	case 4:
+		// Каждый элемент занимает хотя бы байт: длина больше остатка данных некорректна
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBOR
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item interface{}
+			if item, rest, err = decodeItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, rest, nil
+	case 5:
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBOR
+		}
+		items := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value interface{}
+			if key, rest, err = decodeItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errCBOR
+			}
+			if value, rest, err = decodeItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items[key] = value
+		}
+		return items, rest, nil
+	case 7:
+		switch arg {
+		case 20:
+			return false, rest, nil
+		case 21:
+			return true, rest, nil
+		default:
+			// null, undefined и числа с плавающей точкой в WebAuthn не используются
+			return nil, rest, nil
+		}
+	default:
+		// Теги (major 6) в данных аутентификатора не встречаются
+		return nil, nil, errCBOR
+	}
+}
+
+func readArgument(info byte, data []byte) (uint64, []byte, error) {
+	size := 0
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, nil, errCBOR
+	}
+
+	if len(data) < size {
+		return 0, nil, errCBOR
+	}
+
+	var value uint64
+	switch size {
+	case 1:
+		value = uint64(data[0])
+	case 2:
+		value = uint64(binary.BigEndian.Uint16(data))
+	case 4:
+		value = uint64(binary.BigEndian.Uint32(data))
+	case 8:
+		value = binary.BigEndian.Uint64(data)
+	}
+	return value, data[size:], nil
+}
@@ -0,0 +1,112 @@
+// pkg/webauthn/cose.go
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// Алгоритмы COSE (RFC 9053), которые принимает сервер
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// Метки параметров COSE_Key
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1 // для RSA это модуль n
+	coseX   = -2 // для RSA это экспонента e
+	coseY   = -3
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+var ErrUnsupportedAlgorithm = errors.New("unsupported credential algorithm")
+
+// SupportedAlgorithms порядок предпочтения для pubKeyCredParams
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parseCOSEKey разбирает открытый ключ COSE и возвращает остаток данных (расширения authData)
+func parseCOSEKey(data []byte) (*publicKey, []byte, error) {
+	value, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	params, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, nil, errCBOR
+	}
+
+	kty, _ := params[int64(coseKty)].(int64)
+	alg, _ := params[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := params[int64(coseCrv)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		y, _ := params[int64(coseY)].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, nil, ErrUnsupportedAlgorithm
+		}
+		// Проверяем, что точка лежит на кривой
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, nil, ErrUnsupportedAlgorithm
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		return &publicKey{alg: alg, key: key}, rest, nil
+
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := params[int64(coseCrv)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, nil, ErrUnsupportedAlgorithm
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, rest, nil
+
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := params[int64(coseCrv)].([]byte)
+		e, _ := params[int64(coseX)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, nil, ErrUnsupportedAlgorithm
+		}
+		exponent := int(new(big.Int).SetBytes(e).Int64())
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}
+		return &publicKey{alg: alg, key: key}, rest, nil
+	}
+
+	return nil, nil, ErrUnsupportedAlgorithm
+}
+
+func (k *publicKey) verify(data, signature []byte) bool {
+	digest := sha256.Sum256(data)
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	}
+	return false
+}
@@ -0,0 +1,477 @@
+// pkg/webauthn/webauthn.go
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Флаги данных аутентификатора (WebAuthn Level 3, 6.1)
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagBackupState    = 0x10
+	flagAttestedData   = 0x40
+)
+
+// Требование проверки пользователя (PIN, биометрия) на аутентификаторе
+const (
+	UserVerificationRequired  = "required"
+	UserVerificationPreferred = "preferred"
+)
+
+const (
+	challengeSize = 32
+	Timeout       = 5 * time.Minute
+)
+
+var (
+	ErrInvalidResponse   = errors.New("invalid authenticator response")
+	ErrChallengeMismatch = errors.New("challenge mismatch")
+	ErrOriginMismatch    = errors.New("origin not allowed")
+	ErrRPIDMismatch      = errors.New("relying party ID mismatch")
+	ErrUserPresence      = errors.New("user presence not confirmed")
+	ErrUserVerification  = errors.New("user verification required")
+	ErrInvalidSignature  = errors.New("invalid signature")
+	ErrSignCount         = errors.New("signature counter did not increase, authenticator may be cloned")
+	ErrUserHandle        = errors.New("user handle does not match the credential owner")
+)
+
+// RelyingParty параметры проверяющей стороны: ID (домен), отображаемое имя и
+// разрешенные origin фронтенда
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+func NewRelyingParty(id, name string, origins []string) *RelyingParty {
+	return &RelyingParty{ID: id, Name: name, Origins: origins}
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type credentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type rpEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type authenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions параметры navigator.credentials.create() в JSON представлении
+// (PublicKeyCredentialCreationOptionsJSON): бинарные поля кодируются base64url
+type CreationOptions struct {
+	RP                     rpEntity               `json:"rp"`
+	User                   userEntity             `json:"user"`
+	Challenge              string                 `json:"challenge"`
+	PubKeyCredParams       []credentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	Attestation            string                 `json:"attestation"`
+	AuthenticatorSelection authenticatorSelection `json:"authenticatorSelection"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+}
+
+// RequestOptions параметры navigator.credentials.get() (PublicKeyCredentialRequestOptionsJSON)
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AttestationResponse результат navigator.credentials.create(), сериализованный через toJSON()
+type AttestationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse результат navigator.credentials.get(), сериализованный через toJSON()
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Credential зарегистрированный ключ: ID и открытый ключ COSE сохраняются у пользователя
+type Credential struct {
+	ID             string
+	PublicKey      []byte
+	Algorithm      int64
+	SignCount      uint32
+	AAGUID         string
+	Transports     []string
+	BackupEligible bool
+	BackupState    bool
+	UserVerified   bool
+}
+
+// Assertion результат успешной проверки входа
+type Assertion struct {
+	CredentialID string
+	UserHandle   []byte
+	SignCount    uint32
+	UserVerified bool
+	BackupState  bool
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+	key          *publicKey
+}
+
+// NewChallenge генерирует случайный challenge в base64url
+func NewChallenge() (string, error) {
+	buf := make([]byte, challengeSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return EncodeID(buf), nil
+}
+
+// EncodeID кодирует бинарный идентификатор в base64url без выравнивания, как в WebAuthn JSON
+func EncodeID(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+// DecodeID принимает base64url как с выравниванием, так и без него
+func DecodeID(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+// CreationOptions формирует параметры регистрации. Ключи из exclude аутентификатор
+// повторно не зарегистрирует
+func (rp *RelyingParty) CreationOptions(userHandle []byte, name, displayName, challenge string, exclude []CredentialDescriptor) *CreationOptions {
+	params := make([]credentialParameter, 0, len(SupportedAlgorithms))
+	for _, alg := range SupportedAlgorithms {
+		params = append(params, credentialParameter{Type: "public-key", Alg: alg})
+	}
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+
+	return &CreationOptions{
+		RP:               rpEntity{ID: rp.ID, Name: rp.Name},
+		User:             userEntity{ID: EncodeID(userHandle), Name: name, DisplayName: displayName},
+		Challenge:        challenge,
+		PubKeyCredParams: params,
+		Timeout:          Timeout.Milliseconds(),
+		Attestation:      "none", // доверие к модели аутентификатора не требуется
+		AuthenticatorSelection: authenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: UserVerificationPreferred,
+		},
+		ExcludeCredentials: exclude,
+	}
+}
+
+// RequestOptions формирует параметры входа. Пустой allow означает вход по
+// обнаруживаемому ключу (passkey): браузер сам предложит ключи для RP ID
+func (rp *RelyingParty) RequestOptions(challenge string, allow []CredentialDescriptor, userVerification string) *RequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}
+}
+
+// VerifyRegistration проверяет ответ navigator.credentials.create() (WebAuthn 7.1).
+// Заявление аттестации не проверяется, так как запрашивается attestation "none"
+func (rp *RelyingParty) VerifyRegistration(resp *AttestationResponse, challenge string, requireUV bool) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type", ErrInvalidResponse)
+	}
+
+	rawClientData, err := DecodeID(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: clientDataJSON", ErrInvalidResponse)
+	}
+	if err := rp.verifyClientData(rawClientData, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	rawAttestation, err := DecodeID(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestationObject", ErrInvalidResponse)
+	}
+	value, _, err := decodeCBOR(rawAttestation)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestationObject: %v", ErrInvalidResponse, err)
+	}
+	attestation, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: attestationObject", ErrInvalidResponse)
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing authData", ErrInvalidResponse)
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData, requireUV)
+	if err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttestedData == 0 || authData.key == nil {
+		return nil, fmt.Errorf("%w: missing attested credential data", ErrInvalidResponse)
+	}
+
+	credentialID := EncodeID(authData.credentialID)
+	if id := strings.TrimRight(resp.ID, "="); id != "" && id != credentialID {
+		return nil, fmt.Errorf("%w: credential ID mismatch", ErrInvalidResponse)
+	}
+
+	return &Credential{
+		ID:             credentialID,
+		PublicKey:      authData.publicKey,
+		Algorithm:      authData.key.alg,
+		SignCount:      authData.signCount,
+		AAGUID:         formatAAGUID(authData.aaguid),
+		Transports:     resp.Response.Transports,
+		BackupEligible: authData.flags&flagBackupEligible != 0,
+		BackupState:    authData.flags&flagBackupState != 0,
+		UserVerified:   authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// CredentialID возвращает ID ключа из ответа navigator.credentials.get(), по которому
+// сервер находит сохраненный открытый ключ
+func (resp *AssertionResponse) CredentialID() (string, error) {
+	id := resp.RawID
+	if id == "" {
+		id = resp.ID
+	}
+	raw, err := DecodeID(id)
+	if err != nil || len(raw) == 0 {
+		return "", fmt.Errorf("%w: credential ID", ErrInvalidResponse)
+	}
+	return EncodeID(raw), nil
+}
+
+// VerifyAssertion проверяет ответ navigator.credentials.get() (WebAuthn 7.2) сохраненным
+// ключом. Счетчик подписей должен расти, если аутентификатор его поддерживает
+func (rp *RelyingParty) VerifyAssertion(resp *AssertionResponse, challenge string, storedKey []byte, storedSignCount uint32, requireUV bool) (*Assertion, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type", ErrInvalidResponse)
+	}
+
+	credentialID, err := resp.CredentialID()
+	if err != nil {
+		return nil, err
+	}
+
+	rawClientData, err := DecodeID(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: clientDataJSON", ErrInvalidResponse)
+	}
+	if err := rp.verifyClientData(rawClientData, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	rawAuthData, err := DecodeID(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: authenticatorData", ErrInvalidResponse)
+	}
+	authData, err := rp.verifyAuthenticatorData(rawAuthData, requireUV)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := DecodeID(resp.Response.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature", ErrInvalidResponse)
+	}
+
+	key, _, err := parseCOSEKey(storedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Подписываются authenticatorData || SHA-256(clientDataJSON)
+	clientDataHash := sha256.Sum256(rawClientData)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+	if !key.verify(signed, signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	// Нулевые счетчики означают, что аутентификатор их не ведет (типично для passkey)
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return nil, ErrSignCount
+	}
+
+	var userHandle []byte
+	if resp.Response.UserHandle != "" {
+		if userHandle, err = DecodeID(resp.Response.UserHandle); err != nil {
+			return nil, fmt.Errorf("%w: userHandle", ErrInvalidResponse)
+		}
+	}
+
+	return &Assertion{
+		CredentialID: credentialID,
+		UserHandle:   userHandle,
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+		BackupState:  authData.flags&flagBackupState != 0,
+	}, nil
+}
+
+// VerifyUserHandle сверяет user handle обнаруживаемого ключа с владельцем сохраненного ключа.
+// Ключ, выбранный по allowCredentials, user handle может не вернуть
+func (a *Assertion) VerifyUserHandle(owner []byte) error {
+	if len(a.UserHandle) > 0 && !bytes.Equal(a.UserHandle, owner) {
+		return ErrUserHandle
+	}
+	return nil
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony, challenge string) error {
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("%w: clientDataJSON", ErrInvalidResponse)
+	}
+
+	if data.Type != ceremony {
+		return fmt.Errorf("%w: unexpected ceremony type %q", ErrInvalidResponse, data.Type)
+	}
+
+	received := strings.TrimRight(data.Challenge, "=")
+	if challenge == "" || subtle.ConstantTimeCompare([]byte(received), []byte(challenge)) != 1 {
+		return ErrChallengeMismatch
+	}
+
+	if data.CrossOrigin {
+		return ErrOriginMismatch
+	}
+	for _, origin := range rp.Origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+	return ErrOriginMismatch
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(raw []byte, requireUV bool) (*authenticatorData, error) {
+	data, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(data.rpIDHash, rpIDHash[:]) {
+		return nil, ErrRPIDMismatch
+	}
+	if data.flags&flagUserPresent == 0 {
+		return nil, ErrUserPresence
+	}
+	if requireUV && data.flags&flagUserVerified == 0 {
+		return nil, ErrUserVerification
+	}
+	return data, nil
+}
+
+// parseAuthenticatorData разбирает rpIdHash(32) | flags(1) | signCount(4) | [attestedCredentialData] | [extensions]
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrInvalidResponse)
+	}
+
+	data := &authenticatorData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+
+	if data.flags&flagAttestedData == 0 {
+		return data, nil
+	}
+
+	rest := raw[37:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("%w: attested credential data too short", ErrInvalidResponse)
+	}
+	data.aaguid = rest[:16]
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+		return nil, fmt.Errorf("%w: invalid credential ID length", ErrInvalidResponse)
+	}
+	data.credentialID = rest[:idLength]
+	rest = rest[idLength:]
+
+	key, extensions, err := parseCOSEKey(rest)
+	if err != nil {
+		if errors.Is(err, ErrUnsupportedAlgorithm) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: credential public key", ErrInvalidResponse)
+	}
+	data.key = key
+	data.publicKey = append([]byte(nil), rest[:len(rest)-len(extensions)]...)
+	return data, nil
+}
+
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 {
+		return ""
+	}
+	s := hex.EncodeToString(aaguid)
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
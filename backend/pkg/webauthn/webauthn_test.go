@@ -0,0 +1,498 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+const (
+	testRPID   = "auth.example.com"
+	testOrigin = "https://auth.example.com"
+)
+
+// cborPair пара ключ-значение словаря CBOR в порядке записи
+type cborPair struct {
+	key   interface{}
+	value interface{}
+}
+
+// encodeCBOR минимальный кодировщик CBOR для построения ответов аутентификатора в тестах
+func encodeCBOR(value interface{}) []byte {
+	switch v := value.(type) {
+	case int:
+		return encodeCBOR(int64(v))
+	case int64:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case []cborPair:
+		out := cborHead(5, uint64(len(v)))
+		for _, pair := range v {
+			out = append(out, encodeCBOR(pair.key)...)
+			out = append(out, encodeCBOR(pair.value)...)
+		}
+		return out
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	}
+	panic("unsupported CBOR value")
+}
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+	return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+}
+
+// testAuthenticator программный аутентификатор с ключом одного из поддерживаемых алгоритмов
+type testAuthenticator struct {
+	alg          int64
+	signer       crypto.Signer
+	credentialID []byte
+}
+
+func newTestAuthenticator(t *testing.T, alg int64) *testAuthenticator {
+	t.Helper()
+	var signer crypto.Signer
+	var err error
+	switch alg {
+	case AlgES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	case AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &testAuthenticator{alg: alg, signer: signer, credentialID: id}
+}
+
+func (a *testAuthenticator) coseKey() []byte {
+	switch key := a.signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		return encodeCBOR([]cborPair{
+			{coseKty, ktyEC2}, {coseAlg, AlgES256}, {coseCrv, crvP256},
+			{coseX, key.X.FillBytes(make([]byte, 32))}, {coseY, key.Y.FillBytes(make([]byte, 32))},
+		})
+	case ed25519.PublicKey:
+		return encodeCBOR([]cborPair{{coseKty, ktyOKP}, {coseAlg, AlgEdDSA}, {coseCrv, crvEd25519}, {coseX, []byte(key)}})
+	case *rsa.PublicKey:
+		return encodeCBOR([]cborPair{
+			{coseKty, ktyRSA}, {coseAlg, AlgRS256},
+			{coseCrv, key.N.Bytes()}, {coseX, big.NewInt(int64(key.E)).Bytes()},
+		})
+	}
+	panic("unsupported key")
+}
+
+func (a *testAuthenticator) sign(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var signature []byte
+	var err error
+	switch key := a.signer.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, data)
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(data)
+		signature, err = ecdsa.SignASN1(rand.Reader, key, digest[:])
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256(data)
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+func authData(rpID string, flags byte, signCount uint32, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, signCount)
+	return append(data, attested...)
+}
+
+func (a *testAuthenticator) attestedData() []byte {
+	data := bytes.Repeat([]byte{0xaa}, 16) // AAGUID
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+	data = append(data, a.credentialID...)
+	return append(data, a.coseKey()...)
+}
+
+func clientDataJSON(ceremony, challenge, origin string, crossOrigin bool) []byte {
+	data, _ := json.Marshal(clientData{Type: ceremony, Challenge: challenge, Origin: origin, CrossOrigin: crossOrigin})
+	return data
+}
+
+func testRelyingParty() *RelyingParty {
+	return NewRelyingParty(testRPID, "Example", []string{testOrigin})
+}
+
+// register регистрирует ключ аутентификатора и возвращает сохраняемые данные
+func (a *testAuthenticator) register(t *testing.T, rp *RelyingParty) *Credential {
+	t.Helper()
+	challenge, _ := NewChallenge()
+	attestation := encodeCBOR([]cborPair{
+		{"fmt", "none"},
+		{"attStmt", []cborPair{}},
+		{"authData", authData(testRPID, flagUserPresent|flagUserVerified|flagAttestedData, 0, a.attestedData())},
+	})
+
+	var resp AttestationResponse
+	resp.ID = EncodeID(a.credentialID)
+	resp.Type = "public-key"
+	resp.Response.ClientDataJSON = EncodeID(clientDataJSON("webauthn.create", challenge, testOrigin, false))
+	resp.Response.AttestationObject = EncodeID(attestation)
+
+	credential, err := rp.VerifyRegistration(&resp, challenge, true)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+	return credential
+}
+
+// assertion параметры ответа navigator.credentials.get()
+type assertion struct {
+	ceremony    string
+	challenge   string
+	origin      string
+	crossOrigin bool
+	rpID        string
+	flags       byte
+	signCount   uint32
+	userHandle  []byte
+}
+
+func (a *testAuthenticator) assert(t *testing.T, p assertion) *AssertionResponse {
+	t.Helper()
+	rawClientData := clientDataJSON(p.ceremony, p.challenge, p.origin, p.crossOrigin)
+	rawAuthData := authData(p.rpID, p.flags, p.signCount, nil)
+	clientDataHash := sha256.Sum256(rawClientData)
+
+	var resp AssertionResponse
+	resp.ID = EncodeID(a.credentialID)
+	resp.RawID = resp.ID
+	resp.Type = "public-key"
+	resp.Response.ClientDataJSON = EncodeID(rawClientData)
+	resp.Response.AuthenticatorData = EncodeID(rawAuthData)
+	resp.Response.Signature = EncodeID(a.sign(t, append(rawAuthData, clientDataHash[:]...)))
+	if p.userHandle != nil {
+		resp.Response.UserHandle = EncodeID(p.userHandle)
+	}
+	return &resp
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	algorithms := []struct {
+		name string
+		alg  int64
+	}{
+		{"ES256", AlgES256},
+		{"EdDSA", AlgEdDSA},
+		{"RS256", AlgRS256},
+	}
+	for _, algorithm := range algorithms {
+		t.Run(algorithm.name, func(t *testing.T) {
+			rp := testRelyingParty()
+			authenticator := newTestAuthenticator(t, algorithm.alg)
+			credential := authenticator.register(t, rp)
+			if credential.ID != EncodeID(authenticator.credentialID) || credential.Algorithm != algorithm.alg {
+				t.Fatalf("credential = %+v", credential)
+			}
+			if credential.AAGUID != "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa" || !credential.UserVerified {
+				t.Errorf("credential = %+v", credential)
+			}
+
+			challenge, _ := NewChallenge()
+			owner := []byte("user-handle")
+			resp := authenticator.assert(t, assertion{
+				ceremony: "webauthn.get", challenge: challenge, origin: testOrigin, rpID: testRPID,
+				flags: flagUserPresent | flagUserVerified, signCount: 5, userHandle: owner,
+			})
+			result, err := rp.VerifyAssertion(resp, challenge, credential.PublicKey, 4, true)
+			if err != nil {
+				t.Fatalf("VerifyAssertion: %v", err)
+			}
+			if result.SignCount != 5 || !result.UserVerified || result.CredentialID != credential.ID {
+				t.Errorf("assertion = %+v", result)
+			}
+			if err := result.VerifyUserHandle(owner); err != nil {
+				t.Errorf("VerifyUserHandle: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionFailures(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := newTestAuthenticator(t, AlgES256)
+	credential := authenticator.register(t, rp)
+	challenge, _ := NewChallenge()
+
+	valid := assertion{
+		ceremony: "webauthn.get", challenge: challenge, origin: testOrigin, rpID: testRPID,
+		flags: flagUserPresent | flagUserVerified, signCount: 11,
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(*assertion)
+		storedCount uint32
+		requireUV   bool
+		want        error
+	}{
+		{"valid", func(*assertion) {}, 10, true, nil},
+		{"wrong RP ID hash", func(a *assertion) { a.rpID = "evil.example.com" }, 10, false, ErrRPIDMismatch},
+		{"wrong origin", func(a *assertion) { a.origin = "https://evil.example.com" }, 10, false, ErrOriginMismatch},
+		{"cross origin", func(a *assertion) { a.crossOrigin = true }, 10, false, ErrOriginMismatch},
+		{"wrong challenge", func(a *assertion) { a.challenge = "other" }, 10, false, ErrChallengeMismatch},
+		{"registration ceremony", func(a *assertion) { a.ceremony = "webauthn.create" }, 10, false, ErrInvalidResponse},
+		{"user not present", func(a *assertion) { a.flags = flagUserVerified }, 10, false, ErrUserPresence},
+		{"user not verified", func(a *assertion) { a.flags = flagUserPresent }, 10, true, ErrUserVerification},
+		{"user verification not required", func(a *assertion) { a.flags = flagUserPresent }, 10, false, nil},
+		{"sign count regression", func(a *assertion) { a.signCount = 9 }, 10, false, ErrSignCount},
+		{"sign count replay", func(a *assertion) { a.signCount = 10 }, 10, false, ErrSignCount},
+		{"counter reset to zero", func(a *assertion) { a.signCount = 0 }, 10, false, ErrSignCount},
+		{"no counters", func(a *assertion) { a.signCount = 0 }, 0, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid
+			tt.modify(&p)
+			_, err := rp.VerifyAssertion(authenticator.assert(t, p), challenge, credential.PublicKey, tt.storedCount, tt.requireUV)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("VerifyAssertion error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("signature by another key", func(t *testing.T) {
+		other := newTestAuthenticator(t, AlgES256)
+		other.credentialID = authenticator.credentialID
+		_, err := rp.VerifyAssertion(other.assert(t, valid), challenge, credential.PublicKey, 10, true)
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("VerifyAssertion error = %v, want %v", err, ErrInvalidSignature)
+		}
+	})
+
+	t.Run("tampered client data", func(t *testing.T) {
+		resp := authenticator.assert(t, valid)
+		resp.Response.ClientDataJSON = EncodeID(append(clientDataJSON("webauthn.get", challenge, testOrigin, false), ' '))
+		_, err := rp.VerifyAssertion(resp, challenge, credential.PublicKey, 10, true)
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("VerifyAssertion error = %v, want %v", err, ErrInvalidSignature)
+		}
+	})
+}
+
+func TestVerifyUserHandle(t *testing.T) {
+	owner := []byte("owner")
+	tests := []struct {
+		name   string
+		handle []byte
+		want   error
+	}{
+		{"matching", []byte("owner"), nil},
+		{"another user", []byte("intruder"), ErrUserHandle},
+		{"not returned", nil, nil},
+	}
+	for _, tt := range tests {
+		result := &Assertion{UserHandle: tt.handle}
+		if err := result.VerifyUserHandle(owner); !errors.Is(err, tt.want) {
+			t.Errorf("%s: VerifyUserHandle = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestVerifyRegistrationFailures(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := newTestAuthenticator(t, AlgEdDSA)
+	challenge, _ := NewChallenge()
+
+	build := func(rpID string, flags byte, attested []byte, origin string) *AttestationResponse {
+		var resp AttestationResponse
+		resp.Type = "public-key"
+		resp.Response.ClientDataJSON = EncodeID(clientDataJSON("webauthn.create", challenge, origin, false))
+		resp.Response.AttestationObject = EncodeID(encodeCBOR([]cborPair{
+			{"fmt", "none"}, {"attStmt", []cborPair{}}, {"authData", authData(rpID, flags, 0, attested)},
+		}))
+		return &resp
+	}
+
+	flags := byte(flagUserPresent | flagUserVerified | flagAttestedData)
+	tests := []struct {
+		name string
+		resp *AttestationResponse
+		want error
+	}{
+		{"wrong RP ID", build("evil.example.com", flags, authenticator.attestedData(), testOrigin), ErrRPIDMismatch},
+		{"wrong origin", build(testRPID, flags, authenticator.attestedData(), "https://evil.example.com"), ErrOriginMismatch},
+		{"user not verified", build(testRPID, flagUserPresent|flagAttestedData, authenticator.attestedData(), testOrigin), ErrUserVerification},
+		{"no attested data", build(testRPID, flagUserPresent|flagUserVerified, nil, testOrigin), ErrInvalidResponse},
+		{"truncated attested data", build(testRPID, flags, authenticator.attestedData()[:20], testOrigin), ErrInvalidResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := rp.VerifyRegistration(tt.resp, challenge, true); !errors.Is(err, tt.want) {
+				t.Errorf("VerifyRegistration error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	// Примеры из RFC 8949, приложение A
+	tests := []struct {
+		name  string
+		input []byte
+		want  interface{}
+	}{
+		{"0", []byte{0x00}, int64(0)},
+		{"23", []byte{0x17}, int64(23)},
+		{"24", []byte{0x18, 0x18}, int64(24)},
+		{"1000", []byte{0x19, 0x03, 0xe8}, int64(1000)},
+		{"1000000", []byte{0x1a, 0x00, 0x0f, 0x42, 0x40}, int64(1000000)},
+		{"1000000000000", []byte{0x1b, 0x00, 0x00, 0x00, 0xe8, 0xd4, 0xa5, 0x10, 0x00}, int64(1000000000000)},
+		{"-1", []byte{0x20}, int64(-1)},
+		{"-1000", []byte{0x39, 0x03, 0xe7}, int64(-1000)},
+		{"h''", []byte{0x40}, []byte{}},
+		{"h'01020304'", []byte{0x44, 0x01, 0x02, 0x03, 0x04}, []byte{1, 2, 3, 4}},
+		{`"IETF"`, []byte{0x64, 0x49, 0x45, 0x54, 0x46}, "IETF"},
+		{"false", []byte{0xf4}, false},
+		{"true", []byte{0xf5}, true},
+		{"[1, [2, 3]]", []byte{0x82, 0x01, 0x82, 0x02, 0x03}, []interface{}{int64(1), []interface{}{int64(2), int64(3)}}},
+		{`{1: 2, "a": "b"}`, []byte{0xa2, 0x01, 0x02, 0x61, 0x61, 0x61, 0x62}, map[interface{}]interface{}{int64(1): int64(2), "a": "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rest, err := decodeCBOR(append(tt.input, 0xff))
+			if err != nil {
+				t.Fatalf("decodeCBOR: %v", err)
+			}
+			if !equalCBOR(got, tt.want) {
+				t.Errorf("decodeCBOR = %#v, want %#v", got, tt.want)
+			}
+			if !bytes.Equal(rest, []byte{0xff}) {
+				t.Errorf("rest = %x, want ff", rest)
+			}
+		})
+	}
+}
+
+func equalCBOR(a, b interface{}) bool {
+	switch av := a.(type) {
+	case []byte:
+		bv, ok := b.([]byte)
+		return ok && bytes.Equal(av, bv)
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !equalCBOR(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[interface{}]interface{}:
+		bv, ok := b.(map[interface{}]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			if !equalCBOR(v, bv[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func TestDecodeCBORMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{"empty", nil},
+		{"truncated argument", []byte{0x19, 0x01}},
+		{"byte string longer than data", []byte{0x44, 0x01, 0x02}},
+		{"array longer than data", []byte{0x85, 0x01}},
+		{"indefinite length", []byte{0x9f, 0x01, 0xff}},
+		{"reserved additional info", []byte{0x1c}},
+		{"tag", []byte{0xc0, 0x00}},
+		{"array map key", []byte{0xa1, 0x80, 0x01}},
+		{"nesting too deep", append(bytes.Repeat([]byte{0x81}, maxCBORDepth+2), 0x00)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeCBOR(tt.input); err == nil {
+				t.Error("decodeCBOR accepted malformed input")
+			}
+		})
+	}
+}
+
+func TestParseCOSEKey(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	x, y := ecKey.X.FillBytes(make([]byte, 32)), ecKey.Y.FillBytes(make([]byte, 32))
+	offCurve := append([]byte(nil), y...)
+	offCurve[31] ^= 1
+
+	tests := []struct {
+		name string
+		key  []cborPair
+		want error
+	}{
+		{"ES256", []cborPair{{coseKty, ktyEC2}, {coseAlg, AlgES256}, {coseCrv, crvP256}, {coseX, x}, {coseY, y}}, nil},
+		{"ES256 point off curve", []cborPair{{coseKty, ktyEC2}, {coseAlg, AlgES256}, {coseCrv, crvP256}, {coseX, x}, {coseY, offCurve}}, ErrUnsupportedAlgorithm},
+		{"ES256 wrong curve", []cborPair{{coseKty, ktyEC2}, {coseAlg, AlgES256}, {coseCrv, 2}, {coseX, x}, {coseY, y}}, ErrUnsupportedAlgorithm},
+		{"EdDSA short key", []cborPair{{coseKty, ktyOKP}, {coseAlg, AlgEdDSA}, {coseCrv, crvEd25519}, {coseX, x[:31]}}, ErrUnsupportedAlgorithm},
+		{"RS256 small modulus", []cborPair{{coseKty, ktyRSA}, {coseAlg, AlgRS256}, {coseCrv, make([]byte, 128)}, {coseX, []byte{1, 0, 1}}}, ErrUnsupportedAlgorithm},
+		{"ES384", []cborPair{{coseKty, ktyEC2}, {coseAlg, -35}, {coseCrv, 2}, {coseX, x}, {coseY, y}}, ErrUnsupportedAlgorithm},
+		{"key type mismatch", []cborPair{{coseKty, ktyOKP}, {coseAlg, AlgES256}, {coseCrv, crvP256}, {coseX, x}, {coseY, y}}, ErrUnsupportedAlgorithm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, rest, err := parseCOSEKey(append(encodeCBOR(tt.key), 0xa0))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("parseCOSEKey error = %v, want %v", err, tt.want)
+			}
+			if err == nil && (key.alg != AlgES256 || !bytes.Equal(rest, []byte{0xa0})) {
+				t.Errorf("key = %+v, rest = %x", key, rest)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+'use client';
+
+import { Suspense } from 'react';
+import { useRouter } from 'next/navigation';
+import { Button } from '@/components/ui/button';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
+import { CheckCircle, XCircle } from 'lucide-react';
+import { useTokenLink } from '@/hooks/use-token-link';
+
+function ConfirmEmailChangeContent() {
+	const router = useRouter();
+	const { status, message } = useTokenLink('/auth/email/confirm');
+
+	if (status === 'loading') return null;
+
+	return (
+		<div className="h-full flex items-center justify-center">
+			<Card className="w-full max-w-md">
+				<CardHeader className="text-center">
+					<CardTitle className="flex items-center justify-center gap-2">
+						{status === 'success' && <CheckCircle className="h-6 w-6 text-accent" />}
+						{status === 'error' && <XCircle className="h-6 w-6 text-destructive" />}
+						Email change
+					</CardTitle>
+					<CardDescription>
+						{status === 'success' && 'Email confirmed'}
+						{status === 'error' && 'The link could not be used'}
+					</CardDescription>
+				</CardHeader>
+				<CardContent className="text-center">
+					<p className="mb-6 text-gray-600 dark:text-primary">
+						{message}
+					</p>
+					<Button onClick={() => router.push('/sign-in')} className="w-full">
+						Go to sign in
+					</Button>
+				</CardContent>
+			</Card>
+		</div>
+	);
+}
+
+export default function ConfirmEmailChangePage() {
+	return (
+		<Suspense fallback={null}>
+			<ConfirmEmailChangeContent />
+		</Suspense>
+	);
+}
@@ -0,0 +1,63 @@
+'use client';
+
+import Link from 'next/link';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
+import { Button } from '@/components/ui/button';
+import { Input } from '@/components/ui/input';
+import { Label } from '@/components/ui/label';
+import { useForgotPassword } from '@/hooks/use-password-reset';
+
+export default function ForgotPassword() {
+	const { email, setEmail, error, sent, isLoading, handleSubmit } = useForgotPassword();
+
+	return (
+		<div className="h-full min-w-[512px] flex items-center justify-center">
+			<Card className="w-full max-w-md">
+				<CardHeader className="text-center">
+					<CardTitle className="text-2xl font-bold">
+						Forgot password
+					</CardTitle>
+					<CardDescription>
+						{sent
+							? 'If an account exists for this address, we have emailed a link to reset the password.'
+							: 'Enter your email and we will send you a link to reset your password'}
+					</CardDescription>
+				</CardHeader>
+				<CardContent>
+					{!sent && (
+						<form onSubmit={handleSubmit} className="space-y-4">
+							<div className="space-y-2">
+								<Label htmlFor="email">
+									Email
+								</Label>
+								<Input
+									id="email"
+									type="email"
+									value={email}
+									onChange={(e) => setEmail(e.target.value)}
+									autoFocus
+									required
+								/>
+								{error && (
+									<div className="text-red-400 text-xs">{error}</div>
+								)}
+							</div>
+							<Button
+								type="submit"
+								disabled={isLoading}
+								className="w-full"
+							>
+								{isLoading ? 'Sending...' : 'Send reset link'}
+							</Button>
+						</form>
+					)}
+					<Link href="/sign-in">
+						<Button variant="ghost" className="w-full mt-4">
+							Back to sign in
+						</Button>
+					</Link>
+				</CardContent>
+			</Card>
+		</div>
+	);
+}
@@ -0,0 +1,91 @@
+'use client';
+
+import { Suspense } from 'react';
+import Link from 'next/link';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
+import { Button } from '@/components/ui/button';
+import { Input } from '@/components/ui/input';
+import { Label } from '@/components/ui/label';
+import { useResetPassword } from '@/hooks/use-password-reset';
+
+function ResetPasswordContent() {
+	const { hasToken, expired, form, errors, isLoading, updateForm, handleSubmit } = useResetPassword();
+
+	return (
+		<div className="h-full min-w-[512px] flex items-center justify-center">
+			<Card className="w-full max-w-md">
+				<CardHeader className="text-center">
+					<CardTitle className="text-2xl font-bold">
+						Reset password
+					</CardTitle>
+					<CardDescription>
+						{!hasToken
+							? 'The reset link is incomplete. Request a new one.'
+							: expired
+								? 'Your password has expired. Choose a new one to continue signing in.'
+								: 'Choose a new password. You will be signed out everywhere.'}
+					</CardDescription>
+				</CardHeader>
+				<CardContent>
+					{hasToken ? (
+						<form onSubmit={handleSubmit} className="space-y-4">
+							<div className="space-y-2">
+								<Label htmlFor="password">
+									New password
+								</Label>
+								<Input
+									id="password"
+									type="password"
+									autoComplete="new-password"
+									value={form.password}
+									onChange={(e) => updateForm('password', e.target.value)}
+									required
+								/>
+								{errors.password && (
+									<div className="text-red-400 text-xs">{errors.password}</div>
+								)}
+							</div>
+							<div className="space-y-2">
+								<Label htmlFor="confirmPassword">
+									Confirm password
+								</Label>
+								<Input
+									id="confirmPassword"
+									type="password"
+									autoComplete="new-password"
+									value={form.confirmPassword}
+									onChange={(e) => updateForm('confirmPassword', e.target.value)}
+									required
+								/>
+								{errors.confirmPassword && (
+									<div className="text-red-400 text-xs">{errors.confirmPassword}</div>
+								)}
+							</div>
+							<Button
+								type="submit"
+								disabled={isLoading}
+								className="w-full"
+							>
+								{isLoading ? 'Saving...' : 'Set new password'}
+							</Button>
+						</form>
+					) : (
+						<Link href="/forgot-password">
+							<Button className="w-full">
+								Request a new link
+							</Button>
+						</Link>
+					)}
+				</CardContent>
+			</Card>
+		</div>
+	);
+}
+
+export default function ResetPassword() {
+	return (
+		<Suspense fallback={null}>
+			<ResetPasswordContent />
+		</Suspense>
+	);
+}
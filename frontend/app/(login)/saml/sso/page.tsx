@@ -0,0 +1,77 @@
+"use client";
+
+import { Suspense, useEffect, useState } from 'react';
+import { useRouter, useSearchParams } from 'next/navigation';
+import { signOut, useSession } from 'next-auth/react';
+import { Button } from '@/components/ui/button';
+import { Card, CardContent, CardFooter, CardHeader, CardTitle } from '@/components/ui/card';
+import { Alert, AlertDescription } from '@/components/ui/alert';
+import { XCircle } from 'lucide-react';
+import { ReauthenticationRequiredError, SAMLService } from '@/services/samlService';
+
+function SAMLSSOContent() {
+	const router = useRouter();
+	const searchParams = useSearchParams();
+	const { data: session, status } = useSession();
+	const token = session?.accessToken;
+	const [error, setError] = useState<string | null>(null);
+
+	useEffect(() => {
+		if (status === 'loading') return;
+
+		const current = window.location.pathname + window.location.search;
+		if (!token) {
+			router.push(`/sign-in?redirect=${encodeURIComponent(current)}`);
+			return;
+		}
+
+		SAMLService.completeSSO(searchParams, token)
+			.then(SAMLService.postToACS)
+			.catch(async (err) => {
+				if (err instanceof ReauthenticationRequiredError) {
+					// End the old session so the sign-in page asks for credentials again
+					await signOut({ redirect: false });
+					router.push(`/sign-in?redirect=${encodeURIComponent(current)}`);
+					return;
+				}
+				setError(err instanceof Error ? err.message : 'An error occurred');
+			});
+	}, [status, token, searchParams, router]);
+
+	if (!error) return <div></div>;
+
+	return (
+		<div className="h-full flex items-center justify-center">
+			<Card className="w-full max-w-md">
+				<CardHeader>
+					<CardTitle className="flex items-center">
+						<XCircle className="h-5 w-5 text-destructive mr-2" />
+						Sign-in Error
+					</CardTitle>
+				</CardHeader>
+				<CardContent>
+					<Alert>
+						<AlertDescription>{error}</AlertDescription>
+					</Alert>
+				</CardContent>
+				<CardFooter>
+					<Button
+						variant="outline"
+						onClick={() => router.push('/')}
+						className="w-full"
+					>
+						Return to Home
+					</Button>
+				</CardFooter>
+			</Card>
+		</div>
+	);
+}
+
+export default function SAMLSSOPage() {
+	return (
+		<Suspense fallback={<div></div>}>
+			<SAMLSSOContent />
+		</Suspense>
+	);
+}
@@ -9,7 +9,33 @@ import { Label } from '@/components/ui/label';
 import { useSignIn } from '@/hooks/use-sign-in';
 
 function SignInContent() {
-	const { form, errors, isLoading, updateForm, handleSubmit } = useSignIn();
+	const {
+		form,
+		errors,
+		isLoading,
+		mfaRequired,
+		mfaMethods,
+		passkeysSupported,
+		passwordlessEnabled,
+		emailMode,
+		emailCodeSent,
+		toggleEmailMode,
+		recoveryMode,
+		toggleRecoveryMode,
+		code,
+		setCode,
+		cancelMfa,
+		updateForm,
+		handleSubmit,
+		signInWithPasskey,
+		verifyWithSecurityKey,
+	} = useSignIn();
+	const totpEnabled = mfaMethods.includes('totp');
+	const securityKeyEnabled = passkeysSupported && mfaMethods.includes('webauthn');
+	const recoveryEnabled = mfaMethods.includes('recovery_code');
+	// Unusual sign-ins are confirmed with a code sent by email instead of a second factor
+	const emailCodeEnabled = mfaMethods.includes('email');
+	const showCodeForm = totpEnabled || emailCodeEnabled || recoveryMode;
 
 	return (
 		<div className="h-full min-w-[512px] flex items-center justify-center">
@@ -27,49 +53,171 @@ function SignInContent() {
 						JIKO
 					</CardTitle>
 					<CardDescription>
-						Sign in to your account
+						{mfaRequired
+							? emailCodeEnabled
+								? 'We noticed an unusual sign-in. Enter the code we emailed you'
+								: 'Enter the code from your authenticator app'
+							: emailCodeSent
+								? 'Follow the link or enter the code we emailed you'
+								: 'Sign in to your account'}
 					</CardDescription>
 				</CardHeader>
 				<CardContent>
+					{mfaRequired ? (
+						<form onSubmit={handleSubmit} className="space-y-4">
+							{showCodeForm && (
+								<>
+									<div className="space-y-2">
+										<Label htmlFor="code">
+											{recoveryMode ? 'Recovery code' : 'Authentication code'}
+										</Label>
+										<Input
+											id="code"
+											type="text"
+											inputMode={recoveryMode ? 'text' : 'numeric'}
+											autoComplete="one-time-code"
+											maxLength={recoveryMode ? 11 : 6}
+											value={code}
+											onChange={(e) => setCode(recoveryMode ? e.target.value : e.target.value.replace(/\D/g, ''))}
+											autoFocus
+											required
+										/>
+										{errors.code && (
+											<div className="text-red-400 text-xs">{errors.code}</div>
+										)}
+									</div>
+									<Button
+										type="submit"
+										disabled={isLoading}
+										className="w-full"
+									>
+										{isLoading ? 'Verifying...' : 'Verify'}
+									</Button>
+								</>
+							)}
+							{securityKeyEnabled && !recoveryMode && (
+								<Button
+									type="button"
+									variant={totpEnabled ? 'outline' : 'default'}
+									disabled={isLoading}
+									onClick={verifyWithSecurityKey}
+									className="w-full"
+								>
+									Use security key
+								</Button>
+							)}
+							{recoveryEnabled && (
+								<Button
+									type="button"
+									variant="link"
+									onClick={toggleRecoveryMode}
+									className="w-full"
+								>
+									{recoveryMode ? 'Use another verification method' : 'Use a recovery code'}
+								</Button>
+							)}
+							<Button
+								type="button"
+								variant="ghost"
+								onClick={cancelMfa}
+								className="w-full"
+							>
+								Back to sign in
+							</Button>
+						</form>
+					) : (
 					<form onSubmit={handleSubmit} className="space-y-4">
 						<div className="space-y-2">
 							<Label htmlFor="identifier">
-								Email or Username
+								{emailMode ? 'Email' : 'Email or Username'}
 							</Label>
 							<Input
 								id="identifier"
-								type="text"
+								type={emailMode ? 'email' : 'text'}
 								value={form.identifier}
 								onChange={(e) => updateForm('identifier', e.target.value)}
+								disabled={emailCodeSent}
 								required
 							/>
 							{errors.identifier && (
 								<div className="text-red-400 text-xs">{errors.identifier}</div>
 							)}
 						</div>
-						<div className="space-y-2">
-							<Label htmlFor="password">
-								Password
-							</Label>
-							<Input
-								id="password"
-								type="password"
-								value={form.password}
-								onChange={(e) => updateForm('password', e.target.value)}
-								required
-							/>
-							{errors.password && (
-								<div className="text-red-400 text-xs">{errors.password}</div>
-							)}
-						</div>
+						{emailMode && emailCodeSent && (
+							<div className="space-y-2">
+								<Label htmlFor="code">
+									Code from the email
+								</Label>
+								<Input
+									id="code"
+									type="text"
+									inputMode="numeric"
+									autoComplete="one-time-code"
+									maxLength={6}
+									value={code}
+									onChange={(e) => setCode(e.target.value.replace(/\D/g, ''))}
+									autoFocus
+									required
+								/>
+								{errors.code && (
+									<div className="text-red-400 text-xs">{errors.code}</div>
+								)}
+							</div>
+						)}
+						{!emailMode && (
+							<div className="space-y-2">
+								<div className="flex items-center justify-between">
+									<Label htmlFor="password">
+										Password
+									</Label>
+									<Link href="/forgot-password" className="text-xs text-muted-foreground hover:underline">
+										Forgot password?
+									</Link>
+								</div>
+								<Input
+									id="password"
+									type="password"
+									value={form.password}
+									onChange={(e) => updateForm('password', e.target.value)}
+									required
+								/>
+								{errors.password && (
+									<div className="text-red-400 text-xs">{errors.password}</div>
+								)}
+							</div>
+						)}
 						<Button
 							type="submit"
 							disabled={isLoading}
 							className="w-full"
 						>
-							{isLoading ? 'Signing in...' : 'Sign In'}
+							{isLoading
+								? (emailMode && !emailCodeSent ? 'Sending...' : 'Signing in...')
+								: (emailMode && !emailCodeSent ? 'Email me a sign-in link' : 'Sign In')}
 						</Button>
+						{passwordlessEnabled && (
+							<Button
+								type="button"
+								variant="link"
+								onClick={toggleEmailMode}
+								className="w-full"
+							>
+								{emailMode ? 'Sign in with a password' : 'Sign in with an email link'}
+							</Button>
+						)}
+						{passkeysSupported && (
+							<Button
+								type="button"
+								variant="outline"
+								disabled={isLoading}
+								onClick={signInWithPasskey}
+								className="w-full"
+							>
+								Sign in with a passkey
+							</Button>
+						)}
 					</form>
+					)}
 				</CardContent>
 			</Card>
 		</div>
@@ -6,10 +6,10 @@ import { Button } from '@/components/ui/button';
 import { Input } from '@/components/ui/input';
 import { Label } from '@/components/ui/label';
 import { Checkbox } from '@/components/ui/checkbox';
-import { useSignUp } from '@/hooks/use-sign-up';
+import { describePolicy, useSignUp } from '@/hooks/use-sign-up';
 
 export default function SignUp() {
-	const { form, errors, isLoading, handleSubmit, updateForm } = useSignUp();
+	const { form, errors, isLoading, policy, handleSubmit, updateForm } = useSignUp();
 
 	return (
 		<div className="h-full min-w-[512px] flex items-center justify-center">
@@ -72,10 +72,10 @@ export default function SignUp() {
 								value={form.password}
 								onChange={(e) => updateForm('password', e.target.value)}
 								required
-								minLength={8}
+								minLength={policy.min_length}
 							/>
 							<p className="text-xs">
-								Must contain uppercase, lowercase letters, numbers, and special characters
+								{describePolicy(policy)}
 							</p>
 							{errors.password && (
 								<div className="text-red-400 text-xs">{errors.password}</div>
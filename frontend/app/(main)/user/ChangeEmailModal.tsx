@@ -0,0 +1,99 @@
+'use client';
+
+import { useState } from 'react';
+import {
+	Dialog,
+	DialogContent,
+	DialogDescription,
+	DialogFooter,
+	DialogHeader,
+	DialogTitle,
+} from '@/components/ui/dialog';
+import { Button } from '@/components/ui/button';
+import { Input } from '@/components/ui/input';
+import { Label } from '@/components/ui/label';
+import { ChangeEmailData } from '@/hooks/use-account';
+
+interface ChangeEmailModalProps {
+	isOpen: boolean;
+	onClose: () => void;
+	onSubmit: (data: ChangeEmailData) => Promise<string | null>;
+	loading?: boolean;
+}
+
+const emptyForm = { new_email: '', password: '' };
+
+export function ChangeEmailModal({
+	isOpen,
+	onClose,
+	onSubmit,
+	loading = false
+}: ChangeEmailModalProps) {
+	const [form, setForm] = useState(emptyForm);
+	const [error, setError] = useState('');
+
+	const handleSubmit = async (e: React.FormEvent) => {
+		e.preventDefault();
+		const failure = await onSubmit(form);
+		if (failure) {
+			setError(failure);
+			return;
+		}
+		handleClose();
+	};
+
+	const handleClose = () => {
+		setForm(emptyForm);
+		setError('');
+		onClose();
+	};
+
+	return (
+		<Dialog open={isOpen} onOpenChange={handleClose}>
+			<DialogContent className="sm:max-w-[425px]">
+				<DialogHeader>
+					<DialogTitle>Change Email</DialogTitle>
+					<DialogDescription>
+						We will send a confirmation link to the new address. Your current address gets a link to cancel the change.
+					</DialogDescription>
+				</DialogHeader>
+				<form onSubmit={handleSubmit}>
+					<div className="grid gap-4 py-4">
+						<div className="space-y-2">
+							<Label htmlFor="new-email">New email</Label>
+							<Input
+								id="new-email"
+								type="email"
+								value={form.new_email}
+								onChange={(e) => setForm(prev => ({ ...prev, new_email: e.target.value }))}
+								required
+							/>
+						</div>
+						<div className="space-y-2">
+							<Label htmlFor="email-password">Current password</Label>
+							<Input
+								id="email-password"
+								type="password"
+								autoComplete="current-password"
+								value={form.password}
+								onChange={(e) => setForm(prev => ({ ...prev, password: e.target.value }))}
+								required
+							/>
+						</div>
+						{error && (
+							<div className="text-red-400 text-xs">{error}</div>
+						)}
+					</div>
+					<DialogFooter>
+						<Button type="button" variant="outline" onClick={handleClose}>
+							Cancel
+						</Button>
+						<Button type="submit" disabled={loading}>
+							{loading ? 'Sending...' : 'Send confirmation'}
+						</Button>
+					</DialogFooter>
+				</form>
+			</DialogContent>
+		</Dialog>
+	);
+}
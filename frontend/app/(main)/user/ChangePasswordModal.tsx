@@ -0,0 +1,116 @@
+'use client';
+
+import { useState } from 'react';
+import {
+	Dialog,
+	DialogContent,
+	DialogDescription,
+	DialogFooter,
+	DialogHeader,
+	DialogTitle,
+} from '@/components/ui/dialog';
+import { Button } from '@/components/ui/button';
+import { Input } from '@/components/ui/input';
+import { Label } from '@/components/ui/label';
+import { ChangePasswordData } from '@/hooks/use-account';
+
+interface ChangePasswordModalProps {
+	isOpen: boolean;
+	onClose: () => void;
+	onSubmit: (data: ChangePasswordData) => Promise<string | null>;
+	loading?: boolean;
+}
+
+const emptyForm = { current_password: '', new_password: '', confirm_password: '' };
+
+export function ChangePasswordModal({
+	isOpen,
+	onClose,
+	onSubmit,
+	loading = false
+}: ChangePasswordModalProps) {
+	const [form, setForm] = useState(emptyForm);
+	const [error, setError] = useState('');
+
+	const handleSubmit = async (e: React.FormEvent) => {
+		e.preventDefault();
+		if (form.new_password !== form.confirm_password) {
+			setError('Passwords do not match');
+			return;
+		}
+
+		const failure = await onSubmit({ current_password: form.current_password, new_password: form.new_password });
+		if (failure) {
+			setError(failure);
+			return;
+		}
+		handleClose();
+	};
+
+	const handleClose = () => {
+		setForm(emptyForm);
+		setError('');
+		onClose();
+	};
+
+	return (
+		<Dialog open={isOpen} onOpenChange={handleClose}>
+			<DialogContent className="sm:max-w-[425px]">
+				<DialogHeader>
+					<DialogTitle>Change Password</DialogTitle>
+					<DialogDescription>
+						Other devices will be signed out
+					</DialogDescription>
+				</DialogHeader>
+				<form onSubmit={handleSubmit}>
+					<div className="grid gap-4 py-4">
+						<div className="space-y-2">
+							<Label htmlFor="current-password">Current password</Label>
+							<Input
+								id="current-password"
+								type="password"
+								autoComplete="current-password"
+								value={form.current_password}
+								onChange={(e) => setForm(prev => ({ ...prev, current_password: e.target.value }))}
+								required
+							/>
+						</div>
+						<div className="space-y-2">
+							<Label htmlFor="new-password">New password</Label>
+							<Input
+								id="new-password"
+								type="password"
+								autoComplete="new-password"
+								value={form.new_password}
+								onChange={(e) => setForm(prev => ({ ...prev, new_password: e.target.value }))}
+								required
+							/>
+						</div>
+						<div className="space-y-2">
+							<Label htmlFor="confirm-password">Confirm new password</Label>
+							<Input
+								id="confirm-password"
+								type="password"
+								autoComplete="new-password"
+								value={form.confirm_password}
+								onChange={(e) => setForm(prev => ({ ...prev, confirm_password: e.target.value }))}
+								required
+							/>
+						</div>
+						{error && (
+							<div className="text-red-400 text-xs">{error}</div>
+						)}
+					</div>
+					<DialogFooter>
+						<Button type="button" variant="outline" onClick={handleClose}>
+							Cancel
+						</Button>
+						<Button type="submit" disabled={loading}>
+							{loading ? 'Saving...' : 'Change Password'}
+						</Button>
+					</DialogFooter>
+				</form>
+			</DialogContent>
+		</Dialog>
+	);
+}
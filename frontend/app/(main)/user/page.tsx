@@ -1,5 +1,6 @@
 "use client";
 
+import { useState } from 'react';
 import Link from 'next/link';
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
 import { Button } from '@/components/ui/button';
@@ -7,11 +8,17 @@ import { Avatar, AvatarFallback, AvatarImage } from '@/components/ui/avatar';
 import { Badge } from '@/components/ui/badge';
 import { useSession } from 'next-auth/react';
 import { ArrowLeft, User, Mail, Calendar, Shield } from 'lucide-react';
+import { useAccount } from '@/hooks/use-account';
+import { ChangePasswordModal } from './ChangePasswordModal';
+import { ChangeEmailModal } from './ChangeEmailModal';
 
 export default function UserProfile() {
 	const { data: session } = useSession();
 	const user = session?.user;
 	const isAdmin = user?.role === 'admin';
+	const { loading, changePassword, changeEmail } = useAccount();
+	const [passwordOpen, setPasswordOpen] = useState(false);
+	const [emailOpen, setEmailOpen] = useState(false);
 
 	return (
 		<div className="w-full">
@@ -99,7 +106,10 @@ export default function UserProfile() {
 								<Button variant="outline" className="w-full">
 									Edit Profile
 								</Button>
-								<Button variant="outline" className="w-full">
+								<Button variant="outline" className="w-full" onClick={() => setEmailOpen(true)}>
+									Change Email
+								</Button>
+								<Button variant="outline" className="w-full" onClick={() => setPasswordOpen(true)}>
 									Change Password
 								</Button>
 								<Button variant="destructive" className="w-full">
@@ -110,6 +120,19 @@ export default function UserProfile() {
 					</div>
 				</div>
 			</div>
+
+			<ChangePasswordModal
+				isOpen={passwordOpen}
+				onClose={() => setPasswordOpen(false)}
+				onSubmit={changePassword}
+				loading={loading}
+			/>
+			<ChangeEmailModal
+				isOpen={emailOpen}
+				onClose={() => setEmailOpen(false)}
+				onSubmit={changeEmail}
+				loading={loading}
+			/>
 		</div>
 	);
 }
\ No newline at end of file
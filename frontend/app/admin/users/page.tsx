@@ -38,7 +38,8 @@ export default function Users() {
 		loadUsers,
 		createUser,
 		updateUser,
-		deleteUser
+		deleteUser,
+		unlockUser
 	} = useUsers();
 	const { showNotification } = useNotification();
 
@@ -95,6 +96,18 @@ export default function Users() {
 		}
 	};
 
+	const handleUnlockUser = async (user: User) => {
+		const success = await unlockUser(user.id);
+		if (success) {
+			showNotification('User unlocked successfully', 'success');
+			loadUsers();
+		} else {
+			showNotification('Error unlocking user', 'error');
+		}
+	};
+
+	const isLocked = (user: User) => !!user.locked_until && new Date(user.locked_until) > new Date();
+
 	const openEditModal = (user: User) => {
 		setEditingUser(user);
 		setShowEditModal(true);
@@ -172,6 +185,15 @@ export default function Users() {
 									>
 										Edit
 									</Button>
+									{isLocked(user) && (
+										<Button
+											variant="ghost"
+											size="sm"
+											onClick={() => handleUnlockUser(user)}
+										>
+											Unlock
+										</Button>
+									)}
 									<Button
 										variant="ghost"
 										size="sm"
@@ -1,5 +1,73 @@
 import type { NextAuthOptions } from "next-auth";
 import CredentialsProvider from "next-auth/providers/credentials";
+import type { JWT } from "next-auth/jwt";
+import { cookies } from "next/headers";
+import { MFA_REQUIRED_ERROR } from "@/lib/mfa";
+import { PASSWORD_EXPIRED_ERROR } from "@/lib/password";
+
+const backendUrl = process.env.NODE_ENV === 'production'
+	? 'http://backend:8080'
+	: 'http://localhost:8080';
+
+// The backend recognises a browser by a signed device cookie. Sign-in requests reach the backend
+// from this server, so the cookie is passed through in both directions
+const DEVICE_COOKIE = "jiko_device";
+
+function readCookie(header: unknown, name: string): string | undefined {
+	if (typeof header !== "string") {
+		return undefined;
+	}
+	for (const part of header.split(";")) {
+		const [key, ...value] = part.trim().split("=");
+		if (key === name) {
+			return value.join("=");
+		}
+	}
+	return undefined;
+}
+
+async function storeDeviceCookie(res: Response) {
+	const header = res.headers.getSetCookie().find((cookie) => cookie.startsWith(`${DEVICE_COOKIE}=`));
+	if (!header) {
+		return;
+	}
+	const [pair, ...attributes] = header.split(";").map((part) => part.trim());
+	const maxAge = attributes.find((attribute) => attribute.toLowerCase().startsWith("max-age="));
+	(await cookies()).set(DEVICE_COOKIE, pair.slice(DEVICE_COOKIE.length + 1), {
+		httpOnly: true,
+		secure: process.env.NODE_ENV === "production",
+		sameSite: "lax",
+		path: "/",
+		maxAge: maxAge ? Number(maxAge.split("=")[1]) : undefined,
+	});
+}
+
+// Exchanges the refresh token for a new token pair; the backend rotates refresh tokens on every use
+async function refreshAccessToken(token: JWT): Promise<JWT> {
+	try {
+		const res = await fetch(`${backendUrl}/api/v1/auth/refresh`, {
+			method: "POST",
+			headers: { "Content-Type": "application/json" },
+			body: JSON.stringify({ refresh_token: token.refreshToken }),
+		});
+
+		const data = await res.json();
+		if (!res.ok) {
+			throw new Error(data.error || "Failed to refresh token");
+		}
+
+		return {
+			...token,
+			accessToken: data.access_token,
+			refreshToken: data.refresh_token,
+			expiresAt: data.expires_at,
+			error: undefined,
+		};
+	} catch (error) {
+		console.error("Token refresh error:", error);
+		return { ...token, error: "RefreshAccessTokenError" };
+	}
+}
 
 export const authOptions: NextAuthOptions = {
 	providers: [
@@ -7,46 +75,112 @@ export const authOptions: NextAuthOptions = {
 			name: "credentials",
 			credentials: {
 				identifier: { label: "Email or Username", type: "text" },
-				password: { label: "Password", type: "password" }
+				password: { label: "Password", type: "password" },
+				mfaToken: { label: "MFA token", type: "text" },
+				code: { label: "Authentication code", type: "text" },
+				recoveryCode: { label: "Recovery code", type: "text" },
+				webauthnCeremony: { label: "WebAuthn ceremony", type: "text" },
+				webauthnResponse: { label: "WebAuthn response", type: "text" },
+				magicToken: { label: "Email link token", type: "text" },
+				loginId: { label: "Email login", type: "text" },
+				emailCode: { label: "Email code", type: "text" },
+				browserToken: { label: "Browser token", type: "text" }
 			},
-			async authorize(credentials) {
-				if (!credentials?.identifier || !credentials?.password) {
+			async authorize(credentials, req) {
+				if (!credentials) {
 					return null;
 				}
 
+				// Pick the backend step: second factor (code or security key), passkey login, email link or code, or password
+				let path: string;
+				let body: Record<string, unknown>;
 				try {
-					const backendUrl = process.env.NODE_ENV === 'production'
-						? 'http://backend:8080'
-						: 'http://localhost:8080';
+					if (credentials.mfaToken && (credentials.code || credentials.recoveryCode || credentials.webauthnResponse)) {
+						path = "/auth/mfa/verify";
+						if (credentials.webauthnResponse) {
+							body = { mfa_token: credentials.mfaToken, webauthn: JSON.parse(credentials.webauthnResponse) };
+						} else if (credentials.recoveryCode) {
+							body = { mfa_token: credentials.mfaToken, recovery_code: credentials.recoveryCode };
+						} else {
+							body = { mfa_token: credentials.mfaToken, code: credentials.code };
+						}
+					} else if (credentials.webauthnCeremony && credentials.webauthnResponse) {
+						path = "/auth/webauthn/login/finish";
+						body = {
+							ceremony_id: credentials.webauthnCeremony,
+							credential: JSON.parse(credentials.webauthnResponse),
+						};
+					} else if (credentials.browserToken && (credentials.magicToken || (credentials.loginId && credentials.emailCode))) {
+						path = "/auth/passwordless/verify";
+						body = credentials.magicToken
+							? { token: credentials.magicToken, browser_token: credentials.browserToken }
+							: { login_id: credentials.loginId, code: credentials.emailCode, browser_token: credentials.browserToken };
+					} else if (credentials.identifier && credentials.password) {
+						path = "/auth/login";
+						body = { identifier: credentials.identifier, password: credentials.password };
+					} else {
+						return null;
+					}
+				} catch {
+					return null;
+				}
+
+				// Pass the browser's address and agent through so the backend rate-limits
+				// and records sign-ins per client rather than per frontend server
+				const headers: Record<string, string> = { "Content-Type": "application/json" };
+				const forwardedFor = req?.headers?.["x-forwarded-for"];
+				if (typeof forwardedFor === "string") {
+					headers["X-Forwarded-For"] = forwardedFor;
+				}
+				const userAgent = req?.headers?.["user-agent"];
+				if (typeof userAgent === "string") {
+					headers["User-Agent"] = userAgent;
+				}
+				const deviceCookie = readCookie(req?.headers?.cookie, DEVICE_COOKIE);
+				if (deviceCookie) {
+					headers["Cookie"] = `${DEVICE_COOKIE}=${deviceCookie}`;
+				}
 
-					const res = await fetch(`${backendUrl}/api/v1/auth/login`, {
+				let data;
+				try {
+					const res = await fetch(`${backendUrl}/api/v1${path}`, {
 						method: "POST",
-						headers: { "Content-Type": "application/json" },
-						body: JSON.stringify({
-							identifier: credentials.identifier,
-							password: credentials.password,
-						}),
+						headers,
+						body: JSON.stringify(body),
 					});
 
-					const data = await res.json();
-
-					if (res.ok && data.access_token) {
-						return {
-							id: data.user.id,
-							email: data.user.email,
-							name: data.user.username,
-							role: data.user.role,
-							emailVerified: data.user.email_verified,
-							accessToken: data.access_token,
-							expiresAt: data.expires_at,
-						};
+					data = await res.json();
+					await storeDeviceCookie(res);
+					if (!res.ok && !data.password_expired) {
+						return null;
 					}
-
-					return null;
 				} catch (error) {
 					console.error("Auth error:", error);
 					return null;
 				}
+
+				if (data.mfa_required) {
+					throw new Error(`${MFA_REQUIRED_ERROR}${data.methods.join(",")}:${data.mfa_token}`);
+				}
+
+				if (data.password_expired) {
+					throw new Error(`${PASSWORD_EXPIRED_ERROR}${data.reset_token}`);
+				}
+
+				if (!data.access_token) {
+					return null;
+				}
+
+				return {
+					id: data.user.id,
+					email: data.user.email,
+					name: data.user.username,
+					role: data.user.role,
+					emailVerified: data.user.email_verified,
+					accessToken: data.access_token,
+					refreshToken: data.refresh_token,
+					expiresAt: data.expires_at,
+				};
 			},
 		}),
 	],
@@ -54,13 +188,15 @@ export const authOptions: NextAuthOptions = {
 		async jwt({ token, user }) {
 			if (user) {
 				token.accessToken = user.accessToken;
+				token.refreshToken = user.refreshToken;
 				token.role = user.role;
 				token.emailVerified = user.emailVerified;
 				token.expiresAt = user.expiresAt;
 			}
 
-			if (token.expiresAt && Date.now() > (token.expiresAt as number) * 1000) {
-				return token;
+			// Refresh a little before expiry so in-flight requests do not fail
+			if (token.expiresAt && token.refreshToken && Date.now() > ((token.expiresAt as number) - 30) * 1000) {
+				return refreshAccessToken(token);
 			}
 
 			return token;
@@ -71,10 +207,27 @@ export const authOptions: NextAuthOptions = {
 				session.user.id = token.sub!;
 				session.user.role = token.role as string;
 				session.user.emailVerified = token.emailVerified as boolean;
+				session.error = token.error as string | undefined;
 			}
 			return session;
 		},
 	},
+	events: {
+		// Revoke the backend session so issued tokens stop working immediately
+		async signOut({ token }) {
+			if (!token?.accessToken) {
+				return;
+			}
+			try {
+				await fetch(`${backendUrl}/api/v1/auth/logout`, {
+					method: "POST",
+					headers: { Authorization: `Bearer ${token.accessToken}` },
+				});
+			} catch (error) {
+				console.error("Logout error:", error);
+			}
+		},
+	},
 	pages: {
 		signIn: "/sign-in",
 		error: "/error",
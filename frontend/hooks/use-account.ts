@@ -0,0 +1,52 @@
+import { useCallback, useState } from 'react';
+import { useSession } from 'next-auth/react';
+import { useNotification } from '@/components/NotificationProvider';
+
+export interface ChangePasswordData {
+	current_password: string;
+	new_password: string;
+}
+
+export interface ChangeEmailData {
+	new_email: string;
+	password: string;
+}
+
+// Self-service password and email changes for the signed-in user
+export function useAccount() {
+	const { data: session } = useSession();
+	const token = session?.accessToken;
+	const [loading, setLoading] = useState(false);
+	const { showNotification } = useNotification();
+
+	// Returns null on success or the backend error message
+	const post = useCallback(async (path: string, body: object): Promise<string | null> => {
+		setLoading(true);
+		try {
+			const response = await fetch(`/api/v1${path}`, {
+				method: 'POST',
+				headers: {
+					'Authorization': `Bearer ${token}`,
+					'Content-Type': 'application/json'
+				},
+				body: JSON.stringify(body)
+			});
+			const data = await response.json();
+			if (!response.ok) {
+				return data.error || 'Request failed';
+			}
+			showNotification(data.message, 'success');
+			return null;
+		} catch (error) {
+			console.error('Account update error:', error);
+			return 'An error occurred, please try again';
+		} finally {
+			setLoading(false);
+		}
+	}, [token, showNotification]);
+
+	const changePassword = useCallback((data: ChangePasswordData) => post('/auth/password/change', data), [post]);
+	const changeEmail = useCallback((data: ChangeEmailData) => post('/auth/email/change', data), [post]);
+
+	return { loading, changePassword, changeEmail };
+}
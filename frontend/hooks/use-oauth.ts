@@ -1,5 +1,5 @@
 import { useState, useCallback, useMemo, useEffect } from 'react';
-import { useSearchParams } from 'next/navigation';
+import { useRouter, useSearchParams } from 'next/navigation';
 import { useSession } from 'next-auth/react';
 import { isClientApproved, updateClientApproval } from '@/lib/cookies';
 import { OAuthService } from '@/services/oauthService';
@@ -10,12 +10,19 @@ export function useOAuth(): OAuthState & OAuthActions & {
 	isValidParams: boolean;
 } {
 	const searchParams = useSearchParams();
+	const router = useRouter();
 	const { data: session, status } = useSession();
 	const token = session?.accessToken;
 
 	// Utility functions
 	const extractOAuthParams = useCallback((params: URLSearchParams): OAuthParams => {
-		return Object.fromEntries(params.entries());
+		const result: OAuthParams = Object.fromEntries(params.entries());
+		// resource may be repeated (RFC 8707)
+		const resources = params.getAll('resource');
+		if (resources.length > 0) {
+			result.resource = resources;
+		}
+		return result;
 	}, []);
 
 	const validateOAuthParams = useCallback((params: OAuthParams): boolean => {
@@ -94,6 +101,13 @@ export function useOAuth(): OAuthState & OAuthActions & {
 			return;
 		}
 
+		// Any sign-in method (password, passkey, email link) returns here after completing
+		if (!token) {
+			const current = window.location.pathname + window.location.search;
+			router.push(`/sign-in?redirect=${encodeURIComponent(current)}`);
+			return;
+		}
+
 		const initialize = async () => {
 			const autoApproved = await attemptAutoApprove();
 			if (!autoApproved) {
@@ -106,7 +120,7 @@ export function useOAuth(): OAuthState & OAuthActions & {
 			setError(err instanceof Error ? err.message : 'An error occurred');
 			setLoading(false);
 		});
-	}, [isValidParams, status, attemptAutoApprove, fetchClientInfo]);
+	}, [isValidParams, status, token, router, attemptAutoApprove, fetchClientInfo]);
 
 	// Authorization handler
 	const handleAuthorize = useCallback(async (action: 'approve' | 'deny') => {
@@ -0,0 +1,101 @@
+import { useState } from 'react';
+import { useRouter, useSearchParams } from 'next/navigation';
+import { useNotification } from '@/components/NotificationProvider';
+
+export function useForgotPassword() {
+	const [email, setEmail] = useState('');
+	const [error, setError] = useState('');
+	const [sent, setSent] = useState(false);
+	const [isLoading, setIsLoading] = useState(false);
+	const { showNotification } = useNotification();
+
+	const handleSubmit = async (e: React.FormEvent) => {
+		e.preventDefault();
+		if (!/^[^\s@]+@[^\s@]+\.[^\s@]+$/.test(email)) {
+			setError('Enter a valid email');
+			return;
+		}
+
+		setIsLoading(true);
+		setError('');
+		try {
+			const res = await fetch('/api/v1/auth/password/forgot', {
+				method: 'POST',
+				headers: { 'Content-Type': 'application/json' },
+				body: JSON.stringify({ email }),
+			});
+			if (!res.ok) {
+				throw new Error('Failed to request password reset');
+			}
+			// The backend answers the same way for unknown addresses
+			setSent(true);
+		} catch (error) {
+			console.error('Forgot password error:', error);
+			showNotification('Failed to send the reset email, please try again', 'error');
+		} finally {
+			setIsLoading(false);
+		}
+	};
+
+	return { email, setEmail, error, sent, isLoading, handleSubmit };
+}
+
+export function useResetPassword() {
+	const searchParams = useSearchParams();
+	const router = useRouter();
+	const token = searchParams.get('token');
+	// Set when the sign-in redirected here because the password reached its maximum age
+	const expired = searchParams.get('expired') === '1';
+	const [form, setForm] = useState({ password: '', confirmPassword: '' });
+	const [errors, setErrors] = useState<Record<string, string>>({});
+	const [isLoading, setIsLoading] = useState(false);
+	const { showNotification } = useNotification();
+
+	const updateForm = (field: string, value: string) => {
+		setForm(prev => ({ ...prev, [field]: value }));
+	};
+
+	const handleSubmit = async (e: React.FormEvent) => {
+		e.preventDefault();
+		const newErrors: Record<string, string> = {};
+		if (!form.password) {
+			newErrors.password = 'Password is required';
+		}
+		if (form.password !== form.confirmPassword) {
+			newErrors.confirmPassword = 'Passwords do not match';
+		}
+		setErrors(newErrors);
+		if (Object.keys(newErrors).length > 0 || !token) {
+			return;
+		}
+
+		setIsLoading(true);
+		try {
+			const res = await fetch('/api/v1/auth/password/reset', {
+				method: 'POST',
+				headers: { 'Content-Type': 'application/json' },
+				body: JSON.stringify({ token, password: form.password }),
+			});
+			const data = await res.json();
+			if (!res.ok) {
+				// Password policy errors belong to the field, anything else means the link is unusable
+				if (data.error?.startsWith('password')) {
+					setErrors({ password: data.error });
+				} else {
+					showNotification(data.error || 'Failed to reset password', 'error');
+				}
+				return;
+			}
+
+			showNotification('Password changed, please sign in', 'success');
+			router.push('/sign-in');
+		} catch (error) {
+			console.error('Reset password error:', error);
+			showNotification('An error occurred while resetting the password', 'error');
+		} finally {
+			setIsLoading(false);
+		}
+	};
+
+	return { hasToken: token !== null, expired, form, errors, isLoading, updateForm, handleSubmit };
+}
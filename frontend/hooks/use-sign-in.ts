@@ -1,8 +1,12 @@
-import { useState } from 'react';
+import { useEffect, useRef, useState } from 'react';
 import { useSearchParams } from 'next/navigation';
-import { signIn } from 'next-auth/react';
+import { signIn, SignInResponse } from 'next-auth/react';
 import { useRouter } from 'next/navigation';
 import { useNotification } from '@/components/NotificationProvider';
+import { MfaChallenge, parseMfaError } from '@/lib/mfa';
+import { parsePasswordExpiredError } from '@/lib/password';
+import { getAssertion, isWebAuthnSupported, RequestOptionsJSON } from '@/lib/webauthn';
+import { clearPendingEmailLogin, loadPendingEmailLogin, PendingEmailLogin, savePendingEmailLogin } from '@/lib/passwordless';
 
 export function useSignIn() {
 	const [form, setForm] = useState({
@@ -10,11 +14,43 @@ export function useSignIn() {
 		password: ''
 	});
 	const [errors, setErrors] = useState<Record<string, string>>({});
+	// Set when the password step succeeded and the account requires a second factor
+	const [mfa, setMfa] = useState<MfaChallenge | null>(null);
+	const [code, setCode] = useState('');
+	// Second step with a single-use recovery code instead of the authenticator app
+	const [recoveryMode, setRecoveryMode] = useState(false);
 	const [isLoading, setIsLoading] = useState(false);
+	// Detected after mount so server and client render the same markup
+	const [passkeysSupported, setPasskeysSupported] = useState(false);
+	// Email sign-in: enabled by the admin, requested in this form, and the pending request
+	const [passwordlessEnabled, setPasswordlessEnabled] = useState(false);
+	const [emailMode, setEmailMode] = useState(false);
+	const [emailLogin, setEmailLogin] = useState<PendingEmailLogin | null>(null);
+	// The emailed link is single-use, so it must be redeemed once even if the effect runs twice
+	const magicTokenUsed = useRef(false);
 	const { showNotification } = useNotification();
 	const searchParams = useSearchParams();
 	const router = useRouter();
 	const redirectUrl = searchParams.get('redirect');
+	const magicToken = searchParams.get('magic_token');
+	// An emailed link opens without the original redirect, which is restored from the pending request
+	const [continueUrl, setContinueUrl] = useState(redirectUrl);
+
+	useEffect(() => {
+		setPasskeysSupported(isWebAuthnSupported());
+		fetch('/api/v1/auth/passwordless')
+			.then(res => res.ok ? res.json() : { enabled: false })
+			.then(data => setPasswordlessEnabled(Boolean(data.enabled)))
+			.catch(() => setPasswordlessEnabled(false));
+	}, []);
+
+	useEffect(() => {
+		if (magicToken && !magicTokenUsed.current) {
+			magicTokenUsed.current = true;
+			signInWithMagicLink(magicToken);
+		}
+		// eslint-disable-next-line react-hooks/exhaustive-deps
+	}, [magicToken]);
 
 	const validateEmail = (email: string): boolean => {
 		const emailRegex = /^[^\s@]+@[^\s@]+\.[^\s@]+$/;
@@ -44,33 +80,193 @@ export function useSignIn() {
 		return Object.keys(newErrors).length === 0;
 	};
 
+	// Handles the next-auth result shared by every sign-in path
+	const completeSignIn = (result: SignInResponse | undefined, failureMessage: string, redirect: string | null = continueUrl) => {
+		const challenge = result?.error ? parseMfaError(result.error) : null;
+		const resetToken = result?.error ? parsePasswordExpiredError(result.error) : null;
+		if (challenge) {
+			setMfa(challenge);
+			setErrors({});
+		} else if (resetToken) {
+			showNotification('Your password has expired, please choose a new one', 'error');
+			router.push(`/reset-password?token=${encodeURIComponent(resetToken)}&expired=1`);
+		} else if (result?.error) {
+			setCode('');
+			showNotification(failureMessage, 'error');
+		} else if (result?.ok) {
+			clearPendingEmailLogin();
+			showNotification('Login successful!', 'success');
+			setTimeout(() => {
+				if (redirect) {
+					router.push(decodeURIComponent(redirect));
+				} else {
+					router.push('/welcome');
+				}
+			}, 1000);
+		}
+	};
+
 	const handleSubmit = async (e: React.FormEvent) => {
 		e.preventDefault();
-		if (!validateForm()) return;
+		if (mfa && recoveryMode) {
+			if (!/^[a-z0-9]{5}-?[a-z0-9]{5}$/i.test(code.trim())) {
+				setErrors({ code: 'Enter one of your recovery codes' });
+				return;
+			}
+		} else if (mfa) {
+			if (!/^\d{6}$/.test(code)) {
+				setErrors({ code: 'Enter the 6-digit code from your authenticator app' });
+				return;
+			}
+		} else if (emailLogin) {
+			if (!/^\d{6}$/.test(code)) {
+				setErrors({ code: 'Enter the 6-digit code from the email' });
+				return;
+			}
+		} else if (emailMode) {
+			await requestEmailLogin();
+			return;
+		} else if (!validateForm()) {
+			return;
+		}
+
+		setIsLoading(true);
+		try {
+			let result: SignInResponse | undefined;
+			if (mfa && recoveryMode) {
+				result = await signIn('credentials', { mfaToken: mfa.token, recoveryCode: code.trim(), redirect: false });
+			} else if (mfa) {
+				result = await signIn('credentials', { mfaToken: mfa.token, code, redirect: false });
+			} else if (emailLogin) {
+				result = await signIn('credentials', {
+					loginId: emailLogin.loginId,
+					emailCode: code,
+					browserToken: emailLogin.browserToken,
+					redirect: false,
+				});
+			} else {
+				result = await signIn('credentials', { identifier: form.identifier, password: form.password, redirect: false });
+			}
+			completeSignIn(result, recoveryMode ? 'Invalid recovery code' : mfa || emailLogin ? 'Invalid authentication code' : 'Invalid credentials');
+		} catch (error) {
+			console.error('Login error:', error);
+			showNotification('An error occurred while signing in', 'error');
+		} finally {
+			setIsLoading(false);
+		}
+	};
+
+	// Emails a sign-in link and code; the response is the same whether or not the address has an account
+	const requestEmailLogin = async () => {
+		if (!validateEmail(form.identifier)) {
+			setErrors({ identifier: 'Enter a valid email' });
+			return;
+		}
+
+		setIsLoading(true);
+		try {
+			const res = await fetch('/api/v1/auth/passwordless/start', {
+				method: 'POST',
+				headers: { 'Content-Type': 'application/json' },
+				body: JSON.stringify({ email: form.identifier }),
+			});
+			const data = await res.json();
+			if (!res.ok) {
+				showNotification(data.error || 'Failed to send the sign-in email', 'error');
+				return;
+			}
+
+			const pending = { loginId: data.login_id, browserToken: data.browser_token, redirect: redirectUrl };
+			savePendingEmailLogin(pending);
+			setEmailLogin(pending);
+			setErrors({});
+			showNotification(data.message, 'success');
+		} catch (error) {
+			console.error('Email sign-in error:', error);
+			showNotification('Failed to send the sign-in email', 'error');
+		} finally {
+			setIsLoading(false);
+		}
+	};
+
+	// Redeems the emailed link; only works in the browser that requested it
+	const signInWithMagicLink = async (token: string) => {
+		const pending = loadPendingEmailLogin();
+		if (!pending) {
+			showNotification('Open the sign-in link in the browser where you requested it', 'error');
+			return;
+		}
+
+		setContinueUrl(pending.redirect);
+		setIsLoading(true);
+		try {
+			const result = await signIn('credentials', { magicToken: token, browserToken: pending.browserToken, redirect: false });
+			completeSignIn(result, 'The sign-in link is invalid or has expired', pending.redirect);
+		} catch (error) {
+			console.error('Email link sign-in error:', error);
+			showNotification('An error occurred while signing in', 'error');
+		} finally {
+			setIsLoading(false);
+		}
+	};
 
+	// Passwordless sign-in; an entered identifier narrows the prompt to that account's keys
+	const signInWithPasskey = async () => {
 		setIsLoading(true);
 		try {
+			const res = await fetch('/api/v1/auth/webauthn/login/begin', {
+				method: 'POST',
+				headers: { 'Content-Type': 'application/json' },
+				body: JSON.stringify({ identifier: form.identifier }),
+			});
+			const options: { ceremony_id: string; publicKey: RequestOptionsJSON } = await res.json();
+			if (!res.ok) {
+				throw new Error('Failed to start passkey sign-in');
+			}
+
+			const assertion = await getAssertion(options.publicKey);
 			const result = await signIn('credentials', {
-				identifier: form.identifier,
-				password: form.password,
+				webauthnCeremony: options.ceremony_id,
+				webauthnResponse: JSON.stringify(assertion),
 				redirect: false,
 			});
+			completeSignIn(result, 'Passkey was not accepted');
+		} catch (error) {
+			console.error('Passkey sign-in error:', error);
+			showNotification('Passkey sign-in was cancelled or failed', 'error');
+		} finally {
+			setIsLoading(false);
+		}
+	};
 
-			if (result?.error) {
-				showNotification('Invalid credentials', 'error');
-			} else if (result?.ok) {
-				showNotification('Login successful!', 'success');
-				setTimeout(() => {
-					if (redirectUrl) {
-						router.push(decodeURIComponent(redirectUrl));
-					} else {
-						router.push('/welcome');
-					}
-				}, 1000);
+	// Second factor with a registered security key or passkey
+	const verifyWithSecurityKey = async () => {
+		if (!mfa) {
+			return;
+		}
+
+		setIsLoading(true);
+		try {
+			const res = await fetch('/api/v1/auth/mfa/webauthn/begin', {
+				method: 'POST',
+				headers: { 'Content-Type': 'application/json' },
+				body: JSON.stringify({ mfa_token: mfa.token }),
+			});
+			const options: { publicKey: RequestOptionsJSON } = await res.json();
+			if (!res.ok) {
+				throw new Error('Failed to start security key verification');
 			}
+
+			const assertion = await getAssertion(options.publicKey);
+			const result = await signIn('credentials', {
+				mfaToken: mfa.token,
+				webauthnResponse: JSON.stringify(assertion),
+				redirect: false,
+			});
+			completeSignIn(result, 'Security key was not accepted');
 		} catch (error) {
-			console.error('Login error:', error);
-			showNotification('An error occurred while signing in', 'error');
+			console.error('Security key error:', error);
+			showNotification('Security key verification was cancelled or failed', 'error');
 		} finally {
 			setIsLoading(false);
 		}
@@ -80,11 +276,46 @@ export function useSignIn() {
 		setForm(prev => ({ ...prev, [field]: value }));
 	};
 
+	const toggleRecoveryMode = () => {
+		setRecoveryMode(prev => !prev);
+		setCode('');
+		setErrors({});
+	};
+
+	const toggleEmailMode = () => {
+		setEmailMode(prev => !prev);
+		setEmailLogin(null);
+		setCode('');
+		setErrors({});
+	};
+
+	const cancelMfa = () => {
+		setMfa(null);
+		setRecoveryMode(false);
+		setEmailLogin(null);
+		setCode('');
+		setErrors({});
+	};
+
 	return {
 		form,
 		errors,
 		isLoading,
+		mfaRequired: mfa !== null,
+		mfaMethods: mfa?.methods ?? [],
+		passkeysSupported,
+		passwordlessEnabled,
+		emailMode,
+		emailCodeSent: emailLogin !== null,
+		toggleEmailMode,
+		recoveryMode,
+		toggleRecoveryMode,
+		code,
+		setCode,
+		cancelMfa,
 		updateForm,
 		handleSubmit,
+		signInWithPasskey,
+		verifyWithSecurityKey,
 	};
 }
\ No newline at end of file
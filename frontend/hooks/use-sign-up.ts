@@ -1,5 +1,19 @@
-import { useState } from 'react';
+import { useEffect, useState } from 'react';
 import { useNotification } from '@/components/NotificationProvider';
+import { PasswordPolicy } from '@/types/db';
+
+// Used until the backend policy loads; the backend validates the password again anyway
+const DEFAULT_PASSWORD_POLICY: PasswordPolicy = {
+	min_length: 12,
+	require_upper: true,
+	require_lower: true,
+	require_number: true,
+	require_special: true,
+	min_score: 3,
+	disallow_identity: true,
+	history_size: 0,
+	max_age_days: 0,
+};
 
 interface SignUpFormData {
 	username: string;
@@ -23,8 +37,16 @@ export function useSignUp() {
 	});
 	const [errors, setErrors] = useState<SignUpErrors>({});
 	const [isLoading, setIsLoading] = useState(false);
+	const [policy, setPolicy] = useState<PasswordPolicy>(DEFAULT_PASSWORD_POLICY);
 	const { showNotification } = useNotification();
 
+	useEffect(() => {
+		fetch('/api/v1/auth/password-policy')
+			.then(res => res.ok ? res.json() : DEFAULT_PASSWORD_POLICY)
+			.then(setPolicy)
+			.catch(() => setPolicy(DEFAULT_PASSWORD_POLICY));
+	}, []);
+
 	const validateEmail = (email: string): boolean => {
 		const emailRegex = /^[^\s@]+@[^\s@]+\.[^\s@]+$/;
 		return emailRegex.test(email);
@@ -33,7 +55,7 @@ export function useSignUp() {
 	const hasUpperCase = (str: string): boolean => /[A-Z]/.test(str);
 	const hasLowerCase = (str: string): boolean => /[a-z]/.test(str);
 	const hasNumber = (str: string): boolean => /\d/.test(str);
-	const hasSpecialChar = (str: string): boolean => /[!@#$%^&*()_+\-=\[\]{};':"\\|,.<>\/?]/.test(str);
+	const hasSpecialChar = (str: string): boolean => /[^\p{L}\p{N}]/u.test(str);
 
 	const validateForm = (): boolean => {
 		const newErrors: SignUpErrors = {};
@@ -52,11 +74,13 @@ export function useSignUp() {
 
 		if (!form.password) {
 			newErrors.password = 'Password is required';
-		} else if (form.password.length < 8) {
-			newErrors.password = 'Password must be at least 8 characters';
-		} else if (!hasUpperCase(form.password) || !hasLowerCase(form.password) ||
-			!hasNumber(form.password) || !hasSpecialChar(form.password)) {
-			newErrors.password = 'Password must contain uppercase and lowercase letters, numbers, and special characters';
+		} else if (form.password.length < policy.min_length) {
+			newErrors.password = `Password must be at least ${policy.min_length} characters`;
+		} else if ((policy.require_upper && !hasUpperCase(form.password)) ||
+			(policy.require_lower && !hasLowerCase(form.password)) ||
+			(policy.require_number && !hasNumber(form.password)) ||
+			(policy.require_special && !hasSpecialChar(form.password))) {
+			newErrors.password = describePolicy(policy);
 		}
 
 		if (!form.confirmPassword) {
@@ -123,7 +147,22 @@ export function useSignUp() {
 		form,
 		errors,
 		isLoading,
+		policy,
 		handleSubmit,
 		updateForm
 	};
-}
\ No newline at end of file
+}
+
+// Human-readable character class requirements of the policy
+export function describePolicy(policy: PasswordPolicy): string {
+	const classes = [
+		policy.require_upper && 'uppercase letters',
+		policy.require_lower && 'lowercase letters',
+		policy.require_number && 'numbers',
+		policy.require_special && 'special characters',
+	].filter(Boolean);
+	if (classes.length === 0) {
+		return `Must be at least ${policy.min_length} characters`;
+	}
+	return `Must be at least ${policy.min_length} characters and contain ${classes.join(', ')}`;
+}
@@ -0,0 +1,47 @@
+import { useEffect, useRef, useState } from 'react';
+import { useSearchParams } from 'next/navigation';
+
+// Redeems a single-use link from an email (email change confirm/cancel, account unlock)
+// by posting its token to the given API path
+export function useTokenLink(path: string) {
+	const searchParams = useSearchParams();
+	const [status, setStatus] = useState<'loading' | 'success' | 'error'>('loading');
+	const [message, setMessage] = useState('');
+	// Links are single-use, so the request must not repeat when the effect runs twice
+	const submitted = useRef(false);
+
+	useEffect(() => {
+		if (submitted.current) {
+			return;
+		}
+		submitted.current = true;
+
+		const token = searchParams.get('token');
+		if (!token) {
+			setStatus('error');
+			setMessage('The link is incomplete');
+			return;
+		}
+
+		fetch(`/api/v1${path}`, {
+			method: 'POST',
+			headers: { 'Content-Type': 'application/json' },
+			body: JSON.stringify({ token }),
+		})
+			.then(async response => {
+				const data = await response.json();
+				setStatus(response.ok ? 'success' : 'error');
+				setMessage(response.ok ? data.message : data.error || 'The link is invalid or has expired');
+			})
+			.catch(error => {
+				console.error('Email link error:', error);
+				setStatus('error');
+				setMessage('An error occurred, please try again');
+			});
+	}, [path, searchParams]);
+
+	return {
+		status,
+		message,
+	};
+}
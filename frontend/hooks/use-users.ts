@@ -101,6 +101,23 @@ export function useUsers() {
 		}
 	}, [token]);
 
+	// Lifts a lockout caused by failed sign-in attempts
+	const unlockUser = useCallback(async (userId: string) => {
+		try {
+			const response = await fetch(`/api/v1/admin/users/${userId}/unlock`, {
+				method: 'POST',
+				headers: {
+					'Authorization': `Bearer ${token}`
+				}
+			});
+
+			return response.ok;
+		} catch (error) {
+			console.error('Error unlocking user:', error);
+			return false;
+		}
+	}, [token]);
+
 	useEffect(() => {
 		loadUsers();
 	}, [loadUsers]);
@@ -114,6 +131,7 @@ export function useUsers() {
 		loadUsers,
 		createUser,
 		updateUser,
-		deleteUser
+		deleteUser,
+		unlockUser
 	};
 }
@@ -0,0 +1,21 @@
+// Prefix of the sign-in error that asks the client for a second factor; the rest is
+// "<methods>:<MFA token>" with methods comma-separated.
+// Kept outside auth.ts so client components can import it without pulling in server-only code
+export const MFA_REQUIRED_ERROR = "MFA_REQUIRED:";
+
+export interface MfaChallenge {
+	token: string;
+	methods: string[];
+}
+
+export function parseMfaError(error: string): MfaChallenge | null {
+	if (!error.startsWith(MFA_REQUIRED_ERROR)) {
+		return null;
+	}
+	const rest = error.slice(MFA_REQUIRED_ERROR.length);
+	const separator = rest.indexOf(':');
+	return {
+		methods: rest.slice(0, separator).split(',').filter(Boolean),
+		token: rest.slice(separator + 1),
+	};
+}
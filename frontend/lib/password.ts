@@ -0,0 +1,10 @@
+// Prefix of the sign-in error for an expired password; the rest is a single-use reset token
+// that lets the user choose a new password without the email round trip
+export const PASSWORD_EXPIRED_ERROR = "PASSWORD_EXPIRED:";
+
+export function parsePasswordExpiredError(error: string): string | null {
+	if (!error.startsWith(PASSWORD_EXPIRED_ERROR)) {
+		return null;
+	}
+	return error.slice(PASSWORD_EXPIRED_ERROR.length);
+}
@@ -0,0 +1,28 @@
+// Email sign-in requested from this browser. The backend only redeems the emailed link or code
+// together with the browser token returned when the email was requested, so a forwarded link
+// cannot be used elsewhere.
+const STORAGE_KEY = "passwordless_login";
+
+export interface PendingEmailLogin {
+	loginId: string;
+	browserToken: string;
+	// Where to continue after sign-in, e.g. back into an OAuth authorize request
+	redirect: string | null;
+}
+
+export function savePendingEmailLogin(login: PendingEmailLogin) {
+	localStorage.setItem(STORAGE_KEY, JSON.stringify(login));
+}
+
+export function loadPendingEmailLogin(): PendingEmailLogin | null {
+	try {
+		const value = localStorage.getItem(STORAGE_KEY);
+		return value ? JSON.parse(value) : null;
+	} catch {
+		return null;
+	}
+}
+
+export function clearPendingEmailLogin() {
+	localStorage.removeItem(STORAGE_KEY);
+}
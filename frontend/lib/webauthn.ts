@@ -0,0 +1,72 @@
+// Browser helpers for WebAuthn ceremonies. The backend speaks the JSON form of the
+// options and responses (binary fields as base64url), so convert at the boundary.
+
+function base64urlToBuffer(value: string): ArrayBuffer {
+	const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+	const padded = base64 + '='.repeat((4 - (base64.length % 4)) % 4);
+	const binary = atob(padded);
+	const bytes = new Uint8Array(binary.length);
+	for (let i = 0; i < binary.length; i++) {
+		bytes[i] = binary.charCodeAt(i);
+	}
+	return bytes.buffer;
+}
+
+function bufferToBase64url(buffer: ArrayBuffer): string {
+	const bytes = new Uint8Array(buffer);
+	let binary = '';
+	for (let i = 0; i < bytes.length; i++) {
+		binary += String.fromCharCode(bytes[i]);
+	}
+	return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+interface CredentialDescriptorJSON {
+	type: 'public-key';
+	id: string;
+	transports?: AuthenticatorTransport[];
+}
+
+export interface RequestOptionsJSON {
+	challenge: string;
+	timeout: number;
+	rpId: string;
+	allowCredentials: CredentialDescriptorJSON[];
+	userVerification: UserVerificationRequirement;
+}
+
+const toDescriptor = (descriptor: CredentialDescriptorJSON): PublicKeyCredentialDescriptor => ({
+	...descriptor,
+	id: base64urlToBuffer(descriptor.id),
+});
+
+export function isWebAuthnSupported(): boolean {
+	return typeof window !== 'undefined' && !!window.PublicKeyCredential;
+}
+
+// Runs navigator.credentials.get() and returns the assertion serialized for the backend
+export async function getAssertion(options: RequestOptionsJSON) {
+	const credential = await navigator.credentials.get({
+		publicKey: {
+			...options,
+			challenge: base64urlToBuffer(options.challenge),
+			allowCredentials: options.allowCredentials.map(toDescriptor),
+		},
+	}) as PublicKeyCredential | null;
+	if (!credential) {
+		throw new Error('No credential returned');
+	}
+
+	const response = credential.response as AuthenticatorAssertionResponse;
+	return {
+		id: credential.id,
+		rawId: bufferToBase64url(credential.rawId),
+		type: credential.type,
+		response: {
+			clientDataJSON: bufferToBase64url(response.clientDataJSON),
+			authenticatorData: bufferToBase64url(response.authenticatorData),
+			signature: bufferToBase64url(response.signature),
+			userHandle: response.userHandle ? bufferToBase64url(response.userHandle) : '',
+		},
+	};
+}
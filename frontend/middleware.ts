@@ -10,7 +10,7 @@ export async function middleware(request: NextRequest) {
 	const { pathname } = request.nextUrl;
 
 	// Публичные роуты (доступны всем)
-	const publicRoutes = ['/', '/sign-in', '/sign-up', '/oauth/authorize', '/error'];
+	const publicRoutes = ['/', '/sign-in', '/sign-up', '/forgot-password', '/reset-password', '/confirm-email-change', '/cancel-email-change', '/unlock-account', '/oauth/authorize', '/saml/sso', '/error'];
 	const isPublicRoute = publicRoutes.includes(pathname)
 
 	// Защита admin роутов: только админы
@@ -0,0 +1,67 @@
+export interface SAMLCompleteResponse {
+	acs_url: string;
+	saml_response: string;
+	relay_state?: string;
+}
+
+// The service provider asked for a fresh sign-in (ForceAuthn) and the current session is too old
+export class ReauthenticationRequiredError extends Error {
+	constructor() {
+		super('Please sign in again to continue');
+	}
+}
+
+export class SAMLService {
+	private static readonly BASE_URL = '/api/v1/saml';
+
+	static async completeSSO(params: URLSearchParams, token: string): Promise<SAMLCompleteResponse> {
+		const response = await fetch(`${this.BASE_URL}/sso/complete`, {
+			method: 'POST',
+			headers: {
+				'Content-Type': 'application/json',
+				Authorization: `Bearer ${token}`,
+			},
+			body: JSON.stringify({
+				saml_request: params.get('SAMLRequest') ?? '',
+				binding: params.get('binding') ?? '',
+				sp: params.get('sp') ?? '',
+				relay_state: params.get('RelayState') ?? '',
+			}),
+		});
+
+		if (response.status === 401) {
+			const data = await response.json().catch(() => ({}));
+			if (data.reauthenticate) {
+				throw new ReauthenticationRequiredError();
+			}
+		}
+		if (!response.ok) {
+			throw new Error('Error processing SAML sign-in request');
+		}
+
+		return response.json();
+	}
+
+	// HTTP-POST binding: the response is delivered to the ACS by an auto-submitted form
+	static postToACS(data: SAMLCompleteResponse) {
+		const form = document.createElement('form');
+		form.method = 'POST';
+		form.action = data.acs_url;
+
+		const fields: Record<string, string | undefined> = {
+			SAMLResponse: data.saml_response,
+			RelayState: data.relay_state,
+		};
+		for (const [name, value] of Object.entries(fields)) {
+			if (!value) continue;
+			const input = document.createElement('input');
+			input.type = 'hidden';
+			input.name = name;
+			input.value = value;
+			form.appendChild(input);
+		}
+
+		document.body.appendChild(form);
+		form.submit();
+	}
+}
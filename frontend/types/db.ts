@@ -5,6 +5,7 @@ export interface User {
     role: string;
     email_verified: boolean;
     last_login?: string | null;
+    locked_until?: string | null;
     created_at: string;
     updated_at: string;
 }
@@ -20,4 +21,15 @@ export interface Client {
     scope: string;
     created_at: string;
     updated_at: string;
-}
\ No newline at end of file
+}
+export interface PasswordPolicy {
+    min_length: number;
+    require_upper: boolean;
+    require_lower: boolean;
+    require_number: boolean;
+    require_special: boolean;
+    min_score: number;
+    disallow_identity: boolean;
+    history_size: number;
+    max_age_days: number;
+}
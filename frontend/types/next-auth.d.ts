@@ -4,6 +4,7 @@ import NextAuth from "next-auth";
 declare module "next-auth" {
 	interface Session {
 		accessToken?: string;
+		error?: string;
 		user: {
 			id: string;
 			name?: string | null;
@@ -21,12 +22,18 @@ declare module "next-auth" {
 		role: string;
 		emailVerified: boolean;
 		accessToken: string;
+		refreshToken: string;
 		expiresAt: number;
 	}
+}
 
+declare module "next-auth/jwt" {
 	interface JWT {
 		accessToken?: string;
+		refreshToken?: string;
 		role?: string;
+		emailVerified?: boolean;
 		expiresAt?: number;
+		error?: string;
 	}
 }
\ No newline at end of file
@@ -8,7 +8,9 @@ export interface OAuthParams {
 	client_id?: string;
 	redirect_uri?: string;
 	response_type?: string;
-	[key: string]: string | undefined;
+	scope?: string;
+	resource?: string[];
+	[key: string]: string | string[] | undefined;
 }
 
 export interface OAuthState {